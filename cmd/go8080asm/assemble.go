@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+	"github.com/lukepeterson/go8080assembler/pkg/cpm"
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+	"github.com/lukepeterson/go8080assembler/pkg/memory"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+	"github.com/lukepeterson/go8080assembler/pkg/symbols"
+)
+
+func runAssemble(args []string) error {
+	flags := flag.NewFlagSet("assemble", flag.ExitOnError)
+	output := flags.String("o", "", "write the output to `file` (default: the input name with .bin, .com, .obj, .rel or .prl)")
+	objectFile := flags.Bool("c", false, "write a relocatable object module instead of a binary")
+	relFile := flags.Bool("rel", false, "write a Microsoft REL module, for linking with L80")
+	target := flags.String("target", "", "assemble for `system`: cpm writes a .COM file starting at 0100H, with the BDOS and FCB symbols predefined")
+	prlFile := flags.Bool("prl", false, "write a CP/M page relocatable .PRL file, for MP/M and RSXs")
+	memoryMap := flags.String("map", "", "place and check the program against the memory map in `file`")
+	symbolFile := flags.String("symfile", "", "write the address of every label to `file`, as JSON if it ends in .json or else a CP/M .SYM file")
+	cpu := flags.String("cpu", "8080", "assemble for `cpu`: 8080, 8085, or 8085U for the 8085 with its undocumented instructions")
+	syntax := flags.String("syntax", "intel", "read `mnemonics` written for intel (8080) or zilog (the 8080 subset of the Z80)")
+	dialect := flags.String("dialect", "", "read source written for another `assembler`: asm80, asm (CP/M), mac, rmac, m80 or tasm")
+	imports := stringList{}
+	flags.Var(&imports, "import", "define the symbols in `file`, a .SYM, map or JSON symbol file (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go8080asm assemble [-c | -rel | -prl] [-target cpm] [-cpu cpu] [-syntax zilog] [-dialect assembler] [-map file] [-import file]... [-symfile file] [-o file] file.asm")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	filename := flags.Arg(0)
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if *target != "" && *target != "cpm" {
+		return fmt.Errorf("unknown target: %s", *target)
+	}
+
+	processor, err := isa.ParseCPU(*cpu)
+	if err != nil {
+		return err
+	}
+
+	options := []assembler.Option{assembler.WithDirectory(filepath.Dir(filename)), assembler.WithCPU(processor)}
+	switch *syntax {
+	case "intel":
+	case "zilog":
+		options = append(options, assembler.Z80Mnemonics())
+	default:
+		return fmt.Errorf("unknown syntax: %s", *syntax)
+	}
+	if *dialect != "" {
+		d, found := lexer.Dialects[*dialect]
+		if !found {
+			return fmt.Errorf("unknown dialect: %s", *dialect)
+		}
+		options = append(options, assembler.WithDialect(d))
+	}
+	imported, err := readImports(imports)
+	if err != nil {
+		return err
+	}
+	options = append(options, assembler.WithImports(imported...))
+
+	if *prlFile {
+		prl, err := cpm.PRL(string(source), options...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		return os.WriteFile(outputName(*output, filename, ".prl"), prl, 0o644)
+	}
+
+	if *target == "cpm" {
+		options = append(options, assembler.CPM())
+	}
+	if *memoryMap != "" {
+		m, err := readMemoryMap(*memoryMap)
+		if err != nil {
+			return err
+		}
+		options = append(options, assembler.WithMemoryMap(m))
+	}
+	asm := assembler.New(string(source), options...)
+
+	if *objectFile || *relFile {
+		module, err := asm.AssembleObject()
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		module.Name = moduleName(filename)
+		if *relFile {
+			return writeFile(outputName(*output, filename, ".rel"), func(f *os.File) error { return object.WriteREL(f, module) })
+		}
+		return writeFile(outputName(*output, filename, ".obj"), func(f *os.File) error { return module.Write(f) })
+	}
+
+	bytecode, err := asm.Assemble()
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	for _, warning := range asm.Warnings() {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", filename, warning)
+	}
+	if usage := asm.MemoryUsage(); usage != nil {
+		if err := memory.WriteUsage(os.Stdout, usage); err != nil {
+			return err
+		}
+	}
+	if *symbolFile != "" {
+		if err := writeSymbols(*symbolFile, asm.Labels()); err != nil {
+			return err
+		}
+	}
+	if *target == "cpm" {
+		com := &bytes.Buffer{}
+		if err := cpm.WriteCOM(com, asm.Origin(), bytecode); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		return os.WriteFile(outputName(*output, filename, ".com"), com.Bytes(), 0o644)
+	}
+	return os.WriteFile(outputName(*output, filename, ".bin"), bytecode, 0o644)
+}
+
+// readImports reads the symbols in each of the files.
+func readImports(filenames []string) ([]symbols.Symbol, error) {
+	imported := []symbols.Symbol{}
+	for _, filename := range filenames {
+		read, err := symbols.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		imported = append(imported, read...)
+	}
+	return imported, nil
+}
+
+// writeSymbols writes a symbol file, as JSON if its name ends in .json or
+// else in CP/M .SYM format.
+func writeSymbols(filename string, table map[string]uint16) error {
+	return writeFile(filename, func(f *os.File) error {
+		if strings.EqualFold(filepath.Ext(filename), ".json") {
+			return symbols.WriteJSON(f, table)
+		}
+		return symbols.WriteSYM(f, table)
+	})
+}
+
+// readMemoryMap reads a memory map config file.
+func readMemoryMap(filename string) (*memory.Map, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := memory.ReadMap(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return m, nil
+}
+
+// moduleName returns the module name for a source or object file: its base
+// name in upper case, without the extension.
+func moduleName(filename string) string {
+	return strings.ToUpper(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+}
+
+// outputName returns output if it was given, or else filename with its
+// extension replaced.
+func outputName(output string, filename string, extension string) string {
+	if output != "" {
+		return output
+	}
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + extension
+}
+
+// parseAddress parses a 16-bit address in the same notation as the
+// assembler: hexadecimal, with an optional 0x prefix or H suffix.
+func parseAddress(s string) (uint16, error) {
+	address, err := isa.ParseNumber(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address: %s", s)
+	}
+	return address, nil
+}
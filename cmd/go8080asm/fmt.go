@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/format"
+)
+
+func runFmt(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	list := flags.Bool("l", false, "list the files whose formatting differs")
+	diff := flags.Bool("d", false, "print diffs instead of the formatted source")
+	write := flags.Bool("w", false, "write the formatted source back to each file")
+	letterCase := flags.String("case", "upper", "write mnemonics, registers and numbers in upper or lower `case`")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go8080asm fmt [-l] [-d] [-w] [-case lower] [file.asm...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	options := format.Options{}
+	switch *letterCase {
+	case "upper":
+	case "lower":
+		options.Lower = true
+	default:
+		return fmt.Errorf("unknown case: %s", *letterCase)
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			return fmt.Errorf("can't use -w with standard input")
+		}
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		return formatFile("<stdin>", string(source), options, *list, *diff, false)
+	}
+
+	failed := false
+	for _, filename := range flags.Args() {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		if err := formatFile(filename, string(source), options, *list, *diff, *write); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// formatFile formats one file, printing, listing, diffing or writing the
+// result like gofmt.
+func formatFile(filename string, source string, options format.Options, list, diff, write bool) error {
+	formatted, err := format.Source(source, options)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if !list && !diff && !write {
+		_, err := os.Stdout.WriteString(formatted)
+		return err
+	}
+	if formatted == source {
+		return nil
+	}
+	if list {
+		fmt.Println(filename)
+	}
+	if diff {
+		fmt.Print(unifiedDiff(filename, source, formatted))
+	}
+	if write {
+		return os.WriteFile(filename, []byte(formatted), 0o644)
+	}
+	return nil
+}
+
+// unifiedDiff returns a unified diff of two versions of a file which have
+// the same number of lines, as formatted source always does, so that line n
+// of one is line n of the other.
+func unifiedDiff(filename string, before string, after string) string {
+	const context = 3
+	a, b := strings.Split(before, "\n"), strings.Split(after, "\n")
+	changed := []int{}
+	for i := range a {
+		if a[i] != b[i] {
+			changed = append(changed, i)
+		}
+	}
+
+	out := strings.Builder{}
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", filename, filename)
+	for k := 0; k < len(changed); {
+		// Changes close enough for their context to overlap share a hunk
+		first, last := changed[k], changed[k]
+		for k++; k < len(changed) && changed[k]-last <= 2*context; k++ {
+			last = changed[k]
+		}
+		start, end := max(0, first-context), min(len(a), last+context+1)
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", start+1, end-start, start+1, end-start)
+		for j := start; j < end; {
+			if a[j] == b[j] {
+				fmt.Fprintf(&out, " %s\n", a[j])
+				j++
+				continue
+			}
+			run := j
+			for ; run < end && a[run] != b[run]; run++ {
+				fmt.Fprintf(&out, "-%s\n", a[run])
+			}
+			for ; j < run; j++ {
+				fmt.Fprintf(&out, "+%s\n", b[j])
+			}
+		}
+	}
+	return out.String()
+}
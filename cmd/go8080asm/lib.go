@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+)
+
+func libUsage() {
+	fmt.Fprintln(os.Stderr, "usage: go8080asm lib create library.lib file.obj|file.rel...")
+	fmt.Fprintln(os.Stderr, "       go8080asm lib list library.lib")
+	fmt.Fprintln(os.Stderr, "       go8080asm lib extract library.lib [module...]")
+	os.Exit(2)
+}
+
+func runLib(args []string) error {
+	if len(args) < 2 {
+		libUsage()
+	}
+	library := args[1]
+
+	switch args[0] {
+	case "create":
+		if len(args) < 3 {
+			libUsage()
+		}
+		modules := []*object.Module{}
+		for _, filename := range args[2:] {
+			read, err := readModules(filename)
+			if err != nil {
+				return err
+			}
+			modules = append(modules, read...)
+		}
+		return writeFile(library, func(f *os.File) error { return object.WriteLibrary(f, modules...) })
+
+	case "list":
+		modules, err := readModules(library)
+		if err != nil {
+			return err
+		}
+		for _, module := range modules {
+			fmt.Printf("%s\tcode %d bytes, data %d bytes\n", module.Name, len(module.Code), len(module.Data))
+			for _, symbol := range module.Symbols {
+				fmt.Printf("\t%s\n", symbol.Name)
+			}
+		}
+		return nil
+
+	case "extract":
+		modules, err := readModules(library)
+		if err != nil {
+			return err
+		}
+		// With no names, every module is extracted
+		wanted := map[string]bool{}
+		for _, name := range args[2:] {
+			wanted[strings.ToUpper(name)] = true
+		}
+		found := map[string]bool{}
+		for _, module := range modules {
+			if len(args) > 2 && !wanted[module.Name] {
+				continue
+			}
+			found[module.Name] = true
+			if module.Name == "" || strings.ContainsAny(module.Name, `/\`) || strings.Contains(module.Name, "..") {
+				return fmt.Errorf("module name %q in %s isn't a valid filename", module.Name, library)
+			}
+			filename := strings.ToLower(module.Name) + ".obj"
+			if err := writeFile(filename, func(f *os.File) error { return module.Write(f) }); err != nil {
+				return err
+			}
+		}
+		for _, name := range args[2:] {
+			if !found[strings.ToUpper(name)] {
+				return fmt.Errorf("module %s not found in %s", strings.ToUpper(name), library)
+			}
+		}
+		return nil
+	}
+
+	libUsage()
+	return nil
+}
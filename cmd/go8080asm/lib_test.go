@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+)
+
+func TestLibExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules []string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "one module",
+			modules: []string{"AA", "BB", "CC"},
+			args:    []string{"aa"},
+			want:    []string{"aa.obj"},
+		},
+		{
+			name:    "every module",
+			modules: []string{"AA", "BB", "CC"},
+			want:    []string{"aa.obj", "bb.obj", "cc.obj"},
+		},
+		{
+			name:    "module not found",
+			modules: []string{"AA", "BB"},
+			args:    []string{"BB", "DD"},
+			want:    []string{"bb.obj"},
+			wantErr: "module DD not found in my.lib",
+		},
+		{
+			name:    "path in module name",
+			modules: []string{"../AA"},
+			want:    []string{},
+			wantErr: `module name "../AA" in my.lib isn't a valid filename`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			modules := []*object.Module{}
+			for _, name := range test.modules {
+				modules = append(modules, &object.Module{Name: name, Code: []byte{0x00}})
+			}
+			if err := writeFile("my.lib", func(f *os.File) error { return object.WriteLibrary(f, modules...) }); err != nil {
+				t.Fatal(err)
+			}
+
+			err := runLib(append([]string{"extract", "my.lib"}, test.args...))
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("runLib() error = %v, want %q", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("runLib() error = %v", err)
+			}
+			got, err := filepath.Glob("*.obj")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil {
+				got = []string{}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("extracted %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// chdir changes to dir for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
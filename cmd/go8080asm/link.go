@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/linker"
+	"github.com/lukepeterson/go8080assembler/pkg/memory"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+)
+
+func runLink(args []string) error {
+	flags := flag.NewFlagSet("link", flag.ExitOnError)
+	output := flags.String("o", "a.bin", "write the linked binary to `file`")
+	code := flags.String("code", "", "place the code segments at `address` (default: 0000, or the first executable region of the memory map)")
+	data := flags.String("data", "", "place the data segments at `address` (default: the first RAM region after the code, or after the code)")
+	memoryMap := flags.String("map", "", "place and check the segments against the memory map in `file`, and print how much of each region is used")
+	symbols := flags.Bool("symbols", false, "print the address of each module and public symbol")
+	symbolFile := flags.String("symfile", "", "write the address of every public symbol to `file`, as JSON if it ends in .json or else a CP/M .SYM file")
+	libraries := stringList{}
+	flags.Var(&libraries, "lib", "search library `file` for modules that resolve external symbols (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go8080asm link [-o file] [-code address] [-data address] [-map file] [-symbols] [-symfile file] [-lib library]... file.obj|file.rel...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var m *memory.Map
+	if *memoryMap != "" {
+		var err error
+		if m, err = readMemoryMap(*memoryMap); err != nil {
+			return err
+		}
+	}
+
+	layout := linker.Layout{DataAfterCode: true}
+	var err error
+	if *code != "" {
+		if layout.Code, err = parseAddress(*code); err != nil {
+			return err
+		}
+	} else if m != nil {
+		if region, found := m.Code(); found {
+			layout.Code = region.Start
+		}
+	}
+	if *data != "" {
+		if layout.Data, err = parseAddress(*data); err != nil {
+			return err
+		}
+		layout.DataAfterCode = false
+	} else if m != nil {
+		if region, found := m.Data(int(layout.Code)); found && !region.Contains(int(layout.Code)) {
+			layout.Data = region.Start
+			layout.DataAfterCode = false
+		}
+	}
+
+	modules := []*object.Module{}
+	for _, filename := range flags.Args() {
+		read, err := readModules(filename)
+		if err != nil {
+			return err
+		}
+		modules = append(modules, read...)
+	}
+
+	searched := [][]*object.Module{}
+	for _, filename := range libraries {
+		library, err := readModules(filename)
+		if err != nil {
+			return err
+		}
+		searched = append(searched, library)
+	}
+
+	image, err := linker.Link(linker.Search(modules, searched...), layout)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		blocks := image.Blocks()
+		warnings, err := m.Check(blocks)
+		if err != nil {
+			return err
+		}
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+		}
+		m.Fill(image.Bytecode, image.Origin, blocks)
+		if err := memory.WriteUsage(os.Stdout, m.Usage(blocks)); err != nil {
+			return err
+		}
+	}
+
+	if *symbols {
+		for _, placement := range image.Placements {
+			fmt.Printf("%-8s code %04X  data %04X\n", placement.Module, placement.Code, placement.Data)
+		}
+		names := []string{}
+		for name := range image.Symbols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%04X  %s\n", image.Symbols[name], name)
+		}
+	}
+	if *symbolFile != "" {
+		if err := writeSymbols(*symbolFile, image.Symbols); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(*output, image.Bytecode, 0o644)
+}
+
+// readModules reads the modules in an object or REL file.
+func readModules(filename string) ([]*object.Module, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	modules, err := object.ReadModules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return modules, nil
+}
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
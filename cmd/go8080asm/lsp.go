@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+	"github.com/lukepeterson/go8080assembler/pkg/lsp"
+)
+
+func runLSP(args []string) error {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	dialect := flags.String("dialect", "", "read source written for another `assembler`: asm80, asm (CP/M), mac, rmac, m80 or tasm")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go8080asm lsp [-dialect assembler]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	server := lsp.NewServer(os.Stdin, os.Stdout)
+	if *dialect != "" {
+		d, found := lexer.Dialects[*dialect]
+		if !found {
+			return fmt.Errorf("unknown dialect: %s", *dialect)
+		}
+		server.SetDialect(d)
+	}
+	return server.Run()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// errFailed is returned by commands that have already reported why they
+// failed, and only need to set the exit code.
+var errFailed = errors.New("failed")
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"assemble", "assemble a source file into a binary or object module", runAssemble},
+	{"fmt", "format source files in the standard style", runFmt},
+	{"lib", "create, list and extract library archives", runLib},
+	{"link", "link object modules into a binary", runLink},
+	{"lsp", "run a language server for editors", runLSP},
+	{"patch", "assemble patches into an existing binary or HEX file", runPatch},
+	{"rom", "pad, checksum and split a binary for programming into EPROMs", runROM},
+	{"test", "run the TEST blocks in assembly source files", runTest},
+	{"z80", "translate a source file to Z80 mnemonics", runZ80},
+}
+
+// writeFile creates filename and calls write to fill it.
+func writeFile(filename string, write func(f *os.File) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: go8080asm <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.description)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		err := c.run(os.Args[2:])
+		if errors.Is(err, errFailed) {
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
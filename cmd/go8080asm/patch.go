@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+	"github.com/lukepeterson/go8080assembler/pkg/ihex"
+	"github.com/lukepeterson/go8080assembler/pkg/patch"
+	"github.com/lukepeterson/go8080assembler/pkg/rom"
+)
+
+func runPatch(args []string) error {
+	flags := flag.NewFlagSet("patch", flag.ExitOnError)
+	output := flags.String("o", "", "write the patched image to `file` (default: the base name with .patched before the extension)")
+	origin := flags.String("origin", "0000", "a binary base image starts at `address`; HEX files have their own addresses")
+	patchable := stringList{}
+	flags.Var(&patchable, "patchable", "only allow changes to bytes from `start-end` inclusive (repeatable)")
+	imports := stringList{}
+	flags.Var(&imports, "import", "define the symbols in `file`, such as the base image's .SYM file (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go8080asm patch [-origin address] [-patchable start-end]... [-import file]... [-o file] base.bin|base.hex patch.asm")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	baseName, sourceName := flags.Arg(0), flags.Arg(1)
+
+	ranges := []patch.Range{}
+	for _, r := range patchable {
+		from, to, found := strings.Cut(r, "-")
+		if !found {
+			return fmt.Errorf("invalid range %s, expected start-end", r)
+		}
+		start, err := parseAddress(from)
+		if err != nil {
+			return err
+		}
+		end, err := parseAddress(to)
+		if err != nil {
+			return err
+		}
+		ranges = append(ranges, patch.Range{Start: start, End: end})
+	}
+
+	isHex := strings.EqualFold(filepath.Ext(baseName), ".hex")
+	base := &rom.Image{}
+	var spans []ihex.Span // The addresses a HEX file loads
+	f, err := os.Open(baseName)
+	if err != nil {
+		return err
+	}
+	if isHex {
+		base.Origin, base.Bytecode, spans, err = ihex.ReadSpans(f)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", baseName, err)
+		}
+	} else {
+		if base.Origin, err = parseAddress(*origin); err == nil {
+			base.Bytecode, err = os.ReadFile(baseName)
+		}
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	source, err := os.ReadFile(sourceName)
+	if err != nil {
+		return err
+	}
+	imported, err := readImports(imports)
+	if err != nil {
+		return err
+	}
+	changes, err := patch.Apply(base, string(source), ranges, assembler.WithDirectory(filepath.Dir(sourceName)), assembler.WithImports(imported...))
+	if err != nil {
+		return fmt.Errorf("%s: %w", sourceName, err)
+	}
+
+	changed := 0
+	for _, change := range changes {
+		fmt.Printf("%04X  % X -> % X  (line %d)\n", change.Address, change.Old, change.New, change.Line)
+		changed += len(change.New)
+	}
+	fmt.Printf("%d bytes changed\n", changed)
+
+	if *output == "" {
+		*output = strings.TrimSuffix(baseName, filepath.Ext(baseName)) + ".patched" + filepath.Ext(baseName)
+	}
+	if isHex {
+		// Only the addresses the base file loaded and the patched bytes are
+		// written, so the gaps between its records stay gaps
+		spans = patchedSpans(base, spans, changes)
+		return writeFile(*output, func(f *os.File) error { return ihex.WriteSpans(f, base.Origin, base.Bytecode, spans) })
+	}
+	return os.WriteFile(*output, base.Bytecode, 0o644)
+}
+
+// patchedSpans returns the spans of the image that are in spans or changed
+// by the patch. Bytes that a patch emits into a gap with the gap's own
+// value aren't changes, and are left as gaps, which read the same.
+func patchedSpans(base *rom.Image, spans []ihex.Span, changes []patch.Change) []ihex.Span {
+	loaded := make([]bool, len(base.Bytecode))
+	for _, span := range spans {
+		for i := range span.Size {
+			loaded[int(span.Start)-int(base.Origin)+i] = true
+		}
+	}
+	for _, change := range changes {
+		for i := range change.New {
+			loaded[int(change.Address)-int(base.Origin)+i] = true
+		}
+	}
+
+	patched := []ihex.Span{}
+	for i, isLoaded := range loaded {
+		if !isLoaded {
+			continue
+		}
+		if n := len(patched); n > 0 && int(patched[n-1].Start)+patched[n-1].Size == int(base.Origin)+i {
+			patched[n-1].Size++
+			continue
+		}
+		patched = append(patched, ihex.Span{Start: base.Origin + uint16(i), Size: 1})
+	}
+	return patched
+}
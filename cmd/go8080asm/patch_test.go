@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/ihex"
+)
+
+func TestPatchHexWithGap(t *testing.T) {
+	chdir(t, t.TempDir())
+	// 0000 and 0010-0011 are loaded, and 0001-000F is a gap
+	base := []ihex.Span{{Start: 0x0000, Size: 1}, {Start: 0x0010, Size: 2}}
+	image := make([]byte, 0x12)
+	for i := range image {
+		image[i] = ihex.Gap
+	}
+	image[0x00], image[0x10], image[0x11] = 0x00, 0xC9, 0xC9
+	if err := writeFile("base.hex", func(f *os.File) error { return ihex.WriteSpans(f, 0, image, base) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("patch.asm", []byte("ORG 0005H\nDB 12H\nORG 0011H\nNOP\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runPatch([]string{"base.hex", "patch.asm"}); err != nil {
+		t.Fatalf("runPatch() error = %v", err)
+	}
+	f, err := os.Open("base.patched.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, got, spans, err := ihex.ReadSpans(f)
+	if err != nil {
+		t.Fatalf("ihex.ReadSpans() error = %v", err)
+	}
+	wantSpans := []ihex.Span{{Start: 0x0000, Size: 1}, {Start: 0x0005, Size: 1}, {Start: 0x0010, Size: 2}}
+	if !reflect.DeepEqual(spans, wantSpans) {
+		t.Errorf("patched spans = %v, want %v", spans, wantSpans)
+	}
+	image[0x05], image[0x11] = 0x12, 0x00
+	if !reflect.DeepEqual(got, image) {
+		t.Errorf("patched image = %X, want %X", got, image)
+	}
+}
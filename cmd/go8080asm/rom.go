@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/rom"
+)
+
+func runROM(args []string) error {
+	flags := flag.NewFlagSet("rom", flag.ExitOnError)
+	output := flags.String("o", "", "write the output to `name`.rom, or name.0.rom, name.even.rom and so on when split (default: the input name)")
+	origin := flags.String("origin", "0000", "the image starts at `address`")
+	size := flags.String("size", "", "pad the image to `size` bytes, or the size of an EPROM like 2716")
+	fill := flags.String("fill", "FF", "pad with `byte`")
+	checksum := flags.String("checksum", "", "embed a checksum: `sum8`, sum16 or crc16")
+	at := flags.String("at", "", "store the checksum at `address`, low byte first (default: the last bytes of the image)")
+	covers := flags.String("range", "", "compute the checksum over `start-end` inclusive (default: everything before the checksum)")
+	split := flags.String("split", "", "split the image into chips of `size` bytes, or the size of an EPROM like 2732")
+	lanes := flags.Int("lanes", 1, "interleave the image across `n` byte lanes, such as 2 for even and odd ROMs")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go8080asm rom [-origin address] [-size size] [-fill byte] [-checksum type [-at address] [-range start-end]] [-split size] [-lanes n] [-o name] image.bin")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || *lanes < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	filename := flags.Arg(0)
+	bytecode, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	image := &rom.Image{Bytecode: bytecode}
+	if image.Origin, err = parseAddress(*origin); err != nil {
+		return err
+	}
+
+	if *size != "" {
+		romSize, err := parseSize(*size)
+		if err != nil {
+			return err
+		}
+		fillByte, err := isa.ParseNumberUpTo(*fill, 0xFF)
+		if err != nil {
+			return err
+		}
+		if err := image.Pad(romSize, byte(fillByte)); err != nil {
+			return err
+		}
+	}
+
+	if *checksum != "" {
+		if err := embedChecksum(image, *checksum, *at, *covers); err != nil {
+			return err
+		}
+	}
+
+	base := *output
+	if base == "" {
+		base = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	chips := [][]byte{image.Bytecode}
+	if *split != "" {
+		chipSize, err := parseSize(*split)
+		if err != nil {
+			return err
+		}
+		// Each bank of chips holds one chip's worth of bytes per lane
+		if chips, err = image.Split(chipSize * *lanes); err != nil {
+			return err
+		}
+	}
+	for i, chip := range chips {
+		name := base
+		if len(chips) > 1 {
+			name += fmt.Sprintf(".%d", i)
+		}
+		for lane, bytes := range rom.Lanes(chip, *lanes) {
+			if err := os.WriteFile(name+laneName(lane, *lanes)+".rom", bytes, 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// embedChecksum embeds a checksum in image, by default in its last bytes and
+// covering everything before them, and prints it.
+func embedChecksum(image *rom.Image, name string, at string, covers string) error {
+	c, err := rom.ParseChecksum(name)
+	if err != nil {
+		return err
+	}
+
+	end := int(image.Origin) + len(image.Bytecode)
+	address := end - c.Size()
+	if at != "" {
+		parsed, err := parseAddress(at)
+		if err != nil {
+			return err
+		}
+		address = int(parsed)
+	}
+	if address < int(image.Origin) || address+c.Size() > end {
+		return fmt.Errorf("checksum address 0x%04X is outside the image", address)
+	}
+
+	start, last := int(image.Origin), address-1
+	if address == int(image.Origin) {
+		start, last = address+c.Size(), end-1
+	}
+	if covers != "" {
+		from, to, found := strings.Cut(covers, "-")
+		if !found {
+			return fmt.Errorf("invalid range %s, expected start-end", covers)
+		}
+		parsedStart, err := parseAddress(from)
+		if err != nil {
+			return err
+		}
+		parsedLast, err := parseAddress(to)
+		if err != nil {
+			return err
+		}
+		start, last = int(parsedStart), int(parsedLast)
+	}
+	if last < start {
+		return fmt.Errorf("checksum range 0x%04X-0x%04X is empty", start, last)
+	}
+
+	value, err := image.Embed(c, uint16(address), uint16(start), uint16(last))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s of %04X-%04X is %0*X, at %04X\n", c, start, last, c.Size()*2, value, address)
+	return nil
+}
+
+// parseSize parses a size in bytes, in hexadecimal, or the part number of
+// an EPROM.
+func parseSize(s string) (int, error) {
+	if size, found := rom.Chips[s]; found {
+		return size, nil
+	}
+	size, err := isa.ParseNumberUpTo(s, 0x10000)
+	if err != nil || size == 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return size, nil
+}
+
+// laneName returns the file name suffix for a byte lane: nothing if there's
+// only one, even and odd if there are two, and the lane number otherwise.
+func laneName(lane int, lanes int) string {
+	switch lanes {
+	case 1:
+		return ""
+	case 2:
+		return []string{".even", ".odd"}[lane]
+	}
+	return fmt.Sprintf(".lane%d", lane)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lukepeterson/go8080assembler/pkg/asmtest"
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+	"github.com/lukepeterson/go8080assembler/pkg/coverage"
+)
+
+func runTest(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "report passing tests as well as failures")
+	cover := flags.Bool("cover", false, "report the percentage of lines covered by the tests")
+	coverListing := flags.Bool("coverlisting", false, "print each source file annotated with execution counts")
+	coverProfile := flags.String("coverprofile", "", "write an LCOV coverage profile to `file`")
+	coverHTML := flags.String("coverhtml", "", "write an HTML coverage report to `file`")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go8080asm test [-v] [-cover] [-coverlisting] [-coverprofile file] [-coverhtml file] file.asm...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	measure := *cover || *coverListing || *coverProfile != "" || *coverHTML != ""
+	profiles := []*coverage.Profile{}
+
+	failed := false
+	for _, filename := range flags.Args() {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		recorder := coverage.NewRecorder()
+		results, err := asmtest.Run(string(source), recorder.Attach)
+		if err != nil {
+			fmt.Printf("FAIL\t%s\t%v\n", filename, err)
+			failed = true
+			continue
+		}
+
+		for _, result := range results {
+			if result.Passed && !*verbose {
+				continue
+			}
+			status := "PASS"
+			if !result.Passed {
+				status = "FAIL"
+			}
+			fmt.Printf("--- %s: %s (%d cycles)\n", status, result.Name, result.Cycles)
+			for _, failure := range result.Failures {
+				fmt.Printf("    %s\n", failure)
+			}
+		}
+
+		summary := ""
+		if measure {
+			profile, err := profileOf(filename, string(source), recorder)
+			if err != nil {
+				return err
+			}
+			profiles = append(profiles, profile)
+			summary = fmt.Sprintf("\tcoverage: %.1f%% of lines", profile.Percent())
+			if *coverListing {
+				if err := profile.WriteListing(os.Stdout); err != nil {
+					return err
+				}
+			}
+		}
+
+		if asmtest.Passed(results) {
+			fmt.Printf("ok\t%s\t%d tests%s\n", filename, len(results), summary)
+		} else {
+			fmt.Printf("FAIL\t%s\n", filename)
+			failed = true
+		}
+	}
+
+	if *coverProfile != "" {
+		if err := writeFile(*coverProfile, func(f *os.File) error { return coverage.WriteLCOV(f, profiles...) }); err != nil {
+			return err
+		}
+	}
+	if *coverHTML != "" {
+		if err := writeFile(*coverHTML, func(f *os.File) error { return coverage.WriteHTML(f, profiles...) }); err != nil {
+			return err
+		}
+	}
+
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// profileOf returns the coverage of the program in a test file, from the
+// runs recorded by recorder.
+func profileOf(filename string, source string, recorder *coverage.Recorder) (*coverage.Profile, error) {
+	program, _, err := asmtest.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	asm := assembler.New(program)
+	if _, err := asm.Assemble(); err != nil {
+		return nil, err
+	}
+	return recorder.Profile(filename, source, asm.Statements()), nil
+}
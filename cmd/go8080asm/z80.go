@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+	"github.com/lukepeterson/go8080assembler/pkg/z80"
+)
+
+func runZ80(args []string) error {
+	flags := flag.NewFlagSet("z80", flag.ExitOnError)
+	output := flags.String("o", "", "write the translation to `file` (default: standard output)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go8080asm z80 [-o file] file.asm")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	filename := flags.Arg(0)
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	translated, err := z80.FromIntel(string(source))
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	// Check the translation by assembling both versions
+	directory := assembler.WithDirectory(filepath.Dir(filename))
+	original, err := assembler.New(string(source), directory).AssembleObject()
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	converted, err := assembler.New(translated, directory, assembler.Z80Mnemonics()).AssembleObject()
+	if err != nil {
+		return fmt.Errorf("%s: translation doesn't assemble: %w", filename, err)
+	}
+	if err := compareModules(original, converted); err != nil {
+		return fmt.Errorf("%s: translation doesn't match: %w", filename, err)
+	}
+
+	if *output == "" {
+		_, err := os.Stdout.WriteString(translated)
+		return err
+	}
+	return os.WriteFile(*output, []byte(translated), 0o644)
+}
+
+// compareModules returns an error describing the first difference between
+// the segments of two modules.
+func compareModules(want *object.Module, got *object.Module) error {
+	segments := []struct {
+		segment   object.Segment
+		want, got []byte
+	}{
+		{object.Code, want.Code, got.Code},
+		{object.Data, want.Data, got.Data},
+	}
+	for _, s := range segments {
+		for i := range min(len(s.want), len(s.got)) {
+			if s.want[i] != s.got[i] {
+				return fmt.Errorf("%s byte 0x%04X is %02X, want %02X", s.segment, i, s.got[i], s.want[i])
+			}
+		}
+		if len(s.want) != len(s.got) {
+			return fmt.Errorf("%s segment is %d bytes, want %d", s.segment, len(s.got), len(s.want))
+		}
+	}
+	return nil
+}
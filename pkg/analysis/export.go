@@ -0,0 +1,129 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func nodeID(address uint16) string {
+	return fmt.Sprintf("n%04X", address)
+}
+
+func dotString(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func writeDOTEdge(b *strings.Builder, edge Edge) {
+	attributes := []string{}
+	if edge.Label != "" {
+		attributes = append(attributes, "label="+dotString(edge.Label))
+	}
+	switch edge.Kind {
+	case EdgeFallthrough:
+		attributes = append(attributes, "style=dashed")
+	case EdgeDispatch, EdgeTail:
+		attributes = append(attributes, "style=dotted")
+	}
+	fmt.Fprintf(b, "\t%s -> %s", nodeID(edge.From), nodeID(edge.To))
+	if len(attributes) > 0 {
+		fmt.Fprintf(b, " [%s]", strings.Join(attributes, ", "))
+	}
+	b.WriteString(";\n")
+}
+
+// WriteDOT writes the control flow graph in Graphviz DOT format. Each node is
+// a basic block, labelled with its symbol name and instructions.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString("digraph cfg {\n")
+	b.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+
+	for _, block := range g.Blocks {
+		lines := []string{block.Name + ":"}
+		for _, instruction := range block.Instructions {
+			lines = append(lines, fmt.Sprintf("%04X  %s", instruction.Address, instruction))
+		}
+		label := strings.ReplaceAll(strings.Join(lines, "\n")+"\n", "\n", `\l`)
+		fmt.Fprintf(b, "\t%s [label=%s];\n", nodeID(block.Address), dotString(label))
+	}
+	for _, edge := range g.Edges {
+		writeDOTEdge(b, edge)
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteCallGraphDOT writes the call graph in Graphviz DOT format. Each node is
+// a routine, labelled with its symbol name.
+func (g *Graph) WriteCallGraphDOT(w io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString("digraph calls {\n")
+	b.WriteString("\tnode [shape=ellipse];\n")
+
+	for _, routine := range g.Routines {
+		fmt.Fprintf(b, "\t%s [label=%s];\n", nodeID(routine), dotString(g.Name(routine)))
+	}
+	for _, edge := range g.Calls {
+		writeDOTEdge(b, edge)
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type jsonNode struct {
+	Name         string   `json:"name"`
+	Address      uint16   `json:"address"`
+	Instructions []string `json:"instructions,omitempty"`
+}
+
+type jsonEdge struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Kind  EdgeKind `json:"kind"`
+	Label string   `json:"label,omitempty"`
+}
+
+type jsonGraph struct {
+	Blocks   []jsonNode `json:"blocks"`
+	Edges    []jsonEdge `json:"edges"`
+	Routines []jsonNode `json:"routines"`
+	Calls    []jsonEdge `json:"calls"`
+}
+
+// WriteJSON writes both graphs as JSON. Edges refer to blocks and routines
+// by symbol name.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	out := jsonGraph{
+		Blocks:   []jsonNode{},
+		Edges:    []jsonEdge{},
+		Routines: []jsonNode{},
+		Calls:    []jsonEdge{},
+	}
+
+	for _, block := range g.Blocks {
+		node := jsonNode{Name: block.Name, Address: block.Address}
+		for _, instruction := range block.Instructions {
+			node.Instructions = append(node.Instructions, instruction.String())
+		}
+		out.Blocks = append(out.Blocks, node)
+	}
+	for _, routine := range g.Routines {
+		out.Routines = append(out.Routines, jsonNode{Name: g.Name(routine), Address: routine})
+	}
+	for _, edge := range g.Edges {
+		out.Edges = append(out.Edges, jsonEdge{From: g.Name(edge.From), To: g.Name(edge.To), Kind: edge.Kind, Label: edge.Label})
+	}
+	for _, edge := range g.Calls {
+		out.Calls = append(out.Calls, jsonEdge{From: g.Name(edge.From), To: g.Name(edge.To), Kind: edge.Kind, Label: edge.Label})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
@@ -0,0 +1,73 @@
+package analysis
+
+import (
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/disassembler"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+)
+
+type flowKind int
+
+const (
+	flowNext       flowKind = iota // Falls through to the next instruction
+	flowJump                       // Unconditional jump
+	flowBranch                     // Conditional jump
+	flowCall                       // Unconditional call, including RST
+	flowCondCall                   // Conditional call
+	flowReturn                     // Unconditional return
+	flowCondReturn                 // Conditional return
+	flowIndirect                   // PCHL
+	flowHalt                       // HLT
+)
+
+func flowOf(instruction disassembler.Instruction) flowKind {
+	opcode := instruction.Opcode
+	switch {
+	case userDefined(instruction):
+		return flowNext
+	case opcode == 0xC3 || instruction.Mnemonic == "JMP_CB":
+		return flowJump
+	case opcode&0xC7 == 0xC2 || instruction.Mnemonic == "JNK" || instruction.Mnemonic == "JK":
+		return flowBranch
+	case opcode == 0xCD || strings.HasPrefix(instruction.Mnemonic, "CALL_"):
+		return flowCall
+	case opcode&0xC7 == 0xC7:
+		return flowCall
+	case opcode&0xC7 == 0xC4 || instruction.Mnemonic == "RSTV":
+		return flowCondCall
+	case opcode == 0xC9 || instruction.Mnemonic == "RET_D9":
+		return flowReturn
+	case opcode&0xC7 == 0xC0:
+		return flowCondReturn
+	case opcode == 0xE9:
+		return flowIndirect
+	case opcode == 0x76:
+		return flowHalt
+	}
+	return flowNext
+}
+
+// userDefined reports whether an instruction is one the program defined
+// with OPCODE or WithOpcodes. These have mnemonics the assembler doesn't, and
+// are taken to run on to the next instruction whatever their opcode.
+func userDefined(instruction disassembler.Instruction) bool {
+	return !lexer.IsMnemonic(instruction.Mnemonic)
+}
+
+// target returns the destination of a jump, call or restart instruction.
+// RSTV restarts at 40H.
+func target(instruction disassembler.Instruction) uint16 {
+	if instruction.Mnemonic == "RSTV" {
+		return 0x40
+	}
+	if instruction.Opcode&0xC7 == 0xC7 {
+		return uint16(instruction.Opcode & 0x38)
+	}
+	return instruction.Data
+}
+
+// next returns the address of the instruction following this one.
+func next(instruction disassembler.Instruction) uint16 {
+	return instruction.Address + uint16(instruction.Length)
+}
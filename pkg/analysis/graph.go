@@ -0,0 +1,284 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lukepeterson/go8080assembler/pkg/disassembler"
+)
+
+type EdgeKind string
+
+const (
+	EdgeFallthrough EdgeKind = "fallthrough" // Execution continues into the next block
+	EdgeJump        EdgeKind = "jump"        // JMP
+	EdgeBranch      EdgeKind = "branch"      // Conditional jump, taken
+	EdgeDispatch    EdgeKind = "dispatch"    // PCHL to an annotated target
+	EdgeCall        EdgeKind = "call"        // CALL, conditional call or RST
+	EdgeTail        EdgeKind = "tail"        // Jump or PCHL tail call into another routine
+)
+
+// Block is a basic block: a run of instructions that is only entered at the
+// top and only left at the bottom.
+type Block struct {
+	Name         string
+	Address      uint16
+	Instructions []disassembler.Instruction
+}
+
+// Edge joins two blocks in the control flow graph, or two routines in the
+// call graph. Label is the instruction that takes the edge, such as "JZ" or
+// "CNC", and is empty for fallthrough edges.
+type Edge struct {
+	From  uint16
+	To    uint16
+	Kind  EdgeKind
+	Label string
+}
+
+// Graph is the control flow graph and call graph of the reachable code in a
+// program.
+type Graph struct {
+	Blocks   []Block  // Sorted by address
+	Edges    []Edge   // Control flow edges between blocks
+	Routines []uint16 // Entry points and call targets, sorted by address
+	Calls    []Edge   // Call graph edges between routines
+	names    map[uint16]string
+}
+
+// Name returns the symbol name for a block or routine address.
+func (g *Graph) Name(address uint16) string {
+	if name, exists := g.names[address]; exists {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", address)
+}
+
+// Block returns the block starting at address, if there is one.
+func (g *Graph) Block(address uint16) (Block, bool) {
+	i := sort.Search(len(g.Blocks), func(i int) bool { return g.Blocks[i].Address >= address })
+	if i < len(g.Blocks) && g.Blocks[i].Address == address {
+		return g.Blocks[i], true
+	}
+	return Block{}, false
+}
+
+// BuildGraph finds the code reachable from each entry point, splits it into
+// basic blocks and builds the call graph between routines.
+func BuildGraph(prog Program) (*Graph, error) {
+	entries, err := prog.entries()
+	if err != nil {
+		return nil, err
+	}
+	dispatches, err := prog.dispatches()
+	if err != nil {
+		return nil, err
+	}
+
+	instructions := map[uint16]disassembler.Instruction{}
+	leaders := map[uint16]bool{}
+	routines := map[uint16]bool{}
+	work := []uint16{}
+
+	for _, entry := range entries {
+		leaders[entry] = true
+		routines[entry] = true
+		work = append(work, entry)
+	}
+	for _, address := range prog.Labels {
+		leaders[address] = true
+	}
+
+	for len(work) > 0 {
+		address := work[len(work)-1]
+		work = work[:len(work)-1]
+		if _, seen := instructions[address]; seen {
+			continue
+		}
+		instruction, err := prog.decode(address)
+		if err != nil {
+			continue
+		}
+		instructions[address] = instruction
+
+		switch flowOf(instruction) {
+		case flowNext:
+			work = append(work, next(instruction))
+		case flowJump:
+			leaders[target(instruction)] = true
+			work = append(work, target(instruction))
+		case flowBranch:
+			leaders[target(instruction)] = true
+			leaders[next(instruction)] = true
+			work = append(work, target(instruction), next(instruction))
+		case flowCall, flowCondCall:
+			leaders[target(instruction)] = true
+			routines[target(instruction)] = true
+			work = append(work, target(instruction), next(instruction))
+		case flowCondReturn:
+			leaders[next(instruction)] = true
+			work = append(work, next(instruction))
+		case flowIndirect:
+			d := dispatches[instruction.Address]
+			for _, address := range d.targets {
+				leaders[address] = true
+				if d.tail {
+					routines[address] = true
+				}
+				work = append(work, address)
+			}
+		}
+	}
+
+	g := &Graph{names: map[uint16]string{}}
+	for address := range instructions {
+		if leaders[address] {
+			g.names[address] = prog.name(address)
+		}
+	}
+	for address := range routines {
+		if _, reachable := instructions[address]; reachable {
+			g.Routines = append(g.Routines, address)
+			g.names[address] = prog.name(address)
+		}
+	}
+	sort.Slice(g.Routines, func(i, j int) bool { return g.Routines[i] < g.Routines[j] })
+
+	g.buildBlocks(instructions, leaders)
+	g.buildEdges(dispatches)
+	g.buildCalls(routines, dispatches)
+	return g, nil
+}
+
+func endsBlock(instruction disassembler.Instruction) bool {
+	switch flowOf(instruction) {
+	case flowNext, flowCall, flowCondCall:
+		return false
+	}
+	return true
+}
+
+func (g *Graph) buildBlocks(instructions map[uint16]disassembler.Instruction, leaders map[uint16]bool) {
+	addresses := []uint16{}
+	for address := range instructions {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+
+	var current *Block
+	for _, address := range addresses {
+		instruction := instructions[address]
+		if current != nil {
+			last := current.Instructions[len(current.Instructions)-1]
+			if leaders[address] || endsBlock(last) || next(last) != address {
+				current = nil
+			}
+		}
+		if current == nil {
+			g.Blocks = append(g.Blocks, Block{Name: g.Name(address), Address: address})
+			current = &g.Blocks[len(g.Blocks)-1]
+		}
+		current.Instructions = append(current.Instructions, instruction)
+	}
+}
+
+func (g *Graph) buildEdges(dispatches map[uint16]dispatch) {
+	for _, block := range g.Blocks {
+		last := block.Instructions[len(block.Instructions)-1]
+		addFallthrough := func() {
+			if _, exists := g.Block(next(last)); exists {
+				g.Edges = append(g.Edges, Edge{From: block.Address, To: next(last), Kind: EdgeFallthrough})
+			}
+		}
+
+		switch flowOf(last) {
+		case flowNext, flowCall, flowCondCall, flowCondReturn:
+			addFallthrough()
+		case flowJump:
+			g.Edges = append(g.Edges, Edge{From: block.Address, To: target(last), Kind: EdgeJump, Label: last.Mnemonic})
+		case flowBranch:
+			g.Edges = append(g.Edges, Edge{From: block.Address, To: target(last), Kind: EdgeBranch, Label: last.Mnemonic})
+			addFallthrough()
+		case flowIndirect:
+			d := dispatches[last.Address]
+			if d.tail {
+				break
+			}
+			for _, address := range d.targets {
+				g.Edges = append(g.Edges, Edge{From: block.Address, To: address, Kind: EdgeDispatch, Label: last.Mnemonic})
+			}
+		}
+	}
+}
+
+// buildCalls walks the blocks of each routine, stopping at the start of any
+// other routine, and records the calls made along the way.
+func (g *Graph) buildCalls(routines map[uint16]bool, dispatches map[uint16]dispatch) {
+	successors := map[uint16][]Edge{}
+	for _, edge := range g.Edges {
+		successors[edge.From] = append(successors[edge.From], edge)
+	}
+
+	for _, routine := range g.Routines {
+		seen := map[Edge]bool{}
+		visited := map[uint16]bool{routine: true}
+		work := []uint16{routine}
+
+		add := func(edge Edge) {
+			if !seen[edge] {
+				seen[edge] = true
+				g.Calls = append(g.Calls, edge)
+			}
+		}
+
+		for len(work) > 0 {
+			address := work[len(work)-1]
+			work = work[:len(work)-1]
+			block, exists := g.Block(address)
+			if !exists {
+				continue
+			}
+
+			for _, instruction := range block.Instructions {
+				switch flowOf(instruction) {
+				case flowCall, flowCondCall:
+					add(Edge{From: routine, To: target(instruction), Kind: EdgeCall, Label: callLabel(instruction)})
+				}
+			}
+
+			last := block.Instructions[len(block.Instructions)-1]
+			if d := dispatches[last.Address]; flowOf(last) == flowIndirect && d.tail {
+				for _, address := range d.targets {
+					add(Edge{From: routine, To: address, Kind: EdgeTail, Label: last.Mnemonic})
+				}
+			}
+
+			for _, edge := range successors[address] {
+				if routines[edge.To] && edge.To != routine {
+					add(Edge{From: routine, To: edge.To, Kind: EdgeTail, Label: edge.Label})
+					continue
+				}
+				if !visited[edge.To] {
+					visited[edge.To] = true
+					work = append(work, edge.To)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(g.Calls, func(i, j int) bool {
+		if g.Calls[i].From != g.Calls[j].From {
+			return g.Calls[i].From < g.Calls[j].From
+		}
+		return g.Calls[i].To < g.Calls[j].To
+	})
+}
+
+// callLabel returns the call instruction without its address, keeping the
+// vector number of restarts.
+func callLabel(instruction disassembler.Instruction) string {
+	if instruction.Mnemonic == "RST" {
+		return instruction.String()
+	}
+	return instruction.Mnemonic
+}
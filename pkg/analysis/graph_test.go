@@ -0,0 +1,126 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const graphInput = `
+START:	MVI A, 0x05
+LOOP:	CALL PRINT
+		DCR A
+		JNZ LOOP
+		CNC DONE
+		HLT
+PRINT:	OUT 0x01
+		RET
+DONE:	RZ
+		JMP PRINT
+`
+
+func TestBuildGraph(t *testing.T) {
+	g, err := BuildGraph(assemble(t, graphInput))
+	if err != nil {
+		t.Fatalf("BuildGraph() error = %v", err)
+	}
+
+	blocks := []string{}
+	for _, block := range g.Blocks {
+		blocks = append(blocks, block.Name)
+	}
+	wantBlocks := []string{"START", "LOOP", "0x0009", "PRINT", "DONE", "0x0011"}
+	if !reflect.DeepEqual(blocks, wantBlocks) {
+		t.Errorf("BuildGraph() blocks = %v, want %v", blocks, wantBlocks)
+	}
+
+	edges := []string{}
+	for _, edge := range g.Edges {
+		edges = append(edges, g.Name(edge.From)+" -> "+g.Name(edge.To)+" "+string(edge.Kind)+" "+edge.Label)
+	}
+	wantEdges := []string{
+		"START -> LOOP fallthrough ",
+		"LOOP -> LOOP branch JNZ",
+		"LOOP -> 0x0009 fallthrough ",
+		"DONE -> 0x0011 fallthrough ",
+		"0x0011 -> PRINT jump JMP",
+	}
+	if !reflect.DeepEqual(edges, wantEdges) {
+		t.Errorf("BuildGraph() edges = %v, want %v", edges, wantEdges)
+	}
+
+	calls := []string{}
+	for _, edge := range g.Calls {
+		calls = append(calls, g.Name(edge.From)+" -> "+g.Name(edge.To)+" "+string(edge.Kind)+" "+edge.Label)
+	}
+	wantCalls := []string{
+		"START -> PRINT call CALL",
+		"START -> DONE call CNC",
+		"DONE -> PRINT tail JMP",
+	}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("BuildGraph() calls = %v, want %v", calls, wantCalls)
+	}
+}
+
+func TestGraph_WriteDOT(t *testing.T) {
+	g, err := BuildGraph(assemble(t, graphInput))
+	if err != nil {
+		t.Fatalf("BuildGraph() error = %v", err)
+	}
+
+	var cfg, calls bytes.Buffer
+	if err := g.WriteDOT(&cfg); err != nil {
+		t.Fatalf("Graph.WriteDOT() error = %v", err)
+	}
+	if err := g.WriteCallGraphDOT(&calls); err != nil {
+		t.Fatalf("Graph.WriteCallGraphDOT() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"digraph cfg {",
+		`n0002 [label="LOOP:\l0002  CALL 0x000D\l0005  DCR A\l0006  JNZ 0x0002\l"];`,
+		`n0002 -> n0002 [label="JNZ"];`,
+		`n0000 -> n0002 [style=dashed];`,
+	} {
+		if !strings.Contains(cfg.String(), want) {
+			t.Errorf("Graph.WriteDOT() missing %q in:\n%s", want, cfg.String())
+		}
+	}
+	for _, want := range []string{
+		"digraph calls {",
+		`n0010 [label="DONE"];`,
+		`n0000 -> n0010 [label="CNC"];`,
+		`n0010 -> n000D [label="JMP", style=dotted];`,
+	} {
+		if !strings.Contains(calls.String(), want) {
+			t.Errorf("Graph.WriteCallGraphDOT() missing %q in:\n%s", want, calls.String())
+		}
+	}
+}
+
+func TestGraph_WriteJSON(t *testing.T) {
+	g, err := BuildGraph(assemble(t, graphInput))
+	if err != nil {
+		t.Fatalf("BuildGraph() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := g.WriteJSON(&out); err != nil {
+		t.Fatalf("Graph.WriteJSON() error = %v", err)
+	}
+
+	var got jsonGraph
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(got.Blocks) != len(g.Blocks) || len(got.Calls) != len(g.Calls) {
+		t.Errorf("Graph.WriteJSON() = %s", out.String())
+	}
+	wantCall := jsonEdge{From: "START", To: "DONE", Kind: EdgeCall, Label: "CNC"}
+	if got.Calls[1] != wantCall {
+		t.Errorf("Graph.WriteJSON() call = %+v, want %+v", got.Calls[1], wantCall)
+	}
+}
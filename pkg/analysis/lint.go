@@ -0,0 +1,133 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/disassembler"
+	"github.com/lukepeterson/go8080assembler/pkg/parser"
+)
+
+// Lint reports labels that are defined but never referenced, code that can't
+// be reached because it follows an unconditional JMP, RET, PCHL or HLT and
+// nothing branches to it, calls whose target is inside data, and the 8080's
+// undocumented duplicate opcodes. Opcodes assembled from 8085 instructions
+// and user-defined instructions aren't reported.
+func Lint(prog Program) ([]Issue, error) {
+	entries, err := prog.entries()
+	if err != nil {
+		return nil, err
+	}
+	dispatches, err := prog.dispatches()
+	if err != nil {
+		return nil, err
+	}
+
+	issues := []Issue{}
+	report := func(address uint16, format string, args ...any) {
+		issues = append(issues, Issue{Address: address, Routine: prog.enclosing(address), Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Labels
+	used := map[uint16]bool{}
+	for _, entry := range entries {
+		used[entry] = true
+	}
+	for _, d := range dispatches {
+		for _, address := range d.targets {
+			used[address] = true
+		}
+	}
+	for label, address := range prog.Labels {
+		if len(prog.References[label]) == 0 && !used[address] {
+			report(address, "label %s is defined but never referenced", label)
+		}
+	}
+
+	// Code
+	instructions := prog.linear()
+	targets := map[uint16]bool{}
+	for _, address := range prog.Labels {
+		targets[address] = true
+	}
+	for _, instruction := range instructions {
+		switch flowOf(instruction) {
+		case flowJump, flowBranch, flowCall, flowCondCall:
+			targets[target(instruction)] = true
+		}
+	}
+
+	for i, instruction := range instructions {
+		if instruction.Undocumented {
+			report(instruction.Address, "undocumented opcode 0x%02X, %s", instruction.Opcode, instruction.Mnemonic)
+		}
+		switch flowOf(instruction) {
+		case flowCall, flowCondCall:
+			if region, inData := prog.dataAt(target(instruction)); inData {
+				report(instruction.Address, "%s target 0x%04X is inside data at 0x%04X", callLabel(instruction), target(instruction), region.Address)
+			}
+		case flowJump, flowReturn, flowIndirect, flowHalt:
+			if i+1 == len(instructions) {
+				continue
+			}
+			following := instructions[i+1]
+			if following.Address == next(instruction) && !targets[following.Address] {
+				report(following.Address, "unreachable code after %s", instruction.Mnemonic)
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Address != issues[j].Address {
+			return issues[i].Address < issues[j].Address
+		}
+		return issues[i].Message < issues[j].Message
+	})
+	return issues, nil
+}
+
+// linear disassembles everything in the program outside of data regions.
+func (prog Program) linear() []disassembler.Instruction {
+	instructions := []disassembler.Instruction{}
+	for address := int(prog.Origin); address < prog.end(); {
+		if region, inData := prog.dataAt(uint16(address)); inData {
+			address = int(region.Address) + region.Size
+			continue
+		}
+		instruction, err := prog.decode(uint16(address))
+		if err != nil {
+			break
+		}
+		instructions = append(instructions, instruction)
+		address += instruction.Length
+	}
+	return instructions
+}
+
+func (prog Program) dataAt(address uint16) (parser.Region, bool) {
+	for _, region := range prog.Data {
+		if region.Contains(address) {
+			return region, true
+		}
+	}
+	return parser.Region{}, false
+}
+
+// enclosing returns the name of the closest label at or before address.
+func (prog Program) enclosing(address uint16) string {
+	best, found := "", false
+	var bestAddress uint16
+	for label, labelAddress := range prog.Labels {
+		if labelAddress > address {
+			continue
+		}
+		if !found || labelAddress > bestAddress || (labelAddress == bestAddress && strings.Compare(label, best) < 0) {
+			best, bestAddress, found = label, labelAddress, true
+		}
+	}
+	if !found {
+		return fmt.Sprintf("0x%04X", address)
+	}
+	return best
+}
@@ -0,0 +1,164 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantIssues []string
+	}{
+		{
+			name: "clean program",
+			input: `
+			START:	CALL PRINT
+					HLT
+			PRINT:	LXI H, MSG
+					RET
+			MSG:	DB 'Hello', 0x00
+			`,
+			wantIssues: []string{},
+		},
+		{
+			name: "unused label",
+			input: `
+			START:	MVI A, 0x01
+			UNUSED:	HLT
+			`,
+			wantIssues: []string{"0x0002 in UNUSED: label UNUSED is defined but never referenced"},
+		},
+		{
+			name: "declared entry point isn't unused",
+			input: `
+			;@entry IRQ
+			START:	HLT
+			IRQ:	RET
+			`,
+			wantIssues: []string{},
+		},
+		{
+			name: "PUBLIC symbol isn't unused",
+			input: `
+			PUBLIC PRINT
+			START:	HLT
+			PRINT:	RET
+			`,
+			wantIssues: []string{},
+		},
+		{
+			name: "unreachable code after JMP",
+			input: `
+			START:	JMP START
+					MVI A, 0x01
+			`,
+			wantIssues: []string{"0x0003 in START: unreachable code after JMP"},
+		},
+		{
+			name: "unreachable code after RET, PCHL and HLT",
+			input: `
+			START:	CALL ONE
+					HLT
+					NOP
+			ONE:	RET
+					NOP
+			`,
+			wantIssues: []string{
+				"0x0004 in START: unreachable code after HLT",
+				"0x0006 in ONE: unreachable code after RET",
+			},
+		},
+		{
+			name: "labelled code after JMP is reachable",
+			input: `
+			START:	JMP NEXT
+			NEXT:	HLT
+			`,
+			wantIssues: []string{},
+		},
+		{
+			name: "data after JMP isn't code",
+			input: `
+			START:	LXI H, MSG
+					JMP START
+					DB 0x01, 0x02
+			MSG:	DB 'A'
+			`,
+			wantIssues: []string{},
+		},
+		{
+			name: "call into data",
+			input: `
+			START:	CALL TABLE
+					HLT
+			TABLE:	DB 0x01, 0x02, 0x03
+			`,
+			wantIssues: []string{"0x0000 in START: CALL target 0x0004 is inside data at 0x0004"},
+		},
+		{
+			name: "undocumented opcodes",
+			input: `
+			START:	NOP_08
+					CALL_DD PRINT
+					JMP_CB START
+			PRINT:	RET_D9
+			`,
+			wantIssues: []string{
+				"0x0000 in START: undocumented opcode 0x08, NOP_08",
+				"0x0001 in START: undocumented opcode 0xDD, CALL_DD",
+				"0x0004 in START: undocumented opcode 0xCB, JMP_CB",
+				"0x0007 in PRINT: undocumented opcode 0xD9, RET_D9",
+			},
+		},
+		{
+			name: "8085 instructions aren't undocumented",
+			input: `
+			.8085
+			START:	RIM
+					SIM
+					HLT
+			`,
+			wantIssues: []string{},
+		},
+		{
+			name: "undocumented 8085 instructions aren't 8080 duplicates",
+			input: `
+			.8085U
+			START:	SHLX
+					JNK START
+					LDHI 0x10
+					JK START
+					HLT
+			`,
+			wantIssues: []string{},
+		},
+		{
+			name: "user-defined instructions in undocumented slots",
+			input: `
+			OPCODE FOO, 0x08
+			OPCODE BAZ, 0xCB, WORD
+			START:	FOO
+					BAZ START
+					HLT
+			`,
+			wantIssues: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := Lint(assemble(t, tt.input))
+			if err != nil {
+				t.Fatalf("Lint() error = %v", err)
+			}
+			got := []string{}
+			for _, issue := range issues {
+				got = append(got, issue.String())
+			}
+			if !reflect.DeepEqual(got, tt.wantIssues) {
+				t.Errorf("Lint() = %v, want %v", got, tt.wantIssues)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+	"github.com/lukepeterson/go8080assembler/pkg/disassembler"
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/parser"
+)
+
+// Program is an assembled program along with the symbol information the
+// analyses need.
+type Program struct {
+	Code       []byte
+	Origin     uint16
+	Labels     map[string]uint16
+	Symbols    map[string]uint16 // Predefined and imported symbols, such as CP/M's BDOS
+	References map[string][]uint16
+	Data       []parser.Region
+	Comments   []parser.Comment
+	Statements []parser.Statement
+	Entries    []string              // Entry point labels, in addition to any ";@entry" annotations
+	Opcodes    map[uint16]isa.Opcode // User-defined instructions, by address
+	CPU        isa.CPU               // Processor the code is decoded for
+}
+
+// NewProgram returns the program produced by the last successful Assemble.
+// PUBLIC symbols are entry points, since other modules can call them. The
+// code is decoded for the 8085 if WithCPU or any .8085 or .8085U directive
+// selects it, since the program then runs on one.
+func NewProgram(asm *assembler.Assembler, code []byte) Program {
+	opcodes := map[uint16]isa.Opcode{}
+	cpu := asm.CPU()
+	for _, s := range asm.Statements() {
+		if o, defined := asm.Opcodes()[s.Mnemonic]; defined {
+			opcodes[s.Address] = o
+		}
+		if selected, err := isa.ParseCPU(s.Mnemonic); err == nil && isa.IsDirective(s.Mnemonic) {
+			cpu = max(cpu, selected)
+		}
+	}
+	return Program{
+		Code:       code,
+		Origin:     asm.Origin(),
+		Labels:     asm.Labels(),
+		Symbols:    asm.Predefined(),
+		References: asm.References(),
+		Data:       asm.Data(),
+		Comments:   asm.Comments(),
+		Statements: asm.Statements(),
+		Entries:    asm.Publics(),
+		Opcodes:    opcodes,
+		CPU:        cpu,
+	}
+}
+
+// dispatch is a ";@stack" annotation describing where a PCHL goes.
+// Annotations are written as comments starting with ";@", so that they have
+// no effect on the assembled output:
+//
+//	;@entry RESET, IRQ        declares entry points
+//	;@stack jump L1, L2       the next PCHL jumps to one of L1 or L2
+//	;@stack tail L1, L2       the next PCHL tail calls one of L1 or L2
+//	;@stack tail depth=6      the next PCHL tail calls code using 6 bytes of stack
+//	;@stack call BDOS depth=8 BDOS, outside the program, uses 8 bytes of stack
+type dispatch struct {
+	tail    bool
+	call    bool
+	targets []uint16
+	depth   int
+}
+
+func (prog Program) end() int {
+	return int(prog.Origin) + len(prog.Code)
+}
+
+func (prog Program) contains(address uint16) bool {
+	return int(address) >= int(prog.Origin) && int(address) < prog.end()
+}
+
+// decode disassembles the instruction at address for the program's CPU.
+// User-defined instructions are decoded as they were defined, not as the
+// instruction with the same opcode.
+func (prog Program) decode(address uint16) (disassembler.Instruction, error) {
+	if !prog.contains(address) {
+		return disassembler.Instruction{}, fmt.Errorf("address outside program: 0x%04X", address)
+	}
+	o, defined := prog.Opcodes[address]
+	if !defined {
+		return disassembler.DecodeCPU(prog.Code, int(address-prog.Origin), address, prog.CPU)
+	}
+	instruction := disassembler.Instruction{Address: address, Opcode: o.Code, Mnemonic: o.Mnemonic, Length: 1}
+	offset := int(address - prog.Origin)
+	switch o.Operand {
+	case isa.Byte:
+		instruction.Length = 2
+	case isa.Word:
+		instruction.Length = 3
+	}
+	if offset+instruction.Length > len(prog.Code) {
+		return disassembler.Instruction{}, fmt.Errorf("instruction at 0x%04X runs past the end of the program", address)
+	}
+	switch o.Operand {
+	case isa.Byte:
+		instruction.Data = uint16(prog.Code[offset+1])
+		instruction.Operands = fmt.Sprintf("%02XH", instruction.Data)
+	case isa.Word:
+		instruction.Data = uint16(prog.Code[offset+1]) | uint16(prog.Code[offset+2])<<8
+		instruction.Operands = fmt.Sprintf("%04XH", instruction.Data)
+	}
+	return instruction, nil
+}
+
+// name returns the label at address, or the address itself if there isn't
+// one. Addresses outside the program can be named by predefined symbols.
+func (prog Program) name(address uint16) string {
+	names := []string{}
+	for label, labelAddress := range prog.Labels {
+		if labelAddress == address {
+			names = append(names, label)
+		}
+	}
+	if len(names) == 0 && !prog.contains(address) {
+		for symbol, symbolAddress := range prog.Symbols {
+			if symbolAddress == address {
+				names = append(names, symbol)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("0x%04X", address)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+func (prog Program) lookup(label string) (uint16, error) {
+	address, exists := prog.Labels[label]
+	if !exists {
+		address, exists = prog.Symbols[label]
+	}
+	if !exists {
+		return 0, fmt.Errorf("label definition not found: %s", label)
+	}
+	return address, nil
+}
+
+// annotations returns the comments starting with ";@<kind>", with the
+// annotation keyword removed and commas replaced by spaces.
+func (prog Program) annotations(kind string) []parser.Comment {
+	found := []parser.Comment{}
+	for _, comment := range prog.Comments {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Text, ";"))
+		fields := strings.Fields(strings.ReplaceAll(text, ",", " "))
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "@"+kind) {
+			continue
+		}
+		found = append(found, parser.Comment{Address: comment.Address, Text: strings.Join(fields[1:], " ")})
+	}
+	return found
+}
+
+func (prog Program) entries() ([]uint16, error) {
+	names := append([]string{}, prog.Entries...)
+	for _, annotation := range prog.annotations("entry") {
+		names = append(names, strings.Fields(annotation.Text)...)
+	}
+
+	entries := []uint16{prog.Origin}
+	seen := map[uint16]bool{prog.Origin: true}
+	for _, name := range names {
+		address, err := prog.lookup(strings.ToUpper(name))
+		if err != nil {
+			return nil, err
+		}
+		if !seen[address] {
+			seen[address] = true
+			entries = append(entries, address)
+		}
+	}
+	return entries, nil
+}
+
+// dispatches returns the "jump" and "tail" annotations by the address of
+// their PCHL.
+func (prog Program) dispatches() (map[uint16]dispatch, error) {
+	dispatches := map[uint16]dispatch{}
+	for _, annotation := range prog.annotations("stack") {
+		d, err := prog.parseStack(annotation)
+		if err != nil {
+			return nil, err
+		}
+		if d.call {
+			continue
+		}
+
+		instruction, err := prog.decode(annotation.Address)
+		if err != nil || instruction.Mnemonic != "PCHL" {
+			return nil, fmt.Errorf("stack annotation at 0x%04X is not followed by PCHL", annotation.Address)
+		}
+		dispatches[annotation.Address] = d
+	}
+	return dispatches, nil
+}
+
+// externals returns the stack depth of each routine outside the program
+// given by a "call" annotation, by address.
+func (prog Program) externals() (map[uint16]int, error) {
+	externals := map[uint16]int{}
+	for _, annotation := range prog.annotations("stack") {
+		d, err := prog.parseStack(annotation)
+		if err != nil {
+			return nil, err
+		}
+		if !d.call {
+			continue
+		}
+		for _, address := range d.targets {
+			if prog.contains(address) {
+				return nil, fmt.Errorf("stack annotation at 0x%04X: %s is inside the program", annotation.Address, prog.name(address))
+			}
+			externals[address] = d.depth
+		}
+	}
+	return externals, nil
+}
+
+func (prog Program) parseStack(annotation parser.Comment) (dispatch, error) {
+	fields := strings.Fields(annotation.Text)
+	if len(fields) > 0 {
+		fields[0] = strings.ToLower(fields[0])
+	}
+	if len(fields) == 0 || (fields[0] != "jump" && fields[0] != "tail" && fields[0] != "call") {
+		return dispatch{}, fmt.Errorf("expected \"jump\", \"tail\" or \"call\" in stack annotation at 0x%04X", annotation.Address)
+	}
+
+	d := dispatch{tail: fields[0] == "tail", call: fields[0] == "call"}
+	for _, field := range fields[1:] {
+		if value, found := strings.CutPrefix(strings.ToLower(field), "depth="); found {
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth < 0 {
+				return dispatch{}, fmt.Errorf("invalid stack depth in annotation at 0x%04X: %s", annotation.Address, value)
+			}
+			d.depth = depth
+			continue
+		}
+		address, err := prog.lookup(strings.ToUpper(field))
+		if err != nil {
+			return dispatch{}, err
+		}
+		d.targets = append(d.targets, address)
+	}
+	return d, nil
+}
@@ -0,0 +1,241 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Routine is the stack usage of one entry point or called subroutine.
+type Routine struct {
+	Name      string
+	Address   uint16
+	Entry     bool
+	MaxDepth  int      // Worst case bytes pushed below the routine's return address, including callees
+	Calls     []uint16 // Addresses of the routines this one calls
+	Recursive bool
+	External  bool // Outside the program, with MaxDepth from a ";@stack call" annotation
+}
+
+// Issue is a problem found while analysing a program.
+type Issue struct {
+	Address uint16
+	Routine string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("0x%04X in %s: %s", i.Address, i.Routine, i.Message)
+}
+
+// StackReport is the result of CheckStack.
+type StackReport struct {
+	Routines []Routine // Sorted by address
+	Issues   []Issue   // Sorted by address
+}
+
+// Routine returns the routine with the given name, if there is one.
+func (r *StackReport) Routine(name string) (Routine, bool) {
+	for _, routine := range r.Routines {
+		if routine.Name == name {
+			return routine, true
+		}
+	}
+	return Routine{}, false
+}
+
+type stackChecker struct {
+	prog       Program
+	dispatches map[uint16]dispatch
+	externals  map[uint16]int
+	routines   map[uint16]*Routine
+	active     map[uint16]bool
+	issues     []Issue
+}
+
+// CheckStack follows every path through each entry point and the routines it
+// calls, tracking the effect of each instruction on the stack pointer. It
+// reports paths that leave a routine with the stack unbalanced, and computes
+// the worst case stack depth of every routine from the call graph.
+func CheckStack(prog Program) (*StackReport, error) {
+	entries, err := prog.entries()
+	if err != nil {
+		return nil, err
+	}
+	dispatches, err := prog.dispatches()
+	if err != nil {
+		return nil, err
+	}
+	externals, err := prog.externals()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &stackChecker{
+		prog:       prog,
+		dispatches: dispatches,
+		externals:  externals,
+		routines:   make(map[uint16]*Routine),
+		active:     make(map[uint16]bool),
+	}
+	for _, entry := range entries {
+		c.routine(entry).Entry = true
+	}
+
+	report := &StackReport{Issues: c.issues}
+	for _, routine := range c.routines {
+		report.Routines = append(report.Routines, *routine)
+	}
+	sort.Slice(report.Routines, func(i, j int) bool {
+		return report.Routines[i].Address < report.Routines[j].Address
+	})
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Address < report.Issues[j].Address
+	})
+	return report, nil
+}
+
+func (c *stackChecker) report(routine *Routine, address uint16, format string, args ...any) {
+	c.issues = append(c.issues, Issue{Address: address, Routine: routine.Name, Message: fmt.Sprintf(format, args...)})
+}
+
+// routine returns the analysed routine at address, analysing it first if
+// this is the first call to it. Routines outside the program, such as CP/M's
+// BDOS, can't be followed, so their depth comes from a ";@stack call"
+// annotation, or is taken as 0 with an issue saying so.
+func (c *stackChecker) routine(address uint16) *Routine {
+	if routine, exists := c.routines[address]; exists {
+		if c.active[address] && !routine.Recursive {
+			routine.Recursive = true
+			c.report(routine, address, "recursive call, worst case stack depth is unbounded")
+		}
+		return routine
+	}
+
+	routine := &Routine{Name: c.prog.name(address), Address: address}
+	c.routines[address] = routine
+	if !c.prog.contains(address) {
+		depth, annotated := c.externals[address]
+		if !annotated {
+			c.report(routine, address, "called outside the program, give its stack depth with ;@stack call %s depth=n", routine.Name)
+		}
+		routine.External = true
+		routine.MaxDepth = depth
+		return routine
+	}
+	c.active[address] = true
+	c.walk(routine)
+	delete(c.active, address)
+	return routine
+}
+
+type pathState struct {
+	address uint16
+	depth   int
+}
+
+func (c *stackChecker) walk(routine *Routine) {
+	depths := map[uint16]int{}
+	calls := map[uint16]bool{}
+	work := []pathState{{address: routine.Address}}
+
+	for len(work) > 0 {
+		state := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		if seen, visited := depths[state.address]; visited {
+			if seen != state.depth {
+				c.report(routine, state.address, "paths join with stack depths %d and %d", seen, state.depth)
+			}
+			continue
+		}
+		depths[state.address] = state.depth
+
+		instruction, err := c.prog.decode(state.address)
+		if err != nil {
+			c.report(routine, state.address, "execution runs outside the program")
+			continue
+		}
+
+		depth := state.depth
+		successors := []uint16{}
+
+		switch flowOf(instruction) {
+		case flowNext:
+			switch {
+			case userDefined(instruction): // Taken not to use the stack
+			case instruction.Opcode&0xCF == 0xC5: // PUSH
+				depth += 2
+			case instruction.Opcode&0xCF == 0xC1: // POP
+				depth -= 2
+			case instruction.Opcode == 0x33: // INX SP
+				depth--
+			case instruction.Opcode == 0x3B: // DCX SP
+				depth++
+			case instruction.Opcode == 0x31: // LXI SP starts a new, empty stack
+				depth = 0
+			case instruction.Opcode == 0xF9: // SPHL
+				c.report(routine, instruction.Address, "SPHL makes the stack depth unknown")
+				continue
+			}
+			// XTHL swaps HL with the top of the stack without moving SP
+
+			if depth < 0 {
+				c.report(routine, instruction.Address, "%s removes the return address from the stack", instruction)
+				continue
+			}
+			successors = append(successors, next(instruction))
+
+		case flowJump:
+			successors = append(successors, target(instruction))
+
+		case flowBranch:
+			successors = append(successors, target(instruction), next(instruction))
+
+		case flowCall, flowCondCall:
+			callee := c.routine(target(instruction))
+			calls[callee.Address] = true
+			routine.MaxDepth = max(routine.MaxDepth, depth+2+callee.MaxDepth)
+			successors = append(successors, next(instruction))
+
+		case flowReturn, flowCondReturn:
+			if depth != 0 {
+				c.report(routine, instruction.Address, "%s with %d bytes still on the stack", instruction, depth)
+			}
+			if flowOf(instruction) == flowCondReturn {
+				successors = append(successors, next(instruction))
+			}
+
+		case flowIndirect:
+			d, annotated := c.dispatches[instruction.Address]
+			if !annotated {
+				c.report(routine, instruction.Address, "PCHL without a ;@stack annotation")
+				continue
+			}
+			routine.MaxDepth = max(routine.MaxDepth, depth+d.depth)
+			if !d.tail {
+				successors = append(successors, d.targets...)
+				break
+			}
+			if depth != 0 {
+				c.report(routine, instruction.Address, "PCHL tail call with %d bytes still on the stack", depth)
+			}
+			for _, address := range d.targets {
+				callee := c.routine(address)
+				calls[callee.Address] = true
+				routine.MaxDepth = max(routine.MaxDepth, depth+callee.MaxDepth)
+			}
+
+		case flowHalt:
+		}
+
+		routine.MaxDepth = max(routine.MaxDepth, depth)
+		for _, successor := range successors {
+			work = append(work, pathState{address: successor, depth: depth})
+		}
+	}
+
+	for address := range calls {
+		routine.Calls = append(routine.Calls, address)
+	}
+	sort.Slice(routine.Calls, func(i, j int) bool { return routine.Calls[i] < routine.Calls[j] })
+}
@@ -0,0 +1,293 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+)
+
+func assemble(t *testing.T, input string, options ...assembler.Option) Program {
+	t.Helper()
+	asm := assembler.New(input, options...)
+	code, err := asm.Assemble()
+	if err != nil {
+		t.Fatalf("Assembler.Assemble() error = %v", err)
+	}
+	return NewProgram(asm, code)
+}
+
+func TestCheckStack(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		options    []assembler.Option
+		wantDepths map[string]int
+		wantIssues []string
+		wantErr    bool
+	}{
+		{
+			name: "balanced routine",
+			input: `
+			START:	CALL SAVE
+					HLT
+			SAVE:	PUSH B
+					PUSH D
+					POP D
+					POP B
+					RET
+			`,
+			wantDepths: map[string]int{"START": 6, "SAVE": 4},
+		},
+		{
+			name: "nested calls",
+			input: `
+			START:	CALL OUTER
+					HLT
+			OUTER:	PUSH H
+					CALL INNER
+					POP H
+					RET
+			INNER:	PUSH PSW
+					POP PSW
+					RET
+			`,
+			wantDepths: map[string]int{"START": 8, "OUTER": 6, "INNER": 2},
+		},
+		{
+			name: "early return leaves a byte pair on the stack",
+			input: `
+			START:	CALL CHECK
+					HLT
+			CHECK:	PUSH B
+					CPI 0x00
+					RZ
+					POP B
+					RET
+			`,
+			wantIssues: []string{"RZ with 2 bytes still on the stack"},
+		},
+		{
+			name: "pop past the return address",
+			input: `
+			START:	CALL DROP
+					HLT
+			DROP:	POP H
+					RET
+			`,
+			wantIssues: []string{"POP H removes the return address from the stack"},
+		},
+		{
+			name: "paths join at different depths",
+			input: `
+			START:	JZ SKIP
+					PUSH B
+			SKIP:	HLT
+			`,
+			wantIssues: []string{"paths join with stack depths"},
+		},
+		{
+			name: "XTHL doesn't move the stack pointer",
+			input: `
+			START:	PUSH H
+					XTHL
+					POP H
+					HLT
+			`,
+			wantDepths: map[string]int{"START": 2},
+		},
+		{
+			name: "SPHL makes the depth unknown",
+			input: `
+			START:	SPHL
+					HLT
+			`,
+			wantIssues: []string{"SPHL makes the stack depth unknown"},
+		},
+		{
+			name: "recursion",
+			input: `
+			START:	CALL LOOP
+					HLT
+			LOOP:	CALL LOOP
+					RET
+			`,
+			wantIssues: []string{"recursive call"},
+		},
+		{
+			name: "restart vector",
+			input: `
+			START:	RST 1
+					HLT
+					NOP
+					NOP
+					NOP
+					NOP
+					NOP
+					NOP
+			VECTOR:	PUSH PSW
+					POP PSW
+					RET
+			`,
+			wantDepths: map[string]int{"START": 4, "VECTOR": 2},
+		},
+		{
+			name: "undocumented 8085 instructions",
+			input: `
+			.8085U
+			START:	SHLX
+					JNK SKIP
+					LHLX
+			SKIP:	PUSH B
+					POP B
+					JK START
+					HLT
+			`,
+			wantDepths: map[string]int{"START": 2},
+		},
+		{
+			name: "unannotated PCHL",
+			input: `
+			START:	PCHL
+			`,
+			wantIssues: []string{"PCHL without a ;@stack annotation"},
+		},
+		{
+			name: "PCHL annotated as a jump table",
+			input: `
+			START:	PUSH B
+					;@stack jump ONE, TWO
+					PCHL
+			ONE:	POP B
+					HLT
+			TWO:	POP B
+					HLT
+			`,
+			wantDepths: map[string]int{"START": 2},
+		},
+		{
+			name: "PCHL annotated as a tail call",
+			input: `
+			START:	CALL DISPATCH
+					HLT
+			DISPATCH:
+					;@stack tail CMD1, CMD2
+					PCHL
+			CMD1:	PUSH B
+					POP B
+					RET
+			CMD2:	PUSH B
+					PUSH D
+					POP D
+					POP B
+					RET
+			`,
+			wantDepths: map[string]int{"START": 6, "DISPATCH": 4},
+		},
+		{
+			name: "PCHL annotated with a depth",
+			input: `
+			START:	CALL DISPATCH
+					HLT
+			DISPATCH:
+					;@stack tail depth=10
+					PCHL
+			`,
+			wantDepths: map[string]int{"START": 12, "DISPATCH": 10},
+		},
+		{
+			name: "declared entry point",
+			input: `
+			;@entry IRQ
+			START:	HLT
+			IRQ:	PUSH PSW
+					POP PSW
+					RET
+			`,
+			wantDepths: map[string]int{"START": 0, "IRQ": 2},
+		},
+		{
+			name: "annotation not followed by PCHL",
+			input: `
+			;@stack jump START
+			START:	HLT
+			`,
+			wantErr: true,
+		},
+		{
+			name: "CP/M program calling BDOS",
+			input: `
+			;@stack call BDOS depth=16
+			START:	MVI C, 9
+					LXI D, MSG
+					CALL BDOS
+					RET
+			MSG:	DB 'HI$'
+			`,
+			options:    []assembler.Option{assembler.CPM()},
+			wantDepths: map[string]int{"START": 18, "BDOS": 16},
+		},
+		{
+			name: "CP/M program calling BDOS without an annotation",
+			input: `
+			START:	MVI C, 9
+					LXI D, MSG
+					CALL BDOS
+					RET
+			MSG:	DB 'HI$'
+			`,
+			options:    []assembler.Option{assembler.CPM()},
+			wantDepths: map[string]int{"START": 2, "BDOS": 0},
+			wantIssues: []string{"called outside the program, give its stack depth with ;@stack call BDOS depth=n"},
+		},
+		{
+			name: "call annotation inside the program",
+			input: `
+			;@stack call START depth=2
+			START:	HLT
+			`,
+			wantErr: true,
+		},
+		{
+			name: "annotation with unknown label",
+			input: `
+			START:	;@stack jump NOWHERE
+					PCHL
+			`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := CheckStack(assemble(t, tt.input, tt.options...))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckStack() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			for name, wantDepth := range tt.wantDepths {
+				routine, found := report.Routine(name)
+				if !found {
+					t.Errorf("CheckStack() routine %s not found", name)
+					continue
+				}
+				if routine.MaxDepth != wantDepth {
+					t.Errorf("CheckStack() %s depth = %d, want %d", name, routine.MaxDepth, wantDepth)
+				}
+			}
+
+			if len(report.Issues) != len(tt.wantIssues) {
+				t.Errorf("CheckStack() issues = %v, want %v", report.Issues, tt.wantIssues)
+				return
+			}
+			for i, want := range tt.wantIssues {
+				if !strings.Contains(report.Issues[i].Message, want) {
+					t.Errorf("CheckStack() issue = %q, want %q", report.Issues[i].Message, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package asmtest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/sim"
+)
+
+// Labels added to each test's code, so the runner can find where the test
+// starts and where each EXPECT is checked.
+const (
+	startLabel      = "ASMTESTSTART"
+	checkpointLabel = "ASMTESTCHECK"
+)
+
+// Test is a TEST block from an assembly source file. The block's code runs
+// after the program, and its EXPECT and EXPECT_MEM lines are checked at the
+// point they appear.
+type Test struct {
+	Name         string
+	Line         int
+	code         []string
+	checkpoints  [][]expectation
+	atCheckpoint bool // The last line of code is a checkpoint
+}
+
+type expectation struct {
+	line     int
+	text     string
+	memory   bool   // EXPECT_MEM rather than EXPECT
+	target   string // Register, register pair, flag or memory address
+	operands []string
+}
+
+// Result is the outcome of running one test.
+type Result struct {
+	Name     string
+	Passed   bool
+	Cycles   uint64
+	Failures []string
+}
+
+// Parse splits source into the program and its TEST blocks. A block starts
+// with "TEST name" and ends at "ENDTEST", the next TEST or the end of the
+// source. The lines of each block are blanked out of the program, so that
+// program lines keep their line numbers.
+func Parse(source string) (string, []Test, error) {
+	program := []string{}
+	tests := []Test{}
+	var current *Test
+
+	for i, line := range strings.Split(source, "\n") {
+		lineNumber := i + 1
+		code := stripComment(line)
+		fields := strings.Fields(code)
+		keyword := ""
+		if len(fields) > 0 {
+			keyword = strings.ToUpper(fields[0])
+		}
+
+		if keyword == "TEST" || current != nil {
+			program = append(program, "")
+		}
+
+		switch keyword {
+		case "TEST":
+			name := strings.TrimSpace(code[strings.Index(strings.ToUpper(code), "TEST")+len("TEST"):])
+			if name == "" {
+				return "", nil, fmt.Errorf("line %d: expected test name", lineNumber)
+			}
+			tests = append(tests, Test{Name: name, Line: lineNumber})
+			current = &tests[len(tests)-1]
+
+		case "ENDTEST":
+			if current == nil {
+				return "", nil, fmt.Errorf("line %d: ENDTEST without TEST", lineNumber)
+			}
+			current = nil
+
+		case "EXPECT", "EXPECT_MEM":
+			if current == nil {
+				return "", nil, fmt.Errorf("line %d: %s outside of a TEST block", lineNumber, keyword)
+			}
+			e, err := parseExpectation(keyword, code, lineNumber)
+			if err != nil {
+				return "", nil, err
+			}
+
+			// Consecutive expectations are checked at the same point
+			if !current.atCheckpoint {
+				current.code = append(current.code, checkpoint(len(current.checkpoints)))
+				current.checkpoints = append(current.checkpoints, []expectation{})
+				current.atCheckpoint = true
+			}
+			last := len(current.checkpoints) - 1
+			current.checkpoints[last] = append(current.checkpoints[last], e)
+
+		default:
+			if current == nil {
+				program = append(program, line)
+			} else {
+				current.code = append(current.code, line)
+				current.atCheckpoint = current.atCheckpoint && len(fields) == 0
+			}
+		}
+	}
+
+	// Every test ends at a checkpoint, even if it has no expectations after
+	// its last instruction
+	for i := range tests {
+		test := &tests[i]
+		if !test.atCheckpoint {
+			test.code = append(test.code, checkpoint(len(test.checkpoints)))
+			test.checkpoints = append(test.checkpoints, []expectation{})
+		}
+	}
+
+	return strings.Join(program, "\n"), tests, nil
+}
+
+func checkpoint(n int) string {
+	return fmt.Sprintf("%s%d: HLT", checkpointLabel, n)
+}
+
+// stripComment removes a trailing ';' comment, ignoring any inside quotes.
+func stripComment(line string) string {
+	quoted := false
+	for i, char := range line {
+		switch char {
+		case '\'':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+func parseExpectation(keyword string, code string, line int) (expectation, error) {
+	text := strings.Join(strings.Fields(code), " ")
+	operands := splitOperands(strings.TrimSpace(code[strings.Index(strings.ToUpper(code), keyword)+len(keyword):]))
+	if len(operands) < 2 {
+		return expectation{}, fmt.Errorf("line %d: expected %s target, value", line, keyword)
+	}
+
+	e := expectation{
+		line:     line,
+		text:     text,
+		memory:   keyword == "EXPECT_MEM",
+		target:   strings.ToUpper(operands[0]),
+		operands: operands[1:],
+	}
+	if !e.memory {
+		if _, valid := registerWidths[e.target]; !valid {
+			return expectation{}, fmt.Errorf("line %d: unknown register or flag for EXPECT: %s", line, operands[0])
+		}
+		if len(e.operands) != 1 {
+			return expectation{}, fmt.Errorf("line %d: expected a single value for EXPECT", line)
+		}
+	}
+	return e, nil
+}
+
+// splitOperands splits on commas outside of quotes.
+func splitOperands(s string) []string {
+	operands := []string{}
+	quoted := false
+	start := 0
+	for i, char := range s {
+		switch char {
+		case '\'':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				operands = append(operands, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		operands = append(operands, strings.TrimSpace(s[start:]))
+	}
+	return operands
+}
+
+// registerWidths is the number of bits in each register, pair and flag that
+// EXPECT can check.
+var registerWidths = map[string]int{
+	"A": 8, "B": 8, "C": 8, "D": 8, "E": 8, "H": 8, "L": 8, "M": 8,
+	"BC": 16, "DE": 16, "HL": 16, "SP": 16, "PSW": 16,
+	"S": 1, "Z": 1, "AC": 1, "P": 1, "CY": 1,
+}
+
+func readRegister(cpu *sim.CPU, name string) uint16 {
+	switch name {
+	case "A":
+		return uint16(cpu.A)
+	case "B":
+		return uint16(cpu.B)
+	case "C":
+		return uint16(cpu.C)
+	case "D":
+		return uint16(cpu.D)
+	case "E":
+		return uint16(cpu.E)
+	case "H":
+		return uint16(cpu.H)
+	case "L":
+		return uint16(cpu.L)
+	case "M":
+		return uint16(cpu.Memory[cpu.HL()])
+	case "BC":
+		return cpu.BC()
+	case "DE":
+		return cpu.DE()
+	case "HL":
+		return cpu.HL()
+	case "SP":
+		return cpu.SP
+	case "PSW":
+		return cpu.PSW()
+	}
+
+	flags := map[string]bool{"S": cpu.Flags.S, "Z": cpu.Flags.Z, "AC": cpu.Flags.AC, "P": cpu.Flags.P, "CY": cpu.Flags.CY}
+	if flags[name] {
+		return 1
+	}
+	return 0
+}
+
+// value parses a number in the same notation as the assembler (hexadecimal,
+// with an optional 0x prefix or H suffix) or looks up a label.
+func value(operand string, labels map[string]uint16) (uint16, error) {
+	operand = strings.ToUpper(operand)
+	if address, isLabel := labels[operand]; isLabel {
+		return address, nil
+	}
+
+	parsed, err := isa.ParseNumber(operand)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value: %s", operand)
+	}
+	return parsed, nil
+}
+
+// check returns a failure message for e, or an empty string if it passes.
+func (e expectation) check(cpu *sim.CPU) (string, error) {
+	if !e.memory {
+		want, err := value(e.operands[0], cpu.Labels)
+		if err != nil {
+			return "", fmt.Errorf("line %d: %w", e.line, err)
+		}
+		width := registerWidths[e.target]
+		if width < 16 && want >= 1<<width {
+			return "", fmt.Errorf("line %d: value %s doesn't fit in %s", e.line, e.operands[0], e.target)
+		}
+
+		got := readRegister(cpu, e.target)
+		if got != want {
+			return fmt.Sprintf("line %d: %s: %s = 0x%0*X, want 0x%0*X", e.line, e.text, e.target, width/4+width%4, got, width/4+width%4, want), nil
+		}
+		return "", nil
+	}
+
+	address, err := value(e.target, cpu.Labels)
+	if err != nil {
+		return "", fmt.Errorf("line %d: %w", e.line, err)
+	}
+
+	want := []byte{}
+	for _, operand := range e.operands {
+		if strings.HasPrefix(operand, "'") {
+			want = append(want, []byte(strings.Trim(operand, "'"))...)
+			continue
+		}
+		b, err := value(operand, cpu.Labels)
+		if err != nil || b > 0xFF {
+			return "", fmt.Errorf("line %d: invalid byte value: %s", e.line, operand)
+		}
+		want = append(want, byte(b))
+	}
+
+	got := make([]byte, len(want))
+	for i := range want {
+		got[i] = cpu.Memory[address+uint16(i)]
+	}
+	if string(got) != string(want) {
+		return fmt.Sprintf("line %d: %s: memory at 0x%04X = % X, want % X", e.line, e.text, address, got, want), nil
+	}
+	return "", nil
+}
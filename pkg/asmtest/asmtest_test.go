@@ -0,0 +1,192 @@
+package asmtest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const program = `
+MULT:	MOV B, H
+		MOV C, L
+		LXI H, 0x0000
+LOOP:	MOV A, D
+		ORA E
+		RZ
+		DAD B
+		DCX D
+		JMP LOOP
+
+FILL:	MOV M, A	; fill C bytes at HL with A
+		INX H
+		DCR C
+		JNZ FILL
+		RET
+
+BUFFER:	DB 0x00, 0x00, 0x00, 0x00
+`
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		tests       string
+		wantResults []Result
+		wantErr     bool
+	}{
+		{
+			name: "passing register expectations",
+			tests: `
+			TEST multiply
+					LXI H, 0x0007
+					LXI D, 0x0006
+					CALL MULT
+					EXPECT HL, 0x2A
+					EXPECT Z, 1
+			ENDTEST`,
+			wantResults: []Result{{Name: "multiply", Passed: true, Cycles: 311}},
+		},
+		{
+			name: "failing register expectation",
+			tests: `
+			TEST multiply by zero
+					LXI H, 0x0007
+					LXI D, 0x0000
+					CALL MULT
+					EXPECT HL, 0x07
+			ENDTEST`,
+			wantResults: []Result{{
+				Name:     "multiply by zero",
+				Cycles:   77,
+				Failures: []string{"line 24: EXPECT HL, 0x07: HL = 0x0000, want 0x0007"},
+			}},
+		},
+		{
+			name: "memory expectations",
+			tests: `
+			TEST fill
+					LXI H, BUFFER
+					MVI C, 0x03
+					MVI A, 5AH
+					CALL FILL
+					EXPECT_MEM BUFFER, 'ZZZ', 0x00
+					EXPECT HL, 0x0017
+					EXPECT_MEM 0x0014, 0x5A, 0x5A, 0x5A, 0x00
+			ENDTEST`,
+			wantResults: []Result{{Name: "fill", Passed: true, Cycles: 132}},
+		},
+		{
+			name: "expectations part way through a test",
+			tests: `
+			TEST two calls
+					LXI H, 0x0002
+					LXI D, 0x0003
+					CALL MULT
+					EXPECT HL, 6
+					XCHG
+					LXI H, 0x0002
+					CALL MULT
+					EXPECT HL, 0C
+					EXPECT DE, 0
+			TEST second test
+					MVI A, 0x01
+					EXPECT A, 0x02`,
+			wantResults: []Result{
+				{Name: "two calls", Passed: true, Cycles: 499},
+				{Name: "second test", Cycles: 7, Failures: []string{"line 32: EXPECT A, 0x02: A = 0x01, want 0x02"}},
+			},
+		},
+		{
+			name: "halting in the routine under test",
+			tests: `
+			TEST halts
+					HLT`,
+			wantResults: []Result{{Name: "halts", Cycles: 7, Failures: []string{"halted at 0x0018"}}},
+		},
+		{
+			name: "assembly error in a test",
+			tests: `
+			TEST bad
+					CALL NOWHERE`,
+			wantResults: []Result{{Name: "bad", Failures: []string{"line 20: label definition not found: NOWHERE"}}},
+		},
+		{
+			name: "EXPECT outside a test",
+			tests: `
+			EXPECT A, 0x00`,
+			wantErr: true,
+		},
+		{
+			name: "unknown register",
+			tests: `
+			TEST bad register
+					EXPECT Q, 0x00`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Run(program + tt.tests)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Run() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(results, tt.wantResults) {
+				t.Errorf("Run() = %+v, want %+v", results, tt.wantResults)
+			}
+		})
+	}
+}
+
+func TestRun_DataSegment(t *testing.T) {
+	// COUNT is at 0x0008, after the code, and the program ends in CSEG
+	source := `
+			DSEG
+	COUNT:	DB 0x41
+			CSEG
+	COUNTUP:	LDA COUNT
+			INR A
+			STA COUNT
+			RET
+
+	TEST count up
+			CALL COUNTUP
+			EXPECT_MEM 0x0008, 0x42
+			EXPECT_MEM COUNT, 0x42
+	ENDTEST`
+	results, err := Run(source)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := []Result{{Name: "count up", Passed: true, Cycles: 58}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Run() = %+v, want %+v", results, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	source := `
+	START:	HLT
+	TEST one
+			MVI A, 0x01 ; comment
+			EXPECT A, 0x01
+			EXPECT_MEM 0x0000, 0x76
+	ENDTEST
+	NEXT:	RET`
+
+	program, tests, err := Parse(source)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if strings.Contains(program, "TEST") || !strings.Contains(program, "NEXT:") {
+		t.Errorf("Parse() program = %q", program)
+	}
+	if len(tests) != 1 || tests[0].Name != "one" || tests[0].Line != 3 {
+		t.Fatalf("Parse() tests = %+v", tests)
+	}
+	if len(tests[0].checkpoints) != 1 || len(tests[0].checkpoints[0]) != 2 {
+		t.Errorf("Parse() checkpoints = %+v", tests[0].checkpoints)
+	}
+}
@@ -0,0 +1,115 @@
+package asmtest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+	"github.com/lukepeterson/go8080assembler/pkg/sim"
+)
+
+// Option configures the simulated CPU each test runs on, before the test
+// starts.
+type Option func(cpu *sim.CPU)
+
+// Run assembles the program in source and runs each of its TEST blocks on a
+// fresh simulated CPU.
+func Run(source string, options ...Option) ([]Result, error) {
+	program, tests, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	asm := assembler.New(program)
+	if _, err := asm.Assemble(); err != nil {
+		return nil, err
+	}
+
+	// The tests' code goes at the end of the data segment if the program
+	// has one, since it's placed after all of the code
+	segment := "CSEG"
+	for _, statement := range asm.Statements() {
+		if statement.Segment == object.Data && statement.Size > 0 {
+			segment = "DSEG"
+		}
+	}
+
+	results := []Result{}
+	for _, test := range tests {
+		result, err := test.run(program, segment, options)
+		if err != nil {
+			return nil, fmt.Errorf("test %s: %w", test.Name, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Passed reports whether every result passed.
+func Passed(results []Result) bool {
+	for _, result := range results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (t Test) run(program, segment string, options []Option) (Result, error) {
+	result := Result{Name: t.Name}
+	fail := func(format string, args ...any) (Result, error) {
+		result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+		return result, nil
+	}
+
+	// The test's code goes after everything in the program, in segment, so
+	// the program's addresses don't change
+	source := program + "\n" + segment + "\n" + startLabel + ":\n" + strings.Join(t.code, "\n") + "\n"
+	cpu, err := sim.Assemble(source)
+	if err != nil {
+		return fail("line %d: %v", t.Line, err)
+	}
+
+	checkpoints := map[uint16]int{}
+	for n := range t.checkpoints {
+		checkpoints[cpu.Labels[fmt.Sprintf("%s%d", checkpointLabel, n)]] = n
+	}
+
+	for _, option := range options {
+		option(cpu)
+	}
+
+	cpu.PC = cpu.Labels[startLabel]
+	for {
+		if err := cpu.Run(); err != nil {
+			result.Cycles = cpu.Cycles
+			return fail("%v", err)
+		}
+
+		address := cpu.PC - 1
+		n, isCheckpoint := checkpoints[address]
+		if !isCheckpoint {
+			result.Cycles = cpu.Cycles
+			return fail("halted at 0x%04X", address)
+		}
+
+		// Don't count the checkpoint's HLT
+		cpu.Cycles -= 7
+		result.Cycles = cpu.Cycles
+		for _, e := range t.checkpoints[n] {
+			failure, err := e.check(cpu)
+			if err != nil {
+				return result, err
+			}
+			if failure != "" {
+				result.Failures = append(result.Failures, failure)
+			}
+		}
+
+		if n == len(t.checkpoints)-1 {
+			result.Passed = len(result.Failures) == 0
+			return result, nil
+		}
+		cpu.Halted = false
+	}
+}
@@ -1,31 +1,237 @@
 package assembler
 
 import (
+	"path/filepath"
+
+	"github.com/lukepeterson/go8080assembler/pkg/ast"
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
 	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+	"github.com/lukepeterson/go8080assembler/pkg/memory"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
 	"github.com/lukepeterson/go8080assembler/pkg/parser"
+	"github.com/lukepeterson/go8080assembler/pkg/symbols"
+	"github.com/lukepeterson/go8080assembler/pkg/z80"
 )
 
 type Assembler struct {
-	input    string
-	bytecode []byte
+	input      string
+	bytecode   []byte
+	labels     map[string]uint16
+	predefined map[string]uint16
+	references map[string][]uint16
+	data       []parser.Region
+	comments   []parser.Comment
+	statements []parser.Statement
+	publics    []string
+	origin     uint16
+	warnings   []string
+	usage      []memory.Usage
+	defined    map[string]isa.Opcode
+
+	// Set by options
+	defaultOrigin *uint16
+	symbols       map[string]uint16
+	memoryMap     *memory.Map
+	imports       []symbols.Symbol
+	directory     string
+	cpu           isa.CPU
+	z80           bool
+	dialect       *lexer.Dialect
+	opcodes       []isa.Opcode
 }
 
-func New(input string) *Assembler {
-	return &Assembler{input: input}
+func New(input string, options ...Option) *Assembler {
+	a := &Assembler{input: input, symbols: map[string]uint16{}}
+	for _, option := range options {
+		option(a)
+	}
+	return a
 }
 
-func (a *Assembler) Assemble() ([]byte, error) {
+// Parse lexes and parses the input into its syntax tree, without
+// assembling it. The dialect, mnemonics and opcodes options apply.
+func (a *Assembler) Parse() (*ast.Program, error) {
 	l := lexer.New(a.input)
+	l.SetCPU(a.cpu)
+	if a.dialect != nil {
+		l.SetDialect(a.dialect)
+	}
+	for _, o := range a.opcodes {
+		l.AddMnemonic(o.Mnemonic)
+	}
 	tokens, err := l.Lex()
 	if err != nil {
 		return nil, err
 	}
+	if a.z80 {
+		if tokens, err = z80.Translate(tokens); err != nil {
+			return nil, err
+		}
+	}
+	return ast.Parse(tokens)
+}
+
+// newParser parses the input and returns a parser configured by the
+// assembler's options, ready to encode it.
+func (a *Assembler) newParser() (*parser.Parser, error) {
+	prog, err := a.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.FromProgram(prog)
+	p.SetCPU(a.cpu)
+	for _, o := range a.opcodes {
+		if err := p.DefineOpcode(o); err != nil {
+			return nil, err
+		}
+	}
+	if a.defaultOrigin != nil {
+		p.SetOrigin(*a.defaultOrigin)
+	}
+	if a.memoryMap != nil {
+		p.SetMemoryMap(a.memoryMap)
+	}
+	for _, s := range a.imports {
+		if err := p.Import(s); err != nil {
+			return nil, err
+		}
+	}
+	p.SetImporter(func(filename string) ([]symbols.Symbol, error) {
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(a.directory, filename)
+		}
+		return symbols.ReadFile(filename)
+	})
+	for name, value := range a.symbols {
+		p.Define(name, value)
+	}
+	return p, nil
+}
+
+func (a *Assembler) Assemble() ([]byte, error) {
+	p, err := a.newParser()
+	if err != nil {
+		return nil, err
+	}
 
-	p := parser.New(tokens)
 	a.bytecode, err = p.Parse()
 	if err != nil {
 		return nil, err
 	}
+	a.labels = p.Labels()
+	a.predefined = p.Predefined()
+	a.references = p.References()
+	a.data = p.Data()
+	a.comments = p.Comments()
+	a.statements = p.Statements()
+	a.publics = p.Publics()
+	a.defined = p.Opcodes()
+	a.origin = p.Origin()
+	a.warnings = p.Warnings()
+	a.usage = nil
+	if m := p.MemoryMap(); m != nil {
+		a.usage = m.Usage(p.Blocks())
+	}
 
 	return a.bytecode, nil
 }
+
+// AssembleObject assembles the input into a relocatable object module, to be
+// linked with other modules. Labels, statements and comments are relative to
+// their segment.
+func (a *Assembler) AssembleObject() (*object.Module, error) {
+	p, err := a.newParser()
+	if err != nil {
+		return nil, err
+	}
+
+	module, err := p.ParseObject()
+	if err != nil {
+		return nil, err
+	}
+	a.bytecode = nil
+	a.origin = 0
+	a.warnings = nil
+	a.usage = nil
+	a.labels = p.Labels()
+	a.predefined = p.Predefined()
+	a.references = p.References()
+	a.data = p.Data()
+	a.comments = p.Comments()
+	a.statements = p.Statements()
+	a.publics = p.Publics()
+	a.defined = p.Opcodes()
+
+	return module, nil
+}
+
+// Labels returns the label addresses from the last successful Assemble.
+func (a *Assembler) Labels() map[string]uint16 {
+	return a.labels
+}
+
+// Predefined returns the symbols from WithSymbols, WithImports and IMPORT,
+// from the last successful Assemble.
+func (a *Assembler) Predefined() map[string]uint16 {
+	return a.predefined
+}
+
+// References returns the addresses of the operands that refer to each label,
+// from the last successful Assemble.
+func (a *Assembler) References() map[string][]uint16 {
+	return a.references
+}
+
+// Data returns the ranges of bytes assembled from data directives, from the
+// last successful Assemble.
+func (a *Assembler) Data() []parser.Region {
+	return a.data
+}
+
+// Comments returns the source comments from the last successful Assemble.
+func (a *Assembler) Comments() []parser.Comment {
+	return a.comments
+}
+
+// Statements returns the address of every instruction and directive from the
+// last successful Assemble.
+func (a *Assembler) Statements() []parser.Statement {
+	return a.statements
+}
+
+// Publics returns the symbols declared PUBLIC, from the last successful
+// Assemble.
+func (a *Assembler) Publics() []string {
+	return a.publics
+}
+
+// CPU returns the processor the program is assembled for until it selects
+// another, from WithCPU.
+func (a *Assembler) CPU() isa.CPU {
+	return a.cpu
+}
+
+// Opcodes returns the user-defined instructions, from WithOpcodes and
+// OPCODE, by mnemonic, from the last successful Assemble.
+func (a *Assembler) Opcodes() map[string]isa.Opcode {
+	return a.defined
+}
+
+// Origin returns the address the bytecode from the last successful Assemble
+// starts at.
+func (a *Assembler) Origin() uint16 {
+	return a.origin
+}
+
+// Warnings returns the warnings from the last successful Assemble, such as
+// code placed in a RAM region of the memory map.
+func (a *Assembler) Warnings() []string {
+	return a.warnings
+}
+
+// MemoryUsage returns how much of each region of the memory map the last
+// successful Assemble used, or nil if there's no memory map.
+func (a *Assembler) MemoryUsage() []memory.Usage {
+	return a.usage
+}
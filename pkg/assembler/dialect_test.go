@@ -0,0 +1,37 @@
+package assembler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+)
+
+// TestDialects assembles the same program written for each dialect, which
+// should give the same bytes as it does in the assembler's own syntax.
+func TestDialects(t *testing.T) {
+	want := assembleFile(t, "native.asm")
+	for _, name := range []string{"asm80", "asm", "mac", "m80", "tasm"} {
+		t.Run(name, func(t *testing.T) {
+			got := assembleFile(t, name+".asm", WithDialect(lexer.Dialects[name]))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Assemble() = %X, want %X", got, want)
+			}
+		})
+	}
+}
+
+func assembleFile(t *testing.T, name string, options ...Option) []byte {
+	t.Helper()
+	source, err := os.ReadFile(filepath.Join("testdata", "dialects", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := New(string(source), options...).Assemble()
+	if err != nil {
+		t.Fatalf("%s: Assemble() error = %v", name, err)
+	}
+	return code
+}
@@ -0,0 +1,580 @@
+package assembler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/ast"
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+	"github.com/lukepeterson/go8080assembler/pkg/parser"
+)
+
+// Incremental reassembles a source file as it's edited, doing as little of
+// the work again as it can. Each line is lexed on its own, so only the
+// lines an edit touches are lexed again; statements keep their encoding
+// until their line changes; and the layout is redone from the first
+// changed line, with only the references to labels whose addresses moved
+// resolved again. The result is always the same as Assemble's.
+//
+// Programs that use segments, PHASE, MEMORY, IMPORT, PUBLIC, EXTRN or
+// OPCODE, or options other than WithOrigin, WithSymbols, WithCPU and CPM,
+// are assembled in full each time, as are programs with a string that
+// isn't closed on its line, a statement that doesn't parse or encode, or
+// an 8085 instruction's name used as a label, which is lexed differently
+// depending on the CPU.
+type Incremental struct {
+	a          *Assembler
+	predefined map[string]uint16
+	lines      []*sourceLine
+	dirty      int // First line changed since the last Assemble, from 1
+
+	// The layout from the last Assemble, up to the statement that failed
+	// if it did. Offsets are from the origin.
+	valid    bool // False until the first layout, and after falling back
+	placed   []placed
+	end      layout // Layout after the last placed statement
+	code     []byte
+	offsets  map[string]int
+	slots    []slot
+	resolved bool   // The last Assemble resolved every slot
+	origin   uint16 // Origin the slots were resolved with
+
+	full *Assembler // The assembler used in full by the last Assemble, or nil
+}
+
+// sourceLine is a line of source and what's been read from it.
+type sourceLine struct {
+	text   string
+	tokens []lexer.Token // From the line alone, on line 1, or nil until it's lexed
+	open   bool          // Has a string that isn't closed, so the lexer would read on into the next line
+	lexed  bool          // Lexed by the current Assemble
+	chunk  *chunk        // Statements starting on the line, if they start a chunk
+}
+
+// chunk is a run of lines that's parsed together: one line, or a line
+// ending in a comma and the lines with the rest of its operands.
+type chunk struct {
+	lines       int
+	statements  []ast.Statement // Lines numbered from 1 at the first line
+	encodings   []*encoding
+	err         error
+	unsupported bool // Has a statement that only a full assembly handles
+}
+
+// encoding is a statement assembled on its own, with its references to
+// labels left as zeros.
+type encoding struct {
+	cpu    isa.CPU
+	code   []byte
+	fixups []object.Fixup
+	err    error
+}
+
+// layout is where the next statement goes.
+type layout struct {
+	offset int
+	origin uint16
+	cpu    isa.CPU
+	slots  int // Number of slots before the statement
+}
+
+// placed is a label, instruction or directive laid out in the code.
+type placed struct {
+	layout
+	line      int
+	statement ast.Statement
+	size      int
+}
+
+// slot is a reference to a label in the code.
+type slot struct {
+	offset int
+	label  string
+	pos    ast.Pos
+}
+
+// NewIncremental returns an incremental assembler for input, configured
+// by options like New.
+func NewIncremental(input string, options ...Option) *Incremental {
+	inc := &Incremental{a: New("", options...), predefined: map[string]uint16{}, offsets: map[string]int{}}
+	for name, value := range inc.a.symbols {
+		inc.predefined[strings.ToUpper(name)] = value
+	}
+	for _, text := range strings.Split(input, "\n") {
+		inc.lines = append(inc.lines, &sourceLine{text: text})
+	}
+	inc.dirty = 1
+	return inc
+}
+
+// Input returns the source as it is after the edits so far.
+func (inc *Incremental) Input() string {
+	texts := make([]string, len(inc.lines))
+	for i, l := range inc.lines {
+		texts[i] = l.text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Edit replaces the source from start up to end with text. Positions are
+// lines and byte columns, starting at 1, in the source as it is before the
+// edit.
+func (inc *Incremental) Edit(start ast.Pos, end ast.Pos, text string) error {
+	valid := func(p ast.Pos) bool {
+		return p.Line >= 1 && p.Line <= len(inc.lines) && p.Column >= 1 && p.Column <= len(inc.lines[p.Line-1].text)+1
+	}
+	if !valid(start) || !valid(end) || end.Line < start.Line || end.Line == start.Line && end.Column < start.Column {
+		return fmt.Errorf("invalid edit from %s to %s", start, end)
+	}
+
+	edited := inc.lines[start.Line-1].text[:start.Column-1] + text + inc.lines[end.Line-1].text[end.Column-1:]
+	replacements := []*sourceLine{}
+	for _, text := range strings.Split(edited, "\n") {
+		replacements = append(replacements, &sourceLine{text: text})
+	}
+	lines := append([]*sourceLine{}, inc.lines[:start.Line-1]...)
+	lines = append(lines, replacements...)
+	inc.lines = append(lines, inc.lines[end.Line:]...)
+	inc.dirty = min(inc.dirty, start.Line)
+	return nil
+}
+
+// Assemble assembles the source as it is after the edits so far.
+func (inc *Incremental) Assemble() ([]byte, error) {
+	a := inc.a
+	if a.dialect != nil || a.z80 || a.memoryMap != nil || len(a.imports) > 0 || len(a.opcodes) > 0 {
+		return inc.assembleAll()
+	}
+
+	for _, l := range inc.lines {
+		l.lexed = l.tokens == nil
+		if l.lexed {
+			l.lex()
+		}
+	}
+
+	// Parse the chunks that changed. A chunk that starts before the first
+	// changed line but runs into it moves the start of the layout back.
+	restart := inc.dirty
+	inc.dirty = len(inc.lines) + 1
+	fallback := false
+	for i := 0; i < len(inc.lines); {
+		n := inc.extent(i)
+		head := inc.lines[i]
+		changed := head.chunk == nil || head.chunk.lines != n
+		for j := i; j < i+n; j++ {
+			changed = changed || inc.lines[j].lexed
+			fallback = fallback || inc.lines[j].open
+			if j > i {
+				inc.lines[j].chunk = nil
+			}
+		}
+		if changed {
+			head.chunk = inc.parse(i, n)
+			restart = min(restart, i+1)
+		}
+		fallback = fallback || head.chunk.err != nil || head.chunk.unsupported
+		i += n
+	}
+	if fallback {
+		return inc.assembleAll()
+	}
+
+	inc.full = nil
+	return inc.layout(restart)
+}
+
+// assembleAll assembles the source in full, for programs the incremental
+// layout doesn't handle.
+func (inc *Incremental) assembleAll() ([]byte, error) {
+	inc.valid = false
+	inc.resolved = false
+	inc.dirty = len(inc.lines) + 1
+	a := *inc.a
+	a.input = inc.Input()
+	inc.full = &a
+	return a.Assemble()
+}
+
+// lex lexes the line on its own.
+func (l *sourceLine) lex() {
+	tokens, _ := lexer.New(l.text).Lex()
+	l.tokens = tokens[:len(tokens)-1]
+	l.open = false
+	for _, token := range l.tokens {
+		closing := token.Column + len(token.Literal)
+		if token.Type == lexer.STRING && (closing >= len(l.text) || l.text[closing] != '\'') {
+			l.open = true
+		}
+	}
+}
+
+// extent returns the number of lines in the chunk starting at line i,
+// counting from 0. Operands continue onto the next line with text after a
+// comma.
+func (inc *Incremental) extent(i int) int {
+	n := 1
+	last := lexer.Token{}
+	for ; i+n <= len(inc.lines); n++ {
+		if tokens := inc.lines[i+n-1].tokens; len(tokens) > 0 {
+			last = tokens[len(tokens)-1]
+		}
+		if last.Type != lexer.COMMA {
+			return n
+		}
+	}
+	return n - 1
+}
+
+// parse parses the chunk of n lines starting at line i, counting from 0.
+func (inc *Incremental) parse(i int, n int) *chunk {
+	c := &chunk{lines: n}
+	tokens := []lexer.Token{}
+	for j := range n {
+		for _, token := range inc.lines[i+j].tokens {
+			token.Line = j + 1
+			tokens = append(tokens, token)
+		}
+	}
+	tokens = append(tokens, lexer.Token{Type: lexer.EOF, Line: n})
+	prog, err := ast.Parse(tokens)
+	if err != nil {
+		c.err = err
+		return c
+	}
+	c.statements = prog.Statements
+	c.encodings = make([]*encoding, len(prog.Statements))
+	for _, s := range prog.Statements {
+		if d, ok := s.(*ast.Directive); ok && !laidOut(d) {
+			c.unsupported = true
+		}
+		if namesInstruction(s) {
+			c.unsupported = true
+		}
+	}
+	return c
+}
+
+// namesInstruction reports whether a statement defines or refers to a label
+// named after an 8085 instruction. Lines are lexed without knowing the CPU,
+// which decides whether the name is a label or a mnemonic.
+func namesInstruction(s ast.Statement) bool {
+	var operands []ast.Operand
+	switch s := s.(type) {
+	case *ast.Label:
+		return isa.Requires(s.Name) != isa.I8080
+	case *ast.Instruction:
+		operands = s.Operands
+	case *ast.Directive:
+		operands = s.Operands
+	}
+	for _, o := range operands {
+		if name, ok := o.(*ast.Name); ok && isa.Requires(name.Name) != isa.I8080 {
+			return true
+		}
+	}
+	return false
+}
+
+// laidOut reports whether the incremental layout handles a directive:
+// DB, ORG with an address, and CPU selection.
+func laidOut(d *ast.Directive) bool {
+	switch d.Name {
+	case "DB":
+		return true
+	case "ORG":
+		if len(d.Operands) != 1 {
+			return false
+		}
+		number, ok := d.Operands[0].(*ast.Number)
+		if !ok {
+			return false
+		}
+		_, err := number.Value()
+		return err == nil
+	case ".8080", ".8085", ".8085U":
+		return len(d.Operands) == 0
+	}
+	return false
+}
+
+// encode assembles a statement on its own. Labels it refers to are
+// declared EXTRN, so the parser leaves them as fixups.
+func encode(s ast.Statement, cpu isa.CPU) *encoding {
+	var operands []ast.Operand
+	switch s := s.(type) {
+	case *ast.Instruction:
+		operands = s.Operands
+	case *ast.Directive:
+		operands = s.Operands
+	}
+	prog := &ast.Program{}
+	declared := map[string]bool{}
+	for _, o := range operands {
+		if name, ok := o.(*ast.Name); ok && !declared[name.Name] {
+			declared[name.Name] = true
+			prog.Statements = append(prog.Statements, &ast.Directive{Name: "EXTRN", Operands: []ast.Operand{name}})
+		}
+	}
+	prog.Statements = append(prog.Statements, s)
+	p := parser.FromProgram(prog)
+	p.SetCPU(cpu)
+	module, err := p.ParseObject()
+	if err != nil {
+		return &encoding{cpu: cpu, err: err}
+	}
+	return &encoding{cpu: cpu, code: module.Code, fixups: module.Fixups}
+}
+
+// layout lays out the statements from line restart on, reusing the layout
+// of the ones before it, and resolves the label references.
+func (inc *Incremental) layout(restart int) ([]byte, error) {
+	if !inc.valid {
+		restart = 1
+		inc.placed = inc.placed[:0]
+		clear(inc.offsets)
+	}
+	k := sort.Search(len(inc.placed), func(i int) bool { return inc.placed[i].line >= restart })
+	state := layout{cpu: inc.a.cpu}
+	if inc.a.defaultOrigin != nil {
+		state.origin = *inc.a.defaultOrigin
+	}
+	if k < len(inc.placed) {
+		state = inc.placed[k].layout
+	} else if inc.valid {
+		state = inc.end
+	}
+
+	// Forget the labels and references from restart on
+	moved := map[string]uint16{} // Labels from restart on, and their addresses before
+	for _, p := range inc.placed[k:] {
+		if label, ok := p.statement.(*ast.Label); ok {
+			moved[label.Name] = inc.origin + uint16(inc.offsets[label.Name])
+			delete(inc.offsets, label.Name)
+		}
+	}
+	inc.valid = true
+	inc.placed = inc.placed[:k]
+	inc.code = inc.code[:state.offset]
+	inc.slots = inc.slots[:state.slots]
+	prefixSlots := state.slots
+
+	err := inc.place(restart, &state)
+	inc.end = state
+	if errors.Is(err, errAssembleAll) {
+		return inc.assembleAll()
+	}
+	if err != nil {
+		// The statements after the one that failed haven't been laid out
+		inc.valid = false
+	} else if int(state.origin)+len(inc.code) > 0x10000 {
+		err = fmt.Errorf("program doesn't fit in memory from origin 0x%04X", state.origin)
+	}
+	if err != nil {
+		inc.resolved = false
+		return nil, err
+	}
+
+	// Labels laid out again have moved if their address changed, or they
+	// were added or removed. Every label moves with the origin.
+	all := !inc.resolved || state.origin != inc.origin
+	changed := map[string]bool{}
+	for _, p := range inc.placed[k:] {
+		if label, ok := p.statement.(*ast.Label); ok {
+			if before, found := moved[label.Name]; !found || before != state.origin+uint16(inc.offsets[label.Name]) {
+				changed[label.Name] = true
+			}
+			delete(moved, label.Name)
+		}
+	}
+	for name := range moved {
+		changed[name] = true
+	}
+	inc.origin = state.origin
+	for i := range inc.slots {
+		s := inc.slots[i]
+		if i < prefixSlots && !all && !changed[s.label] {
+			continue
+		}
+		address, found := inc.address(s.label)
+		if !found {
+			inc.resolved = false
+			return nil, &parser.Error{Line: s.pos.Line, Column: s.pos.Column, Err: fmt.Errorf("label definition not found: %s", s.label)}
+		}
+		inc.code[s.offset] = uint8(address & 0x00FF)
+		inc.code[s.offset+1] = uint8(address >> 8)
+	}
+	inc.resolved = true
+	return append([]byte{}, inc.code...), nil
+}
+
+// errAssembleAll is returned by place for a statement that only a full
+// assembly can report the error in.
+var errAssembleAll = errors.New("assemble in full")
+
+// place lays out the statements from line restart on.
+func (inc *Incremental) place(restart int, state *layout) error {
+	for i := restart - 1; i < len(inc.lines); i++ {
+		c := inc.lines[i].chunk
+		if c == nil {
+			continue
+		}
+		for j, s := range c.statements {
+			pos := s.Pos()
+			pos.Line += i
+			p := placed{layout: *state, line: pos.Line, statement: s}
+			switch s := s.(type) {
+			case *ast.Comment:
+				continue
+			case *ast.Label:
+				if _, defined := inc.offsets[s.Name]; defined {
+					return &parser.Error{Line: pos.Line, Column: pos.Column, Err: fmt.Errorf("duplicate label found: %s", s.Name)}
+				}
+				inc.offsets[s.Name] = state.offset
+				inc.placed = append(inc.placed, p)
+				continue
+			case *ast.Directive:
+				switch s.Name {
+				case ".8080", ".8085", ".8085U":
+					state.cpu, _ = isa.ParseCPU(s.Name)
+					inc.placed = append(inc.placed, p)
+					continue
+				case "ORG":
+					address, _ := s.Operands[0].(*ast.Number).Value()
+					if state.offset == 0 {
+						state.origin = address
+						inc.placed = append(inc.placed, p)
+						continue
+					}
+					offset := int(address) - int(state.origin)
+					if offset < state.offset {
+						return &parser.Error{Line: pos.Line, Column: pos.Column, Err: fmt.Errorf("ORG 0x%04X overlaps the %d bytes before it, which end at 0x%04X", address, state.offset-offset, int(address)+state.offset-offset-1)}
+					}
+					p.size = offset - state.offset
+					inc.code = append(inc.code, make([]byte, p.size)...)
+					state.offset = offset
+					inc.placed = append(inc.placed, p)
+					continue
+				}
+			}
+
+			e := c.encodings[j]
+			if e == nil || e.cpu != state.cpu {
+				e = encode(s, state.cpu)
+				c.encodings[j] = e
+			}
+			if e.err != nil {
+				// The parser's message can depend on the tokens after the
+				// statement, which it didn't see
+				return errAssembleAll
+			}
+			names := names(s)
+			for n, f := range e.fixups {
+				// Each fixup is for the next name in the operands
+				at := pos
+				if n < len(names) {
+					at = names[n].Position
+					at.Line += i
+				}
+				inc.slots = append(inc.slots, slot{offset: state.offset + int(f.Offset), label: f.Name, pos: at})
+			}
+			p.size = len(e.code)
+			inc.code = append(inc.code, e.code...)
+			state.offset += p.size
+			state.slots = len(inc.slots)
+			inc.placed = append(inc.placed, p)
+			if len(inc.code) > 0x10000 {
+				return &parser.Error{Line: pos.Line, Column: pos.Column, Err: fmt.Errorf("%s segment is larger than 64K", object.Code)}
+			}
+		}
+	}
+	return nil
+}
+
+// names returns the names in a statement's operands.
+func names(s ast.Statement) []*ast.Name {
+	var operands []ast.Operand
+	switch s := s.(type) {
+	case *ast.Instruction:
+		operands = s.Operands
+	case *ast.Directive:
+		operands = s.Operands
+	}
+	names := []*ast.Name{}
+	for _, o := range operands {
+		if name, ok := o.(*ast.Name); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// address returns the address of a label or predefined symbol.
+func (inc *Incremental) address(name string) (uint16, bool) {
+	if offset, found := inc.offsets[name]; found {
+		return inc.origin + uint16(offset), true
+	}
+	value, found := inc.predefined[name]
+	return value, found
+}
+
+// Labels returns the label addresses from the last Assemble, if it
+// succeeded.
+func (inc *Incremental) Labels() map[string]uint16 {
+	if inc.full != nil {
+		return inc.full.Labels()
+	}
+	labels := map[string]uint16{}
+	for name, offset := range inc.offsets {
+		labels[name] = inc.origin + uint16(offset)
+	}
+	return labels
+}
+
+// References returns the addresses of the operands that refer to each label,
+// from the last Assemble, if it succeeded.
+func (inc *Incremental) References() map[string][]uint16 {
+	if inc.full != nil {
+		return inc.full.References()
+	}
+	references := map[string][]uint16{}
+	for _, s := range inc.slots {
+		references[s.label] = append(references[s.label], inc.origin+uint16(s.offset))
+	}
+	return references
+}
+
+// Statements returns the address of every instruction and directive from the
+// last Assemble, if it succeeded.
+func (inc *Incremental) Statements() []parser.Statement {
+	if inc.full != nil {
+		return inc.full.Statements()
+	}
+	statements := []parser.Statement{}
+	for _, p := range inc.placed {
+		mnemonic := ""
+		switch s := p.statement.(type) {
+		case *ast.Instruction:
+			mnemonic = s.Mnemonic
+		case *ast.Directive:
+			mnemonic = s.Name
+		default:
+			continue
+		}
+		statements = append(statements, parser.Statement{Line: p.line, Mnemonic: mnemonic, Segment: object.Code, Address: inc.origin + uint16(p.offset), Size: p.size})
+	}
+	return statements
+}
+
+// Origin returns the address the bytecode from the last Assemble starts at,
+// if it succeeded.
+func (inc *Incremental) Origin() uint16 {
+	if inc.full != nil {
+		return inc.full.Origin()
+	}
+	return inc.origin
+}
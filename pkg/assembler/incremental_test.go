@@ -0,0 +1,408 @@
+package assembler
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/ast"
+	"github.com/lukepeterson/go8080assembler/pkg/parser"
+)
+
+const incrementalProgram = `; Copies a block of memory
+START:  LXI H, SOURCE
+        LXI D, DEST
+        MVI B, 04H
+LOOP:   MOV A, M      ; Next byte
+        STAX D
+        INX H
+        INX D
+        DCR B
+        JNZ LOOP
+        CALL DONE
+        HLT
+DONE:   RET
+SOURCE: DB 01H, 02H,
+           03H, 04H
+DEST:   DB 00H, 00H, 00H, 00H`
+
+// edit replaces the text from column start on line up to column end on
+// endLine, or on line if there's no endLine.
+type edit struct {
+	line    int
+	start   int
+	endLine int
+	end     int
+	text    string
+}
+
+// TestIncremental makes a series of edits to a program, assembling after
+// each one, which should give the same result as assembling the edited
+// program in full.
+func TestIncremental(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		options []Option
+		edits   []edit
+	}{
+		{
+			name:  "change an operand",
+			input: incrementalProgram,
+			edits: []edit{{line: 4, start: 16, end: 19, text: "10H"}},
+		},
+		{
+			name:  "insert an instruction",
+			input: incrementalProgram,
+			edits: []edit{{line: 3, start: 1, end: 1, text: "        NOP\n"}},
+		},
+		{
+			name:  "delete a line",
+			input: incrementalProgram,
+			edits: []edit{{line: 7, start: 1, endLine: 8, end: 1, text: ""}, {line: 6, start: 14, endLine: 7, end: 14, text: ""}},
+		},
+		{
+			name:  "rename a label",
+			input: incrementalProgram,
+			edits: []edit{{line: 13, start: 1, end: 5, text: "EXIT"}, {line: 11, start: 14, end: 18, text: "EXIT"}},
+		},
+		{
+			name:  "undefined label and back",
+			input: incrementalProgram,
+			edits: []edit{{line: 10, start: 13, end: 17, text: "LOPE"}, {line: 10, start: 13, end: 17, text: "LOOP"}},
+		},
+		{
+			name:  "duplicate label and back",
+			input: incrementalProgram,
+			edits: []edit{{line: 13, start: 1, end: 5, text: "LOOP"}, {line: 13, start: 1, end: 5, text: "DONE"}},
+		},
+		{
+			name:  "invalid instruction and back",
+			input: incrementalProgram,
+			edits: []edit{{line: 6, start: 9, end: 13, text: "STAX Q"}, {line: 6, start: 9, end: 15, text: "STAX D"}},
+		},
+		{
+			name:  "statement that doesn't parse and back",
+			input: incrementalProgram,
+			edits: []edit{{line: 7, start: 9, end: 9, text: ", "}, {line: 7, start: 9, end: 11, text: ""}},
+		},
+		{
+			name:  "join a continued line",
+			input: incrementalProgram,
+			edits: []edit{{line: 14, start: 20, end: 21, text: ""}, {line: 15, start: 1, end: 1, text: "        DB "}},
+		},
+		{
+			name:  "continue a line",
+			input: incrementalProgram,
+			edits: []edit{{line: 16, start: 29, end: 29, text: ",\n  00H"}},
+		},
+		{
+			name:  "ORG",
+			input: "        ORG 100H\n" + incrementalProgram,
+			edits: []edit{{line: 1, start: 13, end: 17, text: "200H"}, {line: 13, start: 1, end: 1, text: "        ORG 220H\n"}},
+		},
+		{
+			name:  "ORG overlaps",
+			input: "        ORG 100H\n" + incrementalProgram + "\n        ORG 130H\nEND:    NOP",
+			edits: []edit{{line: 4, start: 1, end: 1, text: "        DB 00H, 00H, 00H, 00H, 00H, 00H, 00H, 00H\n"}, {line: 4, start: 1, end: 1, text: "        DB 00H, 00H, 00H, 00H, 00H, 00H, 00H, 00H\n"}},
+		},
+		{
+			name:  "CPU",
+			input: "        .8085\n" + incrementalProgram + "\n        RIM",
+			edits: []edit{{line: 1, start: 9, end: 14, text: ".8080"}, {line: 1, start: 9, end: 14, text: ".8085"}},
+		},
+		{
+			name:  "8085 instruction names as labels",
+			input: incrementalProgram + "\nJK:     JMP JK",
+			edits: []edit{{line: 1, start: 1, end: 1, text: "        .8085U\n"}, {line: 1, start: 1, endLine: 2, end: 1, text: ""}},
+		},
+		{
+			name:    "options",
+			input:   incrementalProgram + "\n        CALL BDOS",
+			options: []Option{CPM()},
+			edits:   []edit{{line: 2, start: 1, end: 1, text: "BDOS:   NOP\n"}, {line: 2, start: 1, endLine: 3, end: 1, text: ""}},
+		},
+		{
+			name:  "string across lines",
+			input: incrementalProgram,
+			edits: []edit{{line: 16, start: 29, end: 29, text: ", 'AB"}, {line: 16, start: 34, end: 34, text: "'"}},
+		},
+		{
+			name:  "PHASE falls back",
+			input: incrementalProgram + "\nCOPY:   PHASE 8000H\n        JMP COPY\n        DEPHASE",
+			edits: []edit{{line: 18, start: 13, end: 17, text: "COPY_LEN"}, {line: 2, start: 1, end: 1, text: "        NOP\n"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inc := NewIncremental(test.input, test.options...)
+			checkIncremental(t, inc, test.options)
+			for _, e := range test.edits {
+				end := ast.Pos{Line: e.endLine, Column: e.end}
+				if e.endLine == 0 {
+					end.Line = e.line
+				}
+				if err := inc.Edit(ast.Pos{Line: e.line, Column: e.start}, end, e.text); err != nil {
+					t.Fatalf("Edit() error = %v", err)
+				}
+				checkIncremental(t, inc, test.options)
+			}
+		})
+	}
+}
+
+// TestIncremental_Random makes random edits to a program, assembling after
+// each one. Most edits add, remove or replace a line, so the program
+// usually assembles; the rest break a line and mend it with the next edit.
+func TestIncremental_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(8080))
+	lines := []string{
+		"        NOP",
+		"L#:     JMP LOOP",
+		"        CALL DONE",
+		"        LXI H, SOURCE",
+		"        MVI A, 04H",
+		"L#:",
+		"        DB 01H, 02H",
+		"        .8085",
+		"        .8080",
+		"; Note",
+		"",
+	}
+	// Continued lines are left out, as deleting one line of a pair leaves
+	// a statement that doesn't parse, and the program's own labels are
+	// kept, so that most versions assemble
+	inc := NewIncremental(strings.Replace(incrementalProgram, ",\n          ", ",", 1))
+	kept := regexp.MustCompile(`^(START|LOOP|DONE|SOURCE|DEST):`)
+	var broken *ast.Pos // Where the last edit inserted a quote
+	for i := range 1000 {
+		input := strings.Split(inc.Input(), "\n")
+		line := r.Intn(len(input)) + 1
+		start, end := ast.Pos{Line: line, Column: 1}, ast.Pos{Line: line, Column: 1}
+		text := strings.Replace(lines[r.Intn(len(lines))], "#", fmt.Sprint(i), 1) + "\n"
+		removable := line < len(input) && !kept.MatchString(input[line-1])
+		switch {
+		case broken != nil:
+			start, end, text = *broken, ast.Pos{Line: broken.Line, Column: broken.Column + 1}, ""
+			broken = nil
+		case r.Intn(10) == 0:
+			broken, text = &start, "'"
+		case r.Intn(3) == 0 && removable:
+			end.Line++
+			text = ""
+		case r.Intn(3) == 0 && removable:
+			end.Line++
+		}
+		if err := inc.Edit(start, end, text); err != nil {
+			t.Fatalf("edit %d: Edit() error = %v", i, err)
+		}
+		if !checkIncremental(t, inc, nil) {
+			t.Fatalf("edit %d: input:\n%s", i, inc.Input())
+		}
+	}
+}
+
+func TestIncremental_Edit(t *testing.T) {
+	tests := []struct {
+		name    string
+		start   ast.Pos
+		end     ast.Pos
+		text    string
+		want    string
+		wantErr string
+	}{
+		{name: "insert", start: ast.Pos{Line: 2, Column: 1}, end: ast.Pos{Line: 2, Column: 1}, text: "LOOP: ", want: "NOP\nLOOP: INR A\nHLT"},
+		{name: "replace across lines", start: ast.Pos{Line: 1, Column: 2}, end: ast.Pos{Line: 3, Column: 2}, text: "OP\nJMP 0H\nH", want: "NOP\nJMP 0H\nHLT"},
+		{name: "end of the last line", start: ast.Pos{Line: 3, Column: 4}, end: ast.Pos{Line: 3, Column: 4}, text: "\n", want: "NOP\nINR A\nHLT\n"},
+		{name: "line out of range", start: ast.Pos{Line: 4, Column: 1}, end: ast.Pos{Line: 4, Column: 1}, wantErr: "invalid edit from 4:1 to 4:1"},
+		{name: "column out of range", start: ast.Pos{Line: 1, Column: 1}, end: ast.Pos{Line: 1, Column: 5}, wantErr: "invalid edit from 1:1 to 1:5"},
+		{name: "end before start", start: ast.Pos{Line: 2, Column: 3}, end: ast.Pos{Line: 2, Column: 2}, wantErr: "invalid edit from 2:3 to 2:2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inc := NewIncremental("NOP\nINR A\nHLT")
+			err := inc.Edit(test.start, test.end, test.text)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("Edit() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Edit() error = %v", err)
+			}
+			if got := inc.Input(); got != test.want {
+				t.Errorf("Input() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestIncremental_Relex checks that only the lines an edit touches are
+// lexed again.
+func TestIncremental_Relex(t *testing.T) {
+	inc := NewIncremental(incrementalProgram)
+	if _, err := inc.Assemble(); err != nil {
+		t.Fatal(err)
+	}
+	if err := inc.Edit(ast.Pos{Line: 4, Column: 16}, ast.Pos{Line: 5, Column: 1}, "10H\nMID:    NOP\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inc.Assemble(); err != nil {
+		t.Fatal(err)
+	}
+	lexed := []int{}
+	for i, l := range inc.lines {
+		if l.lexed {
+			lexed = append(lexed, i+1)
+		}
+	}
+	if want := []int{4, 5, 6}; !reflect.DeepEqual(lexed, want) {
+		t.Errorf("lines lexed = %v, want %v", lexed, want)
+	}
+}
+
+// checkIncremental assembles inc, and compares the result with assembling
+// its input in full.
+func checkIncremental(t *testing.T, inc *Incremental, options []Option) bool {
+	t.Helper()
+	a := New(inc.Input(), options...)
+	want, wantErr := a.Assemble()
+	got, err := inc.Assemble()
+	if fmt.Sprint(err) != fmt.Sprint(wantErr) {
+		t.Errorf("Assemble() error = %v, want %v", err, wantErr)
+		return false
+	}
+	if err != nil {
+		if !reflect.DeepEqual(errorPosition(err), errorPosition(wantErr)) {
+			t.Errorf("Assemble() error position = %v, want %v", errorPosition(err), errorPosition(wantErr))
+			return false
+		}
+		return true
+	}
+	ok := true
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Assemble() = %X, want %X", got, want)
+		ok = false
+	}
+	if inc.Origin() != a.Origin() {
+		t.Errorf("Origin() = 0x%04X, want 0x%04X", inc.Origin(), a.Origin())
+		ok = false
+	}
+	if !reflect.DeepEqual(inc.Labels(), a.Labels()) {
+		t.Errorf("Labels() = %v, want %v", inc.Labels(), a.Labels())
+		ok = false
+	}
+	if len(inc.References()) > 0 || len(a.References()) > 0 {
+		if !reflect.DeepEqual(inc.References(), a.References()) {
+			t.Errorf("References() = %v, want %v", inc.References(), a.References())
+			ok = false
+		}
+	}
+	if len(inc.Statements()) > 0 || len(a.Statements()) > 0 {
+		if !reflect.DeepEqual(inc.Statements(), a.Statements()) {
+			t.Errorf("Statements() = %v, want %v", inc.Statements(), a.Statements())
+			ok = false
+		}
+	}
+	return ok
+}
+
+func errorPosition(err error) []int {
+	if e, ok := err.(*parser.Error); ok {
+		return []int{e.Line, e.Column}
+	}
+	return nil
+}
+
+// benchmarkProgram returns a program of about n lines, made of copies of
+// a routine with its own labels.
+func benchmarkProgram(n int) string {
+	var b strings.Builder
+	for i := 0; i*10 < n; i++ {
+		fmt.Fprintf(&b, "COPY%d:  LXI H, DATA%d\n", i, i)
+		fmt.Fprintf(&b, "        MVI B, 04H\n")
+		fmt.Fprintf(&b, "LOOP%d:  MOV A, M\n", i)
+		fmt.Fprintf(&b, "        STAX D\n")
+		fmt.Fprintf(&b, "        INX H\n")
+		fmt.Fprintf(&b, "        DCR B\n")
+		fmt.Fprintf(&b, "        JNZ LOOP%d\n", i)
+		fmt.Fprintf(&b, "        CALL COPY0\n")
+		fmt.Fprintf(&b, "        RET\n")
+		fmt.Fprintf(&b, "DATA%d:  DB 01H, 02H, 03H, 04H\n", i)
+	}
+	return b.String()
+}
+
+// BenchmarkAssemble assembles a program in full, as an editor would after
+// each change without Incremental.
+func BenchmarkAssemble(b *testing.B) {
+	input := benchmarkProgram(3000)
+	for range b.N {
+		if _, err := New(input).Assemble(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkIncremental_ChangeOperand changes an operand in the middle of
+// a program, which moves no labels.
+func BenchmarkIncremental_ChangeOperand(b *testing.B) {
+	inc := NewIncremental(benchmarkProgram(3000))
+	if _, err := inc.Assemble(); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	operands := []string{"08H", "04H"}
+	for i := range b.N {
+		inc.Edit(ast.Pos{Line: 1502, Column: 16}, ast.Pos{Line: 1502, Column: 19}, operands[i%2])
+		if _, err := inc.Assemble(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkIncremental_InsertLine adds and removes an instruction near the
+// end of a program, which moves the labels after it.
+func BenchmarkIncremental_InsertLine(b *testing.B) {
+	inc := NewIncremental(benchmarkProgram(3000))
+	if _, err := inc.Assemble(); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := range b.N {
+		if i%2 == 0 {
+			inc.Edit(ast.Pos{Line: 2900, Column: 1}, ast.Pos{Line: 2900, Column: 1}, "        NOP\n")
+		} else {
+			inc.Edit(ast.Pos{Line: 2900, Column: 1}, ast.Pos{Line: 2901, Column: 1}, "")
+		}
+		if _, err := inc.Assemble(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkIncremental_InsertLineAtTop adds and removes an instruction at
+// the start of a program, which moves every label.
+func BenchmarkIncremental_InsertLineAtTop(b *testing.B) {
+	inc := NewIncremental(benchmarkProgram(3000))
+	if _, err := inc.Assemble(); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := range b.N {
+		if i%2 == 0 {
+			inc.Edit(ast.Pos{Line: 1, Column: 1}, ast.Pos{Line: 1, Column: 1}, "        NOP\n")
+		} else {
+			inc.Edit(ast.Pos{Line: 1, Column: 1}, ast.Pos{Line: 2, Column: 1}, "")
+		}
+		if _, err := inc.Assemble(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package assembler
+
+import (
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+	"github.com/lukepeterson/go8080assembler/pkg/memory"
+	"github.com/lukepeterson/go8080assembler/pkg/symbols"
+)
+
+// Option configures an Assembler.
+type Option func(a *Assembler)
+
+// WithOrigin assembles the program at address, unless it sets its own with
+// ORG.
+func WithOrigin(address uint16) Option {
+	return func(a *Assembler) {
+		a.defaultOrigin = &address
+	}
+}
+
+// WithSymbols predefines symbols that the program can refer to like labels.
+// A label with the same name replaces the predefined value.
+func WithSymbols(symbols map[string]uint16) Option {
+	return func(a *Assembler) {
+		for name, value := range symbols {
+			a.symbols[name] = value
+		}
+	}
+}
+
+// WithImports defines absolute symbols read from symbol files, as if the
+// program imported them with IMPORT.
+func WithImports(imports ...symbols.Symbol) Option {
+	return func(a *Assembler) {
+		a.imports = append(a.imports, imports...)
+	}
+}
+
+// WithDirectory sets the directory that the symbol files named by IMPORT
+// are relative to, which is usually the one containing the source. The
+// default is the current directory.
+func WithDirectory(directory string) Option {
+	return func(a *Assembler) {
+		a.directory = directory
+	}
+}
+
+// WithMemoryMap places the program in the regions of m and checks that it
+// fits, as if it started with a MEMORY directive for each region. Unless
+// the origin is set, code starts at the first executable region, and the
+// data segment follows the code in its RAM region, or else goes in the
+// first RAM region after the code.
+func WithMemoryMap(m *memory.Map) Option {
+	return func(a *Assembler) {
+		a.memoryMap = m
+	}
+}
+
+// WithCPU assembles the program for cpu, unless it selects another with
+// .8080, .8085 or .8085U. The default is the 8080.
+func WithCPU(cpu isa.CPU) Option {
+	return func(a *Assembler) {
+		a.cpu = cpu
+	}
+}
+
+// WithDialect reads the program as source written for another assembler,
+// such as lexer.MAC or lexer.TASM, with its conventions for numbers,
+// labels, comments, strings and directive names.
+func WithDialect(d *lexer.Dialect) Option {
+	return func(a *Assembler) {
+		a.dialect = d
+	}
+}
+
+// WithOpcodes adds instructions that aren't part of the 8080, such as the
+// ones a custom core puts in unused opcode slots. Programs can also define
+// them with the OPCODE directive.
+func WithOpcodes(opcodes ...isa.Opcode) Option {
+	return func(a *Assembler) {
+		a.opcodes = append(a.opcodes, opcodes...)
+	}
+}
+
+// Z80Mnemonics reads the program as Z80 mnemonics, such as LD A,(HL), rather
+// than Intel's. Only the instructions the 8080 has can be used.
+func Z80Mnemonics() Option {
+	return func(a *Assembler) {
+		a.z80 = true
+	}
+}
+
+// CPMSymbols are the page zero and TPA addresses of a CP/M system.
+var CPMSymbols = map[string]uint16{
+	"BOOT": 0x0000, // Warm boot
+	"BDOS": 0x0005, // BDOS entry point
+	"FCB":  0x005C, // Default file control block
+	"FCB2": 0x006C, // Second file name from the command line
+	"BUFF": 0x0080, // Default DMA buffer and command tail
+	"TPA":  0x0100, // Start of the transient program area
+}
+
+// CPM assembles programs for CP/M: the origin defaults to 0100H, and
+// CPMSymbols are predefined.
+func CPM() Option {
+	return func(a *Assembler) {
+		WithOrigin(0x0100)(a)
+		WithSymbols(CPMSymbols)(a)
+	}
+}
@@ -0,0 +1,15 @@
+*       Prints a message through the BDOS, for CP/M ASM
+        ORG     100H
+START   LXI     D,MESSAGE
+        MVI     C,9
+        CALL    BDOS$ENTRY
+        MVI     B,10
+LOOP    DCR     B
+        JNZ     LOOP
+        ANI     1111$0000B
+        CPI     'A'
+        RST     0
+MESSAGE DB      'IT''S DONE',13,10,'$'
+BDOS$ENTRY:
+        JMP     5
+        END     START
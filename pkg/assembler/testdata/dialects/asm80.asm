@@ -0,0 +1,17 @@
+$TITLE('DIALECT TEST') NOLIST
+        NAME    DIALECT
+; Prints a message through the BDOS, for ISIS-II ASM80
+        ORG     100H
+START:  LXI     D,MESSAGE
+        MVI     C,9
+        CALL    BDOS?ENTRY
+        MVI     B,10
+LOOP:   DCR     B
+        JNZ     LOOP
+        ANI     360Q
+        CPI     'A'
+        RST     0
+MESSAGE: DB     'IT''S DONE',13,10,'$'
+BDOS?ENTRY:
+        JMP     5
+        END     START
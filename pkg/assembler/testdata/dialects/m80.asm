@@ -0,0 +1,18 @@
+        TITLE   Dialect test
+        .XLIST
+; Prints a message through the BDOS, for Microsoft MACRO-80
+        ORG     100H
+START:  LXI     D,MESSAGE
+        MVI     C,9
+        CALL    BDOS$ENTRY
+        MVI     B,10
+LOOP:   DCR     B
+        JNZ     LOOP
+        ANI     0F0H
+        CPI     "A"
+        RST     0
+MESSAGE: DEFM   "IT'S DONE"
+        DEFB    13,10,'$'
+BDOS$ENTRY:
+        JMP     5
+        END     START
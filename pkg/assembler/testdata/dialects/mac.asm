@@ -0,0 +1,17 @@
+        TITLE   'DIALECT TEST'
+        PAGE    60
+*       Prints a message through the BDOS, for CP/M MAC and RMAC
+        ORG     100H
+START   LXI     D,MESSAGE
+        MVI     C,9
+        CALL    ?BDOS$ENTRY
+        MVI     B,10
+LOOP:   DCR     B
+        JNZ     LOOP
+        ANI     0F0H
+        CPI     'A'
+        RST     0
+MESSAGE DB      'IT''S DONE',13,10,'$'
+?BDOS$ENTRY:
+        JMP     0005H
+        END     START
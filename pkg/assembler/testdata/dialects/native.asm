@@ -0,0 +1,14 @@
+; Prints a message through the BDOS, in the assembler's own syntax
+        ORG 100H
+START:  LXI D, MESSAGE
+        MVI C, 09H
+        CALL BDOS_ENTRY
+        MVI B, 0AH
+LOOP:   DCR B
+        JNZ LOOP
+        ANI 0F0H
+        CPI 41H
+        RST 0
+MESSAGE: DB 'IT', 27H, 'S DONE', 0DH, 0AH, 24H
+BDOS_ENTRY:
+        JMP 5H
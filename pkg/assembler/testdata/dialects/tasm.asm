@@ -0,0 +1,16 @@
+; Prints a message through the BDOS, for the Telemark Cross Assembler
+        .ORG    $100
+START   LXI     D,MESSAGE
+        MVI     C,9
+        CALL    BDOS_ENTRY
+        MVI     B,10
+LOOP    DCR     B
+        JNZ     LOOP
+        ANI     %11110000
+        CPI     'A'
+        RST     0
+MESSAGE .TEXT   "IT'S DONE"
+        .DB     $0D,$0A,'$'
+BDOS_ENTRY
+        JMP     5
+        .END
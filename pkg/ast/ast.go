@@ -0,0 +1,121 @@
+// Package ast represents an assembly program as a list of statements with
+// their positions in the source, so that tools such as formatters and
+// editors can work with its structure without assembling it. Parse builds
+// the tree from the lexer's tokens, and parser.FromProgram assembles it.
+package ast
+
+import (
+	"fmt"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+)
+
+// Pos is a position in the source. Lines and columns start at 1, and
+// columns count bytes.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Node is any part of the tree.
+type Node interface {
+	Pos() Pos
+}
+
+// Statement is a *Label, *Instruction, *Directive or *Comment.
+type Statement interface {
+	Node
+	statementNode()
+}
+
+// Operand is a *Register, *Number, *Name or *String.
+type Operand interface {
+	Node
+	operandNode()
+}
+
+// Program is a parsed program.
+type Program struct {
+	Statements []Statement
+	End        Pos // Position of the end of the source
+}
+
+// Label defines a name for the address of the next statement.
+type Label struct {
+	Position Pos
+	Name     string
+}
+
+// Instruction is an instruction and its operands, such as MVI A, 10H. The
+// mnemonic may not be one the assembler has: that's reported when it's
+// encoded.
+type Instruction struct {
+	Position Pos
+	Mnemonic string
+	Operands []Operand
+}
+
+// Directive is an assembler directive and its operands, such as ORG 100H.
+type Directive struct {
+	Position Pos
+	Name     string
+	Operands []Operand
+}
+
+// Comment is a comment, including the semicolon.
+type Comment struct {
+	Position Pos
+	Text     string
+}
+
+// Register is a register or register pair, such as A, M, SP or PSW.
+type Register struct {
+	Position Pos
+	Name     string
+}
+
+// Number is a number, written in hex.
+type Number struct {
+	Position Pos
+	Literal  string
+}
+
+// Name is a reference to a label or symbol, or a keyword operand such as a
+// memory region's access.
+type Name struct {
+	Position Pos
+	Name     string
+}
+
+// String is a quoted string.
+type String struct {
+	Position Pos
+	Value    string
+}
+
+func (s *Label) Pos() Pos       { return s.Position }
+func (s *Instruction) Pos() Pos { return s.Position }
+func (s *Directive) Pos() Pos   { return s.Position }
+func (s *Comment) Pos() Pos     { return s.Position }
+func (o *Register) Pos() Pos    { return o.Position }
+func (o *Number) Pos() Pos      { return o.Position }
+func (o *Name) Pos() Pos        { return o.Position }
+func (o *String) Pos() Pos      { return o.Position }
+
+func (*Label) statementNode()       {}
+func (*Instruction) statementNode() {}
+func (*Directive) statementNode()   {}
+func (*Comment) statementNode()     {}
+func (*Register) operandNode()      {}
+func (*Number) operandNode()        {}
+func (*Name) operandNode()          {}
+func (*String) operandNode()        {}
+
+// Value returns the value of the number.
+func (o *Number) Value() (uint16, error) {
+	return isa.ParseNumber(o.Literal)
+}
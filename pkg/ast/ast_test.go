@@ -0,0 +1,80 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	source := "; Program\n\tORG 100H\nSTART:\tMVI A, 'A' ; Letter\nLOOP: OUT 1\n\tJMP LOOP\n\tDB 'OK', 0"
+	want := &Program{
+		Statements: []Statement{
+			&Comment{Position: Pos{1, 1}, Text: "; Program"},
+			&Directive{Position: Pos{2, 2}, Name: "ORG", Operands: []Operand{&Number{Position: Pos{2, 6}, Literal: "100H"}}},
+			&Label{Position: Pos{3, 1}, Name: "START"},
+			&Instruction{Position: Pos{3, 8}, Mnemonic: "MVI", Operands: []Operand{
+				&Register{Position: Pos{3, 12}, Name: "A"},
+				&String{Position: Pos{3, 15}, Value: "A"},
+			}},
+			&Comment{Position: Pos{3, 19}, Text: "; Letter"},
+			&Label{Position: Pos{4, 1}, Name: "LOOP"},
+			&Instruction{Position: Pos{4, 7}, Mnemonic: "OUT", Operands: []Operand{&Number{Position: Pos{4, 11}, Literal: "1"}}},
+			&Instruction{Position: Pos{5, 2}, Mnemonic: "JMP", Operands: []Operand{&Name{Position: Pos{5, 6}, Name: "LOOP"}}},
+			&Directive{Position: Pos{6, 2}, Name: "DB", Operands: []Operand{
+				&String{Position: Pos{6, 5}, Value: "OK"},
+				&Number{Position: Pos{6, 11}, Literal: "0"},
+			}},
+		},
+		End: Pos{6, 12},
+	}
+
+	got, err := ParseSource(source)
+	if err != nil {
+		t.Fatalf("ParseSource() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSource() got:")
+		for _, s := range got.Statements {
+			t.Errorf("  %s %#v", s.Pos(), s)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr string
+	}{
+		{"NOP\nMOV A B", "line 2: expected comma, got: B"},
+		{"DB 1,", "line 1: expected operand after comma, got: "},
+		{"DB 1, START:", "line 1: expected operand after comma, got: START"},
+		{"MVI A, 1\n2", "line 2: unexpected token type \"NUMBER\", literal: \"2\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := ParseSource(tt.source)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParseSource() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNumber_Value(t *testing.T) {
+	tests := []struct {
+		literal string
+		want    uint16
+		wantErr bool
+	}{
+		{"10", 0x10, false},
+		{"0FFH", 0xFF, false},
+		{"0X1234", 0x1234, false},
+		{"10000", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := (&Number{Literal: tt.literal}).Value()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Number{%s}.Value() = 0x%04X, %v, want 0x%04X", tt.literal, got, err, tt.want)
+		}
+	}
+}
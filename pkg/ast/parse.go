@@ -0,0 +1,134 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+)
+
+// ParseSource lexes and parses a program written in the assembler's own
+// syntax.
+func ParseSource(source string) (*Program, error) {
+	tokens, err := lexer.New(source).Lex()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(tokens)
+}
+
+// Parse builds the tree for a program from its tokens. Only its structure
+// is checked: whether instructions and directives have the operands they
+// need is left to the encoder. An instruction's operands start on its line,
+// and are separated by commas.
+func Parse(tokens []lexer.Token) (*Program, error) {
+	r := reader{tokens: tokens}
+	prog := &Program{}
+	for r.peek().Type != lexer.EOF {
+		token := r.next()
+		switch token.Type {
+		case lexer.COMMENT:
+			prog.Statements = append(prog.Statements, &Comment{Position: pos(token), Text: token.Literal})
+
+		case lexer.LABEL, lexer.MNEMONIC:
+			if token.Type == lexer.LABEL && r.peek().Type == lexer.COLON {
+				r.next()
+				prog.Statements = append(prog.Statements, &Label{Position: pos(token), Name: token.Literal})
+				continue
+			}
+			operands, err := r.operands(token)
+			if err != nil {
+				return nil, err
+			}
+			if isa.IsDirective(token.Literal) {
+				prog.Statements = append(prog.Statements, &Directive{Position: pos(token), Name: token.Literal, Operands: operands})
+			} else {
+				prog.Statements = append(prog.Statements, &Instruction{Position: pos(token), Mnemonic: token.Literal, Operands: operands})
+			}
+
+		default:
+			return nil, fmt.Errorf("line %d: unexpected token type \"%s\", literal: \"%s\"", token.Line, token.Type, token.Literal)
+		}
+	}
+	prog.End = pos(r.peek())
+	return prog, nil
+}
+
+type reader struct {
+	tokens   []lexer.Token
+	position int
+}
+
+func (r *reader) peek() lexer.Token {
+	if r.position < len(r.tokens) {
+		return r.tokens[r.position]
+	}
+	if n := len(r.tokens); n > 0 {
+		return lexer.Token{Type: lexer.EOF, Line: r.tokens[n-1].Line}
+	}
+	return lexer.Token{Type: lexer.EOF, Line: 1}
+}
+
+func (r *reader) next() lexer.Token {
+	token := r.peek()
+	if r.position < len(r.tokens) {
+		r.position++
+	}
+	return token
+}
+
+// operands reads the operands of an instruction or directive.
+func (r *reader) operands(mnemonic lexer.Token) ([]Operand, error) {
+	operands := []Operand{}
+	first := r.peek()
+	if first.Line != mnemonic.Line || !r.isOperand(first) {
+		// OPCODE can name one of the assembler's mnemonics, which is then
+		// reported as already defined
+		if first.Line != mnemonic.Line || mnemonic.Literal != "OPCODE" || first.Type != lexer.MNEMONIC {
+			return operands, nil
+		}
+	}
+	for {
+		token := r.next()
+		operands = append(operands, operand(token))
+		next := r.peek()
+		if next.Type != lexer.COMMA {
+			if next.Line == token.Line && r.isOperand(next) {
+				return nil, fmt.Errorf("line %d: expected comma, got: %s", next.Line, next.Literal)
+			}
+			return operands, nil
+		}
+		r.next()
+		if !r.isOperand(r.peek()) {
+			return nil, fmt.Errorf("line %d: expected operand after comma, got: %s", next.Line, r.peek().Literal)
+		}
+	}
+}
+
+// isOperand reports whether token can be an operand, which a label's name
+// followed by a colon can't.
+func (r *reader) isOperand(token lexer.Token) bool {
+	switch token.Type {
+	case lexer.REGISTER, lexer.NUMBER, lexer.STRING:
+		return true
+	case lexer.LABEL:
+		return r.position+1 >= len(r.tokens) || r.tokens[r.position+1].Type != lexer.COLON
+	}
+	return false
+}
+
+func operand(token lexer.Token) Operand {
+	switch token.Type {
+	case lexer.REGISTER:
+		return &Register{Position: pos(token), Name: token.Literal}
+	case lexer.NUMBER:
+		return &Number{Position: pos(token), Literal: token.Literal}
+	case lexer.STRING:
+		return &String{Position: pos(token), Value: token.Literal}
+	}
+	return &Name{Position: pos(token), Name: token.Literal}
+}
+
+func pos(token lexer.Token) Pos {
+	return Pos{Line: token.Line, Column: token.Column}
+}
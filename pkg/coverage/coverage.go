@@ -0,0 +1,170 @@
+package coverage
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/parser"
+	"github.com/lukepeterson/go8080assembler/pkg/sim"
+)
+
+// Recorder counts how many times each instruction is executed on the CPUs
+// it's attached to, and which way each conditional jump, call and return
+// went.
+type Recorder struct {
+	hits     map[uint16]uint64
+	taken    map[uint16]uint64
+	notTaken map[uint16]uint64
+}
+
+// NewRecorder returns a Recorder with nothing recorded.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		hits:     map[uint16]uint64{},
+		taken:    map[uint16]uint64{},
+		notTaken: map[uint16]uint64{},
+	}
+}
+
+// Attach records every instruction cpu executes from now on. Any StepHook
+// already set is still called.
+func (r *Recorder) Attach(cpu *sim.CPU) {
+	previous := cpu.StepHook
+	cpu.StepHook = func(address uint16, next uint16) {
+		r.record(cpu.Memory[address], address, next)
+		if previous != nil {
+			previous(address, next)
+		}
+	}
+}
+
+func (r *Recorder) record(opcode byte, address uint16, next uint16) {
+	r.hits[address]++
+	if length, conditional := conditionalLength(opcode); conditional {
+		if next != address+length {
+			r.taken[address]++
+		} else {
+			r.notTaken[address]++
+		}
+	}
+}
+
+// Hits returns how many times the instruction at address was executed.
+func (r *Recorder) Hits(address uint16) uint64 {
+	return r.hits[address]
+}
+
+// conditionalLength returns the length of a conditional jump, call or
+// return instruction, and reports whether opcode is one.
+func conditionalLength(opcode byte) (uint16, bool) {
+	switch opcode & 0xC7 {
+	case 0xC0: // Rcc
+		return 1, true
+	case 0xC2, 0xC4: // Jcc, Ccc
+		return 3, true
+	}
+	return 0, false
+}
+
+// Line is the coverage of one executable source line.
+type Line struct {
+	Number   int
+	Address  uint16
+	Hits     uint64
+	Branch   bool // The line is a conditional jump, call or return
+	Taken    uint64
+	NotTaken uint64
+}
+
+// Profile is the coverage of one source file.
+type Profile struct {
+	Filename string
+	Source   string
+	Lines    []Line // Executable lines, in source order
+}
+
+// conditional reports whether mnemonic is a conditional jump, call or
+// return.
+func conditional(mnemonic string) bool {
+	mnemonic = strings.ToUpper(mnemonic)
+	for _, prefix := range []string{"J", "C", "R"} {
+		condition, found := strings.CutPrefix(mnemonic, prefix)
+		if found && slices.Contains([]string{"NZ", "Z", "NC", "C", "PO", "PE", "P", "M"}, condition) {
+			return true
+		}
+	}
+	return false
+}
+
+// Profile returns the coverage of a program assembled from source, using
+// the statements from its assembly. Directives aren't executable, so they
+// aren't included.
+func (r *Recorder) Profile(filename string, source string, statements []parser.Statement) *Profile {
+	profile := &Profile{Filename: filename, Source: source, Lines: []Line{}}
+	for _, statement := range statements {
+		if statement.Size == 0 || isa.IsDirective(statement.Mnemonic) {
+			continue
+		}
+
+		line := Line{Number: statement.Line, Address: statement.Address, Hits: r.hits[statement.Address]}
+		line.Branch = conditional(statement.Mnemonic)
+		line.Taken = r.taken[statement.Address]
+		line.NotTaken = r.notTaken[statement.Address]
+
+		// Several instructions on one line count as one line, which is
+		// covered if any of them ran
+		last := len(profile.Lines) - 1
+		if last >= 0 && profile.Lines[last].Number == line.Number {
+			merged := &profile.Lines[last]
+			merged.Hits = max(merged.Hits, line.Hits)
+			merged.Branch = merged.Branch || line.Branch
+			merged.Taken += line.Taken
+			merged.NotTaken += line.NotTaken
+			continue
+		}
+		profile.Lines = append(profile.Lines, line)
+	}
+	return profile
+}
+
+// Covered returns the number of executable lines that ran at least once, and
+// the number of executable lines.
+func (p *Profile) Covered() (int, int) {
+	covered := 0
+	for _, line := range p.Lines {
+		if line.Hits > 0 {
+			covered++
+		}
+	}
+	return covered, len(p.Lines)
+}
+
+// Branches returns the number of branch directions taken at least once, and
+// the number of branch directions. Each conditional instruction has two.
+func (p *Profile) Branches() (int, int) {
+	covered, total := 0, 0
+	for _, line := range p.Lines {
+		if !line.Branch {
+			continue
+		}
+		total += 2
+		if line.Taken > 0 {
+			covered++
+		}
+		if line.NotTaken > 0 {
+			covered++
+		}
+	}
+	return covered, total
+}
+
+// Percent returns the percentage of executable lines that ran, or 100 if
+// there are none.
+func (p *Profile) Percent() float64 {
+	covered, total := p.Covered()
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
@@ -0,0 +1,176 @@
+package coverage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+	"github.com/lukepeterson/go8080assembler/pkg/sim"
+)
+
+const source = `MVI C, 0x03
+LOOP:	DCR C
+JNZ LOOP
+CZ DONE
+HLT
+DONE:	RET
+DB 0x01, 0x02`
+
+// run assembles and runs source with a recorder attached, and returns its
+// profile.
+func run(t *testing.T, source string) *Profile {
+	t.Helper()
+	asm := assembler.New(source)
+	code, err := asm.Assemble()
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+
+	cpu := sim.New()
+	cpu.Load(asm.Origin(), code)
+	cpu.PC = asm.Origin()
+	cpu.SP = 0xFF00
+	recorder := NewRecorder()
+	recorder.Attach(cpu)
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	return recorder.Profile("loop.asm", source, asm.Statements())
+}
+
+func TestRecorder_Profile(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		wantLines    []Line
+		wantCovered  int
+		wantBranches int
+	}{
+		{
+			name:  "loop and conditional call",
+			input: source,
+			wantLines: []Line{
+				{Number: 1, Address: 0x0000, Hits: 1},
+				{Number: 2, Address: 0x0002, Hits: 3},
+				{Number: 3, Address: 0x0003, Hits: 3, Branch: true, Taken: 2, NotTaken: 1},
+				{Number: 4, Address: 0x0006, Hits: 1, Branch: true, Taken: 1},
+				{Number: 5, Address: 0x0009, Hits: 1},
+				{Number: 6, Address: 0x000A, Hits: 1},
+			},
+			wantCovered:  6,
+			wantBranches: 3,
+		},
+		{
+			name: "code that never runs",
+			input: `JMP END
+MVI A, 0x01
+END:	HLT`,
+			wantLines: []Line{
+				{Number: 1, Address: 0x0000, Hits: 1},
+				{Number: 2, Address: 0x0003, Hits: 0},
+				{Number: 3, Address: 0x0005, Hits: 1},
+			},
+			wantCovered: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := run(t, tt.input)
+			if !reflect.DeepEqual(profile.Lines, tt.wantLines) {
+				t.Errorf("Lines = %+v, want %+v", profile.Lines, tt.wantLines)
+			}
+			if covered, _ := profile.Covered(); covered != tt.wantCovered {
+				t.Errorf("Covered() = %d, want %d", covered, tt.wantCovered)
+			}
+			if branches, _ := profile.Branches(); branches != tt.wantBranches {
+				t.Errorf("Branches() = %d, want %d", branches, tt.wantBranches)
+			}
+		})
+	}
+}
+
+func TestRecorder_AttachKeepsStepHook(t *testing.T) {
+	cpu, err := sim.Assemble("NOP\nHLT")
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+	steps := 0
+	cpu.StepHook = func(address uint16, next uint16) { steps++ }
+
+	recorder := NewRecorder()
+	recorder.Attach(cpu)
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if steps != 2 || recorder.Hits(0x0000) != 1 || recorder.Hits(0x0001) != 1 {
+		t.Errorf("steps = %d, hits = %d, %d, want 2, 1, 1", steps, recorder.Hits(0x0000), recorder.Hits(0x0001))
+	}
+}
+
+func TestWriters(t *testing.T) {
+	profile := run(t, "JMP END\nMVI A, 0x01\nEND:\tJZ END\nHLT\n")
+
+	tests := []struct {
+		name  string
+		write func(b *strings.Builder) error
+		want  string
+	}{
+		{
+			name:  "listing",
+			write: func(b *strings.Builder) error { return profile.WriteListing(b) },
+			want: `        1: 0000 JMP END
+    #####: 0003 MVI A, 0x01
+        1: 0005 END:	JZ END	[taken 0, not taken 1]
+        1: 0008 HLT
+
+3 of 4 lines covered (75.0%)
+1 of 2 branches covered
+`,
+		},
+		{
+			name:  "LCOV",
+			write: func(b *strings.Builder) error { return WriteLCOV(b, profile) },
+			want: `TN:
+SF:loop.asm
+BRDA:3,0,0,0
+BRDA:3,0,1,1
+BRF:2
+BRH:1
+DA:1,1
+DA:2,0
+DA:3,1
+DA:4,1
+LF:4
+LH:3
+end_of_record
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &strings.Builder{}
+			if err := tt.write(b); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	profile := run(t, "JMP END\nMVI A, 0x01\nEND:\tHLT\n")
+	b := &strings.Builder{}
+	if err := WriteHTML(b, profile); err != nil {
+		t.Fatalf("WriteHTML() error = %v", err)
+	}
+	for _, want := range []string{"loop.asm (66.7%)", `class="uncovered"`, "MVI A, 0x01", `class="covered"`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("WriteHTML() output doesn't contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+func (p *Profile) sourceLines() []string {
+	return strings.Split(strings.TrimSuffix(p.Source, "\n"), "\n")
+}
+
+func (p *Profile) byNumber() map[int]Line {
+	lines := map[int]Line{}
+	for _, line := range p.Lines {
+		lines[line.Number] = line
+	}
+	return lines
+}
+
+func branchSummary(line Line) string {
+	if !line.Branch {
+		return ""
+	}
+	return fmt.Sprintf("taken %d, not taken %d", line.Taken, line.NotTaken)
+}
+
+// WriteListing writes the source with each line prefixed by its execution
+// count and address. Lines that never ran are marked "#####", and lines
+// that aren't executable "-". Conditional instructions are followed by how
+// often they were taken.
+func (p *Profile) WriteListing(w io.Writer) error {
+	b := &strings.Builder{}
+	lines := p.byNumber()
+	for i, text := range p.sourceLines() {
+		line, executable := lines[i+1]
+		switch {
+		case !executable:
+			fmt.Fprintf(b, "%9s:      %s\n", "-", text)
+			continue
+		case line.Hits == 0:
+			fmt.Fprintf(b, "%9s: %04X %s", "#####", line.Address, text)
+		default:
+			fmt.Fprintf(b, "%9d: %04X %s", line.Hits, line.Address, text)
+		}
+		if line.Branch {
+			fmt.Fprintf(b, "\t[%s]", branchSummary(line))
+		}
+		b.WriteString("\n")
+	}
+
+	covered, total := p.Covered()
+	fmt.Fprintf(b, "\n%d of %d lines covered (%.1f%%)\n", covered, total, p.Percent())
+	if branches, branchTotal := p.Branches(); branchTotal > 0 {
+		fmt.Fprintf(b, "%d of %d branches covered\n", branches, branchTotal)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteLCOV writes the profiles in the LCOV tracefile format read by genhtml
+// and most coverage tools. Each conditional instruction is a block with two
+// branches, taken and not taken.
+func WriteLCOV(w io.Writer, profiles ...*Profile) error {
+	b := &strings.Builder{}
+	b.WriteString("TN:\n")
+	for _, p := range profiles {
+		fmt.Fprintf(b, "SF:%s\n", p.Filename)
+		for _, line := range p.Lines {
+			if !line.Branch {
+				continue
+			}
+			for branch, count := range []uint64{line.Taken, line.NotTaken} {
+				// A branch on a line that never ran is reported as "-"
+				hits := "-"
+				if line.Hits > 0 {
+					hits = fmt.Sprint(count)
+				}
+				fmt.Fprintf(b, "BRDA:%d,0,%d,%s\n", line.Number, branch, hits)
+			}
+		}
+		if branches, total := p.Branches(); total > 0 {
+			fmt.Fprintf(b, "BRF:%d\nBRH:%d\n", total, branches)
+		}
+		for _, line := range p.Lines {
+			fmt.Fprintf(b, "DA:%d,%d\n", line.Number, line.Hits)
+		}
+		covered, total := p.Covered()
+		fmt.Fprintf(b, "LF:%d\nLH:%d\n", total, covered)
+		b.WriteString("end_of_record\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; }
+.covered { background: #c8f0c8; }
+.uncovered { background: #f0c8c8; }
+.partial { background: #f0e8b0; }
+.count { color: #808080; display: inline-block; width: 8em; text-align: right; }
+</style>
+</head>
+<body>
+{{range .}}<h2>{{.Filename}} ({{printf "%.1f" .Percent}}%)</h2>
+<pre>
+{{range .Lines}}<span class="{{.Class}}" title="{{.Title}}"><span class="count">{{.Count}}</span>  {{.Text}}</span>
+{{end}}</pre>
+{{end}}</body>
+</html>
+`))
+
+type htmlLine struct {
+	Class string
+	Title string
+	Count string
+	Text  string
+}
+
+type htmlFile struct {
+	Filename string
+	Percent  float64
+	Lines    []htmlLine
+}
+
+// WriteHTML writes the profiles as an HTML page, with covered lines in
+// green, uncovered lines in red and branches only taken one way in yellow.
+func WriteHTML(w io.Writer, profiles ...*Profile) error {
+	files := []htmlFile{}
+	for _, p := range profiles {
+		file := htmlFile{Filename: p.Filename, Percent: p.Percent()}
+		lines := p.byNumber()
+		for i, text := range p.sourceLines() {
+			h := htmlLine{Text: text}
+			if line, executable := lines[i+1]; executable {
+				h.Count = fmt.Sprint(line.Hits)
+				h.Title = branchSummary(line)
+				switch {
+				case line.Hits == 0:
+					h.Class = "uncovered"
+				case line.Branch && (line.Taken == 0 || line.NotTaken == 0):
+					h.Class = "partial"
+				default:
+					h.Class = "covered"
+				}
+			}
+			file.Lines = append(file.Lines, h)
+		}
+		files = append(files, file)
+	}
+	return htmlTemplate.Execute(w, files)
+}
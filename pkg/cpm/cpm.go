@@ -0,0 +1,81 @@
+// Package cpm writes programs in the file formats CP/M and MP/M load: .COM
+// files, which run at 0100H, and page relocatable .PRL files, which can be
+// loaded on any page boundary.
+package cpm
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+)
+
+// TPA is the address CP/M loads .COM files at.
+const TPA = 0x0100
+
+// WriteCOM writes bytecode assembled at origin as a .COM file. CP/M always
+// loads them at 0100H, so that's the only origin allowed.
+func WriteCOM(out io.Writer, origin uint16, bytecode []byte) error {
+	if origin != TPA {
+		return fmt.Errorf("a .COM file must start at 0x%04X, not 0x%04X", TPA, origin)
+	}
+	_, err := out.Write(bytecode)
+	return err
+}
+
+// PRL assembles source as a page relocatable program, and returns the .PRL
+// file: a 256-byte header, the code assembled at 0000H, and a bitmap with a
+// bit set, most significant first, for each byte of the code that holds the
+// high byte of an address and so must have the load page added to it.
+//
+// The bitmap is found by assembling the source a second time at 0100H and
+// comparing the two. The program can't set its own origin with ORG. The
+// options apply to both assemblies, after the CP/M symbols are defined.
+func PRL(source string, options ...assembler.Option) ([]byte, error) {
+	low, err := assemble(source, 0x0000, options)
+	if err != nil {
+		return nil, err
+	}
+	high, err := assemble(source, 0x0100, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(low) != len(high) {
+		return nil, fmt.Errorf("program is %d bytes at 0x0000 but %d bytes at 0x0100", len(low), len(high))
+	}
+
+	bitmap := make([]byte, (len(low)+7)/8)
+	for i := range low {
+		switch high[i] - low[i] {
+		case 0:
+		case 1:
+			bitmap[i/8] |= 0x80 >> (i % 8)
+		default:
+			return nil, fmt.Errorf("byte at 0x%04X isn't page relocatable: 0x%02X at 0x0000, 0x%02X at 0x0100", i, low[i], high[i])
+		}
+	}
+
+	// Bytes 1 and 2 of the header are the code length, and bytes 4 and 5
+	// the extra memory the program needs beyond it, which is none
+	header := make([]byte, 0x100)
+	header[1] = byte(len(low))
+	header[2] = byte(len(low) >> 8)
+	return slices.Concat(header, low, bitmap), nil
+}
+
+func assemble(source string, origin uint16, options []assembler.Option) ([]byte, error) {
+	options = append([]assembler.Option{assembler.CPM()}, options...)
+	asm := assembler.New(source, append(options, assembler.WithOrigin(origin))...)
+	bytecode, err := asm.Assemble()
+	if err != nil {
+		return nil, err
+	}
+	for _, statement := range asm.Statements() {
+		if strings.EqualFold(statement.Mnemonic, "ORG") {
+			return nil, fmt.Errorf("line %d: a page relocatable program can't use ORG", statement.Line)
+		}
+	}
+	return bytecode, nil
+}
@@ -0,0 +1,87 @@
+package cpm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteCOM(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  uint16
+		wantErr bool
+	}{
+		{name: "TPA", origin: 0x0100},
+		{name: "wrong origin", origin: 0x0000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			err := WriteCOM(b, tt.origin, []byte{0xC9})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteCOM() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(b.Bytes(), []byte{0xC9}) {
+				t.Errorf("WriteCOM() wrote %X, want C9", b.Bytes())
+			}
+		})
+	}
+}
+
+func TestPRL(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantCode   []byte
+		wantBitmap []byte
+		wantErr    bool
+	}{
+		{
+			name: "relocates addresses but not BDOS",
+			input: `START:	LXI D, MSG
+MVI C, 0x09
+CALL BDOS
+JMP START
+MSG:	DB 0x24`,
+			wantCode: []byte{
+				0x11, 0x0B, 0x00, // LXI D, MSG
+				0x0E, 0x09, // MVI C, 0x09
+				0xCD, 0x05, 0x00, // CALL BDOS
+				0xC3, 0x00, 0x00, // JMP START
+				0x24,
+			},
+			// High bytes of MSG (offset 2) and START (offset 10)
+			wantBitmap: []byte{0x20, 0x20},
+		},
+		{
+			name:    "ORG",
+			input:   "ORG 0x0100\nRET",
+			wantErr: true,
+		},
+		{
+			name:    "assembly error",
+			input:   "JMP NOWHERE",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PRL(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PRL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			header := make([]byte, 0x100)
+			header[1] = byte(len(tt.wantCode))
+			want := append(append(header, tt.wantCode...), tt.wantBitmap...)
+			if !bytes.Equal(got, want) {
+				t.Errorf("PRL() = %X, want %X", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package disassembler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+)
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		origin  uint16
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "single byte instructions",
+			code: []byte{0x00, 0x78, 0x76, 0xC9, 0xF5},
+			want: []string{"NOP", "MOV A, B", "HLT", "RET", "PUSH PSW"},
+		},
+		{
+			name: "immediate data",
+			code: []byte{0x3E, 0x33, 0xDB, 0x44, 0xFE, 0x0A},
+			want: []string{"MVI A, 0x33", "IN 0x44", "CPI 0x0A"},
+		},
+		{
+			name: "addresses",
+			code: []byte{0x21, 0x34, 0x12, 0xC3, 0x00, 0x01, 0xCD, 0xFF, 0xFF},
+			want: []string{"LXI H, 0x1234", "JMP 0x0100", "CALL 0xFFFF"},
+		},
+		{
+			name: "restarts",
+			code: []byte{0xC7, 0xFF},
+			want: []string{"RST 0", "RST 7"},
+		},
+		{
+			name: "undocumented opcodes",
+			code: []byte{0x08, 0x38, 0xCB, 0x00, 0x01, 0xD9, 0xFD, 0x34, 0x12},
+			want: []string{"NOP_08", "NOP_38", "JMP_CB 0x0100", "RET_D9", "CALL_FD 0x1234"},
+		},
+		{
+			name:    "truncated instruction",
+			code:    []byte{0x00, 0xC3, 0x00},
+			want:    []string{"NOP"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instructions, err := Disassemble(tt.code, tt.origin)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Disassemble() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			got := []string{}
+			for _, instruction := range instructions {
+				got = append(got, instruction.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Disassemble() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	instruction, err := Decode([]byte{0x00, 0xCA, 0x34, 0x12}, 1, 0x0101)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	want := Instruction{Address: 0x0101, Opcode: 0xCA, Mnemonic: "JZ", Operands: "0x1234", Length: 3, Data: 0x1234}
+	if !reflect.DeepEqual(instruction, want) {
+		t.Errorf("Decode() = %+v, want %+v", instruction, want)
+	}
+}
+
+func TestDecode_Undocumented(t *testing.T) {
+	for opcode := range 256 {
+		instruction, err := Decode([]byte{byte(opcode), 0x00, 0x00}, 0, 0)
+		if err != nil {
+			t.Fatalf("Decode(0x%02X) error = %v", opcode, err)
+		}
+		want := opcode&0xC7 == 0x00 && opcode != 0x00 || opcode == 0xCB || opcode == 0xD9 || opcode&0xCF == 0xCD && opcode != 0xCD
+		if instruction.Undocumented != want {
+			t.Errorf("Decode(0x%02X).Undocumented = %v, want %v", opcode, instruction.Undocumented, want)
+		}
+	}
+}
+
+func TestDecodeCPU(t *testing.T) {
+	tests := []struct {
+		cpu  isa.CPU
+		code []byte
+		want []string
+	}{
+		{isa.I8080, []byte{0x20, 0xCB, 0x00, 0x01, 0xD9}, []string{"NOP_20", "JMP_CB 0x0100", "RET_D9"}},
+		{
+			isa.I8085,
+			[]byte{0x20, 0x30, 0x08, 0x28, 0x05, 0xCB, 0xD9, 0xDD, 0x34, 0x12, 0xED, 0xFD, 0x00, 0x01},
+			[]string{"RIM", "SIM", "DSUB", "LDHI 0x05", "RSTV", "SHLX", "JNK 0x1234", "LHLX", "JK 0x0100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cpu.String(), func(t *testing.T) {
+			got := []string{}
+			for offset := 0; offset < len(tt.code); {
+				instruction, err := DecodeCPU(tt.code, offset, uint16(offset), tt.cpu)
+				if err != nil {
+					t.Fatalf("DecodeCPU() error = %v", err)
+				}
+				if tt.cpu != isa.I8080 && instruction.Undocumented {
+					t.Errorf("DecodeCPU(0x%02X).Undocumented = true on %s", instruction.Opcode, tt.cpu)
+				}
+				got = append(got, instruction.String())
+				offset += instruction.Length
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeCPU() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
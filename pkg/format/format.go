@@ -0,0 +1,255 @@
+// Package format lays out assembly source in a standard style: labels in the
+// first column, mnemonics, operands and comments aligned in columns, numbers
+// written with an H suffix, and one space after each comma.
+package format
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/ast"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+)
+
+// Options control how source is formatted.
+type Options struct {
+	Lower bool // Write mnemonics, registers and numbers in lower case
+}
+
+const tabWidth = 8
+
+// Source formats a program written in the assembler's own syntax. Each line
+// stays on its line, blank lines are kept, and comments and the case of
+// labels are kept as they are. The result is checked to assemble to the
+// same bytes as the source, by comparing their tokens.
+//
+// TEST lines of assembly unit tests are copied as they are, and the rest of
+// the test block is formatted like the program.
+func Source(source string, options Options) (string, error) {
+	lines := strings.Split(source, "\n")
+	program := programLines(lines)
+	tokens, err := lexer.New(strings.Join(program, "\n")).Lex()
+	if err != nil {
+		return "", err
+	}
+	prog, err := ast.Parse(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	f := formatter{options: options, source: program, lines: make([]line, len(lines))}
+	for _, s := range prog.Statements {
+		f.add(s)
+	}
+	formatted := f.layout()
+	for i := range lines {
+		if program[i] == "" && strings.TrimSpace(lines[i]) != "" {
+			formatted[i] = strings.TrimRight(lines[i], " \t\r")
+		}
+	}
+	result := strings.Join(formatted, "\n")
+
+	if err := equivalent(tokens, programLines(formatted)); err != nil {
+		return "", fmt.Errorf("formatting would change the program: %w", err)
+	}
+	return result, nil
+}
+
+// programLines returns lines with TEST lines blanked out, since the names
+// of tests aren't assembly.
+func programLines(lines []string) []string {
+	program := make([]string, len(lines))
+	for i, text := range lines {
+		fields := strings.Fields(text)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "TEST") {
+			program[i] = text
+		}
+	}
+	return program
+}
+
+// line is the formatted parts of a line of source.
+type line struct {
+	label   string // Labels, with their colons
+	code    []part // Instructions and directives
+	comment string
+	indent  bool // The comment is the only thing on the line, and isn't in the first column
+}
+
+type part struct {
+	mnemonic string
+	operands string
+}
+
+type formatter struct {
+	options Options
+	source  []string
+	lines   []line
+}
+
+func (f *formatter) add(s ast.Statement) {
+	l := &f.lines[s.Pos().Line-1]
+	switch s := s.(type) {
+	case *ast.Label:
+		if l.label != "" {
+			l.label += " "
+		}
+		l.label += f.raw(s.Position, s.Name) + ":"
+	case *ast.Instruction:
+		l.code = append(l.code, part{mnemonic: f.mnemonic(s.Position, s.Mnemonic), operands: f.operands(s.Operands)})
+	case *ast.Directive:
+		l.code = append(l.code, part{mnemonic: f.mnemonic(s.Position, s.Name), operands: f.operands(s.Operands)})
+	case *ast.Comment:
+		l.comment = strings.TrimRight(s.Text, " \t\r")
+		l.indent = s.Position.Column > 1
+	}
+}
+
+// raw returns the text of a name as it's written in the source.
+func (f *formatter) raw(p ast.Pos, name string) string {
+	text := f.source[p.Line-1]
+	start := p.Column - 1
+	if start < 0 || start+len(name) > len(text) || !strings.EqualFold(text[start:start+len(name)], name) {
+		return name
+	}
+	return text[start : start+len(name)]
+}
+
+// mnemonic returns a mnemonic in the chosen case. Names that aren't the
+// assembler's, such as TEST block keywords, are kept as they're written.
+func (f *formatter) mnemonic(p ast.Pos, name string) string {
+	if !lexer.IsMnemonic(name) {
+		return f.raw(p, name)
+	}
+	return f.cased(name)
+}
+
+func (f *formatter) cased(s string) string {
+	if f.options.Lower {
+		return strings.ToLower(s)
+	}
+	return strings.ToUpper(s)
+}
+
+func (f *formatter) operands(operands []ast.Operand) string {
+	texts := []string{}
+	for _, o := range operands {
+		switch o := o.(type) {
+		case *ast.Register:
+			texts = append(texts, f.cased(o.Name))
+		case *ast.Number:
+			texts = append(texts, f.cased(number(o.Literal)))
+		case *ast.Name:
+			texts = append(texts, f.raw(o.Position, o.Name))
+		case *ast.String:
+			texts = append(texts, "'"+o.Value+"'")
+		}
+	}
+	return strings.Join(texts, ", ")
+}
+
+// number writes a hex number with an H suffix, and a leading zero if it
+// starts with a letter.
+func number(literal string) string {
+	digits := strings.TrimSuffix(strings.TrimPrefix(strings.ToUpper(literal), "0X"), "H")
+	if digits == "" || digits[0] > '9' {
+		digits = "0" + digits
+	}
+	return digits + "H"
+}
+
+// layout returns the formatted lines. Mnemonics and operands are aligned
+// through the whole program, and comments after code are aligned within
+// each run of lines without a blank line.
+func (f *formatter) layout() []string {
+	mnemonicColumn, mnemonicWidth := tabWidth, 0
+	for _, l := range f.lines {
+		if len(l.code) > 0 {
+			mnemonicColumn = max(mnemonicColumn, tabStop(len(l.label)))
+		}
+		for _, p := range l.code {
+			mnemonicWidth = max(mnemonicWidth, len(p.mnemonic))
+		}
+	}
+	operandColumn := tabStop(mnemonicWidth)
+
+	formatted := make([]string, len(f.lines))
+	for i, l := range f.lines {
+		text := l.label
+		if len(l.code) > 0 {
+			code := []string{}
+			for _, p := range l.code {
+				if p.operands == "" {
+					code = append(code, p.mnemonic)
+					continue
+				}
+				code = append(code, pad(p.mnemonic, operandColumn)+p.operands)
+			}
+			text = pad(text, mnemonicColumn) + strings.Join(code, " ")
+		}
+		if l.comment != "" && text == "" && l.indent {
+			text = strings.Repeat(" ", mnemonicColumn)
+		}
+		formatted[i] = text
+	}
+
+	for start := 0; start < len(f.lines); {
+		end := start
+		commentColumn := 0
+		for ; end < len(f.lines) && (formatted[end] != "" || f.lines[end].comment != ""); end++ {
+			if f.lines[end].comment != "" && (f.lines[end].label != "" || len(f.lines[end].code) > 0) {
+				commentColumn = max(commentColumn, tabStop(len(formatted[end])))
+			}
+		}
+		for i := start; i < end; i++ {
+			l := f.lines[i]
+			switch {
+			case l.comment == "":
+			case l.label == "" && len(l.code) == 0:
+				formatted[i] += l.comment
+			default:
+				formatted[i] = pad(formatted[i], commentColumn) + l.comment
+			}
+		}
+		start = end + 1
+	}
+	return formatted
+}
+
+// tabStop returns the first tab stop after width characters.
+func tabStop(width int) int {
+	return (width/tabWidth + 1) * tabWidth
+}
+
+func pad(text string, column int) string {
+	return text + strings.Repeat(" ", max(1, column-len(text)))
+}
+
+// equivalent returns an error if the formatted source doesn't lex to the
+// same tokens as the original, apart from how numbers are written and the
+// spacing of comments.
+func equivalent(want []lexer.Token, formatted []string) error {
+	got, err := lexer.New(strings.Join(formatted, "\n")).Lex()
+	if err != nil {
+		return err
+	}
+	for i := range min(len(want), len(got)) {
+		w, g := want[i], got[i]
+		same := w.Type == g.Type && w.Line == g.Line
+		switch w.Type {
+		case lexer.NUMBER:
+			same = same && number(w.Literal) == number(g.Literal)
+		case lexer.COMMENT:
+			same = same && strings.TrimRight(w.Literal, " \t\r") == g.Literal
+		default:
+			same = same && w.Literal == g.Literal
+		}
+		if !same {
+			return fmt.Errorf("line %d: %s became %s", w.Line, w.Literal, g.Literal)
+		}
+	}
+	if len(want) != len(got) {
+		return fmt.Errorf("%d tokens became %d", len(want), len(got))
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package format
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		options Options
+		want    string
+	}{
+		{
+			name:   "columns",
+			source: "start: mvi a,0x33\n\tjmp start\n",
+			want:   "start:  MVI     A, 33H\n        JMP     start\n",
+		},
+		{
+			name:    "lower case",
+			source:  "START: MVI A, 0FFH\n\tPUSH PSW",
+			options: Options{Lower: true},
+			want:    "START:  mvi     a, 0ffh\n        push    psw",
+		},
+		{
+			name:   "long labels move every mnemonic",
+			source: "VERYLONGLABEL: NOP\nX: NOP",
+			want:   "VERYLONGLABEL:  NOP\nX:              NOP",
+		},
+		{
+			name:   "label on its own line",
+			source: "  LOOP:\n  DCR B",
+			want:   "LOOP:\n        DCR     B",
+		},
+		{
+			name:   "numbers",
+			source: "DB 0, 1, 0x0A, 0BH, 0c, FFH",
+			want:   "        DB      0H, 1H, 0AH, 0BH, 0CH, FFH",
+		},
+		{
+			name:   "comments aligned within blocks",
+			source: "MVI A, 1 ; one\nLXI H, 1234H ; address\n\nNOP ; next block\n; whole line\n    ; indented\n",
+			want:   "        MVI     A, 1H           ; one\n        LXI     H, 1234H        ; address\n\n        NOP     ; next block\n; whole line\n        ; indented\n",
+		},
+		{
+			name:   "blank lines and trailing space",
+			source: "NOP   \n\n\n\t\nNOP ;  comment  ",
+			want:   "        NOP\n\n\n\n        NOP     ;  comment",
+		},
+		{
+			name:   "strings",
+			source: "MSG: DB 'Hello, world',0",
+			want:   "MSG:    DB      'Hello, world', 0H",
+		},
+		{
+			name:   "test blocks",
+			source: "TEST adds one\n  mvi a, 1\n  EXPECT A, 1\nENDTEST",
+			want:   "TEST adds one\n        MVI     A, 1H\n        EXPECT  A, 1H\n        ENDTEST",
+		},
+		{
+			name:   "already formatted",
+			source: "START:  MVI     A, 33H  ; load\n        JMP     START\n",
+			want:   "START:  MVI     A, 33H  ; load\n        JMP     START\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Source(tt.source, tt.options)
+			if err != nil {
+				t.Fatalf("Source() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Source() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSource_Errors(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr string
+	}{
+		{"MOV A B", "line 1: expected comma, got: B"},
+		{"NOP\n5", "line 2: unexpected token type \"NUMBER\", literal: \"5\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := Source(tt.source, Options{})
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Source() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestSource_SameBytes checks that formatted programs assemble to the same
+// bytes as the originals.
+func TestSource_SameBytes(t *testing.T) {
+	source := `; Print a message
+	org 100h
+start:	lxi d,msg ; message
+	mvi c,9
+	call 5
+	.8085
+	rim
+	.8080
+Loop: dcr b
+	jnz Loop
+copy: PHASE 0x8000
+run:	jmp run
+	DEPHASE
+	lxi b,copy_len
+msg: db 'IT WORKS',0dh,0x0a,24h
+`
+	for _, options := range []Options{{}, {Lower: true}} {
+		formatted, err := Source(source, options)
+		if err != nil {
+			t.Fatalf("Source() error = %v", err)
+		}
+		want, err := assembler.New(source).Assemble()
+		if err != nil {
+			t.Fatalf("Assemble() error = %v", err)
+		}
+		got, err := assembler.New(formatted).Assemble()
+		if err != nil {
+			t.Fatalf("Assemble() formatted error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("formatted source assembles to %X, want %X", got, want)
+		}
+		again, err := Source(formatted, options)
+		if err != nil || again != formatted {
+			t.Errorf("Source() isn't stable: %q, then %q, %v", formatted, again, err)
+		}
+	}
+}
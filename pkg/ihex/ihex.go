@@ -0,0 +1,170 @@
+// Package ihex reads and writes Intel HEX files, the text format EPROM
+// programmers and monitors load 8080 programs from.
+package ihex
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Record types
+const (
+	data         = 0x00
+	endOfFile    = 0x01
+	segment      = 0x02 // Extended segment address
+	startSegment = 0x03
+	linear       = 0x04 // Extended linear address
+	startLinear  = 0x05
+)
+
+// Gap is the value of bytes between records that aren't in the file, the
+// same as erased EPROM.
+const Gap = 0xFF
+
+// Span is a run of addresses, starting at Start.
+type Span struct {
+	Start uint16
+	Size  int
+}
+
+// Read reads an Intel HEX file and returns the bytes it contains, from the
+// lowest address in it to the highest, with any gaps between records set to
+// Gap.
+func Read(in io.Reader) (uint16, []byte, error) {
+	origin, image, _, err := ReadSpans(in)
+	return origin, image, err
+}
+
+// ReadSpans reads an Intel HEX file like Read, and also returns the runs of
+// addresses its records load, in address order, so that the gaps can be
+// left out when it's written back.
+func ReadSpans(in io.Reader) (uint16, []byte, []Span, error) {
+	memory := map[int]byte{}
+	low, high := 0x10000, 0
+	scanner := bufio.NewScanner(in)
+	ended := false
+	for line := 1; scanner.Scan() && !ended; line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		record, err := parseRecord(text)
+		if err != nil {
+			return 0, nil, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		address := int(record[1])<<8 | int(record[2])
+		payload := record[4 : len(record)-1]
+		switch record[3] {
+		case data:
+			if address+len(payload) > 0x10000 {
+				return 0, nil, nil, fmt.Errorf("line %d: record at 0x%04X runs past 64K", line, address)
+			}
+			for i, b := range payload {
+				memory[address+i] = b
+			}
+			if len(payload) > 0 {
+				low, high = min(low, address), max(high, address+len(payload))
+			}
+		case endOfFile:
+			ended = true
+		case segment, linear:
+			for _, b := range payload {
+				if b != 0 {
+					return 0, nil, nil, fmt.Errorf("line %d: extended address above 64K", line)
+				}
+			}
+		case startSegment, startLinear:
+			// The start address isn't part of the image
+		default:
+			return 0, nil, nil, fmt.Errorf("line %d: unknown record type %02X", line, record[3])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, nil, nil, err
+	}
+	if !ended {
+		return 0, nil, nil, errors.New("missing end of file record")
+	}
+	if low > high {
+		return 0, []byte{}, []Span{}, nil
+	}
+
+	image := make([]byte, high-low)
+	spans := []Span{}
+	for i := range image {
+		b, found := memory[low+i]
+		if !found {
+			image[i] = Gap
+			continue
+		}
+		image[i] = b
+		if n := len(spans); n > 0 && int(spans[n-1].Start)+spans[n-1].Size == low+i {
+			spans[n-1].Size++
+			continue
+		}
+		spans = append(spans, Span{Start: uint16(low + i), Size: 1})
+	}
+	return uint16(low), image, spans, nil
+}
+
+// parseRecord decodes a record and checks its length and checksum.
+func parseRecord(text string) ([]byte, error) {
+	if !strings.HasPrefix(text, ":") {
+		return nil, fmt.Errorf("record doesn't start with ':'")
+	}
+	record, err := hex.DecodeString(text[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid record: %w", err)
+	}
+	if len(record) < 5 || len(record) != int(record[0])+5 {
+		return nil, fmt.Errorf("record length doesn't match its byte count")
+	}
+	var sum byte
+	for _, b := range record {
+		sum += b
+	}
+	if sum != 0 {
+		return nil, fmt.Errorf("bad checksum")
+	}
+	return record, nil
+}
+
+// Write writes bytes, starting at origin, as an Intel HEX file with 16 bytes
+// per record.
+func Write(out io.Writer, origin uint16, bytes []byte) error {
+	return WriteSpans(out, origin, bytes, []Span{{Start: origin, Size: len(bytes)}})
+}
+
+// WriteSpans writes the parts of bytes, which start at origin, that are in
+// spans, as an Intel HEX file with up to 16 bytes per record. Addresses
+// outside the spans aren't written, so they keep whatever the programmer or
+// loader leaves there.
+func WriteSpans(out io.Writer, origin uint16, bytes []byte, spans []Span) error {
+	if int(origin)+len(bytes) > 0x10000 {
+		return fmt.Errorf("%d bytes at 0x%04X doesn't fit in 64K", len(bytes), origin)
+	}
+	w := bufio.NewWriter(out)
+	for _, span := range spans {
+		start := max(int(span.Start)-int(origin), 0)
+		end := min(int(span.Start)-int(origin)+span.Size, len(bytes))
+		for offset := start; offset < end; offset += 16 {
+			writeRecord(w, data, origin+uint16(offset), bytes[offset:min(offset+16, end)])
+		}
+	}
+	writeRecord(w, endOfFile, 0, nil)
+	return w.Flush()
+}
+
+func writeRecord(w *bufio.Writer, recordType byte, address uint16, payload []byte) {
+	record := append([]byte{byte(len(payload)), byte(address >> 8), byte(address), recordType}, payload...)
+	var sum byte
+	for _, b := range record {
+		sum += b
+	}
+	fmt.Fprintf(w, ":%s%02X\n", strings.ToUpper(hex.EncodeToString(record)), -sum)
+}
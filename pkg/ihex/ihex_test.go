@@ -0,0 +1,98 @@
+package ihex
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantOrigin uint16
+		wantData   []byte
+		wantErr    bool
+	}{
+		{
+			name:       "single record",
+			input:      ":0300300002337A1E\n:00000001FF\n",
+			wantOrigin: 0x0030,
+			wantData:   []byte{0x02, 0x33, 0x7A},
+		},
+		{
+			name:       "gap between records",
+			input:      ":0100000000FF\n:010003007686\n:020000040000FA\n:00000001FF\n",
+			wantOrigin: 0x0000,
+			wantData:   []byte{0x00, 0xFF, 0xFF, 0x76},
+		},
+		{name: "bad checksum", input: ":0300300002337A1F\n:00000001FF\n", wantErr: true},
+		{name: "wrong length", input: ":0400300002337A1E\n:00000001FF\n", wantErr: true},
+		{name: "missing end of file", input: ":0300300002337A1E\n", wantErr: true},
+		{name: "above 64K", input: ":020000040001F9\n:00000001FF\n", wantErr: true},
+		{name: "not a record", input: "0300300002337A1E\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin, data, err := Read(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if origin != tt.wantOrigin || !reflect.DeepEqual(data, tt.wantData) {
+				t.Errorf("Read() = 0x%04X, %X, want 0x%04X, %X", origin, data, tt.wantOrigin, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	data := make([]byte, 18)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	b := &bytes.Buffer{}
+	if err := Write(b, 0x0100, data); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	want := `:10010000000102030405060708090A0B0C0D0E0F77
+:020110001011CC
+:00000001FF
+`
+	if b.String() != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	origin, read, err := Read(b)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if origin != 0x0100 || !reflect.DeepEqual(read, data) {
+		t.Errorf("Read() = 0x%04X, %X, want 0x0100, %X", origin, read, data)
+	}
+}
+
+func TestReadSpans(t *testing.T) {
+	input := ":0100000000FF\n:010003007686\n:010004007685\n:00000001FF\n"
+	origin, data, spans, err := ReadSpans(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadSpans() error = %v", err)
+	}
+	wantSpans := []Span{{Start: 0x0000, Size: 1}, {Start: 0x0003, Size: 2}}
+	if origin != 0x0000 || !reflect.DeepEqual(data, []byte{0x00, 0xFF, 0xFF, 0x76, 0x76}) || !reflect.DeepEqual(spans, wantSpans) {
+		t.Errorf("ReadSpans() = 0x%04X, %X, %v, want 0x0000, 00FFFF7676, %v", origin, data, spans, wantSpans)
+	}
+
+	b := &bytes.Buffer{}
+	if err := WriteSpans(b, origin, data, spans); err != nil {
+		t.Fatalf("WriteSpans() error = %v", err)
+	}
+	want := ":0100000000FF\n:0200030076760F\n:00000001FF\n"
+	if b.String() != want {
+		t.Errorf("WriteSpans() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
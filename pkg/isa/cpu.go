@@ -0,0 +1,72 @@
+package isa
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CPU is the processor a program is assembled for. Each one has the
+// instructions of the ones before it.
+type CPU int
+
+const (
+	I8080             CPU = iota
+	I8085                 // The 8085, which adds RIM and SIM
+	I8085Undocumented     // The 8085 with its undocumented instructions
+)
+
+var cpuNames = []string{"8080", "8085", "8085U"}
+
+var cpuDescriptions = []string{"the 8080", "the 8085", "the 8085 with undocumented instructions"}
+
+func (c CPU) String() string {
+	return cpuNames[c]
+}
+
+// ParseCPU returns the CPU with the given name: 8080, 8085, or 8085U for
+// the 8085 with its undocumented instructions.
+func ParseCPU(name string) (CPU, error) {
+	for i, n := range cpuNames {
+		if strings.EqualFold(strings.TrimPrefix(name, "."), n) {
+			return CPU(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown CPU %s, expected one of %s", name, strings.Join(cpuNames, ", "))
+}
+
+// requires lists the instructions that aren't on the 8080, with the CPU
+// they need.
+var requires = map[string]CPU{
+	"RIM": I8085, "SIM": I8085,
+	"DSUB": I8085Undocumented, "ARHL": I8085Undocumented, "RDEL": I8085Undocumented,
+	"LDHI": I8085Undocumented, "LDSI": I8085Undocumented, "RSTV": I8085Undocumented,
+	"SHLX": I8085Undocumented, "LHLX": I8085Undocumented, "JNK": I8085Undocumented,
+	"JK": I8085Undocumented,
+}
+
+// Requires returns the first CPU that has an instruction: I8080 for the
+// 8080's own instructions, and the 8085 modes for the ones it added.
+func Requires(mnemonic string) CPU {
+	return requires[strings.ToUpper(mnemonic)]
+}
+
+// undocumented8080 are the 8080's duplicate opcodes, written as the
+// instruction they act as followed by the opcode. The 8085 uses these
+// opcodes for other instructions, so they're only allowed on the 8080.
+var undocumented8080 = map[string]bool{
+	"NOP_08": true, "NOP_10": true, "NOP_18": true, "NOP_20": true, "NOP_28": true, "NOP_30": true, "NOP_38": true,
+	"JMP_CB": true, "RET_D9": true, "CALL_DD": true, "CALL_ED": true, "CALL_FD": true,
+}
+
+// Check returns an error if the CPU doesn't have an instruction, saying
+// which CPU to select for it.
+func (c CPU) Check(mnemonic string) error {
+	mnemonic = strings.ToUpper(mnemonic)
+	if cpu, found := requires[mnemonic]; found && c < cpu {
+		return fmt.Errorf("%s requires %s, select it with .%s", mnemonic, cpuDescriptions[cpu], cpu)
+	}
+	if undocumented8080[mnemonic] && c != I8080 {
+		return fmt.Errorf("%s requires %s, select it with .%s", mnemonic, cpuDescriptions[I8080], I8080)
+	}
+	return nil
+}
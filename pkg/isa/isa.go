@@ -0,0 +1,252 @@
+// Package isa describes the instruction set the assembler encodes: the
+// opcode and operand form of each mnemonic, the register codes, the
+// directives, and the CPUs that have each instruction. It's shared by the
+// syntax tree, the encoder and the tools built on them.
+package isa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Form is the operands an instruction takes, and how they're encoded
+// alongside its opcode.
+type Form int
+
+const (
+	Implied       Form = iota // No operands, like NOP
+	Register                  // An 8-bit register in bits 0-2, like ADD B
+	DestRegister              // An 8-bit register in bits 3-5, like INR B
+	RegisterPair              // A register pair in bits 4-5, like PUSH B
+	IndirectPair              // B or D in bits 4-5, like STAX B
+	Immediate                 // A byte of data, like ADI 10H
+	Address                   // A 16-bit address or label, like JMP START
+	Move                      // Two 8-bit registers, MOV only
+	MoveImmediate             // An 8-bit register and a byte of data, MVI only
+	LoadPair                  // A register pair and a 16-bit value or label, LXI only
+	Restart                   // A routine number from 0 to 7, RST only
+)
+
+// Instruction is an instruction's opcode, before any register codes are
+// added, and the form of its operands.
+type Instruction struct {
+	Code byte
+	Form Form
+}
+
+var instructions = map[string]Instruction{
+
+	// MOVE, LOAD AND STORE
+	"MOV":  {0x40, Move},
+	"MVI":  {0x06, MoveImmediate},
+	"LXI":  {0x01, LoadPair},
+	"STAX": {0x02, IndirectPair},
+	"LDAX": {0x0A, IndirectPair},
+	"STA":  {0x32, Address},
+	"LDA":  {0x3A, Address},
+	"SHLD": {0x22, Address},
+	"LHLD": {0x2A, Address},
+	"XCHG": {0xEB, Implied},
+
+	// STACK OPERATIONS
+	"XTHL": {0xE3, Implied},
+	"SPHL": {0xF9, Implied},
+
+	"PUSH": {0xC5, RegisterPair},
+	"POP":  {0xC1, RegisterPair},
+	"INX":  {0x03, RegisterPair},
+	"DCX":  {0x0B, RegisterPair},
+	"DAD":  {0x09, RegisterPair},
+
+	// JUMP AND CALL
+	"JMP":  {0xC3, Address},
+	"JC":   {0xDA, Address},
+	"JNC":  {0xD2, Address},
+	"JZ":   {0xCA, Address},
+	"JNZ":  {0xC2, Address},
+	"JP":   {0xF2, Address},
+	"JM":   {0xFA, Address},
+	"JPE":  {0xEA, Address},
+	"JPO":  {0xE2, Address},
+	"PCHL": {0xE9, Implied},
+	"CALL": {0xCD, Address},
+	"CC":   {0xDC, Address},
+	"CNC":  {0xD4, Address},
+	"CZ":   {0xCC, Address},
+	"CNZ":  {0xC4, Address},
+	"CP":   {0xF4, Address},
+	"CM":   {0xFC, Address},
+	"CPE":  {0xEC, Address},
+	"CPO":  {0xE4, Address},
+
+	// RETURN
+	"RET": {0xC9, Implied},
+	"RC":  {0xD8, Implied},
+	"RNC": {0xD0, Implied},
+	"RZ":  {0xC8, Implied},
+	"RNZ": {0xC0, Implied},
+	"RP":  {0xF0, Implied},
+	"RM":  {0xF8, Implied},
+	"RPE": {0xE8, Implied},
+	"RPO": {0xE0, Implied},
+
+	// RESTART
+	"RST": {0xC7, Restart},
+
+	// INCREMENT AND DECREMENT
+	"INR": {0x04, DestRegister},
+	"DCR": {0x05, DestRegister},
+
+	// ADD AND SUBTRACT
+	"ADD": {0x80, Register},
+	"ADC": {0x88, Register},
+	"ADI": {0xC6, Immediate},
+	"ACI": {0xCE, Immediate},
+	"SUB": {0x90, Register},
+	"SBB": {0x98, Register},
+	"SUI": {0xD6, Immediate},
+	"SBI": {0xDE, Immediate},
+	"ANI": {0xE6, Immediate},
+	"XRI": {0xEE, Immediate},
+	"ORI": {0xF6, Immediate},
+	"CPI": {0xFE, Immediate},
+
+	// LOGICAL
+	"ANA": {0xA0, Register},
+	"XRA": {0xA8, Register},
+	"ORA": {0xB0, Register},
+	"CMP": {0xB8, Register},
+
+	// ROTATE
+	"RLC": {0x07, Implied},
+	"RRC": {0x0F, Implied},
+	"RAL": {0x17, Implied},
+	"RAR": {0x1F, Implied},
+
+	// SPECIALS
+	"CMA": {0x2F, Implied},
+	"STC": {0x37, Implied},
+	"CMC": {0x3F, Implied},
+	"DAA": {0x27, Implied},
+
+	// INPUT/OUTPUT
+	"IN":  {0xDB, Immediate},
+	"OUT": {0xD3, Immediate},
+
+	// CONTROL
+	"EI":  {0xFB, Implied},
+	"DI":  {0xF3, Implied},
+	"NOP": {0x00, Implied},
+	"HLT": {0x76, Implied},
+
+	// 8085
+	"RIM": {0x20, Implied},
+	"SIM": {0x30, Implied},
+
+	// UNDOCUMENTED 8085
+	"DSUB": {0x08, Implied},
+	"ARHL": {0x10, Implied},
+	"RDEL": {0x18, Implied},
+	"LDHI": {0x28, Immediate},
+	"LDSI": {0x38, Immediate},
+	"RSTV": {0xCB, Implied},
+	"SHLX": {0xD9, Implied},
+	"LHLX": {0xED, Implied},
+	"JNK":  {0xDD, Address},
+	"JK":   {0xFD, Address},
+
+	// UNDOCUMENTED 8080
+	"NOP_08":  {0x08, Implied},
+	"NOP_10":  {0x10, Implied},
+	"NOP_18":  {0x18, Implied},
+	"NOP_20":  {0x20, Implied},
+	"NOP_28":  {0x28, Implied},
+	"NOP_30":  {0x30, Implied},
+	"NOP_38":  {0x38, Implied},
+	"JMP_CB":  {0xCB, Address},
+	"RET_D9":  {0xD9, Implied},
+	"CALL_DD": {0xDD, Address},
+	"CALL_ED": {0xED, Address},
+	"CALL_FD": {0xFD, Address},
+}
+
+// Lookup returns the instruction with the given mnemonic, if the assembler
+// has it. Directives and user-defined instructions aren't included.
+func Lookup(mnemonic string) (Instruction, bool) {
+	in, found := instructions[strings.ToUpper(mnemonic)]
+	return in, found
+}
+
+// directives are the mnemonics that don't assemble to an instruction.
+var directives = map[string]bool{
+	"DB": true, "CSEG": true, "DSEG": true, "PUBLIC": true, "EXTRN": true, "ORG": true, "MEMORY": true, "IMPORT": true,
+	"PHASE": true, "DEPHASE": true, "OPCODE": true, ".8080": true, ".8085": true, ".8085U": true,
+}
+
+// IsDirective reports whether mnemonic is an assembler directive rather than
+// an instruction.
+func IsDirective(mnemonic string) bool {
+	return directives[strings.ToUpper(mnemonic)]
+}
+
+var registers = map[string]byte{
+	"B": 0x00, "C": 0x01, "D": 0x02, "E": 0x03, "H": 0x04, "L": 0x05, "M": 0x06, "A": 0x07,
+}
+
+// pairs are the register pairs LXI takes, and stackPairs the ones the
+// other register pair instructions take, where PSW has SP's code.
+var (
+	pairs         = map[string]byte{"B": 0x00, "D": 0x01, "H": 0x02, "SP": 0x03}
+	stackPairs    = map[string]byte{"B": 0x00, "D": 0x01, "H": 0x02, "PSW": 0x03, "SP": 0x03}
+	indirectPairs = map[string]byte{"B": 0x00, "D": 0x01}
+)
+
+// RegisterCode returns the code of an 8-bit register, where M is the memory
+// addressed by HL.
+func RegisterCode(name string) (byte, bool) {
+	code, found := registers[strings.ToUpper(name)]
+	return code, found
+}
+
+// PairCode returns the code of a register pair in an instruction of the
+// given form: B, D, H or SP for LoadPair, PSW as well for RegisterPair, and
+// only B or D for IndirectPair.
+func PairCode(form Form, name string) (byte, bool) {
+	table := pairs
+	switch form {
+	case RegisterPair:
+		table = stackPairs
+	case IndirectPair:
+		table = indirectPairs
+	}
+	code, found := table[strings.ToUpper(name)]
+	return code, found
+}
+
+// IsRegister reports whether name is a register or register pair, which
+// can't be used as a mnemonic.
+func IsRegister(name string) bool {
+	_, found := registers[strings.ToUpper(name)]
+	return found || strings.EqualFold(name, "SP") || strings.EqualFold(name, "PSW")
+}
+
+// ParseNumber returns the value of a 16-bit number written in hex, with an
+// optional 0x prefix or H suffix in either case. Numbers are written this
+// way everywhere: in source, on the command line, and in memory map and
+// symbol files.
+func ParseNumber(literal string) (uint16, error) {
+	value, err := ParseNumberUpTo(literal, 0xFFFF)
+	return uint16(value), err
+}
+
+// ParseNumberUpTo is ParseNumber for numbers no larger than limit, which
+// can be 0x10000 for the size of the whole address space.
+func ParseNumberUpTo(literal string, limit int) (int, error) {
+	digits := strings.TrimSuffix(strings.TrimPrefix(strings.ToUpper(literal), "0X"), "H")
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || value > uint64(limit) {
+		return 0, fmt.Errorf("invalid number: %s", literal)
+	}
+	return int(value), nil
+}
@@ -0,0 +1,109 @@
+package isa
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		mnemonic string
+		want     Instruction
+		wantOK   bool
+	}{
+		{"NOP", Instruction{0x00, Implied}, true},
+		{"mov", Instruction{0x40, Move}, true},
+		{"INR", Instruction{0x04, DestRegister}, true},
+		{"JMP_CB", Instruction{0xCB, Address}, true},
+		{"DB", Instruction{}, false},
+		{"FOO", Instruction{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mnemonic, func(t *testing.T) {
+			got, ok := Lookup(tt.mnemonic)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Lookup() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPairCode(t *testing.T) {
+	tests := []struct {
+		form     Form
+		name     string
+		wantCode byte
+		wantOK   bool
+	}{
+		{LoadPair, "SP", 0x03, true},
+		{LoadPair, "PSW", 0, false},
+		{RegisterPair, "PSW", 0x03, true},
+		{IndirectPair, "D", 0x01, true},
+		{IndirectPair, "H", 0, false},
+	}
+	for _, tt := range tests {
+		code, ok := PairCode(tt.form, tt.name)
+		if code != tt.wantCode || ok != tt.wantOK {
+			t.Errorf("PairCode(%d, %s) = %d, %v, want %d, %v", tt.form, tt.name, code, ok, tt.wantCode, tt.wantOK)
+		}
+	}
+}
+
+func TestCPU_Check(t *testing.T) {
+	tests := []struct {
+		cpu      CPU
+		mnemonic string
+		wantErr  string
+	}{
+		{I8080, "NOP", ""},
+		{I8080, "RIM", "RIM requires the 8085, select it with .8085"},
+		{I8085, "RIM", ""},
+		{I8085, "DSUB", "DSUB requires the 8085 with undocumented instructions, select it with .8085U"},
+		{I8080, "NOP_08", ""},
+		{I8085Undocumented, "nop_08", "NOP_08 requires the 8080, select it with .8080"},
+	}
+	for _, tt := range tests {
+		err := tt.cpu.Check(tt.mnemonic)
+		if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+			t.Errorf("%s.Check(%s) error = %v, want %q", tt.cpu, tt.mnemonic, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		literal string
+		want    uint16
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"0x1234", 0x1234, false},
+		{"0FFH", 0xFF, false},
+		{"ffh", 0xFF, false},
+		{"10000", 0, true},
+		{"XYZ", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseNumber(tt.literal)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseNumber(%s) = 0x%04X, %v, want 0x%04X", tt.literal, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseNumberUpTo(t *testing.T) {
+	tests := []struct {
+		literal string
+		limit   int
+		want    int
+		wantErr string
+	}{
+		{"10000", 0x10000, 0x10000, ""},
+		{"10001H", 0x10000, 0, "invalid number: 10001H"},
+		{"0x100", 0xFF, 0, "invalid number: 0x100"},
+		{"0FFh", 0xFF, 0xFF, ""},
+	}
+	for _, tt := range tests {
+		got, err := ParseNumberUpTo(tt.literal, tt.limit)
+		if got != tt.want || (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+			t.Errorf("ParseNumberUpTo(%s, 0x%X) = 0x%X, %v, want 0x%X, %q", tt.literal, tt.limit, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package isa
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operand is the shape of the operand a user-defined instruction takes.
+type Operand int
+
+const (
+	NoOperand Operand = iota // A single byte instruction, like NOP
+	Byte                     // A byte of immediate data, like ADI
+	Word                     // A 16-bit address or label, like JMP
+)
+
+var operandNames = []string{"NONE", "BYTE", "WORD"}
+
+func (o Operand) String() string {
+	return operandNames[o]
+}
+
+// ParseOperand returns the operand shape with the given name: NONE, BYTE or
+// WORD.
+func ParseOperand(name string) (Operand, error) {
+	for i, n := range operandNames {
+		if strings.EqualFold(name, n) {
+			return Operand(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown operand %s, expected one of %s", name, strings.Join(operandNames, ", "))
+}
+
+// Opcode is an instruction that isn't part of the 8080, such as one that a
+// custom core adds in an unused opcode slot.
+type Opcode struct {
+	Mnemonic string
+	Code     byte
+	Operand  Operand
+}
@@ -0,0 +1,282 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect configures the lexer for the source conventions of another
+// assembler. Numbers are read in the dialect's radix and passed on as hex,
+// aliases are passed on as the name they stand for, and labels without
+// colons are given one, so the parser sees the same tokens whichever
+// dialect a program is written in. END ends the program in every dialect.
+type Dialect struct {
+	Name string
+
+	// Numbers without a suffix are decimal. H, D, B, and O or Q suffixes
+	// make them hex, decimal, binary and octal.
+	DollarNumbers    bool   // $FF is a hex number and %1010 a binary one
+	DollarSeparators bool   // $ inside names and numbers is ignored, as in BDOS$ENTRY or 1111$0000B
+	NameChars        string // Characters other than letters, digits and underscores allowed in names
+	LineComments     string // Characters that make a line a comment when they're in its first column
+	OptionalColons   bool   // A name in the first column is a label even without a colon
+	Quotes           string // Characters that quote strings. A doubled quote inside a string is one quote, and a one character string is a number.
+
+	Aliases map[string]string // Other names for mnemonics and directives, such as DEFB for DB
+	Ignored map[string]bool   // Listing directives, such as TITLE and PAGE, which are skipped along with their operands
+}
+
+// ASM80 is Intel's ISIS-II assembler. Lines starting with $ are controls,
+// which are ignored.
+var ASM80 = &Dialect{
+	Name:         "asm80",
+	NameChars:    "?@",
+	LineComments: "$",
+	Quotes:       "'",
+	Ignored:      map[string]bool{"NAME": true},
+}
+
+// ASM is Digital Research's CP/M assembler.
+var ASM = &Dialect{
+	Name:             "asm",
+	DollarSeparators: true,
+	LineComments:     "*",
+	OptionalColons:   true,
+	Quotes:           "'",
+}
+
+// MAC is Digital Research's macro assembler, and RMAC its relocating
+// version.
+var MAC = &Dialect{
+	Name:             "mac",
+	DollarSeparators: true,
+	NameChars:        "?@",
+	LineComments:     "*",
+	OptionalColons:   true,
+	Quotes:           "'",
+	Ignored:          map[string]bool{"TITLE": true, "PAGE": true, "NAME": true},
+}
+
+// M80 is Microsoft's MACRO-80.
+var M80 = &Dialect{
+	Name:      "m80",
+	NameChars: "?@$.",
+	Quotes:    `'"`,
+	Aliases: map[string]string{
+		"DEFB": "DB", "DEFM": "DB", "ENTRY": "PUBLIC", "GLOBAL": "PUBLIC", "EXT": "EXTRN", "EXTERNAL": "EXTRN",
+	},
+	Ignored: map[string]bool{
+		"TITLE": true, "SUBTTL": true, "PAGE": true, ".LIST": true, ".XLIST": true,
+		".SALL": true, ".LALL": true, ".XALL": true, ".CREF": true, ".XCREF": true,
+	},
+}
+
+// TASM is the Telemark Cross Assembler, whose directives start with a dot.
+var TASM = &Dialect{
+	Name:           "tasm",
+	DollarNumbers:  true,
+	OptionalColons: true,
+	Quotes:         `"'`,
+	Aliases: map[string]string{
+		".DB": "DB", ".BYTE": "DB", ".TEXT": "DB", ".ORG": "ORG", ".END": "END",
+	},
+	Ignored: map[string]bool{
+		".LIST": true, ".NOLIST": true, ".PAGE": true, ".NOPAGE": true, ".TITLE": true, ".EJECT": true,
+	},
+}
+
+// Dialects are the dialects by name.
+var Dialects = map[string]*Dialect{
+	ASM80.Name: ASM80,
+	ASM.Name:   ASM,
+	MAC.Name:   MAC,
+	"rmac":     MAC,
+	M80.Name:   M80,
+	TASM.Name:  TASM,
+}
+
+// SetDialect sets the dialect the input is written in.
+func (l *Lexer) SetDialect(d *Dialect) {
+	l.dialect = d
+}
+
+// dialectToken returns the next token if the dialect reads it differently
+// from the assembler's own syntax.
+func (l *Lexer) dialectToken() (Token, bool) {
+	d := l.dialect
+	token := Token{Line: l.line, Column: l.column()}
+	firstColumn := l.position == 0 || l.position <= len(l.input) && l.input[l.position-1] == '\n'
+
+	switch c := l.currentChar; {
+	case c == 0x1A:
+		// CP/M pads text files with ^Z after the end
+		l.skipToEnd()
+		token.Type = EOF
+		return token, true
+	case firstColumn && strings.IndexByte(d.LineComments, c) >= 0:
+		token.Type = COMMENT
+		token.Literal = l.readComment()
+		return token, true
+	case strings.IndexByte(d.Quotes, c) >= 0:
+		text := l.readQuoted(c)
+		if len(text) == 1 {
+			token.Type = NUMBER
+			token.Literal = hexLiteral(uint64(text[0]))
+			return token, true
+		}
+		token.Type = STRING
+		token.Literal = text
+		return token, true
+	case isDigit(c) || (d.DollarNumbers && (c == '$' && isHex(l.peekChar()) || c == '%' && isBinary(l.peekChar()))):
+		text := l.readDialectNumber()
+		token.Type = NUMBER
+		token.Literal = text
+		if value, err := d.parseNumber(text); err == nil {
+			token.Literal = hexLiteral(value)
+		} else {
+			l.fail(fmt.Errorf("line %d: invalid number: %s", token.Line, text))
+		}
+		return token, true
+	case c == '.' || isLetter(c) || strings.IndexByte(d.NameChars, c) >= 0:
+		literal := l.readName()
+		if alias, found := d.Aliases[literal]; found {
+			literal = alias
+		}
+		switch {
+		case d.Ignored[literal]:
+			for l.currentChar != '\n' && l.currentChar != ';' && l.currentChar != 0x00 {
+				l.readChar()
+			}
+			return l.NextToken(), true
+		case literal == "END":
+			l.skipToEnd()
+			token.Type = EOF
+			return token, true
+		}
+		token.Type = l.lookupToken(literal)
+		token.Literal = literal
+		if firstColumn && token.Type == LABEL && d.OptionalColons && l.nextNonBlank() != ':' {
+			l.colon, l.colonLine, l.colonCol = true, token.Line, l.column()
+		}
+		return token, true
+	}
+	return token, false
+}
+
+// readName reads a name, leaving out any $ separators.
+func (l *Lexer) readName() string {
+	d := l.dialect
+	name := strings.Builder{}
+	if l.currentChar == '.' {
+		name.WriteByte('.')
+		l.readChar()
+	}
+	for {
+		c := l.currentChar
+		switch {
+		case c == '$' && d.DollarSeparators:
+		case isLetter(c) || isDigit(c) || c == '_' || (c != 0x00 && strings.IndexByte(d.NameChars, c) >= 0):
+			name.WriteByte(c)
+		default:
+			return strings.ToUpper(name.String())
+		}
+		l.readChar()
+	}
+}
+
+// readDialectNumber reads a number, including its prefix or suffix.
+func (l *Lexer) readDialectNumber() string {
+	position := l.position
+	l.readChar()
+	for isLetter(l.currentChar) || isDigit(l.currentChar) || l.currentChar == '$' {
+		l.readChar()
+	}
+	return l.input[position:l.position]
+}
+
+// parseNumber parses a number written in the dialect.
+func (d *Dialect) parseNumber(text string) (uint64, error) {
+	text = strings.ToUpper(text)
+	if d.DollarSeparators {
+		text = strings.ReplaceAll(text, "$", "")
+	}
+	base := 10
+	switch {
+	case d.DollarNumbers && strings.HasPrefix(text, "$"):
+		text, base = text[1:], 16
+	case d.DollarNumbers && strings.HasPrefix(text, "%"):
+		text, base = text[1:], 2
+	case strings.HasPrefix(text, "0X"):
+		text, base = text[2:], 16
+	case strings.HasSuffix(text, "H"):
+		text, base = text[:len(text)-1], 16
+	case strings.HasSuffix(text, "D"):
+		text = text[:len(text)-1]
+	case strings.HasSuffix(text, "B"):
+		text, base = text[:len(text)-1], 2
+	case strings.HasSuffix(text, "O"), strings.HasSuffix(text, "Q"):
+		text, base = text[:len(text)-1], 8
+	}
+	return strconv.ParseUint(text, base, 32)
+}
+
+// hexLiteral returns value as a hex number literal.
+func hexLiteral(value uint64) string {
+	literal := fmt.Sprintf("%XH", value)
+	if isLetter(literal[0]) {
+		literal = "0" + literal
+	}
+	return literal
+}
+
+// readQuoted reads a string quoted by quote, in which two quotes stand for
+// one.
+func (l *Lexer) readQuoted(quote byte) string {
+	line := l.line
+	text := strings.Builder{}
+	for {
+		l.readChar()
+		switch {
+		case l.currentChar == quote && l.peekChar() == quote:
+			text.WriteByte(quote)
+			l.readChar()
+		case l.currentChar == quote:
+			l.readChar()
+			return text.String()
+		case l.currentChar == '\n' || l.currentChar == 0x00:
+			l.fail(fmt.Errorf("line %d: unterminated string", line))
+			return text.String()
+		default:
+			text.WriteByte(l.currentChar)
+		}
+	}
+}
+
+// nextNonBlank returns the next character that isn't a space or tab,
+// without reading it.
+func (l *Lexer) nextNonBlank() byte {
+	for i := l.position; i < len(l.input); i++ {
+		if l.input[i] != ' ' && l.input[i] != '\t' {
+			return l.input[i]
+		}
+	}
+	return 0x00
+}
+
+func (l *Lexer) skipToEnd() {
+	for l.currentChar != 0x00 {
+		l.readChar()
+	}
+}
+
+// fail records the first error found in the input.
+func (l *Lexer) fail(err error) {
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+func isBinary(char byte) bool {
+	return char == '0' || char == '1'
+}
@@ -1,8 +1,11 @@
 package lexer
 
 import (
+	"sort"
 	"strings"
 	"unicode"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
 )
 
 type TokenType string
@@ -10,6 +13,8 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int
+	Column  int // Byte offset of the token in its line, starting at 1
 }
 
 const (
@@ -18,6 +23,8 @@ const (
 	NUMBER   = "NUMBER"
 	COMMA    = "COMMA"
 	COLON    = "COLON"
+	LPAREN   = "LPAREN"
+	RPAREN   = "RPAREN"
 	STRING   = "STRING"
 	LABEL    = "LABEL"
 	COMMENT  = "COMMENT"
@@ -131,8 +138,55 @@ var mnemonics = map[string]TokenType{
 	"NOP": MNEMONIC,
 	"HLT": MNEMONIC,
 
+	// 8085, read as names unless the CPU has them
+	"RIM": MNEMONIC,
+	"SIM": MNEMONIC,
+
+	// UNDOCUMENTED 8085
+	"DSUB": MNEMONIC,
+	"ARHL": MNEMONIC,
+	"RDEL": MNEMONIC,
+	"LDHI": MNEMONIC,
+	"LDSI": MNEMONIC,
+	"RSTV": MNEMONIC,
+	"SHLX": MNEMONIC,
+	"LHLX": MNEMONIC,
+	"JNK":  MNEMONIC,
+	"JK":   MNEMONIC,
+
+	// UNDOCUMENTED 8080
+	"NOP_08":  MNEMONIC,
+	"NOP_10":  MNEMONIC,
+	"NOP_18":  MNEMONIC,
+	"NOP_20":  MNEMONIC,
+	"NOP_28":  MNEMONIC,
+	"NOP_30":  MNEMONIC,
+	"NOP_38":  MNEMONIC,
+	"JMP_CB":  MNEMONIC,
+	"RET_D9":  MNEMONIC,
+	"CALL_DD": MNEMONIC,
+	"CALL_ED": MNEMONIC,
+	"CALL_FD": MNEMONIC,
+
 	// OTHERS
-	"DB": MNEMONIC,
+	"DB":      MNEMONIC,
+	"ORG":     MNEMONIC,
+	"MEMORY":  MNEMONIC,
+	"IMPORT":  MNEMONIC,
+	"PHASE":   MNEMONIC,
+	"DEPHASE": MNEMONIC,
+	"OPCODE":  MNEMONIC,
+
+	// CPU SELECTION
+	".8080":  MNEMONIC,
+	".8085":  MNEMONIC,
+	".8085U": MNEMONIC,
+
+	// SEGMENTS AND LINKING
+	"CSEG":   MNEMONIC,
+	"DSEG":   MNEMONIC,
+	"PUBLIC": MNEMONIC,
+	"EXTRN":  MNEMONIC,
 }
 
 var registers = map[string]TokenType{
@@ -153,11 +207,23 @@ type Lexer struct {
 	position     int
 	readPosition int
 	currentChar  byte
+	line         int
+	lineStart    int // Position of the first character of the line
 	Tokens       []Token
+
+	dialect   *Dialect // Set by SetDialect, or nil for the assembler's own syntax
+	colon     bool     // A label without a colon was read, so the next token is one
+	colonLine int
+	colonCol  int
+	err       error
+
+	opcodes map[string]bool // Mnemonics added by AddMnemonic and OPCODE
+	opcode  bool            // OPCODE was read, so the next name is a mnemonic
+	cpu     isa.CPU         // Set by SetCPU and the CPU directives
 }
 
 func New(input string) *Lexer {
-	lexer := &Lexer{input: input}
+	lexer := &Lexer{input: input, line: 1}
 	lexer.readChar()
 	return lexer
 }
@@ -167,13 +233,17 @@ func (l *Lexer) Lex() ([]Token, error) {
 		l.Tokens = append(l.Tokens, token)
 	}
 
-	l.Tokens = append(l.Tokens, Token{Type: EOF})
+	l.Tokens = append(l.Tokens, Token{Type: EOF, Line: l.line, Column: l.column()})
 
-	// TODO: Make Lex() function actually detect errors
-	return l.Tokens, nil
+	// TODO: Detect errors in the assembler's own syntax, not just dialects
+	return l.Tokens, l.err
 }
 
 func (l *Lexer) readChar() {
+	if l.currentChar == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
 	if l.readPosition >= len(l.input) {
 		l.currentChar = 0x00
 	} else {
@@ -184,8 +254,17 @@ func (l *Lexer) readChar() {
 }
 
 func (l *Lexer) NextToken() Token {
-	token := Token{}
+	if l.colon {
+		l.colon = false
+		return Token{Type: COLON, Literal: ":", Line: l.colonLine, Column: l.colonCol}
+	}
 	l.skipWhitespace()
+	if l.dialect != nil {
+		if token, ok := l.dialectToken(); ok {
+			return token
+		}
+	}
+	token := Token{Line: l.line, Column: l.column()}
 
 	switch l.currentChar {
 	case ',':
@@ -194,12 +273,25 @@ func (l *Lexer) NextToken() Token {
 	case ':':
 		token.Type = COLON
 		token.Literal = ":"
+	case '(':
+		token.Type = LPAREN
+		token.Literal = "("
+	case ')':
+		token.Type = RPAREN
+		token.Literal = ")"
 	case ';':
 		token.Type = COMMENT
 		token.Literal = l.readComment()
 	case '\'':
 		token.Type = STRING
 		token.Literal = l.readString()
+	case '.':
+		// Directives like .8085 start with a dot
+		l.readChar()
+		literal := "." + strings.ToUpper(l.readToken())
+		token.Type = l.lookupToken(literal)
+		token.Literal = literal
+		return token
 
 	case 0x00:
 		token.Type = EOF
@@ -222,15 +314,22 @@ func (l *Lexer) NextToken() Token {
 	return token
 }
 
+// column returns the column of the current character.
+func (l *Lexer) column() int {
+	return min(l.position, len(l.input)) - l.lineStart + 1
+}
+
 func (l *Lexer) skipWhitespace() {
-	for l.currentChar == ' ' || l.currentChar == '\t' || l.currentChar == '\n' {
+	for l.currentChar == ' ' || l.currentChar == '\t' || l.currentChar == '\n' || l.currentChar == '\r' {
 		l.readChar()
 	}
 }
 
+// readToken reads an identifier: a letter followed by letters, digits and
+// underscores.
 func (l *Lexer) readToken() string {
 	position := l.position
-	for isLetter(l.currentChar) || isDigit(l.currentChar) {
+	for isLetter(l.currentChar) || isDigit(l.currentChar) || l.currentChar == '_' {
 		l.readChar()
 	}
 	return l.input[position:l.position]
@@ -277,9 +376,67 @@ func (l *Lexer) readString() string {
 	return l.input[position:l.position]
 }
 
+// IsMnemonic reports whether name is one of the assembler's own mnemonics
+// or directives.
+func IsMnemonic(name string) bool {
+	_, exists := mnemonics[strings.ToUpper(name)]
+	return exists
+}
+
+// Mnemonics returns the assembler's own mnemonics and directives, sorted.
+func Mnemonics() []string {
+	return sortedNames(mnemonics)
+}
+
+// Registers returns the names of the registers and register pairs, sorted.
+func Registers() []string {
+	return sortedNames(registers)
+}
+
+func sortedNames(names map[string]TokenType) []string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// SetCPU sets the processor the input is written for, until it selects
+// another with .8080, .8085 or .8085U. The 8085's instructions are only
+// mnemonics when the processor has them, so 8080 programs can use their
+// names as labels.
+func (l *Lexer) SetCPU(cpu isa.CPU) {
+	l.cpu = cpu
+}
+
+// AddMnemonic makes name a mnemonic, for instructions that aren't part of
+// the 8080. Names after an OPCODE directive are added automatically.
+func (l *Lexer) AddMnemonic(name string) {
+	if l.opcodes == nil {
+		l.opcodes = map[string]bool{}
+	}
+	l.opcodes[strings.ToUpper(name)] = true
+}
+
 func (l *Lexer) lookupToken(token string) TokenType {
 	token = strings.ToUpper(token)
-	if tokenType, exists := mnemonics[token]; exists {
+	if l.opcode {
+		l.opcode = false
+		if _, exists := registers[token]; !exists {
+			l.AddMnemonic(token)
+		}
+	}
+	if token == "OPCODE" {
+		l.opcode = true
+	}
+	if cpu, err := isa.ParseCPU(token); err == nil && strings.HasPrefix(token, ".") {
+		l.cpu = cpu
+	}
+	if l.opcodes[token] {
+		return MNEMONIC
+	}
+	if tokenType, exists := mnemonics[token]; exists && isa.Requires(token) <= l.cpu {
 		return tokenType
 	}
 	if tokenType, exists := registers[token]; exists {
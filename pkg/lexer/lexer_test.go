@@ -16,279 +16,279 @@ func TestLexer_Lex(t *testing.T) {
 			name:  "move, load and store mnemonics",
 			input: "MOV MVI LXI STAX LDAX STA LDA SHLD LHLD XCHG",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "MOV"},
-				{Type: MNEMONIC, Literal: "MVI"},
-				{Type: MNEMONIC, Literal: "LXI"},
-				{Type: MNEMONIC, Literal: "STAX"},
-				{Type: MNEMONIC, Literal: "LDAX"},
-				{Type: MNEMONIC, Literal: "STA"},
-				{Type: MNEMONIC, Literal: "LDA"},
-				{Type: MNEMONIC, Literal: "SHLD"},
-				{Type: MNEMONIC, Literal: "LHLD"},
-				{Type: MNEMONIC, Literal: "XCHG"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "MOV", Line: 1},
+				{Type: MNEMONIC, Literal: "MVI", Line: 1},
+				{Type: MNEMONIC, Literal: "LXI", Line: 1},
+				{Type: MNEMONIC, Literal: "STAX", Line: 1},
+				{Type: MNEMONIC, Literal: "LDAX", Line: 1},
+				{Type: MNEMONIC, Literal: "STA", Line: 1},
+				{Type: MNEMONIC, Literal: "LDA", Line: 1},
+				{Type: MNEMONIC, Literal: "SHLD", Line: 1},
+				{Type: MNEMONIC, Literal: "LHLD", Line: 1},
+				{Type: MNEMONIC, Literal: "XCHG", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "stack operation mnemonics",
 			input: "PUSH POP XTHL SPHL INX DCX DAD",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "PUSH"},
-				{Type: MNEMONIC, Literal: "POP"},
-				{Type: MNEMONIC, Literal: "XTHL"},
-				{Type: MNEMONIC, Literal: "SPHL"},
-				{Type: MNEMONIC, Literal: "INX"},
-				{Type: MNEMONIC, Literal: "DCX"},
-				{Type: MNEMONIC, Literal: "DAD"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "PUSH", Line: 1},
+				{Type: MNEMONIC, Literal: "POP", Line: 1},
+				{Type: MNEMONIC, Literal: "XTHL", Line: 1},
+				{Type: MNEMONIC, Literal: "SPHL", Line: 1},
+				{Type: MNEMONIC, Literal: "INX", Line: 1},
+				{Type: MNEMONIC, Literal: "DCX", Line: 1},
+				{Type: MNEMONIC, Literal: "DAD", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "jump mnemonics",
 			input: "JMP JC JNC JZ JNZ JP JM JPE JPO PCHL",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "JMP"},
-				{Type: MNEMONIC, Literal: "JC"},
-				{Type: MNEMONIC, Literal: "JNC"},
-				{Type: MNEMONIC, Literal: "JZ"},
-				{Type: MNEMONIC, Literal: "JNZ"},
-				{Type: MNEMONIC, Literal: "JP"},
-				{Type: MNEMONIC, Literal: "JM"},
-				{Type: MNEMONIC, Literal: "JPE"},
-				{Type: MNEMONIC, Literal: "JPO"},
-				{Type: MNEMONIC, Literal: "PCHL"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "JMP", Line: 1},
+				{Type: MNEMONIC, Literal: "JC", Line: 1},
+				{Type: MNEMONIC, Literal: "JNC", Line: 1},
+				{Type: MNEMONIC, Literal: "JZ", Line: 1},
+				{Type: MNEMONIC, Literal: "JNZ", Line: 1},
+				{Type: MNEMONIC, Literal: "JP", Line: 1},
+				{Type: MNEMONIC, Literal: "JM", Line: 1},
+				{Type: MNEMONIC, Literal: "JPE", Line: 1},
+				{Type: MNEMONIC, Literal: "JPO", Line: 1},
+				{Type: MNEMONIC, Literal: "PCHL", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "call mnemonics",
 			input: "CALL CC CNC CZ CNZ CP CM CPE CPO",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "CALL"},
-				{Type: MNEMONIC, Literal: "CC"},
-				{Type: MNEMONIC, Literal: "CNC"},
-				{Type: MNEMONIC, Literal: "CZ"},
-				{Type: MNEMONIC, Literal: "CNZ"},
-				{Type: MNEMONIC, Literal: "CP"},
-				{Type: MNEMONIC, Literal: "CM"},
-				{Type: MNEMONIC, Literal: "CPE"},
-				{Type: MNEMONIC, Literal: "CPO"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "CALL", Line: 1},
+				{Type: MNEMONIC, Literal: "CC", Line: 1},
+				{Type: MNEMONIC, Literal: "CNC", Line: 1},
+				{Type: MNEMONIC, Literal: "CZ", Line: 1},
+				{Type: MNEMONIC, Literal: "CNZ", Line: 1},
+				{Type: MNEMONIC, Literal: "CP", Line: 1},
+				{Type: MNEMONIC, Literal: "CM", Line: 1},
+				{Type: MNEMONIC, Literal: "CPE", Line: 1},
+				{Type: MNEMONIC, Literal: "CPO", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "return mnemonics",
 			input: "RET RC RNC RZ RNZ RP RM RPE RPO",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "RET"},
-				{Type: MNEMONIC, Literal: "RC"},
-				{Type: MNEMONIC, Literal: "RNC"},
-				{Type: MNEMONIC, Literal: "RZ"},
-				{Type: MNEMONIC, Literal: "RNZ"},
-				{Type: MNEMONIC, Literal: "RP"},
-				{Type: MNEMONIC, Literal: "RM"},
-				{Type: MNEMONIC, Literal: "RPE"},
-				{Type: MNEMONIC, Literal: "RPO"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "RET", Line: 1},
+				{Type: MNEMONIC, Literal: "RC", Line: 1},
+				{Type: MNEMONIC, Literal: "RNC", Line: 1},
+				{Type: MNEMONIC, Literal: "RZ", Line: 1},
+				{Type: MNEMONIC, Literal: "RNZ", Line: 1},
+				{Type: MNEMONIC, Literal: "RP", Line: 1},
+				{Type: MNEMONIC, Literal: "RM", Line: 1},
+				{Type: MNEMONIC, Literal: "RPE", Line: 1},
+				{Type: MNEMONIC, Literal: "RPO", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "restart mnemonic",
 			input: "RST",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "RST"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "RST", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "increment and decrement mnemonics",
 			input: "INR DCR",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "INR"},
-				{Type: MNEMONIC, Literal: "DCR"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "INR", Line: 1},
+				{Type: MNEMONIC, Literal: "DCR", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "add and subtract mnemonics",
 			input: "ADD ADC ADI ACI SUB SBB SUI SBI",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "ADD"},
-				{Type: MNEMONIC, Literal: "ADC"},
-				{Type: MNEMONIC, Literal: "ADI"},
-				{Type: MNEMONIC, Literal: "ACI"},
-				{Type: MNEMONIC, Literal: "SUB"},
-				{Type: MNEMONIC, Literal: "SBB"},
-				{Type: MNEMONIC, Literal: "SUI"},
-				{Type: MNEMONIC, Literal: "SBI"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "ADD", Line: 1},
+				{Type: MNEMONIC, Literal: "ADC", Line: 1},
+				{Type: MNEMONIC, Literal: "ADI", Line: 1},
+				{Type: MNEMONIC, Literal: "ACI", Line: 1},
+				{Type: MNEMONIC, Literal: "SUB", Line: 1},
+				{Type: MNEMONIC, Literal: "SBB", Line: 1},
+				{Type: MNEMONIC, Literal: "SUI", Line: 1},
+				{Type: MNEMONIC, Literal: "SBI", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "logical mnemonics",
 			input: "ANA XRA ORA CMP ANI XRI ORI CPI",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "ANA"},
-				{Type: MNEMONIC, Literal: "XRA"},
-				{Type: MNEMONIC, Literal: "ORA"},
-				{Type: MNEMONIC, Literal: "CMP"},
-				{Type: MNEMONIC, Literal: "ANI"},
-				{Type: MNEMONIC, Literal: "XRI"},
-				{Type: MNEMONIC, Literal: "ORI"},
-				{Type: MNEMONIC, Literal: "CPI"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "ANA", Line: 1},
+				{Type: MNEMONIC, Literal: "XRA", Line: 1},
+				{Type: MNEMONIC, Literal: "ORA", Line: 1},
+				{Type: MNEMONIC, Literal: "CMP", Line: 1},
+				{Type: MNEMONIC, Literal: "ANI", Line: 1},
+				{Type: MNEMONIC, Literal: "XRI", Line: 1},
+				{Type: MNEMONIC, Literal: "ORI", Line: 1},
+				{Type: MNEMONIC, Literal: "CPI", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "rotate mnemonics",
 			input: "RLC RRC RAL RAR",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "RLC"},
-				{Type: MNEMONIC, Literal: "RRC"},
-				{Type: MNEMONIC, Literal: "RAL"},
-				{Type: MNEMONIC, Literal: "RAR"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "RLC", Line: 1},
+				{Type: MNEMONIC, Literal: "RRC", Line: 1},
+				{Type: MNEMONIC, Literal: "RAL", Line: 1},
+				{Type: MNEMONIC, Literal: "RAR", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "special mnemonics",
 			input: "CMA STC CMC DAA",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "CMA"},
-				{Type: MNEMONIC, Literal: "STC"},
-				{Type: MNEMONIC, Literal: "CMC"},
-				{Type: MNEMONIC, Literal: "DAA"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "CMA", Line: 1},
+				{Type: MNEMONIC, Literal: "STC", Line: 1},
+				{Type: MNEMONIC, Literal: "CMC", Line: 1},
+				{Type: MNEMONIC, Literal: "DAA", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "input/output mnemonics",
 			input: "IN OUT",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "IN"},
-				{Type: MNEMONIC, Literal: "OUT"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "IN", Line: 1},
+				{Type: MNEMONIC, Literal: "OUT", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "control mnemonics",
 			input: "EI DI NOP HLT",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "EI"},
-				{Type: MNEMONIC, Literal: "DI"},
-				{Type: MNEMONIC, Literal: "NOP"},
-				{Type: MNEMONIC, Literal: "HLT"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "EI", Line: 1},
+				{Type: MNEMONIC, Literal: "DI", Line: 1},
+				{Type: MNEMONIC, Literal: "NOP", Line: 1},
+				{Type: MNEMONIC, Literal: "HLT", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "other mnemonics",
 			input: "DB",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "DB"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "DB", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "general purpose registers",
 			input: "A B C D E H L M",
 			want: []Token{
-				{Type: REGISTER, Literal: "A"},
-				{Type: REGISTER, Literal: "B"},
-				{Type: REGISTER, Literal: "C"},
-				{Type: REGISTER, Literal: "D"},
-				{Type: REGISTER, Literal: "E"},
-				{Type: REGISTER, Literal: "H"},
-				{Type: REGISTER, Literal: "L"},
-				{Type: REGISTER, Literal: "M"},
-				{Type: EOF},
+				{Type: REGISTER, Literal: "A", Line: 1},
+				{Type: REGISTER, Literal: "B", Line: 1},
+				{Type: REGISTER, Literal: "C", Line: 1},
+				{Type: REGISTER, Literal: "D", Line: 1},
+				{Type: REGISTER, Literal: "E", Line: 1},
+				{Type: REGISTER, Literal: "H", Line: 1},
+				{Type: REGISTER, Literal: "L", Line: 1},
+				{Type: REGISTER, Literal: "M", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "special purpose registers",
 			input: "SP PSW",
 			want: []Token{
-				{Type: REGISTER, Literal: "SP"},
-				{Type: REGISTER, Literal: "PSW"},
-				{Type: EOF},
+				{Type: REGISTER, Literal: "SP", Line: 1},
+				{Type: REGISTER, Literal: "PSW", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "case sensitivity",
 			input: "mov",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "MOV"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "MOV", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "single byte instruction without space",
 			input: "HLT",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "HLT"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "HLT", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "single byte instruction with space",
 			input: "  HLT  ",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "HLT"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "HLT", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "single byte instruction with comma and space after comma",
 			input: "MOV B, H",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "MOV"},
-				{Type: REGISTER, Literal: "B"},
-				{Type: COMMA, Literal: ","},
-				{Type: REGISTER, Literal: "H"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "MOV", Line: 1},
+				{Type: REGISTER, Literal: "B", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: REGISTER, Literal: "H", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "single byte instruction with comma and space before comma",
 			input: "MOV B ,H",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "MOV"},
-				{Type: REGISTER, Literal: "B"},
-				{Type: COMMA, Literal: ","},
-				{Type: REGISTER, Literal: "H"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "MOV", Line: 1},
+				{Type: REGISTER, Literal: "B", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: REGISTER, Literal: "H", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "two byte instruction",
 			input: "MVI B, 34h",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "MVI"},
-				{Type: REGISTER, Literal: "B"},
-				{Type: COMMA, Literal: ","},
-				{Type: NUMBER, Literal: "34H"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "MVI", Line: 1},
+				{Type: REGISTER, Literal: "B", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "34H", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "three byte instruction",
 			input: "LDA, 3412h",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "LDA"},
-				{Type: COMMA, Literal: ","},
-				{Type: NUMBER, Literal: "3412H"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "LDA", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "3412H", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		{
 			name:  "lots of extra space",
 			input: "    mov B ,      C   ",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "MOV"},
-				{Type: REGISTER, Literal: "B"},
-				{Type: COMMA, Literal: ","},
-				{Type: REGISTER, Literal: "C"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "MOV", Line: 1},
+				{Type: REGISTER, Literal: "B", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: REGISTER, Literal: "C", Line: 1},
+				{Type: EOF, Line: 1},
 			},
 		},
 		// TODO: Fix the capitalisation of 0X00 (should be 0x00)
@@ -296,15 +296,114 @@ func TestLexer_Lex(t *testing.T) {
 			name:  "DB with string",
 			input: "DB 'mystring', 0x04, 0x05, '$'",
 			want: []Token{
-				{Type: MNEMONIC, Literal: "DB"},
-				{Type: STRING, Literal: "mystring"},
-				{Type: COMMA, Literal: ","},
-				{Type: NUMBER, Literal: "0X04"},
-				{Type: COMMA, Literal: ","},
-				{Type: NUMBER, Literal: "0X05"},
-				{Type: COMMA, Literal: ","},
-				{Type: STRING, Literal: "$"},
-				{Type: EOF},
+				{Type: MNEMONIC, Literal: "DB", Line: 1},
+				{Type: STRING, Literal: "mystring", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "0X04", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "0X05", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: STRING, Literal: "$", Line: 1},
+				{Type: EOF, Line: 1},
+			},
+		},
+		{
+			name:  "line numbers",
+			input: "START:\tMVI A, 0x33 ; comment\n\n\tJMP START\n",
+			want: []Token{
+				{Type: LABEL, Literal: "START", Line: 1},
+				{Type: COLON, Literal: ":", Line: 1},
+				{Type: MNEMONIC, Literal: "MVI", Line: 1},
+				{Type: REGISTER, Literal: "A", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "0X33", Line: 1},
+				{Type: COMMENT, Literal: "; comment", Line: 1},
+				{Type: MNEMONIC, Literal: "JMP", Line: 3},
+				{Type: LABEL, Literal: "START", Line: 3},
+				{Type: EOF, Line: 4},
+			},
+		},
+		{
+			name:  "segment and linking directives",
+			input: "extrn PRINT\npublic MAIN, BUF\ncseg\ndseg",
+			want: []Token{
+				{Type: MNEMONIC, Literal: "EXTRN", Line: 1},
+				{Type: LABEL, Literal: "PRINT", Line: 1},
+				{Type: MNEMONIC, Literal: "PUBLIC", Line: 2},
+				{Type: LABEL, Literal: "MAIN", Line: 2},
+				{Type: COMMA, Literal: ",", Line: 2},
+				{Type: LABEL, Literal: "BUF", Line: 2},
+				{Type: MNEMONIC, Literal: "CSEG", Line: 3},
+				{Type: MNEMONIC, Literal: "DSEG", Line: 4},
+				{Type: EOF, Line: 4},
+			},
+		},
+		{
+			name:  "phase directives and underscores",
+			input: "copy: phase 8000\ndephase\nlxi b, copy_len",
+			want: []Token{
+				{Type: LABEL, Literal: "COPY", Line: 1},
+				{Type: COLON, Literal: ":", Line: 1},
+				{Type: MNEMONIC, Literal: "PHASE", Line: 1},
+				{Type: NUMBER, Literal: "8000", Line: 1},
+				{Type: MNEMONIC, Literal: "DEPHASE", Line: 2},
+				{Type: MNEMONIC, Literal: "LXI", Line: 3},
+				{Type: REGISTER, Literal: "B", Line: 3},
+				{Type: COMMA, Literal: ",", Line: 3},
+				{Type: LABEL, Literal: "COPY_LEN", Line: 3},
+				{Type: EOF, Line: 3},
+			},
+		},
+		{
+			name:  "8085 mnemonics and CPU directives",
+			input: ".8085u\nrim sim dsub jk\n.8080",
+			want: []Token{
+				{Type: MNEMONIC, Literal: ".8085U", Line: 1},
+				{Type: MNEMONIC, Literal: "RIM", Line: 2},
+				{Type: MNEMONIC, Literal: "SIM", Line: 2},
+				{Type: MNEMONIC, Literal: "DSUB", Line: 2},
+				{Type: MNEMONIC, Literal: "JK", Line: 2},
+				{Type: MNEMONIC, Literal: ".8080", Line: 3},
+				{Type: EOF, Line: 3},
+			},
+		},
+		{
+			name:  "8085 mnemonics are names on the 8080",
+			input: "jk: jmp jk\n.8085u\njk",
+			want: []Token{
+				{Type: LABEL, Literal: "JK", Line: 1},
+				{Type: COLON, Literal: ":", Line: 1},
+				{Type: MNEMONIC, Literal: "JMP", Line: 1},
+				{Type: LABEL, Literal: "JK", Line: 1},
+				{Type: MNEMONIC, Literal: ".8085U", Line: 2},
+				{Type: MNEMONIC, Literal: "JK", Line: 3},
+				{Type: EOF, Line: 3},
+			},
+		},
+		{
+			name:  "parentheses",
+			input: "LD A,(HL)",
+			want: []Token{
+				{Type: LABEL, Literal: "LD", Line: 1},
+				{Type: REGISTER, Literal: "A", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: LPAREN, Literal: "(", Line: 1},
+				{Type: LABEL, Literal: "HL", Line: 1},
+				{Type: RPAREN, Literal: ")", Line: 1},
+				{Type: EOF, Line: 1},
+			},
+		},
+		{
+			name:  "user-defined opcodes",
+			input: "swap\nOPCODE swap, 08\nswap",
+			want: []Token{
+				{Type: LABEL, Literal: "SWAP", Line: 1},
+				{Type: MNEMONIC, Literal: "OPCODE", Line: 2},
+				{Type: MNEMONIC, Literal: "SWAP", Line: 2},
+				{Type: COMMA, Literal: ",", Line: 2},
+				{Type: NUMBER, Literal: "08", Line: 2},
+				{Type: MNEMONIC, Literal: "SWAP", Line: 3},
+				{Type: EOF, Line: 3},
 			},
 		},
 	}
@@ -317,6 +416,234 @@ func TestLexer_Lex(t *testing.T) {
 				t.Errorf("Lexer.Lex() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if got := withoutColumns(got); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lexer.Lex() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLexer_LexDialect(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect *Dialect
+		input   string
+		want    []Token
+		wantErr string
+	}{
+		{
+			name:    "radix suffixes",
+			dialect: ASM80,
+			input:   "DB 10, 10H, 0FFh, 101B, 17O, 17Q, 10D",
+			want: []Token{
+				{Type: MNEMONIC, Literal: "DB", Line: 1},
+				{Type: NUMBER, Literal: "0AH", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "10H", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "0FFH", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "5H", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "0FH", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "0FH", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "0AH", Line: 1},
+				{Type: EOF, Line: 1},
+			},
+		},
+		{
+			name:    "dollar separators",
+			dialect: ASM,
+			input:   "JMP BDOS$ENTRY\nMVI A, 1111$0000B",
+			want: []Token{
+				{Type: MNEMONIC, Literal: "JMP", Line: 1},
+				{Type: LABEL, Literal: "BDOSENTRY", Line: 1},
+				{Type: MNEMONIC, Literal: "MVI", Line: 2},
+				{Type: REGISTER, Literal: "A", Line: 2},
+				{Type: COMMA, Literal: ",", Line: 2},
+				{Type: NUMBER, Literal: "0F0H", Line: 2},
+				{Type: EOF, Line: 2},
+			},
+		},
+		{
+			name:    "dollar and percent numbers",
+			dialect: TASM,
+			input:   " .DB $FF, %101, 0x10",
+			want: []Token{
+				{Type: MNEMONIC, Literal: "DB", Line: 1},
+				{Type: NUMBER, Literal: "0FFH", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "5H", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "10H", Line: 1},
+				{Type: EOF, Line: 1},
+			},
+		},
+		{
+			name:    "first column comments",
+			dialect: MAC,
+			input:   "* comment\n NOP ; * not a line comment",
+			want: []Token{
+				{Type: COMMENT, Literal: "* comment", Line: 1},
+				{Type: MNEMONIC, Literal: "NOP", Line: 2},
+				{Type: COMMENT, Literal: "; * not a line comment", Line: 2},
+				{Type: EOF, Line: 2},
+			},
+		},
+		{
+			name:    "optional colons",
+			dialect: TASM,
+			input:   "START NOP\nLOOP: JMP START\nEND",
+			want: []Token{
+				{Type: LABEL, Literal: "START", Line: 1},
+				{Type: COLON, Literal: ":", Line: 1},
+				{Type: MNEMONIC, Literal: "NOP", Line: 1},
+				{Type: LABEL, Literal: "LOOP", Line: 2},
+				{Type: COLON, Literal: ":", Line: 2},
+				{Type: MNEMONIC, Literal: "JMP", Line: 2},
+				{Type: LABEL, Literal: "START", Line: 2},
+				{Type: EOF, Line: 3},
+			},
+		},
+		{
+			name:    "aliases and ignored directives",
+			dialect: M80,
+			input:   "TITLE Test program\n.XLIST\nDEFB 1 ; bytes\nEXT PRINT$",
+			want: []Token{
+				{Type: MNEMONIC, Literal: "DB", Line: 3},
+				{Type: NUMBER, Literal: "1H", Line: 3},
+				{Type: COMMENT, Literal: "; bytes", Line: 3},
+				{Type: MNEMONIC, Literal: "EXTRN", Line: 4},
+				{Type: LABEL, Literal: "PRINT$", Line: 4},
+				{Type: EOF, Line: 4},
+			},
+		},
+		{
+			name:    "strings and characters",
+			dialect: M80,
+			input:   `DB 'it''s', "A", 'B'`,
+			want: []Token{
+				{Type: MNEMONIC, Literal: "DB", Line: 1},
+				{Type: STRING, Literal: "it's", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "41H", Line: 1},
+				{Type: COMMA, Literal: ",", Line: 1},
+				{Type: NUMBER, Literal: "42H", Line: 1},
+				{Type: EOF, Line: 1},
+			},
+		},
+		{
+			name:    "end of file",
+			dialect: ASM,
+			input:   "NOP\nEND\nnot assembled\x1a\x1a",
+			want: []Token{
+				{Type: MNEMONIC, Literal: "NOP", Line: 1},
+				{Type: EOF, Line: 3},
+			},
+		},
+		{
+			name:    "invalid number",
+			dialect: ASM80,
+			input:   "NOP\nMVI A, 19B",
+			wantErr: "line 2: invalid number: 19B",
+		},
+		{
+			name:    "unterminated string",
+			dialect: MAC,
+			input:   "DB 'oops\nNOP",
+			wantErr: "line 1: unterminated string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lexer := New(tt.input)
+			lexer.SetDialect(tt.dialect)
+			got, err := lexer.Lex()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Lexer.Lex() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lexer.Lex() error = %v", err)
+			}
+			if got := withoutColumns(got); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lexer.Lex() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// withoutColumns clears the columns of tokens, for tests that only check
+// their types, literals and lines.
+func withoutColumns(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Column = 0
+	}
+	return tokens
+}
+
+func TestLexer_LexColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect *Dialect
+		input   string
+		want    []Token
+	}{
+		{
+			name:  "instruction with label and comment",
+			input: "START:\tMVI A, 0x33 ; set A\n  RET",
+			want: []Token{
+				{Type: LABEL, Literal: "START", Line: 1, Column: 1},
+				{Type: COLON, Literal: ":", Line: 1, Column: 6},
+				{Type: MNEMONIC, Literal: "MVI", Line: 1, Column: 8},
+				{Type: REGISTER, Literal: "A", Line: 1, Column: 12},
+				{Type: COMMA, Literal: ",", Line: 1, Column: 13},
+				{Type: NUMBER, Literal: "0X33", Line: 1, Column: 15},
+				{Type: COMMENT, Literal: "; set A", Line: 1, Column: 20},
+				{Type: MNEMONIC, Literal: "RET", Line: 2, Column: 3},
+				{Type: EOF, Line: 2, Column: 6},
+			},
+		},
+		{
+			name:  "strings",
+			input: "DB 'AB', 1",
+			want: []Token{
+				{Type: MNEMONIC, Literal: "DB", Line: 1, Column: 1},
+				{Type: STRING, Literal: "AB", Line: 1, Column: 4},
+				{Type: COMMA, Literal: ",", Line: 1, Column: 8},
+				{Type: NUMBER, Literal: "1", Line: 1, Column: 10},
+				{Type: EOF, Line: 1, Column: 11},
+			},
+		},
+		{
+			name:    "label without a colon",
+			dialect: TASM,
+			input:   "LOOP  JMP LOOP",
+			want: []Token{
+				{Type: LABEL, Literal: "LOOP", Line: 1, Column: 1},
+				{Type: COLON, Literal: ":", Line: 1, Column: 5},
+				{Type: MNEMONIC, Literal: "JMP", Line: 1, Column: 7},
+				{Type: LABEL, Literal: "LOOP", Line: 1, Column: 11},
+				{Type: EOF, Line: 1, Column: 15},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lexer := New(tt.input)
+			if tt.dialect != nil {
+				lexer.SetDialect(tt.dialect)
+			}
+			got, err := lexer.Lex()
+			if err != nil {
+				t.Fatalf("Lexer.Lex() error = %v", err)
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Lexer.Lex() got = %v, want %v", got, tt.want)
 			}
@@ -0,0 +1,269 @@
+package linker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/lukepeterson/go8080assembler/pkg/memory"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+)
+
+// Layout is where the linker places the segments. Each module's code
+// segment follows the previous module's, starting at Code, and likewise for
+// data segments starting at Data.
+type Layout struct {
+	Code uint16
+	Data uint16
+
+	// If DataAfterCode is set, Data is ignored and the data segments start
+	// immediately after the last code segment.
+	DataAfterCode bool
+}
+
+// Placement is where a module's segments were placed.
+type Placement struct {
+	Module   string
+	Code     uint16
+	Data     uint16
+	CodeSize int
+	DataSize int
+}
+
+// Image is the result of linking: absolute bytecode starting at Origin, with
+// the address of every public symbol.
+type Image struct {
+	Origin     uint16
+	Bytecode   []byte
+	Symbols    map[string]uint16
+	Placements []Placement
+}
+
+// Link places the segments of each module according to layout, resolves
+// external symbols against the public symbols of all the modules, and
+// returns the absolute image. Every duplicate and undefined symbol is
+// reported, not just the first.
+func Link(modules []*object.Module, layout Layout) (*Image, error) {
+	for _, module := range modules {
+		if err := module.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	placements, err := place(modules, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	base := func(i int, s object.Segment) uint16 {
+		switch s {
+		case object.Code:
+			return placements[i].Code
+		case object.Data:
+			return placements[i].Data
+		}
+		return 0
+	}
+
+	// Build the symbol table
+	errs := []error{}
+	symbols := map[string]uint16{}
+	definedBy := map[string]string{}
+	for i, module := range modules {
+		for _, symbol := range module.Symbols {
+			if other, duplicate := definedBy[symbol.Name]; duplicate {
+				errs = append(errs, fmt.Errorf("duplicate symbol %s defined in %s and %s", symbol.Name, other, module.Name))
+				continue
+			}
+			definedBy[symbol.Name] = module.Name
+			symbols[symbol.Name] = base(i, symbol.Segment) + symbol.Offset
+		}
+	}
+
+	// Copy each module into the image, then relocate and fix up its
+	// addresses in place
+	origin, end := bounds(modules, placements)
+	bytecode := make([]byte, end-origin)
+	for i, module := range modules {
+		code := region(bytecode, int(placements[i].Code)-origin, module.Code)
+		data := region(bytecode, int(placements[i].Data)-origin, module.Data)
+		segment := func(s object.Segment) []byte {
+			if s == object.Code {
+				return code
+			}
+			return data
+		}
+
+		for _, r := range module.Relocations {
+			add(segment(r.Segment), r.Offset, base(i, r.Target))
+		}
+		for _, f := range module.Fixups {
+			address, defined := symbols[f.Name]
+			if !defined {
+				errs = append(errs, fmt.Errorf("undefined symbol %s referenced in %s", f.Name, module.Name))
+				continue
+			}
+			add(segment(f.Segment), f.Offset, address)
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return nil, errors.Join(dedupe(errs)...)
+	}
+	return &Image{Origin: uint16(origin), Bytecode: bytecode, Symbols: symbols, Placements: placements}, nil
+}
+
+// place returns the address of each module's segments, checking that they
+// fit in memory and that the code and data don't overlap.
+func place(modules []*object.Module, layout Layout) ([]Placement, error) {
+	placements := make([]Placement, len(modules))
+	codeEnd := int(layout.Code)
+	for i, module := range modules {
+		placements[i] = Placement{Module: module.Name, Code: uint16(codeEnd), CodeSize: len(module.Code), DataSize: len(module.Data)}
+		codeEnd += len(module.Code)
+	}
+
+	dataStart := int(layout.Data)
+	if layout.DataAfterCode {
+		dataStart = codeEnd
+	}
+	dataEnd := dataStart
+	for i, module := range modules {
+		placements[i].Data = uint16(dataEnd)
+		dataEnd += len(module.Data)
+	}
+
+	if codeEnd > 0x10000 || dataEnd > 0x10000 {
+		return nil, errors.New("linked program doesn't fit in 64K")
+	}
+	codeStart := int(layout.Code)
+	if codeStart < codeEnd && dataStart < dataEnd && codeStart < dataEnd && dataStart < codeEnd {
+		return nil, fmt.Errorf("code (0x%04X-0x%04X) overlaps data (0x%04X-0x%04X)", codeStart, codeEnd-1, dataStart, dataEnd-1)
+	}
+	return placements, nil
+}
+
+// Blocks returns each module's code and data segments as memory blocks, for
+// checking the image against a memory map.
+func (img *Image) Blocks() []memory.Block {
+	blocks := []memory.Block{}
+	for _, placement := range img.Placements {
+		blocks = append(blocks,
+			memory.Block{Name: placement.Module + " code", Start: placement.Code, Size: placement.CodeSize, Code: true},
+			memory.Block{Name: placement.Module + " data", Start: placement.Data, Size: placement.DataSize, Data: true})
+	}
+	return blocks
+}
+
+// bounds returns the lowest and one past the highest address used by any
+// segment.
+func bounds(modules []*object.Module, placements []Placement) (int, int) {
+	low, high := 0x10000, 0
+	for i, module := range modules {
+		for _, segment := range []struct {
+			address uint16
+			size    int
+		}{{placements[i].Code, len(module.Code)}, {placements[i].Data, len(module.Data)}} {
+			if segment.size == 0 {
+				continue
+			}
+			low = min(low, int(segment.address))
+			high = max(high, int(segment.address)+segment.size)
+		}
+	}
+	if low > high {
+		return 0, 0
+	}
+	return low, high
+}
+
+// region copies segment into bytecode at offset, and returns the copy.
+func region(bytecode []byte, offset int, segment []byte) []byte {
+	if len(segment) == 0 {
+		return nil
+	}
+	copied := bytecode[offset : offset+len(segment)]
+	copy(copied, segment)
+	return copied
+}
+
+// add adds value to the little endian 16-bit word at offset.
+func add(b []byte, offset uint16, value uint16) {
+	word := uint16(b[offset]) | uint16(b[offset+1])<<8
+	word += value
+	b[offset], b[offset+1] = byte(word), byte(word>>8)
+}
+
+// dedupe removes repeated errors from a sorted slice, so that a symbol
+// referenced several times from one module is only reported once.
+func dedupe(errs []error) []error {
+	unique := []error{}
+	for i, err := range errs {
+		if i == 0 || err.Error() != errs[i-1].Error() {
+			unique = append(unique, err)
+		}
+	}
+	return unique
+}
+
+// Search returns modules followed by the library modules needed to resolve
+// their external symbols, and the externals of those modules in turn.
+// Library modules that nothing refers to are left out, so that linking a
+// large library only adds the routines the program uses. As with L80, each
+// library is searched from start to end, so a module can be satisfied by a
+// later one in the same library; searching then repeats from the first
+// library until nothing more is added.
+func Search(modules []*object.Module, libraries ...[]*object.Module) []*object.Module {
+	linked := append([]*object.Module{}, modules...)
+	included := map[*object.Module]bool{}
+	defined := map[string]bool{}
+	for _, module := range modules {
+		included[module] = true
+		for _, symbol := range module.Symbols {
+			defined[symbol.Name] = true
+		}
+	}
+
+	undefined := func() map[string]bool {
+		names := map[string]bool{}
+		for _, module := range linked {
+			for _, f := range module.Fixups {
+				if !defined[f.Name] {
+					names[f.Name] = true
+				}
+			}
+		}
+		return names
+	}
+
+	// Keep searching until an entire pass adds nothing, as a module pulled
+	// in from one library can need a module from an earlier one
+	for added := true; added; {
+		added = false
+		for _, library := range libraries {
+			for _, module := range library {
+				if included[module] || !provides(module, undefined()) {
+					continue
+				}
+				included[module] = true
+				linked = append(linked, module)
+				for _, symbol := range module.Symbols {
+					defined[symbol.Name] = true
+				}
+				added = true
+			}
+		}
+	}
+	return linked
+}
+
+// provides reports whether module defines any of the names.
+func provides(module *object.Module, names map[string]bool) bool {
+	for _, symbol := range module.Symbols {
+		if names[symbol.Name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package linker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+)
+
+func assemble(t *testing.T, name string, input string) *object.Module {
+	t.Helper()
+	module, err := assembler.New(input).AssembleObject()
+	if err != nil {
+		t.Fatalf("AssembleObject(%s) error = %v", name, err)
+	}
+	module.Name = name
+	return module
+}
+
+const mainModule = `
+		PUBLIC START
+		EXTRN PRINT, MSG
+START:	LXI H, MSG
+		CALL PRINT
+		LDA COUNT
+		HLT
+		DSEG
+COUNT:	DB 0x03
+`
+
+const printModule = `
+		PUBLIC PRINT, MSG
+PRINT:	MOV A, M
+		RET
+		DSEG
+MSG:	DB 'Hi', 0x00
+`
+
+func TestLink(t *testing.T) {
+	tests := []struct {
+		name          string
+		modules       map[string]string
+		order         []string
+		layout        Layout
+		wantOrigin    uint16
+		wantBytecode  []byte
+		wantSymbols   map[string]uint16
+		wantErrorText []string
+	}{
+		{
+			name:       "data after code",
+			modules:    map[string]string{"MAIN": mainModule, "PRINT": printModule},
+			order:      []string{"MAIN", "PRINT"},
+			layout:     Layout{Code: 0x0100, DataAfterCode: true},
+			wantOrigin: 0x0100,
+			wantBytecode: []byte{
+				0x21, 0x0D, 0x01, // LXI H, MSG
+				0xCD, 0x0A, 0x01, // CALL PRINT
+				0x3A, 0x0C, 0x01, // LDA COUNT
+				0x76,       // HLT
+				0x7E, 0xC9, // PRINT
+				0x03,           // COUNT
+				'H', 'i', 0x00, // MSG
+			},
+			wantSymbols: map[string]uint16{"START": 0x0100, "PRINT": 0x010A, "MSG": 0x010D},
+		},
+		{
+			name:       "data below code",
+			modules:    map[string]string{"MAIN": mainModule, "PRINT": printModule},
+			order:      []string{"PRINT", "MAIN"},
+			layout:     Layout{Code: 0x0010, Data: 0x0008},
+			wantOrigin: 0x0008,
+			wantBytecode: []byte{
+				'H', 'i', 0x00, // MSG
+				0x03,                   // COUNT
+				0x00, 0x00, 0x00, 0x00, // gap
+				0x7E, 0xC9, // PRINT
+				0x21, 0x08, 0x00, // LXI H, MSG
+				0xCD, 0x10, 0x00, // CALL PRINT
+				0x3A, 0x0B, 0x00, // LDA COUNT
+				0x76, // HLT
+			},
+			wantSymbols: map[string]uint16{"START": 0x0012, "PRINT": 0x0010, "MSG": 0x0008},
+		},
+		{
+			name:          "undefined symbols",
+			modules:       map[string]string{"MAIN": mainModule},
+			order:         []string{"MAIN"},
+			layout:        Layout{DataAfterCode: true},
+			wantErrorText: []string{"undefined symbol MSG referenced in MAIN", "undefined symbol PRINT referenced in MAIN"},
+		},
+		{
+			name:          "duplicate symbols",
+			modules:       map[string]string{"MAIN": mainModule, "PRINT": printModule, "COPY": printModule},
+			order:         []string{"MAIN", "PRINT", "COPY"},
+			layout:        Layout{DataAfterCode: true},
+			wantErrorText: []string{"duplicate symbol MSG defined in PRINT and COPY", "duplicate symbol PRINT defined in PRINT and COPY"},
+		},
+		{
+			name:          "overlapping segments",
+			modules:       map[string]string{"MAIN": mainModule, "PRINT": printModule},
+			order:         []string{"MAIN", "PRINT"},
+			layout:        Layout{Code: 0x0000, Data: 0x0004},
+			wantErrorText: []string{"code (0x0000-0x000B) overlaps data (0x0004-0x0007)"},
+		},
+		{
+			name:          "too big",
+			modules:       map[string]string{"MAIN": mainModule, "PRINT": printModule},
+			order:         []string{"MAIN", "PRINT"},
+			layout:        Layout{Code: 0xFFF8, Data: 0x0000},
+			wantErrorText: []string{"doesn't fit in 64K"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modules := []*object.Module{}
+			for _, name := range tt.order {
+				modules = append(modules, assemble(t, name, tt.modules[name]))
+			}
+
+			image, err := Link(modules, tt.layout)
+			if len(tt.wantErrorText) > 0 {
+				if err == nil {
+					t.Fatalf("Link() error = nil, want %v", tt.wantErrorText)
+				}
+				for _, text := range tt.wantErrorText {
+					if !strings.Contains(err.Error(), text) {
+						t.Errorf("Link() error = %v, want it to contain %q", err, text)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Link() error = %v", err)
+			}
+			if image.Origin != tt.wantOrigin {
+				t.Errorf("Origin = 0x%04X, want 0x%04X", image.Origin, tt.wantOrigin)
+			}
+			if !reflect.DeepEqual(image.Bytecode, tt.wantBytecode) {
+				t.Errorf("Bytecode = % X, want % X", image.Bytecode, tt.wantBytecode)
+			}
+			if !reflect.DeepEqual(image.Symbols, tt.wantSymbols) {
+				t.Errorf("Symbols = %v, want %v", image.Symbols, tt.wantSymbols)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	library := []*object.Module{
+		assemble(t, "UNUSED", "PUBLIC UNUSED\nUNUSED: RET"),
+		assemble(t, "PRINT", "PUBLIC PRINT\nEXTRN PUTCH\nPRINT: CALL PUTCH\nRET"),
+		assemble(t, "PUTCH", "PUBLIC PUTCH\nPUTCH: OUT 0x01\nRET"),
+	}
+	other := []*object.Module{
+		assemble(t, "COPY", "PUBLIC PUTCH\nPUTCH: RET"),
+	}
+
+	tests := []struct {
+		name      string
+		modules   []*object.Module
+		libraries [][]*object.Module
+		want      []string
+	}{
+		{
+			name:      "only needed modules are linked",
+			modules:   []*object.Module{assemble(t, "MAIN", "EXTRN PRINT\nCALL PRINT\nHLT")},
+			libraries: [][]*object.Module{library},
+			want:      []string{"MAIN", "PRINT", "PUTCH"},
+		},
+		{
+			name:      "nothing needed",
+			modules:   []*object.Module{assemble(t, "MAIN", "HLT")},
+			libraries: [][]*object.Module{library},
+			want:      []string{"MAIN"},
+		},
+		{
+			name:      "first library wins",
+			modules:   []*object.Module{assemble(t, "MAIN", "EXTRN PUTCH\nCALL PUTCH\nHLT")},
+			libraries: [][]*object.Module{other, library},
+			want:      []string{"MAIN", "COPY"},
+		},
+		{
+			name:      "rest of the library is searched before earlier libraries",
+			modules:   []*object.Module{assemble(t, "MAIN", "EXTRN PRINT\nCALL PRINT\nHLT")},
+			libraries: [][]*object.Module{other, library},
+			want:      []string{"MAIN", "PRINT", "PUTCH"},
+		},
+		{
+			name:      "module needs an earlier library",
+			modules:   []*object.Module{assemble(t, "MAIN", "EXTRN PRINT\nCALL PRINT\nHLT")},
+			libraries: [][]*object.Module{other, library[:2]},
+			want:      []string{"MAIN", "PRINT", "COPY"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, module := range Search(tt.modules, tt.libraries...) {
+				got = append(got, module.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
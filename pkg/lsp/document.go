@@ -0,0 +1,353 @@
+package lsp
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/analysis"
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+	"github.com/lukepeterson/go8080assembler/pkg/ast"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+	"github.com/lukepeterson/go8080assembler/pkg/parser"
+)
+
+// document is an open document and what's known about it from its last
+// analysis.
+type document struct {
+	uri   string
+	lines []string
+
+	tokens      []lexer.Token
+	prog        *ast.Program // nil if the document doesn't parse
+	occurrences []occurrence
+	names       []string // Labels, sorted, kept from the last version that parsed
+
+	statements  map[int]statement // By line, if the document assembles
+	labels      map[string]uint16
+	relocatable bool // Assembled as an object module, so addresses are segment offsets
+
+	diagnostics []Diagnostic
+}
+
+// statement is an assembled statement and its bytes.
+type statement struct {
+	parser.Statement
+	code []byte
+}
+
+// occurrence is a use or definition of a symbol in the source.
+type occurrence struct {
+	name       string
+	pos        ast.Pos
+	length     int // In bytes
+	definition bool
+
+	// The definition isn't the symbol's name written out: PHASE block
+	// lengths are defined by their DEPHASE
+	implicit bool
+	phase    int // Line of the PHASE that an implicit definition ends
+}
+
+// analyze lexes, parses and assembles the text of a document. If it
+// doesn't parse, the labels of the previous version are kept for
+// completion.
+func analyze(uri string, text string, dialect *lexer.Dialect, previous *document) *document {
+	d := &document{uri: uri, lines: strings.Split(text, "\n"), diagnostics: []Diagnostic{}}
+	options := []assembler.Option{assembler.WithDirectory(directoryOf(uri))}
+	l := lexer.New(text)
+	if dialect != nil {
+		options = append(options, assembler.WithDialect(dialect))
+		l.SetDialect(dialect)
+	}
+	d.tokens, _ = l.Lex()
+
+	asm := assembler.New(text, options...)
+	prog, err := asm.Parse()
+	if err != nil {
+		d.report(SeverityError, err)
+		if previous != nil {
+			d.names = previous.names
+		}
+		return d
+	}
+	d.prog = prog
+	d.findOccurrences()
+	d.assemble(asm)
+	return d
+}
+
+// directoryOf returns the directory of a file URI, which IMPORT reads
+// symbol files relative to.
+func directoryOf(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.Dir(filepath.FromSlash(u.Path))
+}
+
+// assemble assembles the document, reporting any error and the issues Lint
+// finds. Modules that declare EXTRN symbols can't be assembled into an
+// absolute image, so they're assembled as object modules instead.
+func (d *document) assemble(asm *assembler.Assembler) {
+	image, err := asm.Assemble()
+	var module *object.Module
+	if err != nil && d.declaresExternals() {
+		module, err = asm.AssembleObject()
+	}
+	if err != nil {
+		d.report(SeverityError, err)
+		return
+	}
+
+	d.statements = map[int]statement{}
+	d.labels = asm.Labels()
+	d.relocatable = module != nil
+	for _, s := range asm.Statements() {
+		code, start := image, int(s.Address)-int(asm.Origin())
+		if module != nil {
+			code, start = module.Code, int(s.Address)
+			if s.Segment == object.Data {
+				code = module.Data
+			}
+		}
+		if start >= 0 && start+s.Size <= len(code) {
+			d.statements[s.Line] = statement{Statement: s, code: code[start : start+s.Size]}
+		}
+	}
+	if module != nil {
+		return
+	}
+
+	issues, err := analysis.Lint(analysis.NewProgram(asm, image))
+	if err != nil {
+		return
+	}
+	lines := map[uint16]int{}
+	for _, s := range asm.Statements() {
+		if _, found := lines[s.Address]; !found && s.Size > 0 {
+			lines[s.Address] = s.Line
+		}
+	}
+	for _, issue := range issues {
+		line := lines[issue.Address]
+		d.diagnostics = append(d.diagnostics, Diagnostic{Range: d.lineRange(line), Severity: SeverityWarning, Source: "go8080asm", Message: issue.Message})
+	}
+}
+
+func (d *document) declaresExternals() bool {
+	for _, s := range d.prog.Statements {
+		if directive, ok := s.(*ast.Directive); ok && directive.Name == "EXTRN" {
+			return true
+		}
+	}
+	return false
+}
+
+var linePrefix = regexp.MustCompile(`^line (\d+): `)
+
+// report adds a diagnostic for err. Errors from the parser carry the
+// position of the token they were found at, and errors from the lexer and
+// syntax tree start with their line number.
+func (d *document) report(severity int, err error) {
+	message := err.Error()
+	r := d.lineRange(1)
+	var parseErr *parser.Error
+	if errors.As(err, &parseErr) {
+		r = d.wordRange(parseErr.Line, parseErr.Column)
+	} else if match := linePrefix.FindStringSubmatch(message); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		r = d.lineRange(line)
+		message = message[len(match[0]):]
+	}
+	d.diagnostics = append(d.diagnostics, Diagnostic{Range: r, Severity: severity, Source: "go8080asm", Message: message})
+}
+
+// findOccurrences finds the labels defined and referred to in the program.
+// Names in MEMORY and OPCODE aren't symbols.
+func (d *document) findOccurrences() {
+	label := ""    // The label on the current statement
+	phase := ""    // The label on the open PHASE block
+	phaseLine := 0 // The line of the open PHASE block
+	for _, s := range d.prog.Statements {
+		var operands []ast.Operand
+		switch s := s.(type) {
+		case *ast.Label:
+			d.add(occurrence{name: s.Name, pos: s.Position, definition: true})
+			label = s.Name
+			continue
+		case *ast.Instruction:
+			operands = s.Operands
+		case *ast.Directive:
+			switch s.Name {
+			case "PHASE":
+				phase, phaseLine = label, s.Position.Line
+			case "DEPHASE":
+				if phase != "" {
+					d.add(occurrence{name: phase + "_LEN", pos: s.Position, definition: true, implicit: true, phase: phaseLine})
+				}
+				phase = ""
+			case "MEMORY", "OPCODE":
+				operands = nil
+			default:
+				operands = s.Operands
+			}
+			if s.Name == "EXTRN" {
+				for _, operand := range operands {
+					if name, ok := operand.(*ast.Name); ok {
+						d.add(occurrence{name: name.Name, pos: name.Position, definition: true})
+					}
+				}
+				operands = nil
+			}
+		case *ast.Comment:
+			continue
+		}
+		for _, operand := range operands {
+			if name, ok := operand.(*ast.Name); ok {
+				d.add(occurrence{name: name.Name, pos: name.Position})
+			}
+		}
+		label = ""
+	}
+
+	names := map[string]bool{}
+	for _, o := range d.occurrences {
+		if o.definition && !o.implicit {
+			names[o.name] = true
+		}
+	}
+	d.names = []string{}
+	for name := range names {
+		d.names = append(d.names, name)
+	}
+	sort.Strings(d.names)
+}
+
+func (d *document) add(o occurrence) {
+	o.length = d.wordEnd(o.pos.Line, o.pos.Column) - o.pos.Column
+	d.occurrences = append(d.occurrences, o)
+}
+
+// occurrenceAt returns the symbol at a line and column, including the
+// column just after it, where the cursor is after typing a name.
+func (d *document) occurrenceAt(line int, column int) (occurrence, bool) {
+	for _, o := range d.occurrences {
+		if o.pos.Line == line && column >= o.pos.Column && column <= o.pos.Column+o.length {
+			return o, true
+		}
+	}
+	return occurrence{}, false
+}
+
+// definitionOf returns the definition of a symbol.
+func (d *document) definitionOf(name string) (occurrence, bool) {
+	for _, o := range d.occurrences {
+		if o.name == name && o.definition {
+			return o, true
+		}
+	}
+	return occurrence{}, false
+}
+
+// line returns the text of a line, starting at 1, without its line ending.
+func (d *document) line(n int) string {
+	if n < 1 || n > len(d.lines) {
+		return ""
+	}
+	return strings.TrimSuffix(d.lines[n-1], "\r")
+}
+
+// position returns the protocol position of a line and byte column, both
+// starting at 1.
+func (d *document) position(line int, column int) Position {
+	text := d.line(line)
+	column = min(max(column-1, 0), len(text))
+	return Position{Line: max(line-1, 0), Character: utf16Len(text[:column])}
+}
+
+// column returns the line and byte column of a protocol position.
+func (d *document) column(p Position) (int, int) {
+	text := d.line(p.Line + 1)
+	units := 0
+	for i, r := range text {
+		if units >= p.Character {
+			return p.Line + 1, i + 1
+		}
+		units += units16(r)
+	}
+	return p.Line + 1, len(text) + 1
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += units16(r)
+	}
+	return n
+}
+
+// units16 returns the number of UTF-16 code units in r.
+func units16(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// separators end the words in a line.
+const separators = " \t,:;()'\""
+
+// wordEnd returns the column after the word that starts at a column: a
+// name, number or string, or a single character of punctuation.
+func (d *document) wordEnd(line int, column int) int {
+	text := d.line(line)
+	i := column - 1
+	if i < 0 || i >= len(text) {
+		return column
+	}
+	if quote := text[i]; quote == '\'' || quote == '"' {
+		for i++; i < len(text); i++ {
+			if text[i] == quote {
+				return i + 2
+			}
+		}
+		return len(text) + 1
+	}
+	for i < len(text) && !strings.ContainsRune(separators, rune(text[i])) {
+		i++
+	}
+	if i == column-1 {
+		i++
+	}
+	return i + 1
+}
+
+// wordRange returns the range of the word that starts at a column, or of
+// the whole line if there's no column.
+func (d *document) wordRange(line int, column int) Range {
+	if column < 1 {
+		return d.lineRange(line)
+	}
+	return Range{Start: d.position(line, column), End: d.position(line, d.wordEnd(line, column))}
+}
+
+// lineRange returns the range of the text on a line, without the space
+// around it.
+func (d *document) lineRange(line int) Range {
+	text := d.line(line)
+	start := len(text) - len(strings.TrimLeft(text, " \t"))
+	end := len(strings.TrimRight(text, " \t"))
+	return Range{Start: d.position(line, start+1), End: d.position(line, max(end, start)+1)}
+}
+
+// occurrenceRange returns the range of a symbol in the source.
+func (d *document) occurrenceRange(o occurrence) Range {
+	return Range{Start: d.position(o.pos.Line, o.pos.Column), End: d.position(o.pos.Line, o.pos.Column+o.length)}
+}
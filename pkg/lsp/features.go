@@ -0,0 +1,395 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/ast"
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+	"github.com/lukepeterson/go8080assembler/pkg/sim"
+)
+
+// hover describes the symbol at a position, or the statement on its line:
+// the bytes it assembled to and, for instructions, the clock cycles it
+// takes and the flags it affects.
+func (d *document) hover(p Position) *Hover {
+	line, column := d.column(p)
+	if o, found := d.occurrenceAt(line, column); found {
+		text := d.describeSymbol(o.name)
+		if text == "" {
+			return nil
+		}
+		r := d.occurrenceRange(o)
+		return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &r}
+	}
+
+	node := d.statementAt(line)
+	if node == nil || column < node.Pos().Column {
+		return nil
+	}
+	// Until the document assembles, only what the source says is known
+	s, assembled := d.statements[line]
+	text := "```asm\n" + d.code(line, node.Pos().Column) + "\n```\n\n"
+	switch node := node.(type) {
+	case *ast.Instruction:
+		if !assembled {
+			text += "Flags: " + flagsAffected(node)
+			break
+		}
+		text += d.describeBytes(s)
+		if len(s.code) > 0 && lexer.IsMnemonic(node.Mnemonic) && isa.Requires(node.Mnemonic) == isa.I8080 {
+			cycles, taken := sim.Cycles(s.code[0])
+			if cycles == taken {
+				text += fmt.Sprintf("\n\nCycles: %d", cycles)
+			} else {
+				text += fmt.Sprintf("\n\nCycles: %d, or %d when the condition is met", cycles, taken)
+			}
+			text += "\n\nFlags: " + flagsAffected(node)
+		}
+	case *ast.Directive:
+		if node.Name != "DB" || !assembled {
+			return nil
+		}
+		text += d.describeBytes(s)
+	}
+	r := d.lineRange(line)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &r}
+}
+
+// describeSymbol returns what's known about a symbol, or "" if it isn't
+// defined.
+func (d *document) describeSymbol(name string) string {
+	definition, defined := d.definitionOf(name)
+	switch {
+	case !defined:
+		return ""
+	case definition.implicit:
+		text := fmt.Sprintf("**%s**: length of the PHASE block on line %d", name, definition.phase)
+		if d.statements != nil {
+			length := 0
+			for line, s := range d.statements {
+				if line > definition.phase && line < definition.pos.Line {
+					length += s.Size
+				}
+			}
+			text += fmt.Sprintf(", 0x%04X", length)
+		}
+		return text
+	}
+	if address, found := d.labels[name]; found {
+		if d.relocatable {
+			return fmt.Sprintf("**%s**: label at offset 0x%04X in its segment", name, address)
+		}
+		return fmt.Sprintf("**%s**: label at 0x%04X", name, address)
+	}
+	if d.relocatable {
+		return fmt.Sprintf("**%s**: external symbol, resolved when linking", name)
+	}
+	return fmt.Sprintf("**%s**", name)
+}
+
+// describeBytes returns the bytes a statement assembled to and where.
+func (d *document) describeBytes(s statement) string {
+	const shown = 16
+	bytes := fmt.Sprintf("% X", s.code[:min(len(s.code), shown)])
+	if len(s.code) > shown {
+		bytes += fmt.Sprintf(" … (%d bytes)", len(s.code))
+	}
+	if d.relocatable {
+		return fmt.Sprintf("Bytes: `%s` at offset 0x%04X in the %s segment", bytes, s.Address, s.Segment)
+	}
+	return fmt.Sprintf("Bytes: `%s` at 0x%04X", bytes, s.Address)
+}
+
+// flagsByMnemonic are the flags that each instruction changing them
+// affects.
+var flagsByMnemonic = map[string]string{
+	"ADD": "S Z AC P CY", "ADC": "S Z AC P CY", "SUB": "S Z AC P CY", "SBB": "S Z AC P CY",
+	"ANA": "S Z AC P CY", "XRA": "S Z AC P CY", "ORA": "S Z AC P CY", "CMP": "S Z AC P CY",
+	"ADI": "S Z AC P CY", "ACI": "S Z AC P CY", "SUI": "S Z AC P CY", "SBI": "S Z AC P CY",
+	"ANI": "S Z AC P CY", "XRI": "S Z AC P CY", "ORI": "S Z AC P CY", "CPI": "S Z AC P CY",
+	"DAA": "S Z AC P CY", "INR": "S Z AC P", "DCR": "S Z AC P", "DAD": "CY",
+	"RLC": "CY", "RRC": "CY", "RAL": "CY", "RAR": "CY", "STC": "CY", "CMC": "CY",
+}
+
+func flagsAffected(instruction *ast.Instruction) string {
+	if instruction.Mnemonic == "POP" && len(instruction.Operands) == 1 {
+		if r, ok := instruction.Operands[0].(*ast.Register); ok && r.Name == "PSW" {
+			return "S Z AC P CY, from the stack"
+		}
+	}
+	if flags, found := flagsByMnemonic[instruction.Mnemonic]; found {
+		return flags
+	}
+	return "none"
+}
+
+// statementAt returns the instruction or directive on a line, or nil.
+func (d *document) statementAt(line int) ast.Statement {
+	if d.prog == nil {
+		return nil
+	}
+	for _, s := range d.prog.Statements {
+		switch s.(type) {
+		case *ast.Instruction, *ast.Directive:
+			if s.Pos().Line == line {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// code returns the text of a line from a column up to its comment.
+func (d *document) code(line int, column int) string {
+	text := d.line(line)[column-1:]
+	quoted := byte(0)
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quoted != 0:
+			if c == quoted {
+				quoted = 0
+			}
+		case c == '\'' || c == '"':
+			quoted = c
+		case c == ';':
+			text = text[:i]
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// definition returns where the symbol at a position is defined.
+func (d *document) definition(p Position) []Location {
+	o, found := d.occurrenceAt(d.column(p))
+	if !found {
+		return nil
+	}
+	definition, defined := d.definitionOf(o.name)
+	if !defined {
+		return nil
+	}
+	return []Location{{URI: d.uri, Range: d.occurrenceRange(definition)}}
+}
+
+// references returns every use of the symbol at a position, and its
+// definition if includeDeclaration is set.
+func (d *document) references(p Position, includeDeclaration bool) []Location {
+	o, found := d.occurrenceAt(d.column(p))
+	if !found {
+		return nil
+	}
+	locations := []Location{}
+	for _, other := range d.occurrences {
+		if other.name == o.name && (includeDeclaration || !other.definition) {
+			locations = append(locations, Location{URI: d.uri, Range: d.occurrenceRange(other)})
+		}
+	}
+	return locations
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// rename renames the label at a position everywhere it's used. Renaming
+// the label on a PHASE block renames uses of the block's length too.
+func (d *document) rename(p Position, newName string) (*WorkspaceEdit, error) {
+	o, found := d.occurrenceAt(d.column(p))
+	if !found {
+		return nil, &Error{Code: CodeRequestFailed, Message: "there's no label here to rename"}
+	}
+	definition, defined := d.definitionOf(o.name)
+	upper := strings.ToUpper(newName)
+	switch {
+	case !defined:
+		return nil, &Error{Code: CodeRequestFailed, Message: fmt.Sprintf("%s isn't defined in this file", o.name)}
+	case definition.implicit:
+		block := strings.TrimSuffix(o.name, "_LEN")
+		return nil, &Error{Code: CodeRequestFailed, Message: fmt.Sprintf("%s is the length of the PHASE block %s, so rename %s instead", o.name, block, block)}
+	case !validName.MatchString(newName):
+		return nil, &Error{Code: CodeRequestFailed, Message: fmt.Sprintf("invalid label: %q", newName)}
+	case lexer.IsMnemonic(upper):
+		return nil, &Error{Code: CodeRequestFailed, Message: fmt.Sprintf("%s is a mnemonic, so it can't be a label", upper)}
+	case isRegister(upper):
+		return nil, &Error{Code: CodeRequestFailed, Message: fmt.Sprintf("%s is a register, so it can't be a label", upper)}
+	case upper != o.name && d.defines(upper):
+		return nil, &Error{Code: CodeRequestFailed, Message: fmt.Sprintf("label %s is already defined", upper)}
+	}
+
+	_, phase := d.definitionOf(o.name + "_LEN")
+	edits := []TextEdit{}
+	for _, other := range d.occurrences {
+		switch {
+		case other.name == o.name:
+			edits = append(edits, TextEdit{Range: d.occurrenceRange(other), NewText: newName})
+		case phase && other.name == o.name+"_LEN" && !other.implicit:
+			// Only the block's name is replaced, keeping the _LEN
+			other.length -= len("_LEN")
+			edits = append(edits, TextEdit{Range: d.occurrenceRange(other), NewText: newName})
+		}
+	}
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{d.uri: edits}}, nil
+}
+
+func (d *document) defines(name string) bool {
+	_, defined := d.definitionOf(name)
+	return defined
+}
+
+func isRegister(name string) bool {
+	for _, r := range lexer.Registers() {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// symbols returns the labels defined in the document. Labels on data are
+// variables, PHASE block lengths are constants, and other labels are
+// functions.
+func (d *document) symbols() []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	if d.prog == nil {
+		return symbols
+	}
+	for i, s := range d.prog.Statements {
+		label, ok := s.(*ast.Label)
+		if !ok {
+			continue
+		}
+		kind := SymbolFunction
+		if next := nextStatement(d.prog.Statements[i+1:]); next != nil {
+			if directive, ok := next.(*ast.Directive); ok && directive.Name == "DB" {
+				kind = SymbolVariable
+			}
+		}
+		o, _ := d.definitionOf(label.Name)
+		symbol := DocumentSymbol{Name: label.Name, Kind: kind, Range: d.lineRange(label.Position.Line), SelectionRange: d.occurrenceRange(o)}
+		if address, found := d.labels[label.Name]; found {
+			symbol.Detail = fmt.Sprintf("0x%04X", address)
+		}
+		symbols = append(symbols, symbol)
+	}
+	for _, o := range d.occurrences {
+		if o.implicit {
+			r := d.occurrenceRange(o)
+			symbols = append(symbols, DocumentSymbol{Name: o.name, Kind: SymbolConstant, Range: r, SelectionRange: r})
+		}
+	}
+	return symbols
+}
+
+// nextStatement returns the first instruction or directive in statements.
+func nextStatement(statements []ast.Statement) ast.Statement {
+	for _, s := range statements {
+		switch s.(type) {
+		case *ast.Instruction, *ast.Directive:
+			return s
+		}
+	}
+	return nil
+}
+
+// completion returns mnemonics and directives at the start of a
+// statement, and registers and labels in its operands.
+func (d *document) completion(p Position) []CompletionItem {
+	line, column := d.column(p)
+	text := d.line(line)[:column-1]
+	if strings.Contains(text, ";") {
+		return nil
+	}
+	if i := strings.LastIndexByte(text, ':'); i >= 0 {
+		text = text[i+1:]
+	}
+
+	items := []CompletionItem{}
+	if !strings.ContainsAny(strings.TrimLeft(text, " \t"), " \t,") {
+		for _, mnemonic := range lexer.Mnemonics() {
+			detail := "instruction"
+			if isa.IsDirective(mnemonic) {
+				detail = "directive"
+			}
+			items = append(items, CompletionItem{Label: mnemonic, Kind: CompletionKeyword, Detail: detail})
+		}
+		return items
+	}
+	for _, register := range lexer.Registers() {
+		items = append(items, CompletionItem{Label: register, Kind: CompletionVariable, Detail: "register"})
+	}
+	for _, name := range d.names {
+		item := CompletionItem{Label: name, Kind: CompletionFunction, Detail: "label"}
+		if address, found := d.labels[name]; found && !d.relocatable {
+			item.Detail = fmt.Sprintf("label at 0x%04X", address)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// tokenTypes and tokenModifiers are the legend for semantic tokens.
+var (
+	tokenTypes     = []string{"keyword", "macro", "variable", "number", "string", "comment", "function"}
+	tokenModifiers = []string{"declaration"}
+)
+
+const (
+	tokenKeyword = iota
+	tokenMacro
+	tokenVariable
+	tokenNumber
+	tokenString
+	tokenComment
+	tokenFunction
+)
+
+// semanticTokens classifies the tokens in the document: mnemonics are
+// keywords, directives macros, registers variables and labels functions.
+// Label definitions have the declaration modifier.
+func (d *document) semanticTokens() SemanticTokens {
+	data := []int{}
+	previous := Position{}
+	for i, token := range d.tokens {
+		tokenType, modifiers := 0, 0
+		switch token.Type {
+		case lexer.MNEMONIC:
+			tokenType = tokenKeyword
+			if isa.IsDirective(token.Literal) {
+				tokenType = tokenMacro
+			}
+		case lexer.REGISTER:
+			tokenType = tokenVariable
+		case lexer.NUMBER:
+			tokenType = tokenNumber
+		case lexer.STRING:
+			tokenType = tokenString
+		case lexer.COMMENT:
+			tokenType = tokenComment
+		case lexer.LABEL:
+			tokenType = tokenFunction
+			if i+1 < len(d.tokens) && d.tokens[i+1].Type == lexer.COLON {
+				modifiers = 1
+			}
+		default:
+			continue
+		}
+
+		end := d.wordEnd(token.Line, token.Column)
+		if token.Type == lexer.COMMENT {
+			end = len(d.line(token.Line)) + 1
+		}
+		start := d.position(token.Line, token.Column)
+		length := d.position(token.Line, end).Character - start.Character
+		if length <= 0 {
+			continue
+		}
+		delta := start.Character
+		if start.Line == previous.Line {
+			delta -= previous.Character
+		}
+		data = append(data, start.Line-previous.Line, delta, length, tokenType, modifiers)
+		previous = start
+	}
+	return SemanticTokens{Data: data}
+}
@@ -0,0 +1,328 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const uri = "file:///work/program.asm"
+
+const program = `; copies a block
+START:  LXI H, DATA
+        CALL COPY
+        JMP START
+COPY:   PHASE 8000H
+        LXI B, COPY_LEN
+        RZ
+        DEPHASE
+DATA:   DB 1, 2, 'AB'
+`
+
+// session sends requests to a server, the first of which opens uri with
+// source, and returns the responses and notifications it writes.
+func session(t *testing.T, source string, requests ...string) []message {
+	t.Helper()
+	input := &bytes.Buffer{}
+	send := func(body string) {
+		fmt.Fprintf(input, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	text, _ := json.Marshal(source)
+	send(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{}}`)
+	send(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"` + uri + `","text":` + string(text) + `}}}`)
+	for i, request := range requests {
+		send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,%s}`, i+1, request))
+	}
+	send(`{"jsonrpc":"2.0","id":99,"method":"shutdown"}`)
+	send(`{"jsonrpc":"2.0","method":"exit"}`)
+
+	output := &bytes.Buffer{}
+	if err := NewServer(input, output).Run(); err != nil {
+		t.Fatalf("Server.Run() error = %v", err)
+	}
+
+	messages := []message{}
+	r := bufio.NewReader(output)
+	for {
+		header, err := textproto.NewReader(r).ReadMIMEHeader()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			t.Fatalf("reading header: %v", err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		io.ReadFull(r, body)
+		msg := message{}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("reading message %s: %v", body, err)
+		}
+		messages = append(messages, msg)
+	}
+}
+
+// result returns the result of the request with id, decoded into v.
+func result(t *testing.T, messages []message, id int, v any) {
+	t.Helper()
+	for _, msg := range messages {
+		if string(msg.ID) != strconv.Itoa(id) {
+			continue
+		}
+		if msg.Error != nil {
+			t.Fatalf("request %d error = %v", id, msg.Error)
+		}
+		if err := json.Unmarshal(msg.Result, v); err != nil {
+			t.Fatalf("decoding result %s: %v", msg.Result, err)
+		}
+		return
+	}
+	t.Fatalf("no response to request %d", id)
+}
+
+func diagnostics(t *testing.T, messages []message) []Diagnostic {
+	t.Helper()
+	for _, msg := range messages {
+		if msg.Method == "textDocument/publishDiagnostics" {
+			p := PublishDiagnosticsParams{}
+			json.Unmarshal(msg.Params, &p)
+			return p.Diagnostics
+		}
+	}
+	t.Fatal("no diagnostics published")
+	return nil
+}
+
+func at(method string, line, character int) string {
+	return fmt.Sprintf(`"method":"textDocument/%s","params":{"textDocument":{"uri":"%s"},"position":{"line":%d,"character":%d},"context":{"includeDeclaration":true}}`, method, uri, line, character)
+}
+
+func span(line, start, end int) Range {
+	return Range{Start: Position{Line: line, Character: start}, End: Position{Line: line, Character: end}}
+}
+
+func TestServer_Diagnostics(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []Diagnostic
+	}{
+		{
+			name:   "none",
+			source: program,
+			want:   []Diagnostic{},
+		},
+		{
+			name:   "undefined label",
+			source: "START: JMP START\n  CALL MISSING",
+			want:   []Diagnostic{{Range: span(1, 7, 14), Severity: SeverityError, Source: "go8080asm", Message: "label definition not found: MISSING"}},
+		},
+		{
+			name:   "bad operand",
+			source: "NOP\n\tMVI Q, 1",
+			want:   []Diagnostic{{Range: span(1, 1, 4), Severity: SeverityError, Source: "go8080asm", Message: "expected register, got: Q"}},
+		},
+		{
+			name:   "syntax error",
+			source: "NOP\nMVI A 1",
+			want:   []Diagnostic{{Range: span(1, 0, 7), Severity: SeverityError, Source: "go8080asm", Message: "expected comma, got: 1"}},
+		},
+		{
+			name:   "lint",
+			source: "START: JMP START\nUNUSED: NOP",
+			want: []Diagnostic{
+				{Range: span(1, 0, 11), Severity: SeverityWarning, Source: "go8080asm", Message: "label UNUSED is defined but never referenced"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diagnostics(t, session(t, tt.source))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diagnostics = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_Hover(t *testing.T) {
+	tests := []struct {
+		name      string
+		line, col int
+		want      string
+	}{
+		{"instruction", 1, 9, "```asm\nLXI H, DATA\n```\n\nBytes: `21 0D 00` at 0x0000\n\nCycles: 10\n\nFlags: none"},
+		{"conditional return", 6, 8, "```asm\nRZ\n```\n\nBytes: `C8` at 0x000C\n\nCycles: 5, or 11 when the condition is met\n\nFlags: none"},
+		{"data", 8, 10, "```asm\nDB 1, 2, 'AB'\n```\n\nBytes: `01 02 41 42` at 0x000D"},
+		{"label", 1, 16, "**DATA**: label at 0x000D"},
+		{"PHASE block length", 5, 18, "**COPY_LEN**: length of the PHASE block on line 5, 0x0004"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &Hover{}
+			result(t, session(t, program, at("hover", tt.line, tt.col)), 1, got)
+			if got.Contents.Value != tt.want {
+				t.Errorf("hover = %q, want %q", got.Contents.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_Flags(t *testing.T) {
+	got := &Hover{}
+	result(t, session(t, "ADI 1\nPOP PSW\nINR A", at("hover", 0, 0), at("hover", 1, 0), at("hover", 2, 0)), 3, got)
+	if !strings.HasSuffix(got.Contents.Value, "Flags: S Z AC P") {
+		t.Errorf("hover = %q, want INR's flags", got.Contents.Value)
+	}
+	result(t, session(t, "POP PSW\nJMP NOWHERE", at("hover", 0, 0)), 1, got)
+	if want := "```asm\nPOP PSW\n```\n\nFlags: S Z AC P CY, from the stack"; got.Contents.Value != want {
+		t.Errorf("hover on a program that doesn't assemble = %q, want %q", got.Contents.Value, want)
+	}
+}
+
+func TestServer_Navigation(t *testing.T) {
+	messages := session(t, program,
+		at("definition", 2, 14),
+		at("references", 1, 1),
+		at("definition", 5, 16),
+	)
+
+	definition := []Location{}
+	result(t, messages, 1, &definition)
+	if want := []Location{{URI: uri, Range: span(4, 0, 4)}}; !reflect.DeepEqual(definition, want) {
+		t.Errorf("definition = %v, want %v", definition, want)
+	}
+
+	references := []Location{}
+	result(t, messages, 2, &references)
+	if want := []Location{{URI: uri, Range: span(1, 0, 5)}, {URI: uri, Range: span(3, 12, 17)}}; !reflect.DeepEqual(references, want) {
+		t.Errorf("references = %v, want %v", references, want)
+	}
+
+	result(t, messages, 3, &definition)
+	if want := []Location{{URI: uri, Range: span(7, 8, 15)}}; !reflect.DeepEqual(definition, want) {
+		t.Errorf("definition of COPY_LEN = %v, want %v", definition, want)
+	}
+}
+
+func TestServer_Rename(t *testing.T) {
+	rename := func(line, character int, newName string) string {
+		return strings.Replace(at("rename", line, character), `"context"`, `"newName":"`+newName+`","context"`, 1)
+	}
+	messages := session(t, program, rename(2, 14, "Move"), rename(5, 16, "X"), rename(1, 1, "MOV"), rename(1, 1, "DATA"))
+
+	edit := &WorkspaceEdit{}
+	result(t, messages, 1, edit)
+	want := []TextEdit{
+		{Range: span(2, 13, 17), NewText: "Move"},
+		{Range: span(4, 0, 4), NewText: "Move"},
+		{Range: span(5, 15, 19), NewText: "Move"},
+	}
+	if !reflect.DeepEqual(edit.Changes[uri], want) {
+		t.Errorf("rename edits = %v, want %v", edit.Changes[uri], want)
+	}
+
+	wantErrors := map[int]string{
+		2: "COPY_LEN is the length of the PHASE block COPY, so rename COPY instead",
+		3: "MOV is a mnemonic, so it can't be a label",
+		4: "label DATA is already defined",
+	}
+	for _, msg := range messages {
+		id, _ := strconv.Atoi(string(msg.ID))
+		if want, found := wantErrors[id]; found && (msg.Error == nil || msg.Error.Message != want) {
+			t.Errorf("rename %d error = %v, want %q", id, msg.Error, want)
+		}
+	}
+}
+
+func TestServer_Symbols(t *testing.T) {
+	got := []DocumentSymbol{}
+	result(t, session(t, program, `"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"`+uri+`"}}`), 1, &got)
+	names := []string{}
+	for _, s := range got {
+		names = append(names, fmt.Sprintf("%s %d %s", s.Name, s.Kind, s.Detail))
+	}
+	want := []string{"START 12 0x0000", "COPY 12 0x0009", "DATA 13 0x000D", "COPY_LEN 14 "}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("symbols = %q, want %q", names, want)
+	}
+}
+
+func TestServer_Completion(t *testing.T) {
+	messages := session(t, program+"  MV\n  LXI H, S\n", at("completion", 9, 4), at("completion", 10, 10), at("completion", 0, 5))
+	labels := func(id int) []string {
+		items := []CompletionItem{}
+		result(t, messages, id, &items)
+		labels := []string{}
+		for _, item := range items {
+			labels = append(labels, item.Label)
+		}
+		return labels
+	}
+
+	if got := labels(1); !contains(got, "MVI") || contains(got, "START") {
+		t.Errorf("completion at the start of a statement = %v, want mnemonics", got)
+	}
+	if got := labels(2); !contains(got, "START") || !contains(got, "PSW") || contains(got, "MVI") {
+		t.Errorf("completion in operands = %v, want registers and labels", got)
+	}
+	if got := labels(3); len(got) != 0 {
+		t.Errorf("completion in a comment = %v, want none", got)
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestServer_SemanticTokens(t *testing.T) {
+	got := SemanticTokens{}
+	source := "LOOP: mvi a, 0x1F ; done\n  DB 'hi'\n  JMP LOOP"
+	result(t, session(t, source, `"method":"textDocument/semanticTokens/full","params":{"textDocument":{"uri":"`+uri+`"}}`), 1, &got)
+	want := []int{
+		0, 0, 4, tokenFunction, 1,
+		0, 6, 3, tokenKeyword, 0,
+		0, 4, 1, tokenVariable, 0,
+		0, 3, 4, tokenNumber, 0,
+		0, 5, 6, tokenComment, 0,
+		1, 2, 2, tokenMacro, 0,
+		0, 3, 4, tokenString, 0,
+		1, 2, 3, tokenKeyword, 0,
+		0, 4, 4, tokenFunction, 0,
+	}
+	if !reflect.DeepEqual(got.Data, want) {
+		t.Errorf("semantic tokens = %v, want %v", got.Data, want)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	messages := session(t, program, `"method":"textDocument/formatting","params":{}`, `"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///other.asm"},"position":{"line":0,"character":0}}`)
+	wantCodes := map[string]int{"1": CodeMethodNotFound, "2": CodeInvalidParams}
+	for _, msg := range messages {
+		if code, found := wantCodes[string(msg.ID)]; found && (msg.Error == nil || msg.Error.Code != code) {
+			t.Errorf("request %s error = %v, want code %d", msg.ID, msg.Error, code)
+		}
+	}
+}
+
+func TestPosition_UTF16(t *testing.T) {
+	d := analyze(uri, "NOP ; é𝄞x\nLOOP: JMP LOOP", nil, nil)
+	if got, want := d.position(1, 13), (Position{Line: 0, Character: 9}); got != want {
+		t.Errorf("position() = %v, want %v", got, want)
+	}
+	if line, column := d.column(Position{Line: 0, Character: 9}); line != 1 || column != 13 {
+		t.Errorf("column() = %d, %d, want 1, 13", line, column)
+	}
+}
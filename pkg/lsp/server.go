@@ -0,0 +1,277 @@
+// Package lsp is a language server for 8080 assembly source, speaking the
+// Language Server Protocol over a pair of streams such as standard input
+// and output. It reports errors and warnings as documents are edited, and
+// answers hover, definition, references, rename, document symbol,
+// completion and semantic token requests.
+//
+// Documents are analysed with the assembler's own lexer, parser and
+// encoder, so what the server reports is what go8080asm would do with the
+// file.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+)
+
+// Server is a language server reading requests from one stream and
+// writing responses to another.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	dialect   *lexer.Dialect
+	documents map[string]*document
+	shutdown  bool
+}
+
+// NewServer returns a server that reads requests from in and writes
+// responses and notifications to out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, documents: map[string]*document{}}
+}
+
+// SetDialect sets the dialect that documents are written in.
+func (s *Server) SetDialect(d *lexer.Dialect) {
+	s.dialect = d
+}
+
+// Run serves requests until the client sends exit, or the input ends. It
+// returns an error if the client exits without asking the server to shut
+// down first.
+func (s *Server) Run() error {
+	for {
+		msg, err := s.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// read reads a message, which is a JSON body after a Content-Length header.
+func (s *Server) read() (*message, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return &message{Error: &Error{Code: CodeParseError, Message: err.Error()}}, nil
+	}
+	return msg, nil
+}
+
+func (s *Server) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = s.out.Write(body)
+	return err
+}
+
+// notify sends a notification to the client.
+func (s *Server) notify(method string, params any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.write(&message{Method: method, Params: body})
+}
+
+// handle answers a request or acts on a notification. Only errors writing
+// to the client are returned: errors in requests are sent back as error
+// responses.
+func (s *Server) handle(msg *message) error {
+	if msg.Error != nil {
+		return s.write(&message{ID: json.RawMessage("null"), Error: msg.Error})
+	}
+	result, err := s.dispatch(msg.Method, msg.Params)
+	var rpcErr *Error
+	if msg.ID == nil {
+		// Notifications have no response, so only errors writing to the
+		// client matter
+		if err != nil && !errors.As(err, &rpcErr) {
+			return err
+		}
+		return nil
+	}
+	response := &message{ID: msg.ID}
+	switch {
+	case errors.As(err, &rpcErr):
+		response.Error = rpcErr
+	case err != nil:
+		response.Error = &Error{Code: CodeRequestFailed, Message: err.Error()}
+	default:
+		if response.Result, err = json.Marshal(result); err != nil {
+			return err
+		}
+	}
+	return s.write(response)
+}
+
+// dispatch calls the handler for method with its parameters.
+func (s *Server) dispatch(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "initialize":
+		return s.initialize(), nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		p := DidOpenTextDocumentParams{}
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+		return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+	case "textDocument/didChange":
+		p := DidChangeTextDocumentParams{}
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+		if len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// Documents are synced in full, so the last change is the whole text
+		return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		p := DidCloseTextDocumentParams{}
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.documents, p.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+
+	case "textDocument/hover":
+		p := TextDocumentPositionParams{}
+		d, err := s.document(params, &p, &p.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.hover(p.Position), nil
+	case "textDocument/definition":
+		p := TextDocumentPositionParams{}
+		d, err := s.document(params, &p, &p.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.definition(p.Position), nil
+	case "textDocument/references":
+		p := ReferenceParams{}
+		d, err := s.document(params, &p, &p.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.references(p.Position, p.Context.IncludeDeclaration), nil
+	case "textDocument/rename":
+		p := RenameParams{}
+		d, err := s.document(params, &p, &p.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.rename(p.Position, p.NewName)
+	case "textDocument/documentSymbol":
+		p := DocumentParams{}
+		d, err := s.document(params, &p, &p.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.symbols(), nil
+	case "textDocument/completion":
+		p := TextDocumentPositionParams{}
+		d, err := s.document(params, &p, &p.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.completion(p.Position), nil
+	case "textDocument/semanticTokens/full":
+		p := DocumentParams{}
+		d, err := s.document(params, &p, &p.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.semanticTokens(), nil
+	}
+	return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method not found: %s", method)}
+}
+
+// initialize returns the server's capabilities.
+func (s *Server) initialize() any {
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync":       1, // Full
+			"hoverProvider":          true,
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"renameProvider":         true,
+			"documentSymbolProvider": true,
+			"completionProvider":     map[string]any{},
+			"semanticTokensProvider": map[string]any{
+				"legend": map[string]any{"tokenTypes": tokenTypes, "tokenModifiers": tokenModifiers},
+				"full":   true,
+			},
+		},
+		"serverInfo": map[string]any{"name": "go8080asm"},
+	}
+}
+
+// update analyses the new text of a document and publishes its
+// diagnostics.
+func (s *Server) update(uri string, text string) error {
+	d := analyze(uri, text, s.dialect, s.documents[uri])
+	s.documents[uri] = d
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: d.diagnostics})
+}
+
+// document decodes params into p and returns the document it refers to.
+func (s *Server) document(params json.RawMessage, p any, id *TextDocumentIdentifier) (*document, error) {
+	if err := decode(params, p); err != nil {
+		return nil, err
+	}
+	d, found := s.documents[id.URI]
+	if !found {
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("document isn't open: %s", id.URI)}
+	}
+	return d, nil
+}
+
+func decode(params json.RawMessage, p any) error {
+	if err := json.Unmarshal(params, p); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+)
+
+// ReadMap reads a memory map from a config file with a region on each line:
+//
+//	; name  start  size   access  fill
+//	ROM     0000H  2000H  RX      FFH
+//	RAM     8000H  0800H  RW
+//
+// Fields are separated by spaces or commas. Numbers are hexadecimal, in the
+// same notation as the assembler, and the fill byte defaults to zero.
+// Everything after a ';' or '#' is a comment.
+func ReadMap(in io.Reader) (*Map, error) {
+	m := &Map{}
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexAny(text, ";#"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(fields) == 0 {
+			continue
+		}
+
+		region, err := parseRegion(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := m.Add(region); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return m, scanner.Err()
+}
+
+func parseRegion(fields []string) (Region, error) {
+	if len(fields) < 4 || len(fields) > 5 {
+		return Region{}, fmt.Errorf("expected name, start, size, access and optional fill, got %d fields", len(fields))
+	}
+
+	region := Region{Name: fields[0]}
+	start, err := isa.ParseNumberUpTo(fields[1], 0xFFFF)
+	if err != nil {
+		return Region{}, err
+	}
+	region.Start = uint16(start)
+	if region.Size, err = isa.ParseNumberUpTo(fields[2], 0x10000); err != nil {
+		return Region{}, err
+	}
+	if region.Access, err = ParseAccess(fields[3]); err != nil {
+		return Region{}, err
+	}
+	if len(fields) == 5 {
+		fill, err := isa.ParseNumberUpTo(fields[4], 0xFF)
+		if err != nil {
+			return Region{}, err
+		}
+		region.Fill = byte(fill)
+	}
+	return region, nil
+}
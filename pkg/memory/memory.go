@@ -0,0 +1,265 @@
+// Package memory describes the memory map of a target system, as regions of
+// ROM and RAM, and checks that a program's code and data fit into it.
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Access is what a program may do with a region's memory.
+type Access uint8
+
+const (
+	Read Access = 1 << iota
+	Write
+	Execute
+)
+
+// ParseAccess parses access written as letters, like "RX" or "rwx".
+func ParseAccess(s string) (Access, error) {
+	var access Access
+	for _, c := range strings.ToUpper(s) {
+		switch c {
+		case 'R':
+			access |= Read
+		case 'W':
+			access |= Write
+		case 'X':
+			access |= Execute
+		default:
+			return 0, fmt.Errorf("invalid access %q, expected R, W and X", s)
+		}
+	}
+	return access, nil
+}
+
+func (a Access) String() string {
+	s := []byte("---")
+	for i, flag := range []Access{Read, Write, Execute} {
+		if a&flag != 0 {
+			s[i] = "rwx"[i]
+		}
+	}
+	return string(s)
+}
+
+// Region is a range of addresses in the memory map. Bytes of the region
+// that nothing is assembled into are set to Fill.
+type Region struct {
+	Name   string
+	Start  uint16
+	Size   int
+	Fill   byte
+	Access Access
+}
+
+// End returns the address after the last byte of the region.
+func (r Region) End() int {
+	return int(r.Start) + r.Size
+}
+
+// Contains reports whether address is inside the region.
+func (r Region) Contains(address int) bool {
+	return address >= int(r.Start) && address < r.End()
+}
+
+// RAM reports whether the region is writable.
+func (r Region) RAM() bool {
+	return r.Access&Write != 0
+}
+
+func (r Region) String() string {
+	return fmt.Sprintf("%s (0x%04X-0x%04X %s)", r.Name, r.Start, r.End()-1, r.Access)
+}
+
+// Map is a memory map: regions that don't overlap, in the order they were
+// added.
+type Map struct {
+	Regions []Region
+}
+
+// Add adds region to the map, unless it's empty, doesn't fit in 64K, or
+// overlaps a region already in the map.
+func (m *Map) Add(region Region) error {
+	if region.Size <= 0 {
+		return fmt.Errorf("memory region %s is empty", region.Name)
+	}
+	if region.End() > 0x10000 {
+		return fmt.Errorf("memory region %s doesn't fit in 64K", region.Name)
+	}
+	for _, other := range m.Regions {
+		if strings.EqualFold(other.Name, region.Name) {
+			return fmt.Errorf("duplicate memory region %s", region.Name)
+		}
+		if int(region.Start) < other.End() && int(other.Start) < region.End() {
+			return fmt.Errorf("memory region %s overlaps %s", region, other)
+		}
+	}
+	m.Regions = append(m.Regions, region)
+	return nil
+}
+
+// Find returns the region containing address.
+func (m *Map) Find(address int) (Region, bool) {
+	for _, region := range m.Regions {
+		if region.Contains(address) {
+			return region, true
+		}
+	}
+	return Region{}, false
+}
+
+// Code returns the first executable region, where code is placed by default.
+func (m *Map) Code() (Region, bool) {
+	for _, region := range m.Regions {
+		if region.Access&Execute != 0 {
+			return region, true
+		}
+	}
+	return Region{}, false
+}
+
+// Data returns the writable region the data segment is placed in if the
+// code ends at address: the one containing address, so the data follows the
+// code, or else the first one starting after it.
+func (m *Map) Data(address int) (Region, bool) {
+	if region, found := m.Find(address); found && region.RAM() {
+		return region, true
+	}
+	for _, region := range m.Regions {
+		if region.RAM() && int(region.Start) >= address {
+			return region, true
+		}
+	}
+	return Region{}, false
+}
+
+// Block is a run of bytes placed in memory, such as the instructions from
+// a group of source lines or a module's data segment.
+type Block struct {
+	Name  string
+	Start uint16
+	Size  int
+	Code  bool
+	Data  bool // In the data segment, which the program writes to
+}
+
+// End returns the address after the last byte of the block.
+func (b Block) End() int {
+	return int(b.Start) + b.Size
+}
+
+func (b Block) String() string {
+	return fmt.Sprintf("%s (0x%04X-0x%04X)", b.Name, b.Start, b.End()-1)
+}
+
+// Check reports every block that's outside the regions of the map or
+// crosses from one region into the next, code in a region that isn't
+// executable, the data segment in a region that isn't writable, and blocks
+// that overlap each other. Code in RAM is allowed,
+// but returned as a warning for each region it's in.
+func (m *Map) Check(blocks []Block) ([]string, error) {
+	errs := []error{}
+	warned := map[string]bool{}
+	var warnings []string
+	for _, block := range blocks {
+		if block.Size == 0 {
+			continue
+		}
+		region, found := m.Find(int(block.Start))
+		switch {
+		case !found:
+			errs = append(errs, fmt.Errorf("%s is outside any memory region", block))
+			continue
+		case block.End() > region.End():
+			errs = append(errs, fmt.Errorf("%s overruns memory region %s", block, region))
+			continue
+		}
+		if block.Data && !region.RAM() {
+			errs = append(errs, fmt.Errorf("%s is data in memory region %s, which isn't writable", block, region))
+		}
+		if block.Code && region.Access&Execute == 0 {
+			errs = append(errs, fmt.Errorf("%s is code in memory region %s, which isn't executable", block, region))
+		} else if block.Code && region.RAM() && !warned[region.Name] {
+			warned[region.Name] = true
+			warnings = append(warnings, fmt.Sprintf("%s is code in RAM region %s", block, region))
+		}
+	}
+
+	sorted := append([]Block{}, blocks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	// Each block is checked against the one that reaches furthest of those
+	// before it, which a block can overlap even with others in between
+	var furthest *Block
+	for i := range sorted {
+		if sorted[i].Size == 0 {
+			continue
+		}
+		if furthest != nil && int(sorted[i].Start) < furthest.End() {
+			errs = append(errs, fmt.Errorf("%s overlaps %s", sorted[i], *furthest))
+		}
+		if furthest == nil || sorted[i].End() > furthest.End() {
+			furthest = &sorted[i]
+		}
+	}
+	return warnings, errors.Join(errs...)
+}
+
+// Fill sets every byte of image, which starts at origin, that's inside a
+// region but not inside any of the blocks to the region's fill byte.
+func (m *Map) Fill(image []byte, origin uint16, blocks []Block) {
+	used := make([]bool, len(image))
+	for _, block := range blocks {
+		for address := int(block.Start); address < block.End(); address++ {
+			if i := address - int(origin); i >= 0 && i < len(image) {
+				used[i] = true
+			}
+		}
+	}
+	for i := range image {
+		if region, found := m.Find(int(origin) + i); found && !used[i] {
+			image[i] = region.Fill
+		}
+	}
+}
+
+// Usage is how many bytes of a region the blocks take up.
+type Usage struct {
+	Region Region
+	Used   int
+}
+
+// Percent returns the percentage of the region that's used.
+func (u Usage) Percent() float64 {
+	return 100 * float64(u.Used) / float64(u.Region.Size)
+}
+
+// Usage returns how much of each region the blocks use.
+func (m *Map) Usage(blocks []Block) []Usage {
+	usage := []Usage{}
+	for _, region := range m.Regions {
+		used := 0
+		for _, block := range blocks {
+			used += max(0, min(block.End(), region.End())-max(int(block.Start), int(region.Start)))
+		}
+		usage = append(usage, Usage{Region: region, Used: used})
+	}
+	return usage
+}
+
+// WriteUsage writes a line for each region, with the number of bytes used
+// and free.
+func WriteUsage(w io.Writer, usage []Usage) error {
+	for _, u := range usage {
+		_, err := fmt.Fprintf(w, "%-8s %04X-%04X %s %6d of %6d bytes used (%5.1f%%), %6d free\n",
+			u.Region.Name, u.Region.Start, u.Region.End()-1, u.Region.Access, u.Used, u.Region.Size, u.Percent(), u.Region.Size-u.Used)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package memory
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testMap(t *testing.T) *Map {
+	t.Helper()
+	m, err := ReadMap(strings.NewReader(`; name  start  size   access  fill
+ROM     0000H  0100H  RX      FFH
+RAM     8000H  0x0100 rwx     # code can run from RAM
+`))
+	if err != nil {
+		t.Fatalf("ReadMap() error = %v", err)
+	}
+	return m
+}
+
+func TestReadMap(t *testing.T) {
+	want := []Region{
+		{Name: "ROM", Start: 0x0000, Size: 0x0100, Fill: 0xFF, Access: Read | Execute},
+		{Name: "RAM", Start: 0x8000, Size: 0x0100, Access: Read | Write | Execute},
+	}
+	if got := testMap(t).Regions; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadMap() = %+v, want %+v", got, want)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "missing access", input: "ROM 0000H 0100H"},
+		{name: "invalid access", input: "ROM 0000H 0100H RZ"},
+		{name: "invalid number", input: "ROM 0000G 0100H RX"},
+		{name: "fill too large", input: "ROM 0000H 0100H RX 100H"},
+		{name: "empty region", input: "ROM 0000H 0 RX"},
+		{name: "past 64K", input: "ROM 0FF00H 0200H RX"},
+		{name: "overlapping regions", input: "ROM 0000H 0100H RX\nRAM 0080H 0100H RW"},
+		{name: "duplicate name", input: "ROM 0000H 0100H RX\nrom 1000H 0100H RX"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadMap(strings.NewReader(tt.input)); err == nil {
+				t.Errorf("ReadMap() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMap_Check(t *testing.T) {
+	tests := []struct {
+		name         string
+		blocks       []Block
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name: "code in ROM and data in RAM",
+			blocks: []Block{
+				{Name: "line 1", Start: 0x0000, Size: 0x0100, Code: true},
+				{Name: "line 9", Start: 0x8000, Size: 0x0010},
+			},
+		},
+		{
+			name: "code in RAM",
+			blocks: []Block{
+				{Name: "line 1", Start: 0x8000, Size: 0x0002, Code: true},
+				{Name: "line 3", Start: 0x8010, Size: 0x0002, Code: true},
+			},
+			wantWarnings: []string{"line 1 (0x8000-0x8001) is code in RAM region RAM (0x8000-0x80FF rwx)"},
+		},
+		{
+			name:    "data segment in ROM",
+			blocks:  []Block{{Name: "line 9", Start: 0x0010, Size: 0x0002, Data: true}},
+			wantErr: "line 9 (0x0010-0x0011) is data in memory region ROM (0x0000-0x00FF r-x), which isn't writable",
+		},
+		{
+			name:    "outside any region",
+			blocks:  []Block{{Name: "line 1", Start: 0x1000, Size: 0x0001, Code: true}},
+			wantErr: "line 1 (0x1000-0x1000) is outside any memory region",
+		},
+		{
+			name:    "overruns region",
+			blocks:  []Block{{Name: "line 1", Start: 0x00FE, Size: 0x0003, Code: true}},
+			wantErr: "line 1 (0x00FE-0x0100) overruns memory region ROM (0x0000-0x00FF r-x)",
+		},
+		{
+			name: "overlapping blocks",
+			blocks: []Block{
+				{Name: "MAIN code", Start: 0x0000, Size: 0x0020, Code: true},
+				{Name: "TABLE data", Start: 0x0010, Size: 0x0010},
+			},
+			wantErr: "TABLE data (0x0010-0x001F) overlaps MAIN code (0x0000-0x001F)",
+		},
+		{
+			name: "overlapping a block before the one before",
+			blocks: []Block{
+				{Name: "A", Start: 0x0000, Size: 0x0100, Code: true},
+				{Name: "B", Start: 0x0010, Size: 0x0010},
+				{Name: "C", Start: 0x0050, Size: 0x0010},
+			},
+			wantErr: "B (0x0010-0x001F) overlaps A (0x0000-0x00FF)\nC (0x0050-0x005F) overlaps A (0x0000-0x00FF)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := testMap(t).Check(tt.blocks)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Check() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("Check() warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestMap_Check_NotExecutable(t *testing.T) {
+	m := &Map{}
+	if err := m.Add(Region{Name: "DATA", Start: 0x2000, Size: 0x0100, Access: Read}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := m.Check([]Block{{Name: "line 1", Start: 0x2000, Size: 1, Code: true}}); err == nil {
+		t.Errorf("Check() error = nil, want error")
+	}
+	if _, err := m.Check([]Block{{Name: "line 1", Start: 0x2000, Size: 1}}); err != nil {
+		t.Errorf("Check() error = %v, want nil for data", err)
+	}
+}
+
+func TestMap_Data(t *testing.T) {
+	m := testMap(t)
+	if err := m.Add(Region{Name: "STACK", Start: 0x9000, Size: 0x0100, Access: Read | Write}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	tests := []struct {
+		address   int
+		want      string
+		wantFound bool
+	}{
+		{0x0080, "RAM", true},   // Code ending in ROM
+		{0x8010, "RAM", true},   // Code ending inside RAM
+		{0x8100, "STACK", true}, // Code filling RAM
+		{0x9100, "", false},
+	}
+	for _, tt := range tests {
+		got, found := m.Data(tt.address)
+		if got.Name != tt.want || found != tt.wantFound {
+			t.Errorf("Data(0x%04X) = %s, %v, want %s, %v", tt.address, got.Name, found, tt.want, tt.wantFound)
+		}
+	}
+}
+
+func TestMap_FillAndUsage(t *testing.T) {
+	m := testMap(t)
+	blocks := []Block{
+		{Name: "line 1", Start: 0x00FC, Size: 2, Code: true},
+		{Name: "line 2", Start: 0x8000, Size: 1},
+	}
+
+	// The image runs from 00FCH past the end of ROM, which isn't filled
+	image := []byte{0x01, 0x02, 0x00, 0x00, 0x00, 0x00}
+	m.Fill(image, 0x00FC, blocks)
+	if want := []byte{0x01, 0x02, 0xFF, 0xFF, 0x00, 0x00}; !reflect.DeepEqual(image, want) {
+		t.Errorf("Fill() = %X, want %X", image, want)
+	}
+
+	usage := m.Usage(blocks)
+	if usage[0].Used != 2 || usage[1].Used != 1 {
+		t.Errorf("Usage() = %+v, want 2 and 1 bytes used", usage)
+	}
+	b := &strings.Builder{}
+	if err := WriteUsage(b, usage); err != nil {
+		t.Fatalf("WriteUsage() error = %v", err)
+	}
+	want := `ROM      0000-00FF r-x      2 of    256 bytes used (  0.8%),    254 free
+RAM      8000-80FF rwx      1 of    256 bytes used (  0.4%),    255 free
+`
+	if b.String() != want {
+		t.Errorf("WriteUsage() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
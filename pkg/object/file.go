@@ -0,0 +1,178 @@
+package object
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Object files are little endian, with strings and byte slices prefixed by a
+// 16-bit length:
+//
+//	"O80" version
+//	name
+//	code bytes
+//	data bytes
+//	symbol count, then name, segment, offset for each
+//	relocation count, then segment, offset, target for each
+//	fixup count, then segment, offset, name for each
+const (
+	magic   = "O80"
+	version = 1
+)
+
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *writer) byte(b byte) {
+	if w.err == nil {
+		w.err = w.w.WriteByte(b)
+	}
+}
+
+func (w *writer) uint16(value uint16) {
+	w.byte(byte(value))
+	w.byte(byte(value >> 8))
+}
+
+func (w *writer) bytes(b []byte) {
+	if len(b) > 0xFFFF {
+		w.err = fmt.Errorf("%d bytes is too long for an object file", len(b))
+		return
+	}
+	w.uint16(uint16(len(b)))
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+func (w *writer) count(n int) {
+	if n > 0xFFFF {
+		w.err = fmt.Errorf("%d entries is too many for an object file", n)
+		return
+	}
+	w.uint16(uint16(n))
+}
+
+// Write writes the module in object file format.
+func (m *Module) Write(out io.Writer) error {
+	w := &writer{w: bufio.NewWriter(out)}
+	for _, b := range []byte(magic) {
+		w.byte(b)
+	}
+	w.byte(version)
+	w.bytes([]byte(m.Name))
+	w.bytes(m.Code)
+	w.bytes(m.Data)
+
+	w.count(len(m.Symbols))
+	for _, symbol := range m.Symbols {
+		w.bytes([]byte(symbol.Name))
+		w.byte(byte(symbol.Segment))
+		w.uint16(symbol.Offset)
+	}
+	w.count(len(m.Relocations))
+	for _, r := range m.Relocations {
+		w.byte(byte(r.Segment))
+		w.uint16(r.Offset)
+		w.byte(byte(r.Target))
+	}
+	w.count(len(m.Fixups))
+	for _, f := range m.Fixups {
+		w.byte(byte(f.Segment))
+		w.uint16(f.Offset)
+		w.bytes([]byte(f.Name))
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+type reader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.r.ReadByte()
+	r.err = err
+	return b
+}
+
+func (r *reader) uint16() uint16 {
+	return uint16(r.byte()) | uint16(r.byte())<<8
+}
+
+func (r *reader) bytes() []byte {
+	b := make([]byte, r.uint16())
+	if r.err == nil {
+		_, r.err = io.ReadFull(r.r, b)
+	}
+	return b
+}
+
+func (r *reader) segment() Segment {
+	s := Segment(r.byte())
+	if r.err == nil && s > Data {
+		r.err = fmt.Errorf("unknown segment %d", s)
+	}
+	return s
+}
+
+// Read reads a module in object file format.
+func Read(in io.Reader) (*Module, error) {
+	r := &reader{r: bufio.NewReader(in)}
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r.r, header); err != nil || string(header[:len(magic)]) != magic {
+		return nil, errors.New("not an object file")
+	}
+	if header[len(magic)] != version {
+		return nil, fmt.Errorf("unsupported object file version %d", header[len(magic)])
+	}
+
+	m := &Module{Name: string(r.bytes()), Code: r.bytes(), Data: r.bytes()}
+	for n := r.uint16(); n > 0 && r.err == nil; n-- {
+		m.Symbols = append(m.Symbols, Symbol{Name: string(r.bytes()), Segment: r.segment(), Offset: r.uint16()})
+	}
+	for n := r.uint16(); n > 0 && r.err == nil; n-- {
+		m.Relocations = append(m.Relocations, Relocation{Segment: r.segment(), Offset: r.uint16(), Target: r.segment()})
+	}
+	for n := r.uint16(); n > 0 && r.err == nil; n-- {
+		m.Fixups = append(m.Fixups, Fixup{Segment: r.segment(), Offset: r.uint16(), Name: string(r.bytes())})
+	}
+
+	if errors.Is(r.err, io.EOF) {
+		return nil, errors.New("truncated object file")
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, m.Validate()
+}
+
+// ReadModules reads the modules in an object file, a library archive or a
+// Microsoft REL file, telling them apart by their magic numbers. REL files
+// don't have one, but may contain several modules, like a LIB-80 library.
+func ReadModules(in io.Reader) ([]*Module, error) {
+	r := bufio.NewReader(in)
+	header, _ := r.Peek(len(magic))
+	switch string(header) {
+	case magic:
+		m, err := Read(r)
+		if err != nil {
+			return nil, err
+		}
+		return []*Module{m}, nil
+	case libraryMagic:
+		return ReadLibrary(r)
+	}
+	return ReadREL(r)
+}
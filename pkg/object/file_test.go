@@ -0,0 +1,100 @@
+package object
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestModule_WriteRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		module *Module
+	}{
+		{
+			name:   "empty module",
+			module: &Module{Name: "EMPTY", Code: []byte{}, Data: []byte{}},
+		},
+		{
+			name: "symbols, relocations and fixups",
+			module: &Module{
+				Name: "MAIN",
+				Code: []byte{0x3A, 0x01, 0x00, 0xCD, 0x00, 0x00, 0x76},
+				Data: []byte{0x00, 0x05},
+				Symbols: []Symbol{
+					{Name: "MAIN", Segment: Code, Offset: 0x0000},
+					{Name: "COUNT", Segment: Data, Offset: 0x0001},
+				},
+				Relocations: []Relocation{{Segment: Code, Offset: 0x0001, Target: Data}},
+				Fixups:      []Fixup{{Segment: Code, Offset: 0x0004, Name: "PRINT"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			if err := tt.module.Write(b); err != nil {
+				t.Fatalf("Module.Write() error = %v", err)
+			}
+			got, err := Read(b)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.module) {
+				t.Errorf("Read() = %+v, want %+v", got, tt.module)
+			}
+		})
+	}
+}
+
+func TestRead_Invalid(t *testing.T) {
+	valid := &bytes.Buffer{}
+	module := &Module{Name: "M", Code: []byte{0x00}, Relocations: []Relocation{{Segment: Code, Offset: 0x0000, Target: Code}}}
+	// Write doesn't validate, so the relocation past the end of the code
+	// segment is caught by Read
+	if err := module.Write(valid); err != nil {
+		t.Fatalf("Module.Write() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "not an object file", input: []byte("MZ\x90\x00")},
+		{name: "unsupported version", input: []byte("O80\x09")},
+		{name: "truncated", input: valid.Bytes()[:8]},
+		{name: "relocation outside segment", input: valid.Bytes()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(tt.input)); err == nil {
+				t.Errorf("Read() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestReadModules(t *testing.T) {
+	module := &Module{Name: "MAIN", Code: []byte{0xC3, 0x00, 0x00}, Data: []byte{}, Relocations: []Relocation{{Segment: Code, Offset: 0x0001, Target: Code}}}
+	objectFile, relFile := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := module.Write(objectFile); err != nil {
+		t.Fatalf("Module.Write() error = %v", err)
+	}
+	if err := WriteREL(relFile, module); err != nil {
+		t.Fatalf("WriteREL() error = %v", err)
+	}
+
+	for name, input := range map[string]*bytes.Buffer{"object file": objectFile, "REL file": relFile} {
+		t.Run(name, func(t *testing.T) {
+			got, err := ReadModules(input)
+			if err != nil {
+				t.Fatalf("ReadModules() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, []*Module{module}) {
+				t.Errorf("ReadModules() = %+v, want %+v", got, []*Module{module})
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package object
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Library archives start with an index of their modules and the public
+// symbols each one defines, so that a linker can see which modules it needs
+// without reading them all:
+//
+//	"O8L" version
+//	module count, then name, symbol names, offset and size for each
+//	each module in object file format, at its offset from the end of the index
+//
+// Offsets and sizes are 32-bit, as a module can be larger than 64K.
+const (
+	libraryMagic   = "O8L"
+	libraryVersion = 1
+)
+
+// IndexEntry describes one module in a library archive.
+type IndexEntry struct {
+	Name    string
+	Symbols []string
+	offset  uint32
+	size    uint32
+}
+
+func (w *writer) uint32(value uint32) {
+	w.uint16(uint16(value))
+	w.uint16(uint16(value >> 16))
+}
+
+func (r *reader) uint32() uint32 {
+	return uint32(r.uint16()) | uint32(r.uint16())<<16
+}
+
+// WriteLibrary writes the modules as a library archive.
+func WriteLibrary(out io.Writer, modules ...*Module) error {
+	encoded := [][]byte{}
+	for _, m := range modules {
+		b := &bytes.Buffer{}
+		if err := m.Write(b); err != nil {
+			return fmt.Errorf("module %s: %w", m.Name, err)
+		}
+		encoded = append(encoded, b.Bytes())
+	}
+
+	w := &writer{w: bufio.NewWriter(out)}
+	for _, b := range []byte(libraryMagic) {
+		w.byte(b)
+	}
+	w.byte(libraryVersion)
+	w.count(len(modules))
+	offset := uint32(0)
+	for i, m := range modules {
+		w.bytes([]byte(m.Name))
+		w.count(len(m.Symbols))
+		for _, symbol := range m.Symbols {
+			w.bytes([]byte(symbol.Name))
+		}
+		w.uint32(offset)
+		w.uint32(uint32(len(encoded[i])))
+		offset += uint32(len(encoded[i]))
+	}
+	for _, b := range encoded {
+		if w.err == nil {
+			_, w.err = w.w.Write(b)
+		}
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// ReadLibraryIndex reads the index of a library archive.
+func ReadLibraryIndex(in io.Reader) ([]IndexEntry, error) {
+	r := &reader{r: bufio.NewReader(in)}
+	return r.libraryIndex()
+}
+
+func (r *reader) libraryIndex() ([]IndexEntry, error) {
+	header := make([]byte, len(libraryMagic)+1)
+	if _, err := io.ReadFull(r.r, header); err != nil || string(header[:len(libraryMagic)]) != libraryMagic {
+		return nil, errors.New("not a library archive")
+	}
+	if header[len(libraryMagic)] != libraryVersion {
+		return nil, fmt.Errorf("unsupported library archive version %d", header[len(libraryMagic)])
+	}
+
+	index := []IndexEntry{}
+	for n := r.uint16(); n > 0 && r.err == nil; n-- {
+		entry := IndexEntry{Name: string(r.bytes()), Symbols: []string{}}
+		for s := r.uint16(); s > 0 && r.err == nil; s-- {
+			entry.Symbols = append(entry.Symbols, string(r.bytes()))
+		}
+		entry.offset = r.uint32()
+		entry.size = r.uint32()
+		index = append(index, entry)
+	}
+
+	if errors.Is(r.err, io.EOF) {
+		return nil, errors.New("truncated library archive")
+	}
+	return index, r.err
+}
+
+// ReadLibrary reads every module in a library archive.
+func ReadLibrary(in io.Reader) ([]*Module, error) {
+	r := &reader{r: bufio.NewReader(in)}
+	index, err := r.libraryIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(r.r)
+	if err != nil {
+		return nil, err
+	}
+	modules := []*Module{}
+	for _, entry := range index {
+		if uint64(entry.offset)+uint64(entry.size) > uint64(len(body)) {
+			return nil, fmt.Errorf("module %s is outside the library archive", entry.Name)
+		}
+		m, err := Read(bytes.NewReader(body[entry.offset : entry.offset+entry.size]))
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", entry.Name, err)
+		}
+		modules = append(modules, m)
+	}
+	return modules, nil
+}
@@ -0,0 +1,51 @@
+package object
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestLibrary(t *testing.T) {
+	modules := []*Module{
+		{Name: "SQUARE", Code: []byte{0xC9}, Data: []byte{}, Symbols: []Symbol{{Name: "SQUARE", Segment: Code}}},
+		{
+			Name:    "STRLEN",
+			Code:    []byte{0xCD, 0x00, 0x00, 0xC9},
+			Data:    []byte{0x00},
+			Symbols: []Symbol{{Name: "STRLEN", Segment: Code}, {Name: "LENGTH", Segment: Data}},
+			Fixups:  []Fixup{{Segment: Code, Offset: 0x0001, Name: "SQUARE"}},
+		},
+	}
+
+	b := &bytes.Buffer{}
+	if err := WriteLibrary(b, modules...); err != nil {
+		t.Fatalf("WriteLibrary() error = %v", err)
+	}
+	archive := b.Bytes()
+
+	index, err := ReadLibraryIndex(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("ReadLibraryIndex() error = %v", err)
+	}
+	names := [][]string{}
+	for _, entry := range index {
+		names = append(names, append([]string{entry.Name}, entry.Symbols...))
+	}
+	wantNames := [][]string{{"SQUARE", "SQUARE"}, {"STRLEN", "STRLEN", "LENGTH"}}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("ReadLibraryIndex() = %v, want %v", names, wantNames)
+	}
+
+	got, err := ReadModules(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("ReadModules() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, modules) {
+		t.Errorf("ReadModules() = %+v, want %+v", got, modules)
+	}
+
+	if _, err := ReadLibrary(bytes.NewReader(archive[:len(archive)-1])); err == nil {
+		t.Errorf("ReadLibrary() of a truncated archive error = nil, want error")
+	}
+}
@@ -0,0 +1,93 @@
+package object
+
+import "fmt"
+
+// Segment is the segment that a symbol or address is relative to.
+type Segment byte
+
+const (
+	Absolute Segment = iota // Not relocated
+	Code                    // CSEG
+	Data                    // DSEG
+)
+
+func (s Segment) String() string {
+	switch s {
+	case Absolute:
+		return "absolute"
+	case Code:
+		return "code"
+	case Data:
+		return "data"
+	}
+	return fmt.Sprintf("segment %d", s)
+}
+
+// Symbol is a PUBLIC symbol defined by a module, as an offset into one of its
+// segments.
+type Symbol struct {
+	Name    string
+	Segment Segment
+	Offset  uint16
+}
+
+// Relocation is a 16-bit address in a module that refers to one of the
+// module's own segments. The bytes at Offset in Segment hold the offset into
+// Target, and the linker adds Target's base address to them.
+type Relocation struct {
+	Segment Segment
+	Offset  uint16
+	Target  Segment
+}
+
+// Fixup is a 16-bit address in a module that refers to an EXTRN symbol. The
+// linker adds the symbol's address to the bytes at Offset in Segment.
+type Fixup struct {
+	Segment Segment
+	Offset  uint16
+	Name    string
+}
+
+// Module is a relocatable object module: the assembled code and data
+// segments of one source file, along with the information needed to place
+// them at any address and link them with other modules.
+type Module struct {
+	Name        string
+	Code        []byte
+	Data        []byte
+	Symbols     []Symbol
+	Relocations []Relocation
+	Fixups      []Fixup
+}
+
+// Bytes returns the contents of segment s.
+func (m *Module) Bytes(s Segment) []byte {
+	switch s {
+	case Code:
+		return m.Code
+	case Data:
+		return m.Data
+	}
+	return nil
+}
+
+// Validate checks that every symbol, relocation and fixup is inside its
+// segment.
+func (m *Module) Validate() error {
+	for _, symbol := range m.Symbols {
+		if symbol.Segment != Absolute && int(symbol.Offset) > len(m.Bytes(symbol.Segment)) {
+			return fmt.Errorf("module %s: symbol %s is outside the %s segment", m.Name, symbol.Name, symbol.Segment)
+		}
+	}
+	for _, r := range m.Relocations {
+		if r.Segment == Absolute || int(r.Offset)+2 > len(m.Bytes(r.Segment)) {
+			return fmt.Errorf("module %s: relocation at %s 0x%04X is outside its segment", m.Name, r.Segment, r.Offset)
+		}
+	}
+	for _, f := range m.Fixups {
+		if f.Segment == Absolute || int(f.Offset)+2 > len(m.Bytes(f.Segment)) {
+			return fmt.Errorf("module %s: fixup for %s at %s 0x%04X is outside its segment", m.Name, f.Name, f.Segment, f.Offset)
+		}
+	}
+	return nil
+}
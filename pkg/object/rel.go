@@ -0,0 +1,560 @@
+package object
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Microsoft REL files, as written by M80 and read by L80, are a stream of
+// bits rather than bytes. Each item starts with a 0 bit followed by an
+// absolute byte, or a 1 bit and a 2-bit type:
+//
+//	01, 10, 11   a 16-bit program, data or common relative word
+//	00           a special link item: a 4-bit control code, then an A field
+//	             (2-bit address type and 16-bit value) and/or a B field
+//	             (3-bit length and up to 7 characters), depending on the code
+//
+// 16-bit values are written low byte first, and each byte most significant
+// bit first.
+const (
+	relAbsolute byte = iota
+	relProgram
+	relData
+	relCommon // COMMON blocks, which aren't supported
+)
+
+// Special link item control codes.
+const (
+	linkEntrySymbol = iota
+	linkSelectCommon
+	linkProgramName
+	linkLibrarySearch
+	linkExtension
+	linkCommonSize
+	linkChainExternal
+	linkEntryPoint
+	linkExternalMinus
+	linkExternalPlus
+	linkDataSize
+	linkSetLocation
+	linkChainAddress
+	linkProgramSize
+	linkEndModule
+	linkEndFile
+)
+
+// relNameLength is the longest name a B field can hold.
+const relNameLength = 7
+
+type bitWriter struct {
+	w     *bufio.Writer
+	b     byte
+	count int
+	err   error
+}
+
+func (w *bitWriter) bits(value uint16, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.b = w.b<<1 | byte(value>>i&1)
+		w.count++
+		if w.count == 8 {
+			w.flushByte()
+		}
+	}
+}
+
+func (w *bitWriter) flushByte() {
+	if w.err == nil {
+		w.err = w.w.WriteByte(w.b)
+	}
+	w.b, w.count = 0, 0
+}
+
+// align pads the current byte with zero bits.
+func (w *bitWriter) align() {
+	if w.count > 0 {
+		w.bits(0, 8-w.count)
+	}
+}
+
+func (w *bitWriter) word(value uint16) {
+	w.bits(value&0xFF, 8)
+	w.bits(value>>8, 8)
+}
+
+func (w *bitWriter) absolute(b byte) {
+	w.bits(0, 1)
+	w.bits(uint16(b), 8)
+}
+
+func (w *bitWriter) relative(kind byte, value uint16) {
+	w.bits(1, 1)
+	w.bits(uint16(kind), 2)
+	w.word(value)
+}
+
+func (w *bitWriter) link(code int) {
+	w.bits(0b100, 3)
+	w.bits(uint16(code), 4)
+}
+
+func (w *bitWriter) aField(kind byte, value uint16) {
+	w.bits(uint16(kind), 2)
+	w.word(value)
+}
+
+func (w *bitWriter) bField(name string) {
+	w.bits(uint16(len(name)), 3)
+	for i := 0; i < len(name); i++ {
+		w.bits(uint16(name[i]), 8)
+	}
+}
+
+func relType(s Segment) byte {
+	switch s {
+	case Code:
+		return relProgram
+	case Data:
+		return relData
+	}
+	return relAbsolute
+}
+
+func checkRELName(name string) error {
+	if len(name) == 0 || len(name) > relNameLength {
+		return fmt.Errorf("name %q must be 1 to %d characters for a REL file", name, relNameLength)
+	}
+	return nil
+}
+
+type location struct {
+	segment Segment
+	offset  uint16
+}
+
+// WriteREL writes the modules in Microsoft REL format, followed by an end
+// of file item. Names longer than 7 characters can't be represented, and
+// are an error.
+func WriteREL(out io.Writer, modules ...*Module) error {
+	w := &bitWriter{w: bufio.NewWriter(out)}
+	for _, m := range modules {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+		if err := writeRELModule(w, m); err != nil {
+			return err
+		}
+	}
+	w.link(linkEndFile)
+	w.align()
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+func writeRELModule(w *bitWriter, m *Module) error {
+	for _, name := range append([]string{m.Name}, symbolNames(m)...) {
+		if err := checkRELName(name); err != nil {
+			return fmt.Errorf("module %s: %w", m.Name, err)
+		}
+	}
+
+	w.link(linkProgramName)
+	w.bField(m.Name)
+	for _, symbol := range m.Symbols {
+		w.link(linkEntrySymbol)
+		w.bField(symbol.Name)
+	}
+	w.link(linkDataSize)
+	w.aField(relAbsolute, uint16(len(m.Data)))
+	w.link(linkProgramSize)
+	w.aField(relProgram, uint16(len(m.Code)))
+
+	// Each reference to an external symbol holds the location of the
+	// previous reference, so that they form a chain from the last one
+	relocations := map[location]Segment{}
+	for _, r := range m.Relocations {
+		relocations[location{r.Segment, r.Offset}] = r.Target
+	}
+	fixups := map[location]Fixup{}
+	for _, f := range m.Fixups {
+		fixups[location{f.Segment, f.Offset}] = f
+	}
+	heads := map[string]location{}
+	externals := []string{}
+
+	for _, s := range []Segment{Code, Data} {
+		b := m.Bytes(s)
+		if len(b) == 0 {
+			continue
+		}
+		w.link(linkSetLocation)
+		w.aField(relType(s), 0)
+
+		for offset := 0; offset < len(b); {
+			here := location{s, uint16(offset)}
+			word := uint16(0)
+			if offset+1 < len(b) {
+				word = uint16(b[offset]) | uint16(b[offset+1])<<8
+			}
+
+			if target, relocated := relocations[here]; relocated {
+				w.relative(relType(target), word)
+				offset += 2
+				continue
+			}
+			if f, isFixup := fixups[here]; isFixup {
+				if word != 0 {
+					w.link(linkExternalPlus)
+					w.aField(relAbsolute, word)
+				}
+				previous, chained := heads[f.Name]
+				if !chained {
+					externals = append(externals, f.Name)
+					w.absolute(0x00)
+					w.absolute(0x00)
+				} else {
+					w.relative(relType(previous.segment), previous.offset)
+				}
+				heads[f.Name] = here
+				offset += 2
+				continue
+			}
+
+			w.absolute(b[offset])
+			offset++
+		}
+	}
+
+	for _, name := range externals {
+		if err := checkRELName(name); err != nil {
+			return fmt.Errorf("module %s: %w", m.Name, err)
+		}
+		w.link(linkChainExternal)
+		w.aField(relType(heads[name].segment), heads[name].offset)
+		w.bField(name)
+	}
+	for _, symbol := range m.Symbols {
+		w.link(linkEntryPoint)
+		w.aField(relType(symbol.Segment), symbol.Offset)
+		w.bField(symbol.Name)
+	}
+	w.link(linkEndModule)
+	w.aField(relAbsolute, 0)
+	w.align()
+	return w.err
+}
+
+func symbolNames(m *Module) []string {
+	names := []string{}
+	for _, symbol := range m.Symbols {
+		names = append(names, symbol.Name)
+	}
+	return names
+}
+
+type bitReader struct {
+	r     *bufio.Reader
+	b     byte
+	count int
+	err   error
+}
+
+func (r *bitReader) bits(n int) uint16 {
+	value := uint16(0)
+	for i := 0; i < n; i++ {
+		if r.count == 0 {
+			if r.err != nil {
+				return 0
+			}
+			r.b, r.err = r.r.ReadByte()
+			if r.err != nil {
+				return 0
+			}
+			r.count = 8
+		}
+		r.count--
+		value = value<<1 | uint16(r.b>>r.count&1)
+	}
+	return value
+}
+
+// align skips to the start of the next byte.
+func (r *bitReader) align() {
+	r.count = 0
+}
+
+func (r *bitReader) word() uint16 {
+	low := r.bits(8)
+	return low | r.bits(8)<<8
+}
+
+func (r *bitReader) aField() (byte, uint16) {
+	kind := byte(r.bits(2))
+	return kind, r.word()
+}
+
+func (r *bitReader) bField() string {
+	n := int(r.bits(3))
+	name := make([]byte, n)
+	for i := range name {
+		name[i] = byte(r.bits(8))
+	}
+	return string(name)
+}
+
+// relReader builds a module from the items in a REL file.
+type relReader struct {
+	module      *Module
+	segment     Segment
+	location    uint16
+	relocations map[location]Segment
+	offsets     map[location]uint16 // External plus or minus offsets
+}
+
+func segmentOf(kind byte) (Segment, error) {
+	switch kind {
+	case relAbsolute:
+		return Absolute, nil
+	case relProgram:
+		return Code, nil
+	case relData:
+		return Data, nil
+	}
+	return 0, errors.New("COMMON blocks are not supported")
+}
+
+// grow makes segment s at least size bytes long.
+func (rr *relReader) grow(s Segment, size int) {
+	switch s {
+	case Code:
+		for len(rr.module.Code) < size {
+			rr.module.Code = append(rr.module.Code, 0x00)
+		}
+	case Data:
+		for len(rr.module.Data) < size {
+			rr.module.Data = append(rr.module.Data, 0x00)
+		}
+	}
+}
+
+func (rr *relReader) emit(b byte) error {
+	if rr.segment == Absolute {
+		return errors.New("absolute segments (ASEG) are not supported")
+	}
+	if int(rr.location) >= 0xFFFF {
+		return fmt.Errorf("%s segment is larger than 64K", rr.segment)
+	}
+	rr.grow(rr.segment, int(rr.location)+1)
+	rr.module.Bytes(rr.segment)[rr.location] = b
+	rr.location++
+	return nil
+}
+
+func (rr *relReader) emitWord(value uint16) error {
+	if err := rr.emit(byte(value)); err != nil {
+		return err
+	}
+	return rr.emit(byte(value >> 8))
+}
+
+// chain follows a chain of references starting at head, calling visit for
+// each of them. Each link is either relocated, holding the location of the
+// next, or absolute 0 at the end of the chain.
+func (rr *relReader) chain(head location, visit func(at location)) error {
+	for steps := 0; head.segment != Absolute || head.offset != 0; steps++ {
+		b := rr.module.Bytes(head.segment)
+		if head.segment == Absolute || int(head.offset)+2 > len(b) || steps > 0x10000 {
+			return fmt.Errorf("invalid reference chain at %s 0x%04X", head.segment, head.offset)
+		}
+		next := location{segment: Absolute, offset: uint16(b[head.offset]) | uint16(b[head.offset+1])<<8}
+		if target, relocated := rr.relocations[head]; relocated {
+			next.segment = target
+			delete(rr.relocations, head)
+		}
+		visit(head)
+		head = next
+	}
+	return nil
+}
+
+// ReadREL reads every module in a Microsoft REL file, up to the end of file
+// item or the end of the input. Absolute segments and COMMON blocks aren't
+// supported.
+func ReadREL(in io.Reader) ([]*Module, error) {
+	r := &bitReader{r: bufio.NewReader(in)}
+	modules := []*Module{}
+
+	for {
+		if _, err := r.r.Peek(1); r.count == 0 && errors.Is(err, io.EOF) {
+			return modules, nil
+		}
+
+		rr := &relReader{
+			module:      &Module{Code: []byte{}, Data: []byte{}},
+			segment:     Code,
+			relocations: map[location]Segment{},
+			offsets:     map[location]uint16{},
+		}
+		end, err := rr.read(r)
+		if err != nil {
+			return nil, err
+		}
+		if end == linkEndFile {
+			return modules, nil
+		}
+		if err := rr.finish(); err != nil {
+			return nil, err
+		}
+		modules = append(modules, rr.module)
+	}
+}
+
+// read reads items up to the end of a module or the end of the file, and
+// returns which it was.
+func (rr *relReader) read(r *bitReader) (int, error) {
+	for {
+		var err error
+		end := -1
+		if r.bits(1) == 0 {
+			b := byte(r.bits(8))
+			if r.err == nil {
+				err = rr.emit(b)
+			}
+		} else if kind := byte(r.bits(2)); kind != 0 {
+			var target Segment
+			if target, err = segmentOf(kind); err == nil {
+				rr.relocations[location{rr.segment, rr.location}] = target
+				err = rr.emitWord(r.word())
+			}
+		} else {
+			code := int(r.bits(4))
+			if code == linkEndModule || code == linkEndFile {
+				end = code
+			}
+			err = rr.special(r, code)
+		}
+
+		if errors.Is(r.err, io.EOF) {
+			return 0, errors.New("truncated REL file")
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		if err != nil {
+			return 0, err
+		}
+		if end >= 0 {
+			return end, nil
+		}
+	}
+}
+
+// special handles a special link item.
+func (rr *relReader) special(r *bitReader, code int) error {
+	switch code {
+	case linkEntrySymbol, linkLibrarySearch, linkExtension:
+		// Only used when searching libraries
+		r.bField()
+	case linkSelectCommon, linkCommonSize:
+		return errors.New("COMMON blocks are not supported")
+	case linkProgramName:
+		rr.module.Name = r.bField()
+
+	case linkChainExternal:
+		kind, head := r.aField()
+		name := r.bField()
+		s, err := segmentOf(kind)
+		if err != nil {
+			return err
+		}
+		return rr.chain(location{s, head}, func(at location) {
+			b := rr.module.Bytes(at.segment)
+			b[at.offset], b[at.offset+1] = 0x00, 0x00
+			rr.module.Fixups = append(rr.module.Fixups, Fixup{Segment: at.segment, Offset: at.offset, Name: name})
+		})
+
+	case linkEntryPoint:
+		kind, offset := r.aField()
+		name := r.bField()
+		s, err := segmentOf(kind)
+		if err != nil {
+			return err
+		}
+		rr.module.Symbols = append(rr.module.Symbols, Symbol{Name: name, Segment: s, Offset: offset})
+
+	case linkExternalMinus, linkExternalPlus:
+		_, offset := r.aField()
+		if code == linkExternalMinus {
+			offset = -offset
+		}
+		rr.offsets[location{rr.segment, rr.location}] = offset
+
+	case linkDataSize:
+		_, size := r.aField()
+		rr.grow(Data, int(size))
+	case linkProgramSize:
+		_, size := r.aField()
+		rr.grow(Code, int(size))
+
+	case linkSetLocation:
+		kind, offset := r.aField()
+		s, err := segmentOf(kind)
+		if err != nil {
+			return err
+		}
+		rr.segment, rr.location = s, offset
+
+	case linkChainAddress:
+		kind, head := r.aField()
+		s, err := segmentOf(kind)
+		if err != nil {
+			return err
+		}
+		here := location{rr.segment, rr.location}
+		return rr.chain(location{s, head}, func(at location) {
+			b := rr.module.Bytes(at.segment)
+			b[at.offset], b[at.offset+1] = byte(here.offset), byte(here.offset>>8)
+			rr.relocations[at] = here.segment
+		})
+
+	case linkEndModule:
+		r.aField()
+		r.align()
+	}
+	return nil
+}
+
+// finish applies external offsets and sorts the relocations into the
+// module.
+func (rr *relReader) finish() error {
+	for at, offset := range rr.offsets {
+		b := rr.module.Bytes(at.segment)
+		if at.segment == Absolute || int(at.offset)+2 > len(b) {
+			return fmt.Errorf("external offset outside segment at 0x%04X", at.offset)
+		}
+		b[at.offset], b[at.offset+1] = byte(offset), byte(offset>>8)
+	}
+	for at, target := range rr.relocations {
+		rr.module.Relocations = append(rr.module.Relocations, Relocation{Segment: at.segment, Offset: at.offset, Target: target})
+	}
+	sort.Slice(rr.module.Relocations, func(i, j int) bool {
+		a, b := rr.module.Relocations[i], rr.module.Relocations[j]
+		if a.Segment != b.Segment {
+			return a.Segment < b.Segment
+		}
+		return a.Offset < b.Offset
+	})
+	sort.Slice(rr.module.Fixups, func(i, j int) bool {
+		a, b := rr.module.Fixups[i], rr.module.Fixups[j]
+		if a.Segment != b.Segment {
+			return a.Segment < b.Segment
+		}
+		return a.Offset < b.Offset
+	})
+	return rr.module.Validate()
+}
@@ -0,0 +1,106 @@
+package object
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriteREL(t *testing.T) {
+	b := &bytes.Buffer{}
+	module := &Module{Name: "A", Code: []byte{0x76}, Data: []byte{}}
+	if err := WriteREL(b, module); err != nil {
+		t.Fatalf("WriteREL() error = %v", err)
+	}
+
+	// Program name A, data size 0, program size 1, set location to program
+	// 0, absolute 0x76, end module, end file
+	want := []byte{0x84, 0x50, 0x65, 0x00, 0x00, 0x13, 0x50, 0x10, 0x09, 0x68, 0x00, 0x01, 0xDA, 0x70, 0x00, 0x00, 0x9E}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("WriteREL() = % X, want % X", b.Bytes(), want)
+	}
+}
+
+func TestWriteREL_LongName(t *testing.T) {
+	module := &Module{Name: "MAIN", Code: []byte{0x00}, Symbols: []Symbol{{Name: "TOOLONGNAME", Segment: Code}}}
+	if err := WriteREL(&bytes.Buffer{}, module); err == nil {
+		t.Errorf("WriteREL() error = nil, want error")
+	}
+}
+
+func TestReadREL(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules []*Module
+	}{
+		{
+			name: "one module",
+			modules: []*Module{{
+				Name: "MAIN",
+				// LXI H, MSG+2; CALL PRINT; CALL PRINT; LDA COUNT; JMP 0000
+				Code: []byte{0x21, 0x02, 0x00, 0xCD, 0x00, 0x00, 0xCD, 0x00, 0x00, 0x3A, 0x01, 0x00, 0xC3, 0x00, 0x00},
+				Data: []byte{0x00, 0x05, 0x00, 0x00},
+				Symbols: []Symbol{
+					{Name: "MAIN", Segment: Code, Offset: 0x0000},
+					{Name: "COUNT", Segment: Data, Offset: 0x0001},
+					{Name: "SIZE", Segment: Absolute, Offset: 0x1234},
+				},
+				Relocations: []Relocation{
+					{Segment: Code, Offset: 0x000A, Target: Data},
+					{Segment: Code, Offset: 0x000D, Target: Code},
+				},
+				Fixups: []Fixup{
+					{Segment: Code, Offset: 0x0001, Name: "MSG"},
+					{Segment: Code, Offset: 0x0004, Name: "PRINT"},
+					{Segment: Code, Offset: 0x0007, Name: "PRINT"},
+					{Segment: Data, Offset: 0x0002, Name: "PRINT"},
+				},
+			}},
+		},
+		{
+			name: "several modules",
+			modules: []*Module{
+				{Name: "A", Code: []byte{0xC9}, Data: []byte{}, Symbols: []Symbol{{Name: "A", Segment: Code}}},
+				{Name: "B", Code: []byte{0xC3, 0x00, 0x00}, Data: []byte{}, Fixups: []Fixup{{Segment: Code, Offset: 0x0001, Name: "A"}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			if err := WriteREL(b, tt.modules...); err != nil {
+				t.Fatalf("WriteREL() error = %v", err)
+			}
+			got, err := ReadREL(b)
+			if err != nil {
+				t.Fatalf("ReadREL() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.modules) {
+				t.Errorf("ReadREL() = %+v, want %+v", got, tt.modules)
+			}
+		})
+	}
+}
+
+func TestReadREL_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		// Select COMMON block "X"
+		{name: "COMMON block", input: []byte{0x82, 0x2C, 0x00}},
+		// Program name A, then the input ends
+		{name: "truncated", input: []byte{0x84, 0x50, 0x65}},
+		// Set location to absolute 0
+		{name: "absolute segment", input: []byte{0x96, 0x00, 0x00, 0x00, 0x72}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadREL(bytes.NewReader(tt.input)); err == nil {
+				t.Errorf("ReadREL() error = nil, want error")
+			}
+		})
+	}
+}
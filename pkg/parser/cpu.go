@@ -0,0 +1,13 @@
+package parser
+
+import "github.com/lukepeterson/go8080assembler/pkg/isa"
+
+// encodeCPU selects the processor for the instructions that follow.
+func (p *Parser) encodeCPU(directive string) ([]byte, error) {
+	cpu, err := isa.ParseCPU(directive)
+	if err != nil {
+		return nil, err
+	}
+	p.cpu = cpu
+	return nil, nil
+}
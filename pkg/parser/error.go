@@ -0,0 +1,26 @@
+package parser
+
+import "github.com/lukepeterson/go8080assembler/pkg/ast"
+
+// Error is an error found while assembling a statement or resolving a
+// label reference, with the position of the node it was found at. Its
+// message is the message of the error it wraps, so callers that don't need
+// the position can ignore it.
+type Error struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// errorAt returns err with the position pos.
+func errorAt(pos ast.Pos, err error) error {
+	return &Error{Line: pos.Line, Column: pos.Column, Err: err}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/ast"
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+)
+
+// DefineOpcode adds an instruction to the ones the program can use. Its
+// mnemonic can't be one the assembler already has, and the lexer must be
+// told about it with AddMnemonic, which the OPCODE directive does itself.
+func (p *Parser) DefineOpcode(o isa.Opcode) error {
+	name := strings.ToUpper(o.Mnemonic)
+	if name == "" || !isName(name) {
+		return fmt.Errorf("invalid mnemonic for opcode 0x%02X: %q", o.Code, o.Mnemonic)
+	}
+	if lexer.IsMnemonic(name) {
+		return fmt.Errorf("%s is already an instruction", name)
+	}
+	if isa.IsRegister(name) {
+		return fmt.Errorf("%s is a register, so it can't be an instruction", name)
+	}
+	if previous, found := p.opcodes[name]; found && previous != (isa.Opcode{Mnemonic: name, Code: o.Code, Operand: o.Operand}) {
+		return fmt.Errorf("%s is already defined as opcode 0x%02X with %s operand", name, previous.Code, previous.Operand)
+	}
+	p.opcodes[name] = isa.Opcode{Mnemonic: name, Code: o.Code, Operand: o.Operand}
+	return nil
+}
+
+// Opcodes returns the user-defined instructions, by mnemonic.
+func (p *Parser) Opcodes() map[string]isa.Opcode {
+	return p.opcodes
+}
+
+func isName(name string) bool {
+	for i, c := range name {
+		letter := c >= 'A' && c <= 'Z'
+		if !letter && (i == 0 || (c != '_' && (c < '0' || c > '9'))) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeOPCODE defines an instruction: OPCODE mnemonic, code, with an
+// optional operand shape of NONE, BYTE or WORD after the code.
+func (p *Parser) encodeOPCODE(ops *operands) ([]byte, error) {
+	operand := ops.read()
+	switch operand.(type) {
+	case *ast.Name, *ast.Register:
+	default:
+		return nil, fmt.Errorf("expected mnemonic, got: %s", literal(operand))
+	}
+	o := isa.Opcode{Mnemonic: literal(operand)}
+	operand = ops.read()
+	number, ok := operand.(*ast.Number)
+	if !ok {
+		return nil, fmt.Errorf("expected opcode, got: %s", literal(operand))
+	}
+	code, err := isa.ParseNumber(number.Literal)
+	if err != nil || code > 0xFF {
+		return nil, fmt.Errorf("expected single byte opcode, got: %s", number.Literal)
+	}
+	o.Code = byte(code)
+	if ops.more() {
+		if o.Operand, err = isa.ParseOperand(literal(ops.read())); err != nil {
+			return nil, err
+		}
+	}
+	return nil, p.DefineOpcode(o)
+}
+
+// encodeOpcode assembles a user-defined instruction.
+func (p *Parser) encodeOpcode(o isa.Opcode, ops *operands) ([]byte, error) {
+	switch o.Operand {
+	case isa.Byte:
+		value, err := byteOperand(ops.read())
+		if err != nil {
+			return nil, err
+		}
+		return []byte{o.Code, value}, nil
+	case isa.Word:
+		return p.encodeWord(o.Code, ops.read())
+	}
+	return []byte{o.Code}, nil
+}
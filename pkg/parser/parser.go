@@ -2,615 +2,1008 @@ package parser
 
 import (
 	"fmt"
-	"strconv"
+	"slices"
+	"sort"
 	"strings"
 
+	"github.com/lukepeterson/go8080assembler/pkg/ast"
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
 	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+	"github.com/lukepeterson/go8080assembler/pkg/memory"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+	"github.com/lukepeterson/go8080assembler/pkg/symbols"
 )
 
 type Parser struct {
-	tokens           []lexer.Token
-	position         int
+	tokens           []lexer.Token // Parsed into prog before encoding, if it isn't set
+	prog             *ast.Program
 	bytecode         []byte
 	labelDefinitions map[string]uint16   // Stores resolved label addresses
 	labelReferences  map[string][]uint16 // Tracks unresolved label usages
+	comments         []Comment
+	data             []Region // Ranges of bytes assembled from DB
+	statements       []Statement
+
+	// Code is assembled into the current segment, selected by CSEG and DSEG,
+	// and labels and label references are recorded relative to their
+	// segment until the segments are laid out
+	segment   object.Segment
+	segments  map[object.Segment]*segment
+	symbols   map[string]symbol
+	fixups    []fixup
+	publics   []string
+	externals map[string]bool
+
+	origin     uint16            // Address of the code segment in an absolute image
+	originSet  bool              // The origin was given by SetOrigin or ORG
+	absolute   bool              // Assembling an absolute image, rather than an object module
+	predefined map[string]uint16 // Symbols defined before assembly, which labels can redefine
+
+	imported map[string]symbols.Symbol // Symbols from symbol files, which labels can't redefine
+	importer func(filename string) ([]symbols.Symbol, error)
+
+	memory   *memory.Map // Memory map from SetMemoryMap and MEMORY, or nil
+	blocks   []memory.Block
+	warnings []string
+
+	phase *phase // The open PHASE block, or nil
+	label string // The label on the current line, if any
+
+	cpu isa.CPU // Selected by SetCPU and .8080, .8085 and .8085U
+
+	opcodes map[string]isa.Opcode // User-defined instructions, from DefineOpcode and OPCODE
 }
 
+type segment struct {
+	bytecode []byte
+	comments []Comment
+	data     []Region
+}
+
+type symbol struct {
+	segment object.Segment
+	offset  uint16
+}
+
+// phase is a block of code that's assembled at the current location but
+// runs at another address, after the program copies it there.
+type phase struct {
+	name    string // Label on the PHASE line, which is the load address
+	line    int
+	start   uint16 // Offset in the current segment where the block starts
+	address uint16 // Address the block runs at
+}
+
+// fixup is an operand that refers to a label.
+type fixup struct {
+	segment object.Segment
+	offset  uint16
+	label   string
+	pos     ast.Pos // The operand, for the position of errors
+}
+
+// Statement records where an instruction or directive from the source was
+// assembled.
+type Statement struct {
+	Line     int
+	Mnemonic string
+	Segment  object.Segment
+	Address  uint16
+	Size     int
+}
+
+// Region is a range of assembled bytes.
+type Region struct {
+	Address uint16
+	Size    int
+}
+
+// Contains reports whether address is inside the region.
+func (r Region) Contains(address uint16) bool {
+	return int(address) >= int(r.Address) && int(address) < int(r.Address)+r.Size
+}
+
+// Comment is a source comment along with the address of the next byte to be
+// assembled after it.
+type Comment struct {
+	Address uint16
+	Text    string
+}
+
+// New returns a parser for a program's tokens, which are parsed into its
+// syntax tree before it's encoded.
 func New(tokens []lexer.Token) *Parser {
+	p := newParser()
+	p.tokens = tokens
+	return p
+}
+
+// FromProgram returns a parser that encodes a program's syntax tree.
+func FromProgram(prog *ast.Program) *Parser {
+	p := newParser()
+	p.prog = prog
+	return p
+}
+
+func newParser() *Parser {
 	return &Parser{
-		tokens:           tokens,
-		position:         0,
 		labelDefinitions: make(map[string]uint16),
 		labelReferences:  make(map[string][]uint16),
+		segment:          object.Code,
+		segments:         map[object.Segment]*segment{object.Code: {}, object.Data: {}},
+		symbols:          make(map[string]symbol),
+		externals:        make(map[string]bool),
+		predefined:       make(map[string]uint16),
+		imported:         make(map[string]symbols.Symbol),
+		opcodes:          make(map[string]isa.Opcode),
 	}
 }
 
-func (p *Parser) advanceToken() {
-	if p.position < len(p.tokens)-1 {
-		p.position++
-	}
+// SetOrigin sets the address an absolute image starts at, unless the program
+// sets it with ORG.
+func (p *Parser) SetOrigin(address uint16) {
+	p.origin = address
+	p.originSet = true
+}
+
+// SetMemoryMap sets the memory map that an absolute image is placed and
+// checked against. MEMORY directives add regions to a copy of it.
+func (p *Parser) SetMemoryMap(m *memory.Map) {
+	p.memory = &memory.Map{Regions: slices.Clone(m.Regions)}
+}
+
+// SetCPU sets the processor the program is assembled for, until it selects
+// another with .8080, .8085 or .8085U. The default is the 8080.
+func (p *Parser) SetCPU(cpu isa.CPU) {
+	p.cpu = cpu
+}
+
+// MemoryMap returns the memory map, or nil if there isn't one.
+func (p *Parser) MemoryMap() *memory.Map {
+	return p.memory
+}
+
+// Define predefines a symbol, which the program can refer to like a label.
+// A label with the same name replaces it.
+func (p *Parser) Define(name string, value uint16) {
+	p.predefined[strings.ToUpper(name)] = value
 }
 
-func (p *Parser) currentToken() lexer.Token {
-	if p.position < len(p.tokens) {
-		return p.tokens[p.position]
+// Import defines an absolute symbol from a symbol file, like an EQU. Labels
+// can't redefine it, and importing it again with a different value is an
+// error. Errors name the symbol's origin.
+func (p *Parser) Import(s symbols.Symbol) error {
+	name := strings.ToUpper(s.Name)
+	if previous, found := p.imported[name]; found && previous.Value != s.Value {
+		return fmt.Errorf("symbol %s is 0x%04X in %s but 0x%04X in %s", name, previous.Value, previous.Origin, s.Value, s.Origin)
 	}
+	if _, defined := p.symbols[name]; defined {
+		return fmt.Errorf("label %s is already defined, so it can't be imported from %s", name, s.Origin)
+	}
+	p.imported[name] = s
+	p.predefined[name] = s.Value
+	return nil
+}
 
-	return lexer.Token{Type: lexer.EOF}
+// SetImporter sets the function that reads the symbol files named by IMPORT
+// directives.
+func (p *Parser) SetImporter(importer func(filename string) ([]symbols.Symbol, error)) {
+	p.importer = importer
 }
 
-func (p *Parser) Parse() ([]byte, error) {
-	for p.currentToken().Type != lexer.EOF {
+// Origin returns the address the absolute image starts at.
+func (p *Parser) Origin() uint16 {
+	return p.origin
+}
 
-		switch p.currentToken().Type {
-		case lexer.MNEMONIC:
-			hexCode, err := p.parseInstruction()
-			if err != nil {
-				return nil, err
-			}
-			p.bytecode = append(p.bytecode, hexCode...)
+// address returns the offset of the next byte in the current segment.
+func (p *Parser) address() uint16 {
+	return uint16(len(p.segments[p.segment].bytecode))
+}
 
-		case lexer.COMMENT:
-			// comments aren't assembled, so we simply skip the token
+// addReference records that the operand at the next byte refers to the
+// label it names.
+func (p *Parser) addReference(name *ast.Name) {
+	p.fixups = append(p.fixups, fixup{segment: p.segment, offset: p.address() + 1, label: name.Name, pos: name.Position})
+}
 
-		case lexer.LABEL:
-			label := p.currentToken().Literal
-			_, labelExists := p.labelDefinitions[label]
-			if labelExists {
-				return nil, fmt.Errorf("duplicate label found: %s", label)
-			}
-			p.labelDefinitions[label] = uint16(len(p.bytecode))
-			p.advanceToken()
+// Parse assembles the program as an absolute image starting at the origin,
+// with the data segment placed immediately after the code segment.
+func (p *Parser) Parse() ([]byte, error) {
+	p.absolute = true
+	p.placeCode()
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
 
-		default:
-			return nil, fmt.Errorf("unexpected token type \"%s\", literal: \"%s\"", p.currentToken().Type, p.currentToken().Literal)
+	// With a memory map, the code goes in the first executable region
+	// unless the origin was set, and the data in the first RAM region after
+	// the code, if there is one
+	codeSize, dataSize := len(p.segments[object.Code].bytecode), len(p.segments[object.Data].bytecode)
+	p.placeCode()
+	dataStart := int(p.origin) + codeSize
+	if p.memory != nil {
+		if region, found := p.memory.Data(dataStart); found && dataSize > 0 {
+			dataStart = max(dataStart, int(region.Start))
 		}
-
-		p.advanceToken()
+	}
+	if dataStart+dataSize > 0x10000 {
+		return nil, fmt.Errorf("program doesn't fit in memory from origin 0x%04X", p.origin)
+	}
+	bases := map[object.Segment]uint16{
+		object.Code: p.origin,
+		object.Data: uint16(dataStart),
+	}
+	p.bytecode = make([]byte, dataStart+dataSize-int(p.origin))
+	for _, s := range []object.Segment{object.Code, object.Data} {
+		copy(p.bytecode[bases[s]-p.origin:], p.segments[s].bytecode)
+		for _, comment := range p.segments[s].comments {
+			p.comments = append(p.comments, Comment{Address: comment.Address + bases[s], Text: comment.Text})
+		}
+		for _, region := range p.segments[s].data {
+			p.addData(region.Address+bases[s], region.Size)
+		}
+	}
+	for i := range p.statements {
+		p.statements[i].Address += bases[p.statements[i].Segment]
+	}
+	for label, s := range p.symbols {
+		p.labelDefinitions[label] = bases[s.segment] + s.offset
+	}
+	for _, f := range p.fixups {
+		if p.externals[f.label] {
+			return nil, errorAt(f.pos, fmt.Errorf("external symbol %s must be resolved by linking", f.label))
+		}
+		if _, defined := p.labelDefinitions[f.label]; !defined {
+			if _, predefined := p.predefined[f.label]; !predefined {
+				return nil, errorAt(f.pos, fmt.Errorf("label definition not found: %s", f.label))
+			}
+		}
+		p.labelReferences[f.label] = append(p.labelReferences[f.label], bases[f.segment]+f.offset)
 	}
 
 	// TODO: Split this out into a second pass
 	for label, positions := range p.labelReferences {
 		targetAddr, targetExists := p.labelDefinitions[label]
+		if !targetExists {
+			targetAddr, targetExists = p.predefined[label]
+		}
 		if targetExists {
 			highByte := uint8(targetAddr >> 8)
 			lowByte := uint8(targetAddr & 0x00FF)
 
 			// Update all instances of the label reference
 			for _, position := range positions {
-				p.bytecode[position] = lowByte
-				p.bytecode[position+1] = highByte
+				p.bytecode[position-p.origin] = lowByte
+				p.bytecode[position-p.origin+1] = highByte
 			}
 		} else {
 			return nil, fmt.Errorf("label definition not found: %s", label)
 		}
 	}
 
+	if p.memory != nil {
+		p.blocks = p.statementBlocks()
+		warnings, err := p.memory.Check(p.blocks)
+		if err != nil {
+			return nil, err
+		}
+		p.warnings = warnings
+		p.memory.Fill(p.bytecode, p.origin, p.blocks)
+	}
+
 	return p.bytecode, nil
 }
 
-type parseFunc func(*Parser) ([]byte, error)
-
-var instructionMap = map[string]parseFunc{
-
-	// MOVE, LOAD AND STORE
-	"MOV":  (*Parser).parseMOV,
-	"MVI":  (*Parser).parseMVI,
-	"LXI":  (*Parser).parseLXI,
-	"STAX": (*Parser).parseSTAXandLDAX,
-	"LDAX": (*Parser).parseSTAXandLDAX,
-	"STA":  (*Parser).parseDirectAddressInstruction,
-	"LDA":  (*Parser).parseDirectAddressInstruction,
-	"SHLD": (*Parser).parseDirectAddressInstruction,
-	"LHLD": (*Parser).parseDirectAddressInstruction,
-	"XCHG": (*Parser).parseSingleByteInstruction,
-
-	// STACK OPERATIONS
-	"XTHL": (*Parser).parseSingleByteInstruction,
-	"SPHL": (*Parser).parseSingleByteInstruction,
-
-	"PUSH": (*Parser).parseRegisterPairInstruction,
-	"POP":  (*Parser).parseRegisterPairInstruction,
-	"INX":  (*Parser).parseRegisterPairInstruction,
-	"DCX":  (*Parser).parseRegisterPairInstruction,
-	"DAD":  (*Parser).parseRegisterPairInstruction,
-
-	// JUMP AND CALL
-	"JMP":  (*Parser).parseDirectAddressInstruction,
-	"JC":   (*Parser).parseDirectAddressInstruction,
-	"JNC":  (*Parser).parseDirectAddressInstruction,
-	"JZ":   (*Parser).parseDirectAddressInstruction,
-	"JNZ":  (*Parser).parseDirectAddressInstruction,
-	"JP":   (*Parser).parseDirectAddressInstruction,
-	"JM":   (*Parser).parseDirectAddressInstruction,
-	"JPE":  (*Parser).parseDirectAddressInstruction,
-	"JPO":  (*Parser).parseDirectAddressInstruction,
-	"PCHL": (*Parser).parseSingleByteInstruction,
-	"CALL": (*Parser).parseDirectAddressInstruction,
-	"CC":   (*Parser).parseDirectAddressInstruction,
-	"CNC":  (*Parser).parseDirectAddressInstruction,
-	"CZ":   (*Parser).parseDirectAddressInstruction,
-	"CNZ":  (*Parser).parseDirectAddressInstruction,
-	"CP":   (*Parser).parseDirectAddressInstruction,
-	"CM":   (*Parser).parseDirectAddressInstruction,
-	"CPE":  (*Parser).parseDirectAddressInstruction,
-	"CPO":  (*Parser).parseDirectAddressInstruction,
-
-	// RETURN
-	"RET": (*Parser).parseSingleByteInstruction,
-	"RC":  (*Parser).parseSingleByteInstruction,
-	"RNC": (*Parser).parseSingleByteInstruction,
-	"RZ":  (*Parser).parseSingleByteInstruction,
-	"RNZ": (*Parser).parseSingleByteInstruction,
-	"RP":  (*Parser).parseSingleByteInstruction,
-	"RM":  (*Parser).parseSingleByteInstruction,
-	"RPE": (*Parser).parseSingleByteInstruction,
-	"RPO": (*Parser).parseSingleByteInstruction,
-
-	// RESTART
-	"RST": (*Parser).parseRestartInstruction,
-
-	// INCREMENT AND DECREMENT
-	"INR": (*Parser).parseRegister8Instruction,
-	"DCR": (*Parser).parseRegister8Instruction,
-
-	// ADD AND SUBTRACT
-	"ADD": (*Parser).parseRegister8Instruction,
-	"ADC": (*Parser).parseRegister8Instruction,
-	"ADI": (*Parser).parseImmediateInstruction,
-	"ACI": (*Parser).parseImmediateInstruction,
-	"SUB": (*Parser).parseRegister8Instruction,
-	"SBB": (*Parser).parseRegister8Instruction,
-	"SUI": (*Parser).parseImmediateInstruction,
-	"SBI": (*Parser).parseImmediateInstruction,
-	"ANI": (*Parser).parseImmediateInstruction,
-	"XRI": (*Parser).parseImmediateInstruction,
-	"ORI": (*Parser).parseImmediateInstruction,
-	"CPI": (*Parser).parseImmediateInstruction,
-
-	// LOGICAL
-	"ANA": (*Parser).parseRegister8Instruction,
-	"XRA": (*Parser).parseRegister8Instruction,
-	"ORA": (*Parser).parseRegister8Instruction,
-	"CMP": (*Parser).parseRegister8Instruction,
-
-	// ROTATE
-	"RLC": (*Parser).parseSingleByteInstruction,
-	"RRC": (*Parser).parseSingleByteInstruction,
-	"RAL": (*Parser).parseSingleByteInstruction,
-	"RAR": (*Parser).parseSingleByteInstruction,
-
-	// SPECIALS
-	"CMA": (*Parser).parseSingleByteInstruction,
-	"STC": (*Parser).parseSingleByteInstruction,
-	"CMC": (*Parser).parseSingleByteInstruction,
-	"DAA": (*Parser).parseSingleByteInstruction,
-
-	// INPUT/OUTPUT
-	"IN":  (*Parser).parseImmediateInstruction,
-	"OUT": (*Parser).parseImmediateInstruction,
-
-	// CONTROL
-	"EI":  (*Parser).parseSingleByteInstruction,
-	"DI":  (*Parser).parseSingleByteInstruction,
-	"NOP": (*Parser).parseSingleByteInstruction,
-	"HLT": (*Parser).parseSingleByteInstruction,
-
-	"DB": (*Parser).parseDB,
-}
-
-var registerMap8 = map[string]byte{
-	"B": 0x00, "C": 0x01, "D": 0x02, "E": 0x03, "H": 0x04, "L": 0x05, "M": 0x06, "A": 0x07,
-}
-
-var registerMap16 = map[string]byte{
-	"B": 0x00, "D": 0x01, "H": 0x02, "SP": 0x03,
-}
-
-func (p *Parser) parseInstruction() ([]byte, error) {
-	instruction := p.currentToken().Literal
-	parseFunc, instructionExists := instructionMap[instruction]
-	if !instructionExists {
-		return nil, fmt.Errorf("unknown instruction: %s", instruction)
+// statementBlocks returns the bytes assembled from the program's
+// statements as memory blocks, one for each run of instructions or data
+// that follow each other. The gaps left by ORG aren't included.
+func (p *Parser) statementBlocks() []memory.Block {
+	blocks := []memory.Block{}
+	for _, statement := range p.statements {
+		if statement.Size == 0 || statement.Mnemonic == "ORG" {
+			continue
+		}
+		code := !isa.IsDirective(statement.Mnemonic)
+		data := statement.Segment == object.Data
+		if n := len(blocks); n > 0 && blocks[n-1].End() == int(statement.Address) && blocks[n-1].Code == code && blocks[n-1].Data == data {
+			blocks[n-1].Size += statement.Size
+			continue
+		}
+		blocks = append(blocks, memory.Block{Name: fmt.Sprintf("line %d", statement.Line), Start: statement.Address, Size: statement.Size, Code: code, Data: data})
 	}
-	return parseFunc(p)
+	return blocks
 }
 
-func (p *Parser) parseMOV() ([]byte, error) {
-	p.advanceToken()
+// Blocks returns the runs of instructions and data placed in memory by
+// Parse, if there's a memory map.
+func (p *Parser) Blocks() []memory.Block {
+	return p.blocks
+}
 
-	if p.currentToken().Type != lexer.REGISTER {
-		return nil, fmt.Errorf("expected register, got: %s", p.currentToken().Literal)
-	}
-	dest := p.currentToken().Literal
-	p.advanceToken()
+// Warnings returns the warnings from checking the program against the
+// memory map, such as code placed in RAM.
+func (p *Parser) Warnings() []string {
+	return p.warnings
+}
 
-	if p.currentToken().Type != lexer.COMMA {
-		return nil, fmt.Errorf("expected comma, got: %s", p.currentToken().Literal)
+// ParseObject assembles the program as a relocatable object module. Labels,
+// statements and comments are left relative to their segment.
+func (p *Parser) ParseObject() (*object.Module, error) {
+	if err := p.parse(); err != nil {
+		return nil, err
 	}
-	p.advanceToken()
 
-	if p.currentToken().Type != lexer.REGISTER {
-		return nil, fmt.Errorf("expected register, got: %s", p.currentToken().Literal)
+	module := &object.Module{
+		Code: p.segments[object.Code].bytecode,
+		Data: p.segments[object.Data].bytecode,
+	}
+	for _, name := range p.publics {
+		s := p.symbols[name]
+		module.Symbols = append(module.Symbols, object.Symbol{Name: name, Segment: s.segment, Offset: s.offset})
+	}
+	for _, f := range p.fixups {
+		if p.externals[f.label] {
+			module.Fixups = append(module.Fixups, object.Fixup{Segment: f.segment, Offset: f.offset, Name: f.label})
+			continue
+		}
+		bytecode := p.segments[f.segment].bytecode
+		s, defined := p.symbols[f.label]
+		if value, predefined := p.predefined[f.label]; !defined && predefined {
+			bytecode[f.offset] = uint8(value & 0x00FF)
+			bytecode[f.offset+1] = uint8(value >> 8)
+			continue
+		}
+		if !defined {
+			return nil, errorAt(f.pos, fmt.Errorf("label definition not found: %s", f.label))
+		}
+		bytecode[f.offset] = uint8(s.offset & 0x00FF)
+		bytecode[f.offset+1] = uint8(s.offset >> 8)
+		if s.segment == object.Absolute {
+			continue
+		}
+		module.Relocations = append(module.Relocations, object.Relocation{Segment: f.segment, Offset: f.offset, Target: s.segment})
 	}
-	src := p.currentToken().Literal
 
-	srcRegister, exists := registerMap8[src]
-	if !exists {
-		return nil, fmt.Errorf("invalid source register for MOV: %s", src)
+	for label, s := range p.symbols {
+		p.labelDefinitions[label] = s.offset
 	}
+	for _, s := range []object.Segment{object.Code, object.Data} {
+		p.comments = append(p.comments, p.segments[s].comments...)
+		p.data = append(p.data, p.segments[s].data...)
+	}
+	return module, nil
+}
 
-	destRegister, exists := registerMap8[dest]
-	if !exists {
-		return nil, fmt.Errorf("invalid destination register for MOV: %s", dest)
+func (p *Parser) parse() error {
+	if p.prog == nil {
+		prog, err := ast.Parse(p.tokens)
+		if err != nil {
+			return err
+		}
+		p.prog = prog
 	}
 
-	opcode := byte(0x40) | (destRegister << 3) | srcRegister
-	return []byte{opcode}, nil
+	for _, s := range p.prog.Statements {
+		switch s := s.(type) {
+		case *ast.Instruction:
+			if err := p.statement(s.Mnemonic, s.Position, s.Operands); err != nil {
+				return err
+			}
 
-}
+		case *ast.Directive:
+			if err := p.statement(s.Name, s.Position, s.Operands); err != nil {
+				return err
+			}
 
-func (p *Parser) parseMVI() ([]byte, error) {
-	p.advanceToken()
+		case *ast.Comment:
+			// comments aren't assembled, but we keep them for tools that read annotations
+			current := p.segments[p.segment]
+			current.comments = append(current.comments, Comment{Address: p.address(), Text: s.Text})
 
-	if p.currentToken().Type != lexer.REGISTER {
-		return nil, fmt.Errorf("expected register, got: %s", p.currentToken().Literal)
+		case *ast.Label:
+			label := s.Name
+			_, labelExists := p.symbols[label]
+			if labelExists {
+				return errorAt(s.Position, fmt.Errorf("duplicate label found: %s", label))
+			}
+			if p.externals[label] {
+				return errorAt(s.Position, fmt.Errorf("label %s is declared EXTRN", label))
+			}
+			if imported, found := p.imported[label]; found {
+				return errorAt(s.Position, fmt.Errorf("label %s is already defined as 0x%04X by %s", label, imported.Value, imported.Origin))
+			}
+			sym := symbol{segment: p.segment, offset: p.address()}
+			if p.phase != nil {
+				// Labels in a PHASE block are at the address the block runs at
+				runAddress := int(p.phase.address) + int(p.address()-p.phase.start)
+				if runAddress > 0xFFFF {
+					return errorAt(s.Position, fmt.Errorf("label %s in PHASE block is past 0xFFFF", label))
+				}
+				sym = symbol{segment: object.Absolute, offset: uint16(runAddress)}
+			}
+			p.symbols[label] = sym
+			p.label = label
+		}
 	}
-	dest := p.currentToken().Literal
-	p.advanceToken()
 
-	if p.currentToken().Type != lexer.COMMA {
-		return nil, fmt.Errorf("expected comma, got: %s", p.currentToken().Literal)
+	if p.phase != nil {
+		return fmt.Errorf("PHASE on line %d has no DEPHASE", p.phase.line)
 	}
-	p.advanceToken()
-
-	if p.currentToken().Type != lexer.NUMBER {
-		return nil, fmt.Errorf("expected number, got: %s", p.currentToken().Literal)
+	for _, name := range p.publics {
+		if p.externals[name] {
+			return fmt.Errorf("symbol %s is declared both PUBLIC and EXTRN", name)
+		}
+		if _, defined := p.symbols[name]; !defined {
+			return fmt.Errorf("public symbol not defined: %s", name)
+		}
 	}
-	byteToStore := p.currentToken().Literal
+	return nil
+}
 
-	destRegister, exists := registerMap8[dest]
-	if !exists {
-		return nil, fmt.Errorf("invalid destination register for MOV: %s", dest)
-	}
+// Labels returns the resolved address of every label defined in the program.
+func (p *Parser) Labels() map[string]uint16 {
+	return p.labelDefinitions
+}
 
-	_, lowByte, err := parseHex(byteToStore)
-	if err != nil {
-		return nil, err
-	}
+// Predefined returns the symbols defined before assembly or imported from
+// symbol files, by name.
+func (p *Parser) Predefined() map[string]uint16 {
+	return p.predefined
+}
 
-	opcode := byte(0x06) | (destRegister << 3)
-	return []byte{opcode, lowByte}, nil
+// References returns the addresses of the operands that refer to each label.
+func (p *Parser) References() map[string][]uint16 {
+	return p.labelReferences
 }
 
-func (p *Parser) parseLXI() ([]byte, error) {
-	p.advanceToken()
+// Data returns the ranges of bytes assembled from data directives, with
+// adjacent ranges merged.
+func (p *Parser) Data() []Region {
+	return p.data
+}
 
-	if p.currentToken().Type != lexer.REGISTER {
-		return nil, fmt.Errorf("expected register, got: %s", p.currentToken().Literal)
+// addSegmentData records a data region in the current segment.
+func (p *Parser) addSegmentData(address uint16, size int) {
+	if size == 0 {
+		return
 	}
-	dest := p.currentToken().Literal
-	p.advanceToken()
-
-	if p.currentToken().Type != lexer.COMMA {
-		return nil, fmt.Errorf("expected comma, got: %s", p.currentToken().Literal)
+	current := p.segments[p.segment]
+	if n := len(current.data); n > 0 && int(current.data[n-1].Address)+current.data[n-1].Size == int(address) {
+		current.data[n-1].Size += size
+		return
 	}
-	p.advanceToken()
+	current.data = append(current.data, Region{Address: address, Size: size})
+}
 
-	destRegister, exists := registerMap16[dest]
-	if !exists {
-		return nil, fmt.Errorf("invalid destination register for LXI: %s", dest)
+func (p *Parser) addData(address uint16, size int) {
+	if size == 0 {
+		return
 	}
-	opcode := byte(0x01) | (destRegister << 4)
-
-	if p.currentToken().Type == lexer.NUMBER {
-		highByte, lowByte, err := parseHex(p.currentToken().Literal)
-		if err != nil {
-			return nil, err
-		}
-		return []byte{opcode, lowByte, highByte}, nil
+	if n := len(p.data); n > 0 && int(p.data[n-1].Address)+p.data[n-1].Size == int(address) {
+		p.data[n-1].Size += size
+		return
 	}
+	p.data = append(p.data, Region{Address: address, Size: size})
+}
 
-	if p.currentToken().Type == lexer.LABEL {
-		label := p.currentToken().Literal
-		_, labelExists := p.labelReferences[label]
-		if !labelExists {
-			p.labelReferences[label] = []uint16{}
-		}
-		p.labelReferences[label] = append(p.labelReferences[label], uint16(len(p.bytecode)+1))
+// Statements returns every instruction and directive in the program, in
+// source order.
+func (p *Parser) Statements() []Statement {
+	return p.statements
+}
 
-		return []byte{opcode, 0x00, 0x00}, nil
+// Publics returns the symbols declared PUBLIC, in source order.
+func (p *Parser) Publics() []string {
+	return p.publics
+}
+
+// Externals returns the symbols declared EXTRN.
+func (p *Parser) Externals() []string {
+	externals := []string{}
+	for name := range p.externals {
+		externals = append(externals, name)
 	}
+	sort.Strings(externals)
+	return externals
+}
 
-	return nil, fmt.Errorf("expected address or label, got: %s", p.currentToken().Type)
+// Comments returns every comment in the program, in source order.
+func (p *Parser) Comments() []Comment {
+	return p.comments
 }
 
-func (p *Parser) parseSTAXandLDAX() ([]byte, error) {
-	opcodes := map[string]byte{
-		"STAX": 0x02,
-		"LDAX": 0x0A,
+// statement assembles an instruction or directive into the current segment
+// and records where it was assembled.
+func (p *Parser) statement(mnemonic string, pos ast.Pos, operandList []ast.Operand) error {
+	statement := Statement{Line: pos.Line, Mnemonic: mnemonic}
+	ops := &operands{list: operandList}
+	hexCode, err := p.encode(mnemonic, pos, ops)
+	if err == nil {
+		err = ops.end()
 	}
+	if err != nil {
+		return errorAt(pos, err)
+	}
+	// CSEG and DSEG take effect before the statement is recorded
+	statement.Segment, statement.Address = p.segment, p.address()
+	if statement.Mnemonic == "DB" || statement.Mnemonic == "ORG" {
+		p.addSegmentData(statement.Address, len(hexCode))
+	}
+	statement.Size = len(hexCode)
+	p.statements = append(p.statements, statement)
+	p.label = ""
+	current := p.segments[p.segment]
+	current.bytecode = append(current.bytecode, hexCode...)
+	if len(current.bytecode) > 0x10000 {
+		return errorAt(pos, fmt.Errorf("%s segment is larger than 64K", p.segment))
+	}
+	return nil
+}
 
-	opcode, valid := opcodes[p.currentToken().Literal]
-	if !valid {
-		return nil, fmt.Errorf("invalid STAX/LDAX instruction: %s", p.currentToken().Literal)
-	}
-	p.advanceToken()
+// operands reads the operands of a statement in order.
+type operands struct {
+	list []ast.Operand
+	next int
+}
 
-	if p.currentToken().Type != lexer.REGISTER {
-		return nil, fmt.Errorf("expected register, got: %s", p.currentToken().Literal)
+// read returns the next operand, or nil at the end of the statement.
+func (o *operands) read() ast.Operand {
+	if o.next >= len(o.list) {
+		return nil
 	}
-	dest := p.currentToken().Literal
+	o.next++
+	return o.list[o.next-1]
+}
 
-	registerMap := map[string]byte{
-		"B": 0x00, "D": 0x01,
+// more reports whether there are operands left to read.
+func (o *operands) more() bool {
+	return o.next < len(o.list)
+}
+
+// register reads an operand that must be a register.
+func (o *operands) register() (string, error) {
+	operand := o.read()
+	register, ok := operand.(*ast.Register)
+	if !ok {
+		return "", fmt.Errorf("expected register, got: %s", literal(operand))
 	}
+	return register.Name, nil
+}
 
-	destRegister, exists := registerMap[dest]
-	if !exists {
-		return nil, fmt.Errorf("invalid destination register for STAX: %s", dest)
+// end returns an error if there are operands that haven't been read.
+func (o *operands) end() error {
+	if o.more() {
+		return fmt.Errorf("unexpected operand: %s", literal(o.list[o.next]))
 	}
+	return nil
+}
 
-	opcode = opcode | (destRegister << 4)
-	return []byte{opcode}, nil
+// literal returns an operand as it was written.
+func literal(operand ast.Operand) string {
+	switch o := operand.(type) {
+	case *ast.Register:
+		return o.Name
+	case *ast.Number:
+		return o.Literal
+	case *ast.Name:
+		return o.Name
+	case *ast.String:
+		return o.Value
+	}
+	return "end of line"
 }
 
-func (p *Parser) parseDirectAddressInstruction() ([]byte, error) {
-	opcodes := map[string]byte{
-		"STA":  0x32,
-		"LDA":  0x3A,
-		"SHLD": 0x22,
-		"LHLD": 0x2A,
-		"JMP":  0xC3,
-		"JC":   0xDA,
-		"JNC":  0xD2,
-		"JZ":   0xCA,
-		"JNZ":  0xC2,
-		"JP":   0xF2,
-		"JM":   0xFA,
-		"JPE":  0xEA,
-		"JPO":  0xE2,
-		"CALL": 0xCD,
-		"CC":   0xDC,
-		"CNC":  0xD4,
-		"CZ":   0xCC,
-		"CNZ":  0xC4,
-		"CP":   0xF4,
-		"CM":   0xFC,
-		"CPE":  0xEC,
-		"CPO":  0xE4,
-	}
+// kind returns the kind of an operand, named after the token it's written
+// as.
+func kind(operand ast.Operand) string {
+	switch operand.(type) {
+	case *ast.Register:
+		return string(lexer.REGISTER)
+	case *ast.Number:
+		return string(lexer.NUMBER)
+	case *ast.Name:
+		return string(lexer.LABEL)
+	case *ast.String:
+		return string(lexer.STRING)
+	}
+	return "end of line"
+}
 
-	opcode, valid := opcodes[p.currentToken().Literal]
-	if !valid {
-		return nil, fmt.Errorf("invalid direct address instruction: %s", p.currentToken().Literal)
+// encode assembles an instruction or directive.
+func (p *Parser) encode(mnemonic string, pos ast.Pos, ops *operands) ([]byte, error) {
+	if isa.IsDirective(mnemonic) {
+		return p.encodeDirective(strings.ToUpper(mnemonic), pos, ops)
+	}
+	in, instructionExists := isa.Lookup(mnemonic)
+	if o, defined := p.opcodes[strings.ToUpper(mnemonic)]; defined && !instructionExists {
+		return p.encodeOpcode(o, ops)
+	}
+	if !instructionExists {
+		return nil, fmt.Errorf("unknown instruction: %s", mnemonic)
+	}
+	if err := p.cpu.Check(mnemonic); err != nil {
+		return nil, err
 	}
-	p.advanceToken()
 
-	if p.currentToken().Type == lexer.NUMBER {
-		highByte, lowByte, err := parseHex(p.currentToken().Literal)
+	switch in.Form {
+	case isa.Register, isa.DestRegister:
+		name, err := ops.register()
 		if err != nil {
 			return nil, err
 		}
-		return []byte{opcode, lowByte, highByte}, nil
-	}
+		register, exists := isa.RegisterCode(name)
+		if !exists {
+			return nil, fmt.Errorf("invalid destination register for %s: %s", mnemonic, name)
+		}
+		if in.Form == isa.DestRegister {
+			register <<= 3
+		}
+		return []byte{in.Code | register}, nil
 
-	if p.currentToken().Type == lexer.LABEL {
-		label := p.currentToken().Literal
-		_, labelExists := p.labelReferences[label]
-		if !labelExists {
-			p.labelReferences[label] = []uint16{}
+	case isa.RegisterPair, isa.IndirectPair:
+		name, err := ops.register()
+		if err != nil {
+			return nil, err
 		}
-		p.labelReferences[label] = append(p.labelReferences[label], uint16(len(p.bytecode)+1))
-		return []byte{opcode, 0x00, 0x00}, nil
-	}
+		pair, exists := isa.PairCode(in.Form, name)
+		if !exists {
+			return nil, fmt.Errorf("invalid destination register for %s: %s", mnemonic, name)
+		}
+		return []byte{in.Code | pair<<4}, nil
 
-	return nil, fmt.Errorf("expected address or label, got: %s", p.currentToken().Type)
-}
+	case isa.Immediate:
+		value, err := byteOperand(ops.read())
+		if err != nil {
+			return nil, err
+		}
+		return []byte{in.Code, value}, nil
 
-func (p *Parser) parseImmediateInstruction() ([]byte, error) {
-	opcodes := map[string]byte{
-		"ADI": 0xC6,
-		"ACI": 0xCE,
-		"SUI": 0xD6,
-		"SBI": 0xDE,
-		"ANI": 0xE6,
-		"XRI": 0xEE,
-		"ORI": 0xF6,
-		"CPI": 0xFE,
-		"IN":  0xDB,
-		"OUT": 0xD3,
-	}
+	case isa.Address:
+		return p.encodeWord(in.Code, ops.read())
 
-	opcode, valid := opcodes[p.currentToken().Literal]
-	if !valid {
-		return nil, fmt.Errorf("invalid immediate instruction: %s, ", p.currentToken().Literal)
-	}
-	p.advanceToken()
+	case isa.Move:
+		dest, err := ops.register()
+		if err != nil {
+			return nil, err
+		}
+		src, err := ops.register()
+		if err != nil {
+			return nil, err
+		}
+		srcRegister, exists := isa.RegisterCode(src)
+		if !exists {
+			return nil, fmt.Errorf("invalid source register for MOV: %s", src)
+		}
+		destRegister, exists := isa.RegisterCode(dest)
+		if !exists {
+			return nil, fmt.Errorf("invalid destination register for MOV: %s", dest)
+		}
+		return []byte{in.Code | destRegister<<3 | srcRegister}, nil
 
-	if p.currentToken().Type == lexer.NUMBER {
-		highByte, lowByte, err := parseHex(p.currentToken().Literal)
+	case isa.MoveImmediate:
+		dest, err := ops.register()
+		if err != nil {
+			return nil, err
+		}
+		operand := ops.read()
+		number, ok := operand.(*ast.Number)
+		if !ok {
+			return nil, fmt.Errorf("expected number, got: %s", literal(operand))
+		}
+		destRegister, exists := isa.RegisterCode(dest)
+		if !exists {
+			return nil, fmt.Errorf("invalid destination register for MVI: %s", dest)
+		}
+		value, err := isa.ParseNumber(number.Literal)
 		if err != nil {
 			return nil, err
 		}
+		return []byte{in.Code | destRegister<<3, uint8(value & 0x00FF)}, nil
 
-		if highByte != 0x00 {
-			return nil, fmt.Errorf("expected single byte of data, got: %s", p.currentToken().Literal)
+	case isa.LoadPair:
+		dest, err := ops.register()
+		if err != nil {
+			return nil, err
 		}
+		pair, exists := isa.PairCode(in.Form, dest)
+		if !exists {
+			return nil, fmt.Errorf("invalid destination register for LXI: %s", dest)
+		}
+		return p.encodeWord(in.Code|pair<<4, ops.read())
 
-		return []byte{opcode, lowByte}, nil
+	case isa.Restart:
+		operand := ops.read()
+		number, ok := operand.(*ast.Number)
+		if !ok {
+			return nil, fmt.Errorf("expected number, got: %s", literal(operand))
+		}
+		routine, err := isa.ParseNumber(number.Literal)
+		if err != nil || routine > 7 {
+			return nil, fmt.Errorf("expected routine value between 0 and 7, got: %s", number.Literal)
+		}
+		return []byte{in.Code + uint8(routine)<<3}, nil
 	}
-
-	return nil, fmt.Errorf("expected number, got: %s", p.currentToken().Type)
+	return []byte{in.Code}, nil
 }
 
-func (p *Parser) parseSingleByteInstruction() ([]byte, error) {
-	opcodes := map[string]byte{
-		"XCHG": 0xEB,
-		"XTHL": 0xE3,
-		"SPHL": 0xF9,
-		"PCHL": 0xE9,
-		"RET":  0xC9,
-		"RC":   0xD8,
-		"RNC":  0xD0,
-		"RZ":   0xC8,
-		"RNZ":  0xC0,
-		"RP":   0xF0,
-		"RM":   0xF8,
-		"RPE":  0xE8,
-		"RPO":  0xE0,
-		"RLC":  0x07,
-		"RRC":  0x0F,
-		"RAL":  0x17,
-		"RAR":  0x1F,
-		"CMA":  0x2F,
-		"STC":  0x37,
-		"CMC":  0x3F,
-		"DAA":  0x27,
-		"EI":   0xFB,
-		"DI":   0xF3,
-		"NOP":  0x00,
-		"HLT":  0x76,
+// byteOperand returns the value of an operand that must be a number no
+// larger than a byte.
+func byteOperand(operand ast.Operand) (byte, error) {
+	number, ok := operand.(*ast.Number)
+	if !ok {
+		return 0, fmt.Errorf("expected number, got: %s", kind(operand))
+	}
+	value, err := isa.ParseNumber(number.Literal)
+	if err != nil {
+		return 0, err
+	}
+	if value > 0xFF {
+		return 0, fmt.Errorf("expected single byte of data, got: %s", number.Literal)
 	}
+	return byte(value), nil
+}
 
-	opcode, valid := opcodes[p.currentToken().Literal]
-	if !valid {
-		return nil, fmt.Errorf("invalid instruction: %s, ", p.currentToken().Literal)
+// encodeWord assembles an opcode followed by a 16-bit operand, which is a
+// number or a reference to a label.
+func (p *Parser) encodeWord(opcode byte, operand ast.Operand) ([]byte, error) {
+	switch o := operand.(type) {
+	case *ast.Number:
+		value, err := isa.ParseNumber(o.Literal)
+		if err != nil {
+			return nil, err
+		}
+		return []byte{opcode, uint8(value & 0x00FF), uint8(value >> 8)}, nil
+	case *ast.Name:
+		p.addReference(o)
+		return []byte{opcode, 0x00, 0x00}, nil
 	}
+	return nil, fmt.Errorf("expected address or label, got: %s", kind(operand))
+}
 
-	return []byte{opcode}, nil
+// encodeDirective carries out a directive, returning the bytes it
+// assembles, if any.
+func (p *Parser) encodeDirective(directive string, pos ast.Pos, ops *operands) ([]byte, error) {
+	switch directive {
+	case "DB":
+		return p.encodeDB(ops)
+	case "CSEG", "DSEG":
+		return p.encodeSegment(directive)
+	case "PUBLIC", "EXTRN":
+		return p.encodeSymbolList(directive, ops)
+	case "ORG":
+		return p.encodeORG(ops)
+	case "MEMORY":
+		return p.encodeMEMORY(ops)
+	case "IMPORT":
+		return p.encodeIMPORT(ops)
+	case "PHASE":
+		return p.encodePHASE(pos, ops)
+	case "DEPHASE":
+		return p.encodeDEPHASE()
+	case "OPCODE":
+		return p.encodeOPCODE(ops)
+	}
+	return p.encodeCPU(directive)
 }
 
-// TODO: make this parseRegister16Instruction?
-// Need to work out how to deal with PSW.
-func (p *Parser) parseRegisterPairInstruction() ([]byte, error) {
-	opcodes := map[string]byte{
-		"PUSH": 0xC5,
-		"POP":  0xC1,
-		"INX":  0x03,
-		"DCX":  0x0B,
-		"DAD":  0x09,
+func (p *Parser) encodeDB(ops *operands) ([]byte, error) {
+	data := []byte{}
+	for {
+		switch o := ops.read().(type) {
+		case *ast.Number:
+			value, err := isa.ParseNumber(o.Literal)
+			if err != nil || value > 0xFF {
+				return nil, fmt.Errorf("invalid byte value: %s", o.Literal)
+			}
+			data = append(data, byte(value))
+		case *ast.String:
+			// Convert string into bytes
+			data = append(data, []byte(o.Value)...)
+		default:
+			return nil, fmt.Errorf("expected number or string, got: %s", literal(o))
+		}
+		if !ops.more() {
+			return data, nil
+		}
 	}
+}
 
-	registerMap := map[string]byte{
-		"B": 0x00, "D": 0x01, "H": 0x02, "PSW": 0x03, "SP": 0x03,
+func (p *Parser) encodeSegment(directive string) ([]byte, error) {
+	if p.phase != nil {
+		return nil, fmt.Errorf("%s inside the PHASE block on line %d", directive, p.phase.line)
 	}
-	opcode, valid := opcodes[p.currentToken().Literal]
-	if !valid {
-		return nil, fmt.Errorf("invalid instruction: %s, ", p.currentToken().Literal)
+	p.segment = object.Code
+	if directive == "DSEG" {
+		p.segment = object.Data
 	}
-	p.advanceToken()
+	return nil, nil
+}
 
-	if p.currentToken().Type != lexer.REGISTER {
-		return nil, fmt.Errorf("expected register, got: %s", p.currentToken().Literal)
+// encodeORG moves the location counter forward to the given address, filling
+// the gap with zeros. In an absolute image, an ORG before any code sets the
+// origin, and later ones are addresses from the origin; in object modules,
+// and in the data segment, they're offsets from the start of the segment.
+func (p *Parser) encodeORG(ops *operands) ([]byte, error) {
+	if p.phase != nil {
+		return nil, fmt.Errorf("ORG inside the PHASE block on line %d", p.phase.line)
 	}
-	dest := p.currentToken().Literal
-
-	destRegister, exists := registerMap[dest]
-	if !exists {
-		return nil, fmt.Errorf("invalid destination register for %s: %s", p.currentToken().Literal, dest)
+	operand := ops.read()
+	number, ok := operand.(*ast.Number)
+	if !ok {
+		return nil, fmt.Errorf("expected address, got: %s", literal(operand))
 	}
+	value, err := isa.ParseNumber(number.Literal)
+	if err != nil {
+		return nil, err
+	}
+	address := int(value)
 
-	opcode = opcode | (destRegister << 4)
-	return []byte{opcode}, nil
+	offset := address
+	if p.absolute && p.segment == object.Code {
+		if len(p.segments[object.Code].bytecode) == 0 {
+			p.origin = uint16(address)
+			p.originSet = true
+			return nil, nil
+		}
+		p.originSet = true
+		offset -= int(p.origin)
+	}
+	if offset < int(p.address()) {
+		return nil, fmt.Errorf("ORG 0x%04X overlaps the %d bytes before it, which end at 0x%04X", address, int(p.address())-offset, address+int(p.address())-offset-1)
+	}
+	return make([]byte, offset-int(p.address())), nil
 }
 
-func (p *Parser) parseRestartInstruction() ([]byte, error) {
-	p.advanceToken()
+// encodeMEMORY adds a region to the memory map: MEMORY name, start, size,
+// access, with an optional fill byte after the access.
+func (p *Parser) encodeMEMORY(ops *operands) ([]byte, error) {
+	operand := ops.read()
+	name, ok := operand.(*ast.Name)
+	if !ok {
+		return nil, fmt.Errorf("expected memory region name, got: %s", literal(operand))
+	}
+	region := memory.Region{Name: name.Name}
 
-	if p.currentToken().Type != lexer.NUMBER {
-		return nil, fmt.Errorf("expected number, got: %s", p.currentToken().Literal)
+	start, err := memoryOperand(ops.read(), 0xFFFF)
+	if err != nil {
+		return nil, err
+	}
+	region.Start = uint16(start)
+	if region.Size, err = memoryOperand(ops.read(), 0x10000); err != nil {
+		return nil, err
+	}
+	if region.Access, err = memory.ParseAccess(literal(ops.read())); err != nil {
+		return nil, err
 	}
 
-	routine, err := strconv.ParseUint(p.currentToken().Literal, 16, 8)
-	if err != nil || routine > 7 {
-		return nil, fmt.Errorf("expected routine value between 0 and 7, got: %s", p.currentToken().Literal)
+	if ops.more() {
+		fill, err := memoryOperand(ops.read(), 0xFF)
+		if err != nil {
+			return nil, err
+		}
+		region.Fill = byte(fill)
 	}
 
-	opcode := byte(0xC7 + routine<<3)
-	return []byte{opcode}, nil
+	if p.memory == nil {
+		p.memory = &memory.Map{}
+	}
+	if err := p.memory.Add(region); err != nil {
+		return nil, err
+	}
+	if len(p.segments[object.Code].bytecode) == 0 {
+		p.placeCode()
+	}
+	return nil, nil
 }
 
-func (p *Parser) parseRegister8Instruction() ([]byte, error) {
-	opcodes := map[string]byte{
-		"INR": 0x04,
-		"DCR": 0x05,
-		"ADD": 0x80,
-		"ADC": 0x88,
-		"SUB": 0x90,
-		"SBB": 0x98,
-		"ANA": 0xA0,
-		"XRA": 0xA8,
-		"ORA": 0xB0,
-		"CMP": 0xB8,
+// placeCode sets the origin of an absolute image to the start of the first
+// executable region of the memory map, unless it's already been set.
+func (p *Parser) placeCode() {
+	if !p.absolute || p.originSet || p.memory == nil {
+		return
 	}
-
-	opcode, valid := opcodes[p.currentToken().Literal]
-	if !valid {
-		return nil, fmt.Errorf("invalid instruction: %s, ", p.currentToken().Literal)
+	if region, found := p.memory.Code(); found {
+		p.origin = region.Start
 	}
-	p.advanceToken()
+}
 
-	if p.currentToken().Type != lexer.REGISTER {
-		return nil, fmt.Errorf("expected register, got: %s", p.currentToken().Literal)
+// memoryOperand returns the value of an operand that must be a number no
+// larger than limit.
+func memoryOperand(operand ast.Operand, limit int) (int, error) {
+	number, ok := operand.(*ast.Number)
+	if !ok {
+		return 0, fmt.Errorf("expected number, got: %s", literal(operand))
 	}
-	dest := p.currentToken().Literal
+	return isa.ParseNumberUpTo(number.Literal, limit)
+}
 
-	destRegister, exists := registerMap8[dest]
-	if !exists {
-		return nil, fmt.Errorf("invalid destination register for %s: %s", p.currentToken().Literal, dest)
+// encodeIMPORT imports the symbols in a symbol file.
+func (p *Parser) encodeIMPORT(ops *operands) ([]byte, error) {
+	operand := ops.read()
+	filename, ok := operand.(*ast.String)
+	if !ok {
+		return nil, fmt.Errorf("expected symbol file name, got: %s", literal(operand))
+	}
+	if p.importer == nil {
+		return nil, fmt.Errorf("can't import %s: no symbol files are available", filename.Value)
 	}
 
-	// TODO: Find a better way to do this
-	// If INR or DCR, set shift to 3
-	shiftAmount := 0
-	if opcode == 0x04 || opcode == 0x05 {
-		shiftAmount = 3
+	imported, err := p.importer(filename.Value)
+	if err != nil {
+		return nil, err
 	}
+	for _, s := range imported {
+		if err := p.Import(s); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
 
-	opcode = opcode | (destRegister << shiftAmount)
-	return []byte{opcode}, nil
+// encodePHASE starts a block of code that's assembled at the current
+// location but runs at the given address: labels in the block are defined
+// at their run-time address. A label on the PHASE line is the block's load
+// address, and DEPHASE defines its length as the label followed by _LEN.
+func (p *Parser) encodePHASE(pos ast.Pos, ops *operands) ([]byte, error) {
+	if p.phase != nil {
+		return nil, fmt.Errorf("PHASE blocks can't be nested, the block on line %d is still open", p.phase.line)
+	}
+	operand := ops.read()
+	number, ok := operand.(*ast.Number)
+	if !ok {
+		return nil, fmt.Errorf("expected address, got: %s", literal(operand))
+	}
+	address, err := isa.ParseNumber(number.Literal)
+	if err != nil {
+		return nil, err
+	}
+	p.phase = &phase{name: p.label, line: pos.Line, start: p.address(), address: address}
+	return nil, nil
 }
 
-func (p *Parser) parseDB() ([]byte, error) {
-	p.advanceToken()
+// encodeDEPHASE ends a PHASE block.
+func (p *Parser) encodeDEPHASE() ([]byte, error) {
+	if p.phase == nil {
+		return nil, fmt.Errorf("DEPHASE without PHASE")
+	}
+	block := p.phase
+	p.phase = nil
+	if block.name == "" {
+		return nil, nil
+	}
+	name := block.name + "_LEN"
+	if _, defined := p.symbols[name]; defined {
+		return nil, fmt.Errorf("label %s is already defined, so it can't be the length of the PHASE block on line %d", name, block.line)
+	}
+	length := symbols.Symbol{Name: name, Value: p.address() - block.start, Origin: fmt.Sprintf("PHASE on line %d", block.line)}
+	return nil, p.Import(length)
+}
 
-	data := []byte{}
+// encodeSymbolList declares the names given to PUBLIC or EXTRN.
+func (p *Parser) encodeSymbolList(directive string, ops *operands) ([]byte, error) {
+	for {
+		operand := ops.read()
+		symbol, ok := operand.(*ast.Name)
+		if !ok {
+			return nil, fmt.Errorf("expected symbol name, got: %s", literal(operand))
+		}
+		name := symbol.Name
 
-	for p.currentToken().Type == lexer.NUMBER || p.currentToken().Type == lexer.STRING {
-		if p.currentToken().Type == lexer.NUMBER {
-			value, err := strconv.ParseUint(p.currentToken().Literal, 16, 8)
-			if err != nil {
-				return nil, fmt.Errorf("invalid byte value: %s", p.currentToken().Literal)
+		switch directive {
+		case "PUBLIC":
+			if !slices.Contains(p.publics, name) {
+				p.publics = append(p.publics, name)
 			}
-			data = append(data, byte(value))
-		} else if p.currentToken().Type == lexer.STRING {
-			// Convert string into bytes
-			data = append(data, []byte(p.currentToken().Literal)...)
+		case "EXTRN":
+			if _, defined := p.symbols[name]; defined {
+				return nil, fmt.Errorf("label %s is declared EXTRN", name)
+			}
+			p.externals[name] = true
 		}
-		p.advanceToken()
 
-		// Handle optional commas???
-		if p.currentToken().Type == lexer.COMMA {
-			p.advanceToken()
+		if !ops.more() {
+			return nil, nil
 		}
 	}
-
-	return data, nil
-}
-
-func parseHex(token string) (uint8, uint8, error) {
-	token = strings.TrimSuffix(token, "H")
-	token = strings.TrimSuffix(token, "h")
-	token = strings.TrimPrefix(token, "0X")
-	token = strings.TrimPrefix(token, "0x")
-	hex, err := strconv.ParseUint(token, 16, 16)
-	if err != nil {
-		return 0, 0, err
-	}
-
-	highByte := uint8(hex >> 8)
-	lowByte := uint8(hex & 0x00FF)
-
-	return highByte, lowByte, nil
 }
@@ -1,10 +1,15 @@
 package parser
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 
+	"github.com/lukepeterson/go8080assembler/pkg/ast"
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
 	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+	"github.com/lukepeterson/go8080assembler/pkg/object"
+	"github.com/lukepeterson/go8080assembler/pkg/symbols"
 )
 
 func TestParser_Parse(t *testing.T) {
@@ -1354,6 +1359,120 @@ func TestParser_Parse(t *testing.T) {
 			},
 			wantBytecode: []byte{0x48, 0x65, 0x6C, 0x6C, 0x6F},
 		},
+		{
+			name: "DB 'Hi', 0X0D, 0X0A (string and numbers)",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "DB"},
+				{Type: lexer.STRING, Literal: "Hi"},
+				{Type: lexer.COMMA, Literal: ","},
+				{Type: lexer.NUMBER, Literal: "0X0D"},
+				{Type: lexer.COMMA, Literal: ","},
+				{Type: lexer.NUMBER, Literal: "0AH"},
+				{Type: lexer.EOF},
+			},
+			wantBytecode: []byte{0x48, 0x69, 0x0D, 0x0A},
+		},
+		{
+			name: "DB followed by an instruction",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "DB"},
+				{Type: lexer.NUMBER, Literal: "0x01"},
+				{Type: lexer.MNEMONIC, Literal: "HLT"},
+				{Type: lexer.EOF},
+			},
+			wantBytecode: []byte{0x01, 0x76},
+		},
+		{
+			name: "DB followed by a label",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "DB"},
+				{Type: lexer.STRING, Literal: "A"},
+				{Type: lexer.LABEL, Literal: "NEXT"},
+				{Type: lexer.COLON, Literal: ":"},
+				{Type: lexer.MNEMONIC, Literal: "JMP"},
+				{Type: lexer.LABEL, Literal: "NEXT"},
+				{Type: lexer.EOF},
+			},
+			wantBytecode: []byte{0x41, 0xC3, 0x01, 0x00},
+		},
+		{
+			name: "DB 0x4455 (two bytes of data)",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "DB"},
+				{Type: lexer.NUMBER, Literal: "0x4455"},
+				{Type: lexer.EOF},
+			},
+			wantErr: true,
+		},
+		{
+			name: "DB with no data",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "DB"},
+				{Type: lexer.EOF},
+			},
+			wantErr: true,
+		},
+		{
+			name: "DSEG placed after CSEG",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "DSEG"},
+				{Type: lexer.LABEL, Literal: "COUNT"},
+				{Type: lexer.COLON, Literal: ":"},
+				{Type: lexer.MNEMONIC, Literal: "DB"},
+				{Type: lexer.NUMBER, Literal: "0x05"},
+				{Type: lexer.MNEMONIC, Literal: "CSEG"},
+				{Type: lexer.MNEMONIC, Literal: "LDA"},
+				{Type: lexer.LABEL, Literal: "COUNT"},
+				{Type: lexer.MNEMONIC, Literal: "HLT"},
+				{Type: lexer.EOF},
+			},
+			wantBytecode: []byte{0x3A, 0x04, 0x00, 0x76, 0x05},
+		},
+		{
+			name: "PUBLIC symbol",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "PUBLIC"},
+				{Type: lexer.LABEL, Literal: "START"},
+				{Type: lexer.LABEL, Literal: "START"},
+				{Type: lexer.COLON, Literal: ":"},
+				{Type: lexer.MNEMONIC, Literal: "JMP"},
+				{Type: lexer.LABEL, Literal: "START"},
+				{Type: lexer.EOF},
+			},
+			wantBytecode: []byte{0xC3, 0x00, 0x00},
+		},
+		{
+			name: "PUBLIC symbol not defined",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "PUBLIC"},
+				{Type: lexer.LABEL, Literal: "START"},
+				{Type: lexer.EOF},
+			},
+			wantErr: true,
+		},
+		{
+			name: "EXTRN symbol needs linking",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "EXTRN"},
+				{Type: lexer.LABEL, Literal: "PRINT"},
+				{Type: lexer.MNEMONIC, Literal: "CALL"},
+				{Type: lexer.LABEL, Literal: "PRINT"},
+				{Type: lexer.EOF},
+			},
+			wantErr: true,
+		},
+		{
+			name: "EXTRN symbol defined locally",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "EXTRN"},
+				{Type: lexer.LABEL, Literal: "PRINT"},
+				{Type: lexer.LABEL, Literal: "PRINT"},
+				{Type: lexer.COLON, Literal: ":"},
+				{Type: lexer.MNEMONIC, Literal: "RET"},
+				{Type: lexer.EOF},
+			},
+			wantErr: true,
+		},
 		{
 			name: "STA 0x4455",
 			tokens: []lexer.Token{
@@ -3002,3 +3121,836 @@ func TestParser_Parse(t *testing.T) {
 		})
 	}
 }
+
+func TestParser_ParseObject(t *testing.T) {
+	tests := []struct {
+		name       string
+		tokens     []lexer.Token
+		wantModule *object.Module
+		wantErr    bool
+	}{
+		{
+			name: "relocations and fixups",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "PUBLIC"},
+				{Type: lexer.LABEL, Literal: "MAIN"},
+				{Type: lexer.COMMA, Literal: ","},
+				{Type: lexer.LABEL, Literal: "COUNT"},
+				{Type: lexer.MNEMONIC, Literal: "EXTRN"},
+				{Type: lexer.LABEL, Literal: "PRINT"},
+				{Type: lexer.MNEMONIC, Literal: "NOP"},
+				{Type: lexer.LABEL, Literal: "MAIN"},
+				{Type: lexer.COLON, Literal: ":"},
+				{Type: lexer.MNEMONIC, Literal: "LDA"},
+				{Type: lexer.LABEL, Literal: "COUNT"},
+				{Type: lexer.MNEMONIC, Literal: "CALL"},
+				{Type: lexer.LABEL, Literal: "PRINT"},
+				{Type: lexer.MNEMONIC, Literal: "JMP"},
+				{Type: lexer.LABEL, Literal: "MAIN"},
+				{Type: lexer.MNEMONIC, Literal: "DSEG"},
+				{Type: lexer.MNEMONIC, Literal: "DB"},
+				{Type: lexer.NUMBER, Literal: "0x00"},
+				{Type: lexer.LABEL, Literal: "COUNT"},
+				{Type: lexer.COLON, Literal: ":"},
+				{Type: lexer.MNEMONIC, Literal: "DB"},
+				{Type: lexer.NUMBER, Literal: "0x05"},
+				{Type: lexer.EOF},
+			},
+			wantModule: &object.Module{
+				Code: []byte{0x00, 0x3A, 0x01, 0x00, 0xCD, 0x00, 0x00, 0xC3, 0x01, 0x00},
+				Data: []byte{0x00, 0x05},
+				Symbols: []object.Symbol{
+					{Name: "MAIN", Segment: object.Code, Offset: 0x0001},
+					{Name: "COUNT", Segment: object.Data, Offset: 0x0001},
+				},
+				Relocations: []object.Relocation{
+					{Segment: object.Code, Offset: 0x0002, Target: object.Data},
+					{Segment: object.Code, Offset: 0x0008, Target: object.Code},
+				},
+				Fixups: []object.Fixup{
+					{Segment: object.Code, Offset: 0x0005, Name: "PRINT"},
+				},
+			},
+		},
+		{
+			name: "undefined label",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "JMP"},
+				{Type: lexer.LABEL, Literal: "NOWHERE"},
+				{Type: lexer.EOF},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.tokens)
+			got, err := p.ParseObject()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parser.ParseObject() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.wantModule) {
+				t.Errorf("Parser.ParseObject() = %+v, want %+v", got, tt.wantModule)
+			}
+		})
+	}
+}
+
+func TestParser_ParseOrigin(t *testing.T) {
+	tests := []struct {
+		name         string
+		tokens       []lexer.Token
+		origin       uint16
+		symbols      map[string]uint16
+		wantBytecode []byte
+		wantOrigin   uint16
+		wantErr      bool
+	}{
+		{
+			name: "default origin",
+			tokens: []lexer.Token{
+				{Type: lexer.LABEL, Literal: "START"},
+				{Type: lexer.COLON, Literal: ":"},
+				{Type: lexer.MNEMONIC, Literal: "JMP"},
+				{Type: lexer.LABEL, Literal: "START"},
+				{Type: lexer.EOF},
+			},
+			origin:       0x0100,
+			wantBytecode: []byte{0xC3, 0x00, 0x01},
+			wantOrigin:   0x0100,
+		},
+		{
+			name: "ORG before any code sets the origin",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "ORG"},
+				{Type: lexer.NUMBER, Literal: "0x8000"},
+				{Type: lexer.LABEL, Literal: "START"},
+				{Type: lexer.COLON, Literal: ":"},
+				{Type: lexer.MNEMONIC, Literal: "JMP"},
+				{Type: lexer.LABEL, Literal: "START"},
+				{Type: lexer.EOF},
+			},
+			origin:       0x0100,
+			wantBytecode: []byte{0xC3, 0x00, 0x80},
+			wantOrigin:   0x8000,
+		},
+		{
+			name: "later ORG pads with zeros",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "NOP"},
+				{Type: lexer.MNEMONIC, Literal: "ORG"},
+				{Type: lexer.NUMBER, Literal: "0x0104"},
+				{Type: lexer.LABEL, Literal: "HERE"},
+				{Type: lexer.COLON, Literal: ":"},
+				{Type: lexer.MNEMONIC, Literal: "JMP"},
+				{Type: lexer.LABEL, Literal: "HERE"},
+				{Type: lexer.EOF},
+			},
+			origin:       0x0100,
+			wantBytecode: []byte{0x00, 0x00, 0x00, 0x00, 0xC3, 0x04, 0x01},
+			wantOrigin:   0x0100,
+		},
+		{
+			name: "ORG before the current address",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "NOP"},
+				{Type: lexer.MNEMONIC, Literal: "NOP"},
+				{Type: lexer.MNEMONIC, Literal: "ORG"},
+				{Type: lexer.NUMBER, Literal: "0x0001"},
+				{Type: lexer.EOF},
+			},
+			wantErr: true,
+		},
+		{
+			name: "predefined symbol",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "CALL"},
+				{Type: lexer.LABEL, Literal: "BDOS"},
+				{Type: lexer.EOF},
+			},
+			symbols:      map[string]uint16{"bdos": 0x0005},
+			wantBytecode: []byte{0xCD, 0x05, 0x00},
+		},
+		{
+			name: "label replaces predefined symbol",
+			tokens: []lexer.Token{
+				{Type: lexer.LABEL, Literal: "BDOS"},
+				{Type: lexer.COLON, Literal: ":"},
+				{Type: lexer.MNEMONIC, Literal: "CALL"},
+				{Type: lexer.LABEL, Literal: "BDOS"},
+				{Type: lexer.EOF},
+			},
+			symbols:      map[string]uint16{"BDOS": 0x0005},
+			wantBytecode: []byte{0xCD, 0x00, 0x00},
+		},
+		{
+			name: "program past the end of memory",
+			tokens: []lexer.Token{
+				{Type: lexer.MNEMONIC, Literal: "ORG"},
+				{Type: lexer.NUMBER, Literal: "0xFFFF"},
+				{Type: lexer.MNEMONIC, Literal: "JMP"},
+				{Type: lexer.NUMBER, Literal: "0x0000"},
+				{Type: lexer.EOF},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.tokens)
+			p.SetOrigin(tt.origin)
+			for name, value := range tt.symbols {
+				p.Define(name, value)
+			}
+			got, err := p.Parse()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parser.Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.wantBytecode) {
+				t.Errorf("Parser.Parse() = %X, want %X", got, tt.wantBytecode)
+			}
+			if p.Origin() != tt.wantOrigin {
+				t.Errorf("Parser.Origin() = 0x%04X, want 0x%04X", p.Origin(), tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestParser_ParseMemory(t *testing.T) {
+	memory := func(name, start, size, access string, fill ...string) []lexer.Token {
+		tokens := []lexer.Token{
+			{Type: lexer.MNEMONIC, Literal: "MEMORY"},
+			{Type: lexer.LABEL, Literal: name},
+			{Type: lexer.COMMA, Literal: ","},
+			{Type: lexer.NUMBER, Literal: start},
+			{Type: lexer.COMMA, Literal: ","},
+			{Type: lexer.NUMBER, Literal: size},
+			{Type: lexer.COMMA, Literal: ","},
+			{Type: lexer.LABEL, Literal: access},
+		}
+		for _, f := range fill {
+			tokens = append(tokens, lexer.Token{Type: lexer.COMMA, Literal: ","}, lexer.Token{Type: lexer.NUMBER, Literal: f})
+		}
+		return tokens
+	}
+	program := func(parts ...[]lexer.Token) []lexer.Token {
+		tokens := []lexer.Token{}
+		for _, part := range parts {
+			tokens = append(tokens, part...)
+		}
+		return append(tokens, lexer.Token{Type: lexer.EOF})
+	}
+	nop := []lexer.Token{{Type: lexer.MNEMONIC, Literal: "NOP"}}
+
+	tests := []struct {
+		name         string
+		tokens       []lexer.Token
+		wantBytecode []byte
+		wantOrigin   uint16
+		wantWarnings []string
+		wantErr      bool
+	}{
+		{
+			name: "code in ROM, data in RAM",
+			tokens: program(
+				memory("ROM", "0x0010", "0x0004", "RX", "0xFF"),
+				memory("RAM", "0x0018", "0x0004", "RW"),
+				nop,
+				[]lexer.Token{
+					{Type: lexer.MNEMONIC, Literal: "DSEG"},
+					{Type: lexer.MNEMONIC, Literal: "DB"},
+					{Type: lexer.NUMBER, Literal: "0x05"},
+				},
+			),
+			wantBytecode: []byte{0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00, 0x05},
+			wantOrigin:   0x0010,
+		},
+		{
+			name: "ORG gap is filled",
+			tokens: program(
+				memory("ROM", "0x0000", "0x0010", "RX", "0xFF"),
+				nop,
+				[]lexer.Token{
+					{Type: lexer.MNEMONIC, Literal: "ORG"},
+					{Type: lexer.NUMBER, Literal: "0x0003"},
+				},
+				nop,
+			),
+			wantBytecode: []byte{0x00, 0xFF, 0xFF, 0x00},
+		},
+		{
+			name:         "code in RAM",
+			tokens:       program(memory("RAM", "0x4000", "0x0100", "RWX"), nop),
+			wantBytecode: []byte{0x00},
+			wantOrigin:   0x4000,
+			wantWarnings: []string{"line 0 (0x4000-0x4000) is code in RAM region RAM (0x4000-0x40FF rwx)"},
+		},
+		{
+			name: "data follows code that ends in RAM",
+			tokens: program(
+				memory("RAM", "0x4000", "0x0100", "RWX"),
+				memory("STACK", "0x5000", "0x0100", "RW"),
+				nop,
+				[]lexer.Token{
+					{Type: lexer.MNEMONIC, Literal: "DSEG"},
+					{Type: lexer.MNEMONIC, Literal: "DB"},
+					{Type: lexer.NUMBER, Literal: "0x05"},
+				},
+			),
+			wantBytecode: []byte{0x00, 0x05},
+			wantOrigin:   0x4000,
+			wantWarnings: []string{"line 0 (0x4000-0x4000) is code in RAM region RAM (0x4000-0x40FF rwx)"},
+		},
+		{
+			name: "data segment in ROM",
+			tokens: program(
+				memory("ROM", "0x0000", "0x0010", "RX"),
+				nop,
+				[]lexer.Token{
+					{Type: lexer.MNEMONIC, Literal: "DSEG"},
+					{Type: lexer.MNEMONIC, Literal: "DB"},
+					{Type: lexer.NUMBER, Literal: "0x05"},
+				},
+			),
+			wantErr: true,
+		},
+		{
+			name:    "code overruns region",
+			tokens:  program(memory("ROM", "0x0000", "0x0001", "RX"), nop, nop),
+			wantErr: true,
+		},
+		{
+			name:    "code outside any region",
+			tokens:  program(memory("RAM", "0x4000", "0x0100", "RW"), nop),
+			wantErr: true,
+		},
+		{
+			name:    "overlapping regions",
+			tokens:  program(memory("ROM", "0x0000", "0x0100", "RX"), memory("RAM", "0x00FF", "0x0100", "RW")),
+			wantErr: true,
+		},
+		{
+			name:    "invalid access",
+			tokens:  program(memory("ROM", "0x0000", "0x0100", "RZ")),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.tokens)
+			got, err := p.Parse()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parser.Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.wantBytecode) {
+				t.Errorf("Parser.Parse() = %X, want %X", got, tt.wantBytecode)
+			}
+			if p.Origin() != tt.wantOrigin {
+				t.Errorf("Parser.Origin() = 0x%04X, want 0x%04X", p.Origin(), tt.wantOrigin)
+			}
+			if !reflect.DeepEqual(p.Warnings(), tt.wantWarnings) {
+				t.Errorf("Parser.Warnings() = %q, want %q", p.Warnings(), tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestParser_ParseImport(t *testing.T) {
+	files := map[string][]symbols.Symbol{
+		"bios.sym": {
+			{Name: "CONIN", Value: 0xF203, Origin: "bios.sym:1"},
+			{Name: "CONOUT", Value: 0xF206, Origin: "bios.sym:1"},
+		},
+		"other.sym": {{Name: "CONIN", Value: 0x0010, Origin: "other.sym:4"}},
+	}
+	importer := func(filename string) ([]symbols.Symbol, error) {
+		return files[filename], nil
+	}
+	importFile := func(filename string) []lexer.Token {
+		return []lexer.Token{{Type: lexer.MNEMONIC, Literal: "IMPORT"}, {Type: lexer.STRING, Literal: filename}}
+	}
+	call := func(label string) []lexer.Token {
+		return []lexer.Token{{Type: lexer.MNEMONIC, Literal: "CALL"}, {Type: lexer.LABEL, Literal: label}}
+	}
+	program := func(parts ...[]lexer.Token) []lexer.Token {
+		tokens := []lexer.Token{}
+		for _, part := range parts {
+			tokens = append(tokens, part...)
+		}
+		return append(tokens, lexer.Token{Type: lexer.EOF})
+	}
+
+	tests := []struct {
+		name         string
+		imports      []symbols.Symbol
+		tokens       []lexer.Token
+		wantBytecode []byte
+		wantErr      string
+	}{
+		{
+			name:         "IMPORT directive",
+			tokens:       program(importFile("bios.sym"), call("CONIN"), call("CONOUT")),
+			wantBytecode: []byte{0xCD, 0x03, 0xF2, 0xCD, 0x06, 0xF2},
+		},
+		{
+			name:         "imported before assembly",
+			imports:      files["bios.sym"],
+			tokens:       program(call("CONOUT")),
+			wantBytecode: []byte{0xCD, 0x06, 0xF2},
+		},
+		{
+			name:         "same value imported twice",
+			imports:      files["bios.sym"],
+			tokens:       program(importFile("bios.sym"), call("CONIN")),
+			wantBytecode: []byte{0xCD, 0x03, 0xF2},
+		},
+		{
+			name:    "different values",
+			tokens:  program(importFile("bios.sym"), importFile("other.sym")),
+			wantErr: "symbol CONIN is 0xF203 in bios.sym:1 but 0x0010 in other.sym:4",
+		},
+		{
+			name:    "label redefines an imported symbol",
+			tokens:  program(importFile("bios.sym"), []lexer.Token{{Type: lexer.LABEL, Literal: "CONIN"}, {Type: lexer.COLON, Literal: ":"}}),
+			wantErr: "label CONIN is already defined as 0xF203 by bios.sym:1",
+		},
+		{
+			name:    "import after a label with the same name",
+			tokens:  program([]lexer.Token{{Type: lexer.LABEL, Literal: "CONIN"}, {Type: lexer.COLON, Literal: ":"}}, importFile("bios.sym")),
+			wantErr: "label CONIN is already defined, so it can't be imported from bios.sym:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.tokens)
+			p.SetImporter(importer)
+			for _, s := range tt.imports {
+				if err := p.Import(s); err != nil {
+					t.Fatalf("Parser.Import() error = %v", err)
+				}
+			}
+			got, err := p.Parse()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Parser.Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parser.Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.wantBytecode) {
+				t.Errorf("Parser.Parse() = %X, want %X", got, tt.wantBytecode)
+			}
+		})
+	}
+}
+
+func TestParser_ParsePhase(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       string
+		wantBytecode []byte
+		wantLabels   map[string]uint16
+		wantErr      string
+	}{
+		{
+			name: "labels run at the PHASE address",
+			source: `LXI H, COPY
+LXI B, COPY_LEN
+COPY: PHASE 8000
+RUN: JMP RUN
+DEPHASE
+DONE: HLT`,
+			wantBytecode: []byte{0x21, 0x06, 0x00, 0x01, 0x03, 0x00, 0xC3, 0x00, 0x80, 0x76},
+			wantLabels:   map[string]uint16{"COPY": 0x0006, "RUN": 0x8000, "DONE": 0x0009},
+		},
+		{
+			name: "block without a label",
+			source: `NOP
+PHASE 0x4000
+LOOP: JMP LOOP
+DEPHASE`,
+			wantBytecode: []byte{0x00, 0xC3, 0x00, 0x40},
+			wantLabels:   map[string]uint16{"LOOP": 0x4000},
+		},
+		{
+			name:    "nested PHASE",
+			source:  "PHASE 8000\nPHASE 9000",
+			wantErr: "PHASE blocks can't be nested, the block on line 1 is still open",
+		},
+		{
+			name:    "DEPHASE without PHASE",
+			source:  "DEPHASE",
+			wantErr: "DEPHASE without PHASE",
+		},
+		{
+			name:    "missing DEPHASE",
+			source:  "NOP\nPHASE 8000\nNOP",
+			wantErr: "PHASE on line 2 has no DEPHASE",
+		},
+		{
+			name:    "segment change inside PHASE",
+			source:  "PHASE 8000\nDSEG",
+			wantErr: "DSEG inside the PHASE block on line 1",
+		},
+		{
+			name:    "length redefined by a label",
+			source:  "COPY: PHASE 8000\nDEPHASE\nCOPY_LEN: NOP",
+			wantErr: "label COPY_LEN is already defined as 0x0000 by PHASE on line 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lexer.New(tt.source).Lex()
+			if err != nil {
+				t.Fatalf("Lexer.Lex() error = %v", err)
+			}
+			p := New(tokens)
+			got, err := p.Parse()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Parser.Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parser.Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.wantBytecode) {
+				t.Errorf("Parser.Parse() = %X, want %X", got, tt.wantBytecode)
+			}
+			if !reflect.DeepEqual(p.Labels(), tt.wantLabels) {
+				t.Errorf("Parser.Labels() = %v, want %v", p.Labels(), tt.wantLabels)
+			}
+		})
+	}
+}
+
+func TestParser_ParseObjectPhase(t *testing.T) {
+	tokens, err := lexer.New("LXI H, COPY\nCOPY: PHASE 8000\nRUN: JMP RUN\nDEPHASE").Lex()
+	if err != nil {
+		t.Fatalf("Lexer.Lex() error = %v", err)
+	}
+	module, err := New(tokens).ParseObject()
+	if err != nil {
+		t.Fatalf("Parser.ParseObject() error = %v", err)
+	}
+	if want := []byte{0x21, 0x03, 0x00, 0xC3, 0x00, 0x80}; !reflect.DeepEqual(module.Code, want) {
+		t.Errorf("Module.Code = %X, want %X", module.Code, want)
+	}
+	// Only the reference to the load address is relocated
+	want := []object.Relocation{{Segment: object.Code, Offset: 1, Target: object.Code}}
+	if !reflect.DeepEqual(module.Relocations, want) {
+		t.Errorf("Module.Relocations = %v, want %v", module.Relocations, want)
+	}
+}
+
+func TestParser_ParseCPU(t *testing.T) {
+	tests := []struct {
+		name         string
+		cpu          isa.CPU
+		source       string
+		wantBytecode []byte
+		wantErr      string
+	}{
+		{
+			name:         "8085 instructions",
+			cpu:          isa.I8085,
+			source:       "RIM\nSIM",
+			wantBytecode: []byte{0x20, 0x30},
+		},
+		{
+			name:         "selected by directive",
+			source:       ".8085\nRIM\nSIM",
+			wantBytecode: []byte{0x20, 0x30},
+		},
+		{
+			name:         "undocumented 8085 instructions",
+			source:       ".8085U\nDSUB\nARHL\nRDEL\nLDHI 10\nLDSI 20\nRSTV\nSHLX\nLHLX\nJNK 1234\nJK 1234",
+			wantBytecode: []byte{0x08, 0x10, 0x18, 0x28, 0x10, 0x38, 0x20, 0xCB, 0xD9, 0xED, 0xDD, 0x34, 0x12, 0xFD, 0x34, 0x12},
+		},
+		{
+			name:    "8085 instruction in 8080 mode",
+			source:  "RIM",
+			wantErr: "RIM requires the 8085, select it with .8085",
+		},
+		{
+			name:    "undocumented instruction in 8085 mode",
+			cpu:     isa.I8085,
+			source:  "ARHL",
+			wantErr: "ARHL requires the 8085 with undocumented instructions, select it with .8085U",
+		},
+		{
+			name:         "undocumented 8080 opcodes",
+			source:       "NOP_08\nNOP_10\nNOP_18\nNOP_20\nNOP_28\nNOP_30\nNOP_38\nJMP_CB 1234\nRET_D9\nCALL_DD 1234\nCALL_ED 1234\nCALL_FD 1234",
+			wantBytecode: []byte{0x08, 0x10, 0x18, 0x20, 0x28, 0x30, 0x38, 0xCB, 0x34, 0x12, 0xD9, 0xDD, 0x34, 0x12, 0xED, 0x34, 0x12, 0xFD, 0x34, 0x12},
+		},
+		{
+			name:    "undocumented 8080 opcode in 8085 mode",
+			source:  ".8085\nNOP_20",
+			wantErr: "NOP_20 requires the 8080, select it with .8080",
+		},
+		{
+			name:    "back to the 8080",
+			cpu:     isa.I8085Undocumented,
+			source:  "SIM\n.8080\nSIM",
+			wantErr: "SIM requires the 8085, select it with .8085",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lexer.New(tt.source).Lex()
+			if err != nil {
+				t.Fatalf("Lexer.Lex() error = %v", err)
+			}
+			p := New(tokens)
+			p.SetCPU(tt.cpu)
+			got, err := p.Parse()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Parser.Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parser.Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.wantBytecode) {
+				t.Errorf("Parser.Parse() = %X, want %X", got, tt.wantBytecode)
+			}
+		})
+	}
+}
+
+func TestParser_ParseOpcode(t *testing.T) {
+	tests := []struct {
+		name         string
+		opcodes      []isa.Opcode
+		source       string
+		wantBytecode []byte
+		wantErr      string
+	}{
+		{
+			name:         "defined by directive",
+			source:       "OPCODE SWAP, 08\nOPCODE OUTX, 10, BYTE\nOPCODE JX, 0CBH, WORD\nSWAP\nOUTX 5\nJX 1234\nSTART: JX START",
+			wantBytecode: []byte{0x08, 0x10, 0x05, 0xCB, 0x34, 0x12, 0xCB, 0x06, 0x00},
+		},
+		{
+			name:         "defined from Go",
+			opcodes:      []isa.Opcode{{Mnemonic: "swap", Code: 0x08}, {Mnemonic: "LDX", Code: 0x38, Operand: isa.Word}},
+			source:       "SWAP\nLDX 2000",
+			wantBytecode: []byte{0x08, 0x38, 0x00, 0x20},
+		},
+		{
+			name:         "defined twice the same way",
+			source:       "OPCODE SWAP, 08\nOPCODE SWAP, 08, NONE\nSWAP",
+			wantBytecode: []byte{0x08},
+		},
+		{
+			name:    "defined twice differently",
+			source:  "OPCODE SWAP, 08\nOPCODE SWAP, 10",
+			wantErr: "SWAP is already defined as opcode 0x08 with NONE operand",
+		},
+		{
+			name:    "existing instruction",
+			source:  "OPCODE NOP, 08",
+			wantErr: "NOP is already an instruction",
+		},
+		{
+			name:    "register",
+			source:  "OPCODE M, 08",
+			wantErr: "M is a register, so it can't be an instruction",
+		},
+		{
+			name:    "invalid mnemonic",
+			opcodes: []isa.Opcode{{Mnemonic: "1X", Code: 0x08}},
+			wantErr: `invalid mnemonic for opcode 0x08: "1X"`,
+		},
+		{
+			name:    "opcode out of range",
+			source:  "OPCODE SWAP, 108",
+			wantErr: "expected single byte opcode, got: 108",
+		},
+		{
+			name:    "unknown operand",
+			source:  "OPCODE SWAP, 08, REGISTER",
+			wantErr: "unknown operand REGISTER, expected one of NONE, BYTE, WORD",
+		},
+		{
+			name:    "byte operand out of range",
+			source:  "OPCODE OUTX, 10, BYTE\nOUTX 100",
+			wantErr: "expected single byte of data, got: 100",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := lexer.New(tt.source)
+			for _, o := range tt.opcodes {
+				l.AddMnemonic(o.Mnemonic)
+			}
+			tokens, err := l.Lex()
+			if err != nil {
+				t.Fatalf("Lexer.Lex() error = %v", err)
+			}
+			p := New(tokens)
+			for _, o := range tt.opcodes {
+				if err = p.DefineOpcode(o); err != nil {
+					break
+				}
+			}
+			var got []byte
+			if err == nil {
+				got, err = p.Parse()
+			}
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Parser.Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parser.Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.wantBytecode) {
+				t.Errorf("Parser.Parse() = %X, want %X", got, tt.wantBytecode)
+			}
+		})
+	}
+}
+
+func TestParser_ErrorPosition(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		object     bool
+		wantLine   int
+		wantColumn int
+	}{
+		{name: "instruction", source: "NOP\n  MVI Q, 1", wantLine: 2, wantColumn: 3},
+		{name: "label", source: "START: NOP\nSTART: NOP", wantLine: 2, wantColumn: 1},
+		{name: "unknown instruction", source: "  FOO", wantLine: 1, wantColumn: 3},
+		{name: "undefined label", source: "START: JMP START\n  CALL MISSING", wantLine: 2, wantColumn: 8},
+		{name: "undefined label in object", source: "JMP MISSING", object: true, wantLine: 1, wantColumn: 5},
+		{name: "external symbol", source: "EXTRN PRINT\nCALL PRINT", wantLine: 2, wantColumn: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lexer.New(tt.source).Lex()
+			if err != nil {
+				t.Fatalf("Lexer.Lex() error = %v", err)
+			}
+			p := New(tokens)
+			if tt.object {
+				_, err = p.ParseObject()
+			} else {
+				_, err = p.Parse()
+			}
+			var parseErr *Error
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse() error = %v, want an *Error", err)
+			}
+			if parseErr.Line != tt.wantLine || parseErr.Column != tt.wantColumn {
+				t.Errorf("Parse() error at %d:%d, want %d:%d", parseErr.Line, parseErr.Column, tt.wantLine, tt.wantColumn)
+			}
+		})
+	}
+}
+
+func TestFromProgram(t *testing.T) {
+	at := func(line, column int) ast.Pos { return ast.Pos{Line: line, Column: column} }
+	tests := []struct {
+		name         string
+		prog         *ast.Program
+		wantBytecode []byte
+		wantErr      string
+		wantPos      ast.Pos
+	}{
+		{
+			name: "instructions and data",
+			prog: &ast.Program{Statements: []ast.Statement{
+				&ast.Label{Position: at(1, 1), Name: "START"},
+				&ast.Instruction{Position: at(1, 8), Mnemonic: "MVI", Operands: []ast.Operand{&ast.Register{Name: "A"}, &ast.Number{Literal: "33H"}}},
+				&ast.Comment{Position: at(1, 18), Text: "; Load"},
+				&ast.Instruction{Position: at(2, 8), Mnemonic: "MOV", Operands: []ast.Operand{&ast.Register{Name: "B"}, &ast.Register{Name: "A"}}},
+				&ast.Instruction{Position: at(3, 8), Mnemonic: "PUSH", Operands: []ast.Operand{&ast.Register{Name: "PSW"}}},
+				&ast.Instruction{Position: at(4, 8), Mnemonic: "LXI", Operands: []ast.Operand{&ast.Register{Name: "H"}, &ast.Name{Name: "MSG"}}},
+				&ast.Instruction{Position: at(5, 8), Mnemonic: "JMP", Operands: []ast.Operand{&ast.Name{Name: "START"}}},
+				&ast.Label{Position: at(6, 1), Name: "MSG"},
+				&ast.Directive{Position: at(6, 8), Name: "DB", Operands: []ast.Operand{&ast.String{Value: "OK"}, &ast.Number{Literal: "0"}}},
+			}},
+			wantBytecode: []byte{0x3E, 0x33, 0x47, 0xF5, 0x21, 0x0A, 0x00, 0xC3, 0x00, 0x00, 0x4F, 0x4B, 0x00},
+		},
+		{
+			name: "directive selecting the CPU",
+			prog: &ast.Program{Statements: []ast.Statement{
+				&ast.Directive{Position: at(1, 1), Name: ".8085"},
+				&ast.Instruction{Position: at(2, 1), Mnemonic: "RIM"},
+			}},
+			wantBytecode: []byte{0x20},
+		},
+		{
+			name: "missing operand",
+			prog: &ast.Program{Statements: []ast.Statement{
+				&ast.Instruction{Position: at(1, 1), Mnemonic: "NOP"},
+				&ast.Instruction{Position: at(2, 3), Mnemonic: "MVI", Operands: []ast.Operand{&ast.Register{Name: "A"}}},
+			}},
+			wantErr: "expected number, got: end of line",
+			wantPos: at(2, 3),
+		},
+		{
+			name: "extra operand",
+			prog: &ast.Program{Statements: []ast.Statement{
+				&ast.Instruction{Position: at(1, 1), Mnemonic: "INR", Operands: []ast.Operand{&ast.Register{Name: "A"}, &ast.Register{Name: "B"}}},
+			}},
+			wantErr: "unexpected operand: B",
+			wantPos: at(1, 1),
+		},
+		{
+			name: "operand of the wrong kind",
+			prog: &ast.Program{Statements: []ast.Statement{
+				&ast.Instruction{Position: at(1, 1), Mnemonic: "JMP", Operands: []ast.Operand{&ast.String{Value: "A"}}},
+			}},
+			wantErr: "expected address or label, got: STRING",
+			wantPos: at(1, 1),
+		},
+		{
+			name: "undefined label",
+			prog: &ast.Program{Statements: []ast.Statement{
+				&ast.Instruction{Position: at(1, 1), Mnemonic: "JMP", Operands: []ast.Operand{&ast.Name{Position: at(1, 5), Name: "NOWHERE"}}},
+			}},
+			wantErr: "label definition not found: NOWHERE",
+			wantPos: at(1, 5),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromProgram(tt.prog).Parse()
+			if tt.wantErr != "" {
+				var parseErr *Error
+				if !errors.As(err, &parseErr) || err.Error() != tt.wantErr {
+					t.Fatalf("Parser.Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				if pos := (ast.Pos{Line: parseErr.Line, Column: parseErr.Column}); pos != tt.wantPos {
+					t.Errorf("Parser.Parse() error at %s, want %s", pos, tt.wantPos)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parser.Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.wantBytecode) {
+				t.Errorf("Parser.Parse() = %X, want %X", got, tt.wantBytecode)
+			}
+		})
+	}
+}
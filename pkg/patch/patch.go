@@ -0,0 +1,96 @@
+// Package patch assembles changes into an existing ROM image, overlaying
+// only the bytes the source emits and reporting which bytes of the image
+// they changed.
+package patch
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+	"github.com/lukepeterson/go8080assembler/pkg/rom"
+)
+
+// Range is a range of addresses, from Start to End inclusive.
+type Range struct {
+	Start uint16
+	End   uint16
+}
+
+// Contains reports whether address is inside the range.
+func (r Range) Contains(address int) bool {
+	return address >= int(r.Start) && address <= int(r.End)
+}
+
+// Change is a run of bytes that the patch changed, starting at Address.
+type Change struct {
+	Address uint16
+	Old     []byte
+	New     []byte
+	Line    int // Source line of the first changed byte
+}
+
+// Apply assembles source, which uses ORG to place its code at addresses in
+// base, and overlays the bytes it emits onto base. The gaps that ORG skips
+// over are left alone. Unless the source sets its own origin, it starts at
+// base's origin.
+//
+// If patchable isn't empty, bytes outside those ranges can't be changed,
+// although the patch can emit the same value they already have. Every
+// such byte, and every byte outside base, is reported as an error, and base
+// is only changed if there are none.
+func Apply(base *rom.Image, source string, patchable []Range, options ...assembler.Option) ([]Change, error) {
+	asm := assembler.New(source, append([]assembler.Option{assembler.WithOrigin(base.Origin)}, options...)...)
+	bytecode, err := asm.Assemble()
+	if err != nil {
+		return nil, err
+	}
+
+	patched := append([]byte{}, base.Bytecode...)
+	changes := []Change{}
+	errs := []error{}
+	for _, statement := range asm.Statements() {
+		if statement.Size == 0 || statement.Mnemonic == "ORG" {
+			continue
+		}
+		if int(statement.Address) < int(base.Origin) || int(statement.Address)+statement.Size > int(base.Origin)+len(base.Bytecode) {
+			errs = append(errs, fmt.Errorf("line %d: 0x%04X is outside the base image", statement.Line, statement.Address))
+			continue
+		}
+
+		for i := range statement.Size {
+			address := int(statement.Address) + i
+			before, after := patched[address-int(base.Origin)], bytecode[address-int(asm.Origin())]
+			if before == after {
+				continue
+			}
+			if len(patchable) > 0 && !inRanges(patchable, address) {
+				errs = append(errs, fmt.Errorf("line %d: 0x%04X isn't in a patchable region", statement.Line, address))
+				continue
+			}
+			patched[address-int(base.Origin)] = after
+
+			if n := len(changes); n > 0 && int(changes[n-1].Address)+len(changes[n-1].New) == address {
+				changes[n-1].Old = append(changes[n-1].Old, before)
+				changes[n-1].New = append(changes[n-1].New, after)
+				continue
+			}
+			changes = append(changes, Change{Address: uint16(address), Old: []byte{before}, New: []byte{after}, Line: statement.Line})
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	base.Bytecode = patched
+	return changes, nil
+}
+
+func inRanges(ranges []Range, address int) bool {
+	for _, r := range ranges {
+		if r.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
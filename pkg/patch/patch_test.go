@@ -0,0 +1,83 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/rom"
+)
+
+func TestApply(t *testing.T) {
+	// NOP, NOP, NOP, JMP 0x1000, HLT, HLT at 0x1000
+	base := []byte{0x00, 0x00, 0x00, 0xC3, 0x00, 0x10, 0x76, 0x76}
+
+	tests := []struct {
+		name        string
+		source      string
+		patchable   []Range
+		wantImage   []byte
+		wantChanges []Change
+		wantErr     bool
+	}{
+		{
+			name: "overlays emitted bytes only",
+			source: `ORG 0x1001
+MVI A, 0x00
+NOP
+ORG 0x1007
+RET`,
+			wantImage: []byte{0x00, 0x3E, 0x00, 0x00, 0x00, 0x10, 0x76, 0xC9},
+			wantChanges: []Change{
+				{Address: 0x1001, Old: []byte{0x00}, New: []byte{0x3E}, Line: 2},
+				{Address: 0x1003, Old: []byte{0xC3}, New: []byte{0x00}, Line: 3},
+				{Address: 0x1007, Old: []byte{0x76}, New: []byte{0xC9}, Line: 5},
+			},
+		},
+		{
+			name:        "patch starts at the base origin",
+			source:      "JMP 0x1006",
+			wantImage:   []byte{0xC3, 0x06, 0x10, 0xC3, 0x00, 0x10, 0x76, 0x76},
+			wantChanges: []Change{{Address: 0x1000, Old: []byte{0x00, 0x00, 0x00}, New: []byte{0xC3, 0x06, 0x10}, Line: 1}},
+		},
+		{
+			name:        "unchanged bytes outside patchable ranges",
+			source:      "ORG 0x1003\nJMP 0x1007",
+			patchable:   []Range{{Start: 0x1004, End: 0x1004}},
+			wantImage:   []byte{0x00, 0x00, 0x00, 0xC3, 0x07, 0x10, 0x76, 0x76},
+			wantChanges: []Change{{Address: 0x1004, Old: []byte{0x00}, New: []byte{0x07}, Line: 2}},
+		},
+		{
+			name:      "changed bytes outside patchable ranges",
+			source:    "ORG 0x1003\nJMP 0x0000",
+			patchable: []Range{{Start: 0x1004, End: 0x1004}},
+			wantErr:   true,
+		},
+		{
+			name:    "outside the base image",
+			source:  "ORG 0x1007\nJMP 0x1000",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := &rom.Image{Origin: 0x1000, Bytecode: append([]byte{}, base...)}
+			changes, err := Apply(image, tt.source, tt.patchable)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !reflect.DeepEqual(image.Bytecode, base) {
+					t.Errorf("Apply() changed the image to %X after an error", image.Bytecode)
+				}
+				return
+			}
+			if !reflect.DeepEqual(image.Bytecode, tt.wantImage) {
+				t.Errorf("Apply() image = %X, want %X", image.Bytecode, tt.wantImage)
+			}
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("Apply() changes = %+v, want %+v", changes, tt.wantChanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Package rom prepares an assembled image for programming into EPROMs: it
+// pads the image to the size of the ROM, embeds a checksum, and splits it
+// into one file per chip or per byte lane.
+package rom
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chips are the sizes of common EPROMs, by part number.
+var Chips = map[string]int{
+	"2708":  0x0400,
+	"2716":  0x0800,
+	"2732":  0x1000,
+	"2764":  0x2000,
+	"27128": 0x4000,
+	"27256": 0x8000,
+	"27512": 0x10000,
+}
+
+// Image is absolute bytecode starting at Origin.
+type Image struct {
+	Origin   uint16
+	Bytecode []byte
+}
+
+// end returns the address after the last byte of the image.
+func (img *Image) end() int {
+	return int(img.Origin) + len(img.Bytecode)
+}
+
+// Pad extends the image to size bytes with the fill byte.
+func (img *Image) Pad(size int, fill byte) error {
+	if len(img.Bytecode) > size {
+		return fmt.Errorf("image is %d bytes, which is larger than the ROM size of %d bytes", len(img.Bytecode), size)
+	}
+	if int(img.Origin)+size > 0x10000 {
+		return fmt.Errorf("a %d byte ROM at 0x%04X doesn't fit in 64K", size, img.Origin)
+	}
+	for len(img.Bytecode) < size {
+		img.Bytecode = append(img.Bytecode, fill)
+	}
+	return nil
+}
+
+// Checksum is an algorithm for checking a ROM's contents.
+type Checksum int
+
+const (
+	Sum8  Checksum = iota // 8-bit sum of the bytes
+	Sum16                 // 16-bit sum of the bytes
+	CRC16                 // CRC-16/CCITT: polynomial 1021H, initial value FFFFH
+)
+
+var checksumNames = []string{"sum8", "sum16", "crc16"}
+
+// ParseChecksum returns the checksum with the given name: sum8, sum16 or
+// crc16.
+func ParseChecksum(name string) (Checksum, error) {
+	for i, n := range checksumNames {
+		if strings.EqualFold(name, n) {
+			return Checksum(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown checksum %s, expected one of %s", name, strings.Join(checksumNames, ", "))
+}
+
+func (c Checksum) String() string {
+	return checksumNames[c]
+}
+
+// Size returns the number of bytes the checksum takes up.
+func (c Checksum) Size() int {
+	if c == Sum8 {
+		return 1
+	}
+	return 2
+}
+
+// Compute returns the checksum of data.
+func (c Checksum) Compute(data []byte) uint16 {
+	var value uint16
+	switch c {
+	case Sum8:
+		for _, b := range data {
+			value = (value + uint16(b)) & 0x00FF
+		}
+	case Sum16:
+		for _, b := range data {
+			value += uint16(b)
+		}
+	case CRC16:
+		value = 0xFFFF
+		for _, b := range data {
+			value ^= uint16(b) << 8
+			for range 8 {
+				if value&0x8000 != 0 {
+					value = value<<1 ^ 0x1021
+				} else {
+					value <<= 1
+				}
+			}
+		}
+	}
+	return value
+}
+
+// Embed computes the checksum of the bytes from start to end inclusive and
+// stores it at address, low byte first. The checksum can't be inside the
+// range it covers.
+func (img *Image) Embed(c Checksum, address uint16, start uint16, end uint16) (uint16, error) {
+	if start > end {
+		return 0, fmt.Errorf("checksum range 0x%04X-0x%04X is backwards", start, end)
+	}
+	if int(start) < int(img.Origin) || int(end) >= img.end() {
+		return 0, fmt.Errorf("checksum range 0x%04X-0x%04X is outside the image", start, end)
+	}
+	if int(address) < int(img.Origin) || int(address)+c.Size() > img.end() {
+		return 0, fmt.Errorf("checksum address 0x%04X is outside the image", address)
+	}
+	if int(address)+c.Size() > int(start) && address <= end {
+		return 0, fmt.Errorf("checksum at 0x%04X is inside the range it covers", address)
+	}
+
+	value := c.Compute(img.Bytecode[start-img.Origin : end-img.Origin+1])
+	at := address - img.Origin
+	img.Bytecode[at] = byte(value)
+	if c.Size() == 2 {
+		img.Bytecode[at+1] = byte(value >> 8)
+	}
+	return value, nil
+}
+
+// Split divides the image into chips of size bytes. The image must already
+// be a whole number of chips, which Pad can make sure of.
+func (img *Image) Split(size int) ([][]byte, error) {
+	if size <= 0 || len(img.Bytecode)%size != 0 {
+		return nil, fmt.Errorf("image is %d bytes, which isn't a whole number of %d byte chips", len(img.Bytecode), size)
+	}
+	chips := [][]byte{}
+	for offset := 0; offset < len(img.Bytecode); offset += size {
+		chips = append(chips, img.Bytecode[offset:offset+size])
+	}
+	return chips, nil
+}
+
+// Lanes divides data into n byte lanes, for boards where each ROM holds
+// every nth byte: with two lanes, the first holds the bytes at even offsets
+// and the second those at odd offsets.
+func Lanes(data []byte, n int) [][]byte {
+	lanes := make([][]byte, n)
+	for i, b := range data {
+		lanes[i%n] = append(lanes[i%n], b)
+	}
+	return lanes
+}
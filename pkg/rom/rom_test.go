@@ -0,0 +1,122 @@
+package rom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChecksum_Compute(t *testing.T) {
+	check := []byte("123456789")
+	tests := []struct {
+		checksum Checksum
+		want     uint16
+	}{
+		{checksum: Sum8, want: 0xDD},
+		{checksum: Sum16, want: 0x01DD},
+		{checksum: CRC16, want: 0x29B1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.checksum.String(), func(t *testing.T) {
+			if got := tt.checksum.Compute(check); got != tt.want {
+				t.Errorf("Compute() = 0x%04X, want 0x%04X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImage_Embed(t *testing.T) {
+	tests := []struct {
+		name       string
+		checksum   Checksum
+		address    uint16
+		start, end uint16
+		want       []byte
+		wantErr    bool
+	}{
+		{
+			name:     "sum8 after the range",
+			checksum: Sum8,
+			address:  0x8003,
+			start:    0x8000,
+			end:      0x8002,
+			want:     []byte{0x01, 0x02, 0x03, 0x06, 0xFF},
+		},
+		{
+			name:     "sum16 before the range",
+			checksum: Sum16,
+			address:  0x8000,
+			start:    0x8002,
+			end:      0x8004,
+			want:     []byte{0x02, 0x01, 0x03, 0x00, 0xFF},
+		},
+		{
+			name:     "checksum inside its range",
+			checksum: CRC16,
+			address:  0x8002,
+			start:    0x8000,
+			end:      0x8003,
+			wantErr:  true,
+		},
+		{
+			name:     "range outside the image",
+			checksum: Sum8,
+			address:  0x8004,
+			start:    0x7FFF,
+			end:      0x8002,
+			wantErr:  true,
+		},
+		{
+			name:     "checksum past the end of the image",
+			checksum: Sum16,
+			address:  0x8004,
+			start:    0x8000,
+			end:      0x8002,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := &Image{Origin: 0x8000, Bytecode: []byte{0x01, 0x02, 0x03, 0x00, 0xFF}}
+			_, err := image.Embed(tt.checksum, tt.address, tt.start, tt.end)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Embed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(image.Bytecode, tt.want) {
+				t.Errorf("Embed() image = %X, want %X", image.Bytecode, tt.want)
+			}
+		})
+	}
+}
+
+func TestImage_PadSplitLanes(t *testing.T) {
+	image := &Image{Origin: 0xF000, Bytecode: []byte{0x01, 0x02, 0x03}}
+	if err := image.Pad(8, 0xFF); err != nil {
+		t.Fatalf("Pad() error = %v", err)
+	}
+	if want := []byte{0x01, 0x02, 0x03, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}; !reflect.DeepEqual(image.Bytecode, want) {
+		t.Errorf("Pad() = %X, want %X", image.Bytecode, want)
+	}
+	if err := image.Pad(4, 0xFF); err == nil {
+		t.Errorf("Pad() to a smaller size error = nil, want error")
+	}
+	if err := (&Image{Origin: 0xF000}).Pad(0x2000, 0xFF); err == nil {
+		t.Errorf("Pad() past 64K error = nil, want error")
+	}
+
+	chips, err := image.Split(4)
+	if err != nil {
+		t.Fatalf("Split() error = %v", err)
+	}
+	if want := [][]byte{{0x01, 0x02, 0x03, 0xFF}, {0xFF, 0xFF, 0xFF, 0xFF}}; !reflect.DeepEqual(chips, want) {
+		t.Errorf("Split() = %X, want %X", chips, want)
+	}
+	if _, err := image.Split(3); err == nil {
+		t.Errorf("Split() into uneven chips error = nil, want error")
+	}
+
+	if got, want := Lanes(chips[0], 2), [][]byte{{0x01, 0x03}, {0x02, 0xFF}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Lanes() = %X, want %X", got, want)
+	}
+}
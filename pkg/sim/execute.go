@@ -0,0 +1,388 @@
+package sim
+
+import "math/bits"
+
+// reg returns the 8-bit register with the given 3-bit code, where 6 is the
+// memory location addressed by HL.
+func (c *CPU) reg(code byte) byte {
+	switch code {
+	case 0:
+		return c.B
+	case 1:
+		return c.C
+	case 2:
+		return c.D
+	case 3:
+		return c.E
+	case 4:
+		return c.H
+	case 5:
+		return c.L
+	case 6:
+		return c.Read(c.HL())
+	}
+	return c.A
+}
+
+func (c *CPU) setReg(code byte, value byte) {
+	switch code {
+	case 0:
+		c.B = value
+	case 1:
+		c.C = value
+	case 2:
+		c.D = value
+	case 3:
+		c.E = value
+	case 4:
+		c.H = value
+	case 5:
+		c.L = value
+	case 6:
+		c.Write(c.HL(), value)
+	default:
+		c.A = value
+	}
+}
+
+// pair returns the register pair with the given 2-bit code, where 3 is SP.
+func (c *CPU) pair(code byte) uint16 {
+	switch code {
+	case 0:
+		return c.BC()
+	case 1:
+		return c.DE()
+	case 2:
+		return c.HL()
+	}
+	return c.SP
+}
+
+func (c *CPU) setPair(code byte, value uint16) {
+	switch code {
+	case 0:
+		c.SetBC(value)
+	case 1:
+		c.SetDE(value)
+	case 2:
+		c.SetHL(value)
+	default:
+		c.SP = value
+	}
+}
+
+// condition reports whether the 3-bit condition code (NZ, Z, NC, C, PO, PE,
+// P, M) is met.
+func (c *CPU) condition(code byte) bool {
+	switch code {
+	case 0:
+		return !c.Flags.Z
+	case 1:
+		return c.Flags.Z
+	case 2:
+		return !c.Flags.CY
+	case 3:
+		return c.Flags.CY
+	case 4:
+		return !c.Flags.P
+	case 5:
+		return c.Flags.P
+	case 6:
+		return !c.Flags.S
+	}
+	return c.Flags.S
+}
+
+func (c *CPU) fetch() byte {
+	value := c.Read(c.PC)
+	c.PC++
+	return value
+}
+
+func (c *CPU) fetch16() uint16 {
+	value := c.read16(c.PC)
+	c.PC += 2
+	return value
+}
+
+func (c *CPU) setZSP(value byte) {
+	c.Flags.Z = value == 0
+	c.Flags.S = value&0x80 != 0
+	c.Flags.P = bits.OnesCount8(value)%2 == 0
+}
+
+func (c *CPU) add(value byte, carry bool) {
+	cy := byte(0)
+	if carry {
+		cy = 1
+	}
+	result := uint16(c.A) + uint16(value) + uint16(cy)
+	c.Flags.AC = (c.A&0x0F)+(value&0x0F)+cy > 0x0F
+	c.Flags.CY = result > 0xFF
+	c.A = byte(result)
+	c.setZSP(c.A)
+}
+
+// sub returns A - value - borrow and sets the flags, without storing the
+// result, so that it can be shared by SUB, SBB and CMP.
+func (c *CPU) sub(value byte, borrow bool) byte {
+	// The 8080 subtracts by adding the two's complement, so AC is the carry
+	// out of bit 3 of that addition.
+	cy := byte(1)
+	if borrow {
+		cy = 0
+	}
+	result := uint16(c.A) + uint16(^value) + uint16(cy)
+	c.Flags.AC = (c.A&0x0F)+(^value&0x0F)+cy > 0x0F
+	c.Flags.CY = result <= 0xFF
+	c.setZSP(byte(result))
+	return byte(result)
+}
+
+// alu performs ADD, ADC, SUB, SBB, ANA, XRA, ORA or CMP, selected by the
+// 3-bit operation code.
+func (c *CPU) alu(operation byte, value byte) {
+	switch operation {
+	case 0:
+		c.add(value, false)
+	case 1:
+		c.add(value, c.Flags.CY)
+	case 2:
+		c.A = c.sub(value, false)
+	case 3:
+		c.A = c.sub(value, c.Flags.CY)
+	case 4:
+		// ANA sets AC from the OR of bit 3 of the operands
+		c.Flags.AC = (c.A|value)&0x08 != 0
+		c.Flags.CY = false
+		c.A &= value
+		c.setZSP(c.A)
+	case 5:
+		c.Flags.AC, c.Flags.CY = false, false
+		c.A ^= value
+		c.setZSP(c.A)
+	case 6:
+		c.Flags.AC, c.Flags.CY = false, false
+		c.A |= value
+		c.setZSP(c.A)
+	case 7:
+		c.sub(value, false)
+	}
+}
+
+func (c *CPU) daa() {
+	correction := byte(0)
+	carry := c.Flags.CY
+	if c.A&0x0F > 0x09 || c.Flags.AC {
+		correction |= 0x06
+	}
+	if c.A > 0x99 || c.Flags.CY {
+		correction |= 0x60
+		carry = true
+	}
+	c.add(correction, false)
+	c.Flags.CY = carry
+}
+
+// Step executes a single instruction and returns the number of clock cycles
+// it took.
+func (c *CPU) Step() (int, error) {
+	if c.Halted {
+		return 0, ErrHalted
+	}
+
+	start := c.PC
+	opcode := c.fetch()
+	cycleCount := cycles[opcode]
+
+	switch {
+	case opcode == 0x76: // HLT
+		c.Halted = true
+
+	case opcode&0xC0 == 0x40: // MOV
+		c.setReg(opcode>>3&0x07, c.reg(opcode&0x07))
+
+	case opcode&0xC0 == 0x80: // ADD, ADC, SUB, SBB, ANA, XRA, ORA, CMP
+		c.alu(opcode>>3&0x07, c.reg(opcode&0x07))
+
+	case opcode&0xC7 == 0xC6: // ADI, ACI, SUI, SBI, ANI, XRI, ORI, CPI
+		c.alu(opcode>>3&0x07, c.fetch())
+
+	case opcode&0xC7 == 0x04: // INR
+		code := opcode >> 3 & 0x07
+		value := c.reg(code) + 1
+		c.Flags.AC = value&0x0F == 0x00
+		c.setZSP(value)
+		c.setReg(code, value)
+
+	case opcode&0xC7 == 0x05: // DCR
+		code := opcode >> 3 & 0x07
+		value := c.reg(code) - 1
+		c.Flags.AC = value&0x0F != 0x0F
+		c.setZSP(value)
+		c.setReg(code, value)
+
+	case opcode&0xC7 == 0x06: // MVI
+		c.setReg(opcode>>3&0x07, c.fetch())
+
+	case opcode&0xCF == 0x01: // LXI
+		c.setPair(opcode>>4&0x03, c.fetch16())
+
+	case opcode&0xCF == 0x03: // INX
+		code := opcode >> 4 & 0x03
+		c.setPair(code, c.pair(code)+1)
+
+	case opcode&0xCF == 0x0B: // DCX
+		code := opcode >> 4 & 0x03
+		c.setPair(code, c.pair(code)-1)
+
+	case opcode&0xCF == 0x09: // DAD
+		result := uint32(c.HL()) + uint32(c.pair(opcode>>4&0x03))
+		c.Flags.CY = result > 0xFFFF
+		c.SetHL(uint16(result))
+
+	case opcode&0xCF == 0xC5: // PUSH
+		code := opcode >> 4 & 0x03
+		if code == 3 {
+			c.push(c.PSW())
+		} else {
+			c.push(c.pair(code))
+		}
+
+	case opcode&0xCF == 0xC1: // POP
+		code := opcode >> 4 & 0x03
+		if code == 3 {
+			c.SetPSW(c.pop())
+		} else {
+			c.setPair(code, c.pop())
+		}
+
+	case opcode&0xC7 == 0xC2: // Jcc
+		address := c.fetch16()
+		if c.condition(opcode >> 3 & 0x07) {
+			c.PC = address
+		}
+
+	case opcode&0xC7 == 0xC4: // Ccc
+		address := c.fetch16()
+		if c.condition(opcode >> 3 & 0x07) {
+			c.push(c.PC)
+			c.PC = address
+			cycleCount += 6
+		}
+
+	case opcode&0xC7 == 0xC0: // Rcc
+		if c.condition(opcode >> 3 & 0x07) {
+			c.PC = c.pop()
+			cycleCount += 6
+		}
+
+	case opcode&0xC7 == 0xC7: // RST
+		c.push(c.PC)
+		c.PC = uint16(opcode & 0x38)
+
+	default:
+		c.execute(opcode)
+	}
+
+	c.Cycles += uint64(cycleCount)
+	c.Steps++
+	if c.StepHook != nil {
+		c.StepHook(start, c.PC)
+	}
+	return cycleCount, nil
+}
+
+// execute runs the instructions that don't belong to one of the regularly
+// encoded groups handled by Step.
+func (c *CPU) execute(opcode byte) {
+	switch opcode {
+	case 0x02: // STAX B
+		c.Write(c.BC(), c.A)
+	case 0x12: // STAX D
+		c.Write(c.DE(), c.A)
+	case 0x0A: // LDAX B
+		c.A = c.Read(c.BC())
+	case 0x1A: // LDAX D
+		c.A = c.Read(c.DE())
+	case 0x22: // SHLD
+		c.write16(c.fetch16(), c.HL())
+	case 0x2A: // LHLD
+		c.SetHL(c.read16(c.fetch16()))
+	case 0x32: // STA
+		c.Write(c.fetch16(), c.A)
+	case 0x3A: // LDA
+		c.A = c.Read(c.fetch16())
+
+	case 0x07: // RLC
+		c.Flags.CY = c.A&0x80 != 0
+		c.A = c.A<<1 | c.A>>7
+	case 0x0F: // RRC
+		c.Flags.CY = c.A&0x01 != 0
+		c.A = c.A>>1 | c.A<<7
+	case 0x17: // RAL
+		carry := c.Flags.CY
+		c.Flags.CY = c.A&0x80 != 0
+		c.A <<= 1
+		if carry {
+			c.A |= 0x01
+		}
+	case 0x1F: // RAR
+		carry := c.Flags.CY
+		c.Flags.CY = c.A&0x01 != 0
+		c.A >>= 1
+		if carry {
+			c.A |= 0x80
+		}
+
+	case 0x27: // DAA
+		c.daa()
+	case 0x2F: // CMA
+		c.A = ^c.A
+	case 0x37: // STC
+		c.Flags.CY = true
+	case 0x3F: // CMC
+		c.Flags.CY = !c.Flags.CY
+
+	case 0xC3, 0xCB: // JMP
+		c.PC = c.fetch16()
+	case 0xCD, 0xDD, 0xED, 0xFD: // CALL
+		address := c.fetch16()
+		c.push(c.PC)
+		c.PC = address
+	case 0xC9, 0xD9: // RET
+		c.PC = c.pop()
+
+	case 0xD3: // OUT
+		port := c.fetch()
+		if c.Out != nil {
+			c.Out(port, c.A)
+		}
+	case 0xDB: // IN
+		port := c.fetch()
+		c.A = 0x00
+		if c.In != nil {
+			c.A = c.In(port)
+		}
+
+	case 0xE3: // XTHL
+		value := c.read16(c.SP)
+		c.write16(c.SP, c.HL())
+		c.SetHL(value)
+	case 0xE9: // PCHL
+		c.PC = c.HL()
+	case 0xEB: // XCHG
+		hl := c.HL()
+		c.SetHL(c.DE())
+		c.SetDE(hl)
+	case 0xF9: // SPHL
+		c.SP = c.HL()
+
+	case 0xF3: // DI
+		c.InterruptsEnabled = false
+	case 0xFB: // EI
+		c.InterruptsEnabled = true
+
+		// NOP and its undocumented duplicates do nothing
+	}
+}
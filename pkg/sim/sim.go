@@ -0,0 +1,222 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lukepeterson/go8080assembler/pkg/assembler"
+)
+
+// ErrStepLimit is returned when a run executes more instructions than the
+// CPU's StepLimit.
+var ErrStepLimit = errors.New("step limit reached")
+
+// ErrHalted is returned when stepping a CPU that has executed HLT.
+var ErrHalted = errors.New("CPU is halted")
+
+// DefaultStepLimit is the StepLimit of a new CPU.
+const DefaultStepLimit = 1000000
+
+// Flags are the 8080 condition flags.
+type Flags struct {
+	S  bool // Sign
+	Z  bool // Zero
+	AC bool // Auxiliary carry
+	P  bool // Parity (set when even)
+	CY bool // Carry
+}
+
+// Byte returns the flags in the layout pushed by PUSH PSW.
+func (f Flags) Byte() byte {
+	b := byte(0x02)
+	if f.S {
+		b |= 0x80
+	}
+	if f.Z {
+		b |= 0x40
+	}
+	if f.AC {
+		b |= 0x10
+	}
+	if f.P {
+		b |= 0x04
+	}
+	if f.CY {
+		b |= 0x01
+	}
+	return b
+}
+
+// SetByte sets the flags from the layout popped by POP PSW.
+func (f *Flags) SetByte(b byte) {
+	f.S = b&0x80 != 0
+	f.Z = b&0x40 != 0
+	f.AC = b&0x10 != 0
+	f.P = b&0x04 != 0
+	f.CY = b&0x01 != 0
+}
+
+// CPU is an Intel 8080 with 64K of memory.
+type CPU struct {
+	A, B, C, D, E, H, L byte
+	SP, PC              uint16
+	Flags               Flags
+	Memory              [0x10000]byte
+
+	InterruptsEnabled bool
+	Halted            bool
+	Cycles            uint64 // Total clock cycles executed
+	Steps             uint64 // Total instructions executed
+	StepLimit         uint64 // Maximum instructions per Run or Call, or 0 for no limit
+
+	// In and Out are called by the IN and OUT instructions. If In is nil,
+	// IN reads 0x00.
+	In  func(port byte) byte
+	Out func(port byte, value byte)
+
+	// ReadHook, if set, is called for every memory read, including
+	// instruction fetches. Returning ok replaces the value read from memory.
+	ReadHook func(address uint16) (value byte, ok bool)
+
+	// WriteHook, if set, is called for every memory write. Returning false
+	// stops the value being written, for read only or memory mapped regions.
+	WriteHook func(address uint16, value byte) bool
+
+	// StepHook, if set, is called after every instruction with the address
+	// it was fetched from and the address of the next instruction.
+	StepHook func(address uint16, next uint16)
+
+	// Labels are the label addresses of the assembled program, if the CPU
+	// was created by Assemble.
+	Labels map[string]uint16
+}
+
+// New returns a CPU with empty memory and the default step limit.
+func New() *CPU {
+	return &CPU{StepLimit: DefaultStepLimit, Labels: map[string]uint16{}}
+}
+
+// Assemble assembles input and returns a CPU with the bytecode loaded at its
+// origin, and PC pointing at the start of it.
+func Assemble(input string, options ...assembler.Option) (*CPU, error) {
+	asm := assembler.New(input, options...)
+	bytecode, err := asm.Assemble()
+	if err != nil {
+		return nil, err
+	}
+
+	cpu := New()
+	cpu.Load(asm.Origin(), bytecode)
+	cpu.PC = asm.Origin()
+	cpu.Labels = asm.Labels()
+	return cpu, nil
+}
+
+// Load copies data into memory starting at address, without calling the
+// write hook.
+func (c *CPU) Load(address uint16, data []byte) {
+	for i, b := range data {
+		c.Memory[address+uint16(i)] = b
+	}
+}
+
+// Read returns the byte at address, as seen by the CPU.
+func (c *CPU) Read(address uint16) byte {
+	if c.ReadHook != nil {
+		if value, ok := c.ReadHook(address); ok {
+			return value
+		}
+	}
+	return c.Memory[address]
+}
+
+// Write stores value at address, as the CPU would.
+func (c *CPU) Write(address uint16, value byte) {
+	if c.WriteHook != nil && !c.WriteHook(address, value) {
+		return
+	}
+	c.Memory[address] = value
+}
+
+func (c *CPU) read16(address uint16) uint16 {
+	return uint16(c.Read(address)) | uint16(c.Read(address+1))<<8
+}
+
+func (c *CPU) write16(address uint16, value uint16) {
+	c.Write(address, byte(value))
+	c.Write(address+1, byte(value>>8))
+}
+
+func (c *CPU) BC() uint16 { return uint16(c.B)<<8 | uint16(c.C) }
+func (c *CPU) DE() uint16 { return uint16(c.D)<<8 | uint16(c.E) }
+func (c *CPU) HL() uint16 { return uint16(c.H)<<8 | uint16(c.L) }
+
+func (c *CPU) SetBC(value uint16) { c.B, c.C = byte(value>>8), byte(value) }
+func (c *CPU) SetDE(value uint16) { c.D, c.E = byte(value>>8), byte(value) }
+func (c *CPU) SetHL(value uint16) { c.H, c.L = byte(value>>8), byte(value) }
+
+// PSW returns the accumulator and flags as pushed by PUSH PSW.
+func (c *CPU) PSW() uint16 { return uint16(c.A)<<8 | uint16(c.Flags.Byte()) }
+
+// SetPSW sets the accumulator and flags as popped by POP PSW.
+func (c *CPU) SetPSW(value uint16) {
+	c.A = byte(value >> 8)
+	c.Flags.SetByte(byte(value))
+}
+
+func (c *CPU) push(value uint16) {
+	c.SP -= 2
+	c.write16(c.SP, value)
+}
+
+func (c *CPU) pop() uint16 {
+	value := c.read16(c.SP)
+	c.SP += 2
+	return value
+}
+
+// Run executes instructions from PC until the CPU halts.
+func (c *CPU) Run() error {
+	for steps := uint64(0); !c.Halted; steps++ {
+		if c.StepLimit != 0 && steps >= c.StepLimit {
+			return fmt.Errorf("%w at 0x%04X", ErrStepLimit, c.PC)
+		}
+		if _, err := c.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Call pushes a return address and runs the subroutine at address until it
+// returns. The stack pointer must already point at usable memory.
+func (c *CPU) Call(address uint16) error {
+	const returnAddress = 0xFFFF
+
+	c.Halted = false
+	sp := c.SP
+	c.push(returnAddress)
+	c.PC = address
+
+	for steps := uint64(0); c.PC != returnAddress || c.SP != sp; steps++ {
+		if c.Halted {
+			return fmt.Errorf("halted at 0x%04X before returning from 0x%04X", c.PC-1, address)
+		}
+		if c.StepLimit != 0 && steps >= c.StepLimit {
+			return fmt.Errorf("%w at 0x%04X", ErrStepLimit, c.PC)
+		}
+		if _, err := c.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CallLabel calls the subroutine at the given label.
+func (c *CPU) CallLabel(label string) error {
+	address, exists := c.Labels[label]
+	if !exists {
+		return fmt.Errorf("label definition not found: %s", label)
+	}
+	return c.Call(address)
+}
@@ -0,0 +1,383 @@
+package sim
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCPU_Run(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantA     byte
+		wantFlags Flags
+	}{
+		{
+			name: "ADI with carry out",
+			input: `
+			MVI A, 0xFF
+			ADI 0x01
+			HLT`,
+			wantA:     0x00,
+			wantFlags: Flags{Z: true, AC: true, P: true, CY: true},
+		},
+		{
+			name: "SUI with borrow",
+			input: `
+			MVI A, 0x00
+			SUI 0x01
+			HLT`,
+			wantA:     0xFF,
+			wantFlags: Flags{S: true, P: true, CY: true},
+		},
+		{
+			name: "ADC uses the carry",
+			input: `
+			STC
+			MVI A, 0x10
+			ACI 0x01
+			HLT`,
+			wantA:     0x12,
+			wantFlags: Flags{P: true},
+		},
+		{
+			name: "SBB uses the borrow",
+			input: `
+			STC
+			MVI A, 0x10
+			SBI 0x01
+			HLT`,
+			wantA:     0x0E,
+			wantFlags: Flags{},
+		},
+		{
+			name: "CPI equal",
+			input: `
+			MVI A, 0x05
+			CPI 0x05
+			HLT`,
+			wantA:     0x05,
+			wantFlags: Flags{Z: true, AC: true, P: true},
+		},
+		{
+			name: "CPI less than",
+			input: `
+			MVI A, 0x05
+			CPI 0x06
+			HLT`,
+			wantA:     0x05,
+			wantFlags: Flags{S: true, P: true, CY: true},
+		},
+		{
+			name: "ANI sets AC from bit 3",
+			input: `
+			MVI A, 0x08
+			ANI 0x00
+			HLT`,
+			wantA:     0x00,
+			wantFlags: Flags{Z: true, AC: true, P: true},
+		},
+		{
+			name: "XRA A clears A and the carry",
+			input: `
+			STC
+			MVI A, 0x5A
+			XRA A
+			HLT`,
+			wantA:     0x00,
+			wantFlags: Flags{Z: true, P: true},
+		},
+		{
+			name: "ORI odd parity",
+			input: `
+			MVI A, 0x01
+			ORI 0x02
+			HLT`,
+			wantA:     0x03,
+			wantFlags: Flags{P: true},
+		},
+		{
+			name: "ORI even parity",
+			input: `
+			MVI A, 0x01
+			ORI 0x06
+			HLT`,
+			wantA:     0x07,
+			wantFlags: Flags{},
+		},
+		{
+			name: "INR sets AC on a nibble carry",
+			input: `
+			MVI A, 0x0F
+			INR A
+			HLT`,
+			wantA:     0x10,
+			wantFlags: Flags{AC: true},
+		},
+		{
+			name: "INR doesn't change the carry",
+			input: `
+			STC
+			MVI A, 0xFF
+			INR A
+			HLT`,
+			wantA:     0x00,
+			wantFlags: Flags{Z: true, AC: true, P: true, CY: true},
+		},
+		{
+			name: "DCR to zero",
+			input: `
+			MVI A, 0x01
+			DCR A
+			HLT`,
+			wantA:     0x00,
+			wantFlags: Flags{Z: true, AC: true, P: true},
+		},
+		{
+			name: "DAA adjusts the low nibble",
+			input: `
+			MVI A, 0x09
+			ADI 0x01
+			DAA
+			HLT`,
+			wantA:     0x10,
+			wantFlags: Flags{AC: true},
+		},
+		{
+			name: "DAA carries out of the high nibble",
+			input: `
+			MVI A, 0x99
+			ADI 0x01
+			DAA
+			HLT`,
+			wantA:     0x00,
+			wantFlags: Flags{Z: true, AC: true, P: true, CY: true},
+		},
+		{
+			name: "RLC",
+			input: `
+			MVI A, 0x81
+			RLC
+			HLT`,
+			wantA:     0x03,
+			wantFlags: Flags{CY: true},
+		},
+		{
+			name: "RAR through the carry",
+			input: `
+			STC
+			MVI A, 0x02
+			RAR
+			HLT`,
+			wantA:     0x81,
+			wantFlags: Flags{},
+		},
+		{
+			name: "PUSH PSW and POP PSW",
+			input: `
+			MVI A, 0x42
+			STC
+			PUSH PSW
+			POP B
+			MOV A, C
+			HLT`,
+			wantA:     0x03,
+			wantFlags: Flags{CY: true},
+		},
+		{
+			name: "memory through HL",
+			input: `
+			LXI H, VALUE
+			MVI M, 0x21
+			INR M
+			MOV A, M
+			HLT
+			VALUE: DB 0x00`,
+			wantA:     0x22,
+			wantFlags: Flags{P: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpu, err := Assemble(tt.input)
+			if err != nil {
+				t.Fatalf("Assemble() error = %v", err)
+			}
+			cpu.SP = 0x8000
+			if err := cpu.Run(); err != nil {
+				t.Fatalf("CPU.Run() error = %v", err)
+			}
+			if cpu.A != tt.wantA {
+				t.Errorf("CPU.Run() A = %02X, want %02X", cpu.A, tt.wantA)
+			}
+			if cpu.Flags != tt.wantFlags {
+				t.Errorf("CPU.Run() flags = %+v, want %+v", cpu.Flags, tt.wantFlags)
+			}
+		})
+	}
+}
+
+const multiply = `
+MULT:	MOV B, H
+		MOV C, L
+		LXI H, 0x0000
+LOOP:	MOV A, D
+		ORA E
+		RZ
+		DAD B
+		DCX D
+		JMP LOOP
+`
+
+func TestCPU_CallLabel(t *testing.T) {
+	cpu, err := Assemble(multiply)
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+
+	cpu.SetHL(7)
+	cpu.SetDE(6)
+	if err := cpu.CallLabel("MULT"); err != nil {
+		t.Fatalf("CPU.CallLabel() error = %v", err)
+	}
+	if cpu.HL() != 42 {
+		t.Errorf("CPU.CallLabel() HL = %d, want 42", cpu.HL())
+	}
+	if cpu.SP != 0x0000 {
+		t.Errorf("CPU.CallLabel() SP = %04X, want 0000", cpu.SP)
+	}
+
+	if err := cpu.CallLabel("DIVIDE"); err == nil {
+		t.Errorf("CPU.CallLabel() with unknown label, want error")
+	}
+}
+
+func TestCPU_Cycles(t *testing.T) {
+	cpu, err := Assemble(`
+			NOP
+			MVI A, 0x00
+			CPI 0x00
+			CZ DONE
+			HLT
+	DONE:	RNZ
+			RET
+	`)
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("CPU.Run() error = %v", err)
+	}
+
+	// NOP 4, MVI 7, CPI 7, CZ taken 17, RNZ not taken 5, RET 10, HLT 7
+	if cpu.Cycles != 57 {
+		t.Errorf("CPU.Cycles = %d, want 57", cpu.Cycles)
+	}
+	if cpu.Steps != 7 {
+		t.Errorf("CPU.Steps = %d, want 7", cpu.Steps)
+	}
+}
+
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		opcode                byte
+		wantCycles, wantTaken int
+	}{
+		{0x00, 4, 4},   // NOP
+		{0xC3, 10, 10}, // JMP
+		{0xCA, 10, 10}, // JZ
+		{0xCC, 11, 17}, // CZ
+		{0xC8, 5, 11},  // RZ
+		{0xC9, 10, 10}, // RET
+	}
+	for _, tt := range tests {
+		cycles, taken := Cycles(tt.opcode)
+		if cycles != tt.wantCycles || taken != tt.wantTaken {
+			t.Errorf("Cycles(0x%02X) = %d, %d, want %d, %d", tt.opcode, cycles, taken, tt.wantCycles, tt.wantTaken)
+		}
+	}
+}
+
+func TestCPU_IO(t *testing.T) {
+	cpu, err := Assemble(`
+			IN 0x10
+			INR A
+			OUT 0x20
+			HLT
+	`)
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+
+	var outPort, outValue byte
+	cpu.In = func(port byte) byte { return port + 1 }
+	cpu.Out = func(port byte, value byte) { outPort, outValue = port, value }
+
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("CPU.Run() error = %v", err)
+	}
+	if outPort != 0x20 || outValue != 0x12 {
+		t.Errorf("CPU.Run() OUT %02X, %02X, want OUT 20, 12", outPort, outValue)
+	}
+}
+
+func TestCPU_MemoryHooks(t *testing.T) {
+	cpu, err := Assemble(`
+			LDA 0x8000
+			STA 0x0000
+			STA 0x9000
+			HLT
+	`)
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+
+	cpu.ReadHook = func(address uint16) (byte, bool) {
+		return 0x55, address == 0x8000
+	}
+	cpu.WriteHook = func(address uint16, value byte) bool {
+		return address >= 0x8000 // everything below 0x8000 is ROM
+	}
+
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("CPU.Run() error = %v", err)
+	}
+	if cpu.Memory[0x0000] != 0x3A {
+		t.Errorf("CPU.Run() wrote to ROM: %02X", cpu.Memory[0x0000])
+	}
+	if cpu.Memory[0x9000] != 0x55 {
+		t.Errorf("CPU.Run() RAM = %02X, want 55", cpu.Memory[0x9000])
+	}
+}
+
+func TestCPU_StepLimit(t *testing.T) {
+	cpu, err := Assemble(`LOOP: JMP LOOP`)
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+	cpu.StepLimit = 100
+
+	if err := cpu.Run(); !errors.Is(err, ErrStepLimit) {
+		t.Errorf("CPU.Run() error = %v, want %v", err, ErrStepLimit)
+	}
+	if err := cpu.Call(0x0000); !errors.Is(err, ErrStepLimit) {
+		t.Errorf("CPU.Call() error = %v, want %v", err, ErrStepLimit)
+	}
+}
+
+func TestCPU_Halt(t *testing.T) {
+	cpu, err := Assemble(`STOP: HLT`)
+	if err != nil {
+		t.Fatalf("Assemble() error = %v", err)
+	}
+
+	if err := cpu.CallLabel("STOP"); err == nil {
+		t.Errorf("CPU.CallLabel() halting subroutine, want error")
+	}
+	if !cpu.Halted {
+		t.Errorf("CPU.Halted = false, want true")
+	}
+	if _, err := cpu.Step(); !errors.Is(err, ErrHalted) {
+		t.Errorf("CPU.Step() error = %v, want %v", err, ErrHalted)
+	}
+}
@@ -0,0 +1,206 @@
+// Package symbols reads and writes symbol tables, so that a program can
+// refer to the routines of a ROM or another build by name: CP/M .SYM files,
+// linker map files, and JSON.
+package symbols
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+)
+
+// Symbol is a named absolute address, and where it came from, such as
+// "bios.sym:12".
+type Symbol struct {
+	Name   string
+	Value  uint16
+	Origin string
+}
+
+// ReadFile reads the symbols in a file, telling the format from its
+// contents.
+func ReadFile(filename string) ([]Symbol, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Read(filename, b)
+}
+
+// Read reads the symbols in a JSON object, or else a text file listing
+// addresses and names, naming filename as their origin. Text files are CP/M
+// .SYM files, including those from LINK-80 and go8080asm link -symbols,
+// where each line has pairs of a 4-digit hexadecimal address and a name, or
+// L80 map files, which have a segment line such as "Data 0103 01A7" and
+// pairs of a name and an address. Lines that aren't made up of those pairs,
+// such as module and segment lines, are skipped.
+func Read(filename string, b []byte) ([]Symbol, error) {
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '{' {
+		return readJSON(filename, trimmed)
+	}
+	return readText(filename, b)
+}
+
+func readJSON(filename string, b []byte) ([]Symbol, error) {
+	table := map[string]any{}
+	if err := json.Unmarshal(b, &table); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	symbols := []Symbol{}
+	for name, value := range table {
+		var address uint64
+		var err error
+		switch v := value.(type) {
+		case float64:
+			address = uint64(v)
+			if v < 0 || v > 0xFFFF || v != float64(address) {
+				err = fmt.Errorf("invalid address %v", v)
+			}
+		case string:
+			address, err = parseAddress(v)
+		default:
+			err = fmt.Errorf("invalid address %v", v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: symbol %s: %w", filename, name, err)
+		}
+		symbols = append(symbols, Symbol{Name: strings.ToUpper(name), Value: uint16(address), Origin: filename})
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+	return symbols, nil
+}
+
+func readText(filename string, b []byte) ([]Symbol, error) {
+	// CP/M text files end at the first ^Z
+	if end := bytes.IndexByte(b, 0x1A); end >= 0 {
+		b = b[:end]
+	}
+
+	lines := [][]string{}
+	nameFirst := false
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && segmentWords[strings.ToUpper(fields[0])] && isAddress(fields[1]) {
+			nameFirst = true
+		}
+		lines = append(lines, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	symbols := []Symbol{}
+	for i, fields := range lines {
+		symbols = append(symbols, pairs(fields, nameFirst, fmt.Sprintf("%s:%d", filename, i+1))...)
+	}
+	return symbols, nil
+}
+
+// pairs returns the symbols on a line of address and name pairs, or of name
+// and address pairs in a map file, and nothing if the line is anything else.
+func pairs(fields []string, nameFirst bool, origin string) []Symbol {
+	if len(fields)%2 != 0 {
+		return nil
+	}
+	symbols := []Symbol{}
+	for i := 0; i < len(fields); i += 2 {
+		address, name := fields[i], fields[i+1]
+		if nameFirst {
+			address, name = name, address
+		}
+		if !isAddress(address) || !isName(name) {
+			return nil
+		}
+		value, _ := parseAddress(address)
+		symbols = append(symbols, Symbol{Name: strings.ToUpper(name), Value: uint16(value), Origin: origin})
+	}
+	return symbols
+}
+
+// isAddress reports whether s is four hexadecimal digits, optionally
+// followed by H or a linker's relocation mark.
+func isAddress(s string) bool {
+	s = strings.TrimRight(strings.TrimSuffix(strings.ToUpper(s), "H"), "'\"*")
+	if len(s) != 4 {
+		return false
+	}
+	_, err := isa.ParseNumber(s)
+	return err == nil
+}
+
+// segmentWords are the words that map files put before segment addresses,
+// which mark a map file and aren't symbols.
+var segmentWords = map[string]bool{"CODE": true, "DATA": true, "PROGRAM": true, "COMMON": true, "ABSOLUTE": true}
+
+// isName reports whether s could be an assembler label.
+func isName(s string) bool {
+	if segmentWords[strings.ToUpper(s)] {
+		return false
+	}
+	for i, r := range s {
+		if !(unicode.IsLetter(r) || r == '_' || r == '?' || r == '@' || r == '$' || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func parseAddress(s string) (uint64, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "'\"*")
+	address, err := isa.ParseNumber(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %s", s)
+	}
+	return uint64(address), nil
+}
+
+// WriteJSON writes symbols as a JSON object of names and hexadecimal
+// addresses, sorted by name.
+func WriteJSON(w io.Writer, symbols map[string]uint16) error {
+	table := map[string]string{}
+	for name, value := range symbols {
+		table[name] = fmt.Sprintf("0x%04X", value)
+	}
+	b, err := json.MarshalIndent(table, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// WriteSYM writes symbols as a CP/M .SYM file, sorted by address, four to a
+// line.
+func WriteSYM(w io.Writer, symbols map[string]uint16) error {
+	names := []string{}
+	for name := range symbols {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if symbols[names[i]] != symbols[names[j]] {
+			return symbols[names[i]] < symbols[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	b := &strings.Builder{}
+	for i, name := range names {
+		separator := "\t"
+		if i%4 == 3 || i == len(names)-1 {
+			separator = "\r\n"
+		}
+		fmt.Fprintf(b, "%04X %s%s", symbols[name], name, separator)
+	}
+	b.WriteByte(0x1A)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
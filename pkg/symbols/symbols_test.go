@@ -0,0 +1,146 @@
+package symbols
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Symbol
+		wantErr bool
+	}{
+		{
+			name:  "CP/M .SYM file",
+			input: "0000 BOOT\t0003 CONIN\t0006 CONOUT\r\nF200 ?LIST\r\n\x1A0000 JUNK",
+			want: []Symbol{
+				{Name: "BOOT", Value: 0x0000, Origin: "in:1"},
+				{Name: "CONIN", Value: 0x0003, Origin: "in:1"},
+				{Name: "CONOUT", Value: 0x0006, Origin: "in:1"},
+				{Name: "?LIST", Value: 0xF200, Origin: "in:2"},
+			},
+		},
+		{
+			name: "map file with names first",
+			input: `Data    0103    01A7    <  164>
+PRINT   0103'   START   0100
+`,
+			want: []Symbol{
+				{Name: "PRINT", Value: 0x0103, Origin: "in:2"},
+				{Name: "START", Value: 0x0100, Origin: "in:2"},
+			},
+		},
+		{
+			name: "map file with hex letter names",
+			input: `Program 0100    0143    <   67>
+CAFE    0103    BEEF    0110'
+ADD     0120
+`,
+			want: []Symbol{
+				{Name: "CAFE", Value: 0x0103, Origin: "in:2"},
+				{Name: "BEEF", Value: 0x0110, Origin: "in:2"},
+				{Name: "ADD", Value: 0x0120, Origin: "in:3"},
+			},
+		},
+		{
+			name: "text that isn't symbols",
+			input: `size 0100
+0000 BOOT
+BOOT 0000 size
+`,
+			want: []Symbol{
+				{Name: "BOOT", Value: 0x0000, Origin: "in:2"},
+			},
+		},
+		{
+			name: "go8080asm link -symbols",
+			input: `MAIN     code 0100  data 0180
+0105  LOOP
+0100  START
+`,
+			want: []Symbol{
+				{Name: "LOOP", Value: 0x0105, Origin: "in:2"},
+				{Name: "START", Value: 0x0100, Origin: "in:3"},
+			},
+		},
+		{
+			name:  "JSON",
+			input: `{"conout": "0x0006", "BOOT": 0, "CONIN": "0003H"}`,
+			want: []Symbol{
+				{Name: "BOOT", Value: 0x0000, Origin: "in"},
+				{Name: "CONIN", Value: 0x0003, Origin: "in"},
+				{Name: "CONOUT", Value: 0x0006, Origin: "in"},
+			},
+		},
+		{name: "JSON address too large", input: `{"BIG": 65536}`, wantErr: true},
+		{name: "JSON invalid address", input: `{"BAD": "xyz"}`, wantErr: true},
+		{name: "invalid JSON", input: `{"BAD": `, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read("in", []byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	table := map[string]uint16{"START": 0x0100, "LOOP": 0x0105, "BDOS": 0x0005, "FCB": 0x005C, "EXIT": 0x0110}
+	tests := []struct {
+		name  string
+		write func(b *bytes.Buffer) error
+		want  string
+	}{
+		{
+			name:  "SYM",
+			write: func(b *bytes.Buffer) error { return WriteSYM(b, table) },
+			want:  "0005 BDOS\t005C FCB\t0100 START\t0105 LOOP\r\n0110 EXIT\r\n\x1A",
+		},
+		{
+			name:  "JSON",
+			write: func(b *bytes.Buffer) error { return WriteJSON(b, table) },
+			want: `{
+  "BDOS": "0x0005",
+  "EXIT": "0x0110",
+  "FCB": "0x005C",
+  "LOOP": "0x0105",
+  "START": "0x0100"
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			if err := tt.write(b); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("got %q, want %q", b.String(), tt.want)
+			}
+
+			// Symbols read back the same as they were written
+			read, err := Read("in", b.Bytes())
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			got := map[string]uint16{}
+			for _, s := range read {
+				got[s.Name] = s.Value
+			}
+			if !reflect.DeepEqual(got, table) {
+				t.Errorf("Read() = %v, want %v", got, table)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package z80
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+)
+
+// FromIntel rewrites a program written with 8080 mnemonics using the Z80's.
+// Only the instruction on each line changes: labels, comments, directives
+// and blank lines are copied as they are, and comments stay in the same
+// column where there's room. Mnemonics and registers keep the case they
+// were written in.
+func FromIntel(source string) (string, error) {
+	tokens, err := lexer.New(source).Lex()
+	if err != nil {
+		return "", err
+	}
+	lines := map[int][]lexer.Token{}
+	for _, token := range tokens {
+		if token.Type != lexer.EOF {
+			lines[token.Line] = append(lines[token.Line], token)
+		}
+	}
+
+	// Lines that gain a comma use the same spacing after it as the rest of
+	// the program
+	separator := ", "
+	if strings.Contains(source, ",") && !strings.Contains(source, ", ") {
+		separator = ","
+	}
+
+	converted := strings.Split(source, "\n")
+	for i, line := range converted {
+		if converted[i], err = convertLine(line, lines[i+1], separator); err != nil {
+			return "", fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	return strings.Join(converted, "\n"), nil
+}
+
+// convertLine rewrites the instruction on a line of source, given the
+// tokens lexed from it. Operands are separated like they are on the line,
+// or by separator if it doesn't have any commas.
+func convertLine(line string, tokens []lexer.Token, separator string) (string, error) {
+	labels := 0
+	for len(tokens) >= 2 && tokens[0].Type == lexer.LABEL && tokens[1].Type == lexer.COLON {
+		tokens = tokens[2:]
+		labels++
+	}
+	// Without .8085, the 8085's instructions are lexed as names, but they're
+	// still the instruction at the start of a statement
+	if len(tokens) == 0 || (tokens[0].Type != lexer.MNEMONIC && isa.Requires(tokens[0].Literal) == isa.I8080) || isa.IsDirective(tokens[0].Literal) {
+		return line, nil
+	}
+
+	// Find the instruction in the text of the line, after the labels and
+	// before the comment
+	commentStart := len(line)
+	if i := indexUnquoted(line, ';'); i >= 0 {
+		commentStart = i
+	}
+	start := 0
+	for range labels {
+		start += indexUnquoted(line[start:], ':') + 1
+	}
+	for start < commentStart && (line[start] == ' ' || line[start] == '\t') {
+		start++
+	}
+	mnemonicEnd := start + len(tokens[0].Literal)
+	code := strings.TrimRight(line[:commentStart], " \t\r")
+	if mnemonicEnd > len(code) {
+		return line, nil
+	}
+
+	operandText := strings.TrimSpace(code[mnemonicEnd:])
+	operands := []string{}
+	if operandText != "" {
+		for _, operand := range strings.Split(operandText, ",") {
+			operands = append(operands, strings.TrimSpace(operand))
+		}
+	}
+
+	written := line[start:mnemonicEnd]
+	c := style{lower: written == strings.ToLower(written)}
+	mnemonic, converted, err := c.convert(tokens[0].Literal, operands)
+	if err != nil {
+		return "", err
+	}
+
+	// Keep the spacing after the mnemonic and commas
+	space := code[mnemonicEnd : len(code)-len(operandText)]
+	if space == "" {
+		space = " "
+	}
+	if strings.Contains(operandText, ", ") {
+		separator = ", "
+	} else if strings.Contains(operandText, ",") {
+		separator = ","
+	}
+	instruction := c.name(mnemonic)
+	if len(converted) > 0 {
+		instruction += space + strings.Join(converted, separator)
+	}
+
+	if commentStart == len(line) {
+		return line[:start] + instruction + line[len(code):], nil
+	}
+	gap := line[len(code):commentStart]
+	return line[:start] + instruction + align(line[:start]+instruction, gap, column(line[:commentStart])) + line[commentStart:], nil
+}
+
+// indexUnquoted returns the index of the first c in s that isn't inside a
+// string, or -1.
+func indexUnquoted(s string, c byte) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\'':
+			quoted = !quoted
+		case s[i] == c && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+// column returns the column that text ends at, with tabs every 8 columns.
+func column(text string) int {
+	col := 0
+	for _, c := range text {
+		if c == '\t' {
+			col = (col/8 + 1) * 8
+		} else {
+			col++
+		}
+	}
+	return col
+}
+
+// align returns the space to put after text so that a comment starts at
+// column want, or as near as it can, using tabs if gap, the space before
+// the comment originally, did.
+func align(text string, gap string, want int) string {
+	col := column(text)
+	if strings.Contains(gap, "\t") {
+		tabs := "\t"
+		for col = (col/8 + 1) * 8; col < want; col += 8 {
+			tabs += "\t"
+		}
+		return tabs
+	}
+	return strings.Repeat(" ", max(1, want-col))
+}
+
+// style is how the source writes mnemonics and registers.
+type style struct {
+	lower bool
+}
+
+func (c style) name(s string) string {
+	if c.lower {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// register returns the Z80 name of an 8-bit register, with M as (HL).
+func (c style) register(operand string) string {
+	if strings.EqualFold(operand, "M") {
+		return "(" + c.name("HL") + ")"
+	}
+	return c.name(strings.ToUpper(operand))
+}
+
+// pair returns the Z80 name of a register pair.
+func (c style) pair(operand string) string {
+	pairs := map[string]string{"B": "BC", "D": "DE", "H": "HL", "SP": "SP", "PSW": "AF"}
+	if pair, found := pairs[strings.ToUpper(operand)]; found {
+		return c.name(pair)
+	}
+	return operand
+}
+
+// accumulatorOperations are the 8080 instructions that operate on the
+// accumulator and a register or immediate byte, and the Z80 mnemonic for
+// each. The Z80 writes A as the first operand of ADD, ADC and SBC.
+var accumulatorOperations = map[string]string{
+	"ADD": "ADD", "ADC": "ADC", "SUB": "SUB", "SBB": "SBC", "ANA": "AND", "XRA": "XOR", "ORA": "OR", "CMP": "CP",
+	"ADI": "ADD", "ACI": "ADC", "SUI": "SUB", "SBI": "SBC", "ANI": "AND", "XRI": "XOR", "ORI": "OR", "CPI": "CP",
+}
+
+var implied = map[string]string{
+	"NOP": "NOP", "HLT": "HALT", "DI": "DI", "EI": "EI", "DAA": "DAA", "RET": "RET",
+	"CMA": "CPL", "STC": "SCF", "CMC": "CCF", "RLC": "RLCA", "RRC": "RRCA", "RAL": "RLA", "RAR": "RRA",
+	"XCHG": "EX DE,HL", "XTHL": "EX (SP),HL", "SPHL": "LD SP,HL", "PCHL": "JP (HL)",
+}
+
+// operandCounts is the number of operands each 8080 instruction that has
+// them takes.
+var operandCounts = map[string]int{
+	"MOV": 2, "MVI": 2, "LXI": 2,
+	"LDAX": 1, "STAX": 1, "LDA": 1, "STA": 1, "LHLD": 1, "SHLD": 1, "PUSH": 1, "POP": 1, "DAD": 1,
+	"INX": 1, "DCX": 1, "INR": 1, "DCR": 1, "JMP": 1, "CALL": 1, "RST": 1, "IN": 1, "OUT": 1,
+}
+
+// conditionOf returns the condition of a conditional jump, call or return.
+func conditionOf(mnemonic string) (string, bool) {
+	if len(mnemonic) < 2 || !strings.ContainsRune("JCR", rune(mnemonic[0])) {
+		return "", false
+	}
+	return mnemonic[1:], conditions[mnemonic[1:]]
+}
+
+// convert returns the Z80 mnemonic and operands for an 8080 instruction.
+func (c style) convert(mnemonic string, operands []string) (string, []string, error) {
+	want := operandCounts[mnemonic]
+	condition, conditional := conditionOf(mnemonic)
+	if accumulatorOperations[mnemonic] != "" || (conditional && mnemonic[0] != 'R') {
+		want = 1
+	}
+	if len(operands) != want {
+		return "", nil, fmt.Errorf("%s expects %d operands, got %d", mnemonic, want, len(operands))
+	}
+
+	a, hl := c.name("A"), c.name("HL")
+	switch {
+	case implied[mnemonic] != "":
+		z80, operandText, _ := strings.Cut(implied[mnemonic], " ")
+		if operandText == "" {
+			return z80, nil, nil
+		}
+		converted := strings.Split(operandText, ",")
+		for i := range converted {
+			converted[i] = c.name(converted[i])
+		}
+		return z80, converted, nil
+	case conditional:
+		converted := []string{c.name(condition)}
+		switch mnemonic[0] {
+		case 'J':
+			return "JP", append(converted, operands[0]), nil
+		case 'C':
+			return "CALL", append(converted, operands[0]), nil
+		}
+		return "RET", converted, nil
+	case accumulatorOperations[mnemonic] != "":
+		z80, operand := accumulatorOperations[mnemonic], operands[0]
+		if !strings.HasSuffix(mnemonic, "I") {
+			operand = c.register(operand)
+		}
+		if z80 == "ADD" || z80 == "ADC" || z80 == "SBC" {
+			return z80, []string{a, operand}, nil
+		}
+		return z80, []string{operand}, nil
+	}
+
+	switch mnemonic {
+	case "MOV":
+		return "LD", []string{c.register(operands[0]), c.register(operands[1])}, nil
+	case "MVI":
+		return "LD", []string{c.register(operands[0]), operands[1]}, nil
+	case "LXI":
+		return "LD", []string{c.pair(operands[0]), operands[1]}, nil
+	case "LDAX":
+		return "LD", []string{a, "(" + c.pair(operands[0]) + ")"}, nil
+	case "STAX":
+		return "LD", []string{"(" + c.pair(operands[0]) + ")", a}, nil
+	case "LDA":
+		return "LD", []string{a, "(" + operands[0] + ")"}, nil
+	case "STA":
+		return "LD", []string{"(" + operands[0] + ")", a}, nil
+	case "LHLD":
+		return "LD", []string{hl, "(" + operands[0] + ")"}, nil
+	case "SHLD":
+		return "LD", []string{"(" + operands[0] + ")", hl}, nil
+	case "PUSH", "POP":
+		return mnemonic, []string{c.pair(operands[0])}, nil
+	case "DAD":
+		return "ADD", []string{hl, c.pair(operands[0])}, nil
+	case "INX":
+		return "INC", []string{c.pair(operands[0])}, nil
+	case "DCX":
+		return "DEC", []string{c.pair(operands[0])}, nil
+	case "INR":
+		return "INC", []string{c.register(operands[0])}, nil
+	case "DCR":
+		return "DEC", []string{c.register(operands[0])}, nil
+	case "JMP":
+		return "JP", operands, nil
+	case "CALL":
+		return "CALL", operands, nil
+	case "RST":
+		routine, err := isa.ParseNumber(operands[0])
+		if err != nil || routine > 7 {
+			return "", nil, fmt.Errorf("expected routine value between 0 and 7, got: %s", operands[0])
+		}
+		return "RST", []string{c.name(fmt.Sprintf("%02XH", routine*8))}, nil
+	case "IN":
+		return "IN", []string{a, "(" + operands[0] + ")"}, nil
+	case "OUT":
+		return "OUT", []string{"(" + operands[0] + ")", a}, nil
+	}
+	return "", nil, fmt.Errorf("%s has no Z80 equivalent", mnemonic)
+}
@@ -0,0 +1,102 @@
+package z80
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromIntel(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "loads and stores",
+			source: "MOV A, M\nMVI B, 10\nLXI H, 1234H\nLDAX D\nSTAX B\nLDA 10H\nSTA 10H\nLHLD 20H\nSHLD 20H",
+			want:   "LD A, (HL)\nLD B, 10\nLD HL, 1234H\nLD A, (DE)\nLD (BC), A\nLD A, (10H)\nLD (10H), A\nLD HL, (20H)\nLD (20H), HL",
+		},
+		{
+			name:   "arithmetic",
+			source: "ADD B\nADI 1\nSUB C\nSUI 2\nSBB M\nANA A\nXRI 0FFH\nCMP E\nCPI 20H\nDAD SP\nINR A\nDCX H",
+			want:   "ADD A, B\nADD A, 1\nSUB C\nSUB 2\nSBC A, (HL)\nAND A\nXOR 0FFH\nCP E\nCP 20H\nADD HL, SP\nINC A\nDEC HL",
+		},
+		{
+			name:   "jumps, calls and returns",
+			source: "JMP 0\nJNZ 0\nJP 0\nCALL 5\nCM 5\nCP 5\nRET\nRPE\nRST 7\nPCHL",
+			want:   "JP 0\nJP NZ, 0\nJP P, 0\nCALL 5\nCALL M, 5\nCALL P, 5\nRET\nRET PE\nRST 38H\nJP (HL)",
+		},
+		{
+			name:   "stack, exchange and I/O",
+			source: "PUSH PSW\nPOP B\nXCHG\nXTHL\nSPHL\nIN 10H\nOUT 11H",
+			want:   "PUSH AF\nPOP BC\nEX DE, HL\nEX (SP), HL\nLD SP, HL\nIN A, (10H)\nOUT (11H), A",
+		},
+		{
+			name:   "implied",
+			source: "NOP\nHLT\nCMA\nSTC\nCMC\nRLC\nRRC\nRAL\nRAR\nDAA\nEI\nDI",
+			want:   "NOP\nHALT\nCPL\nSCF\nCCF\nRLCA\nRRCA\nRLA\nRRA\nDAA\nEI\nDI",
+		},
+		{
+			name:   "lower case and no space after commas",
+			source: "loop:\tmov a,m\n\tjnz loop",
+			want:   "loop:\tld a,(hl)\n\tjp nz,loop",
+		},
+		{
+			name:   "comments stay in their column",
+			source: "START:  MOV A, M     ; fetch\n        XCHG         ; swap\n        RST 1        ; call 8",
+			want:   "START:  LD A, (HL)   ; fetch\n        EX DE, HL    ; swap\n        RST 08H      ; call 8",
+		},
+		{
+			name:   "comments after tabs",
+			source: "\tMOV A, M\t; fetch\n\tLHLD 1234H\t; a long instruction",
+			want:   "\tLD A, (HL)\t; fetch\n\tLD HL, (1234H)\t; a long instruction",
+		},
+		{
+			name:   "directives, labels and comments are unchanged",
+			source: "; header\n\n\tORG 100H\nMSG:\tDB 'MOV A;M', 0\nDONE:\n",
+			want:   "; header\n\n\tORG 100H\nMSG:\tDB 'MOV A;M', 0\nDONE:\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromIntel(tt.source)
+			if err != nil {
+				t.Fatalf("FromIntel() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FromIntel() = %q, want %q", got, tt.want)
+			}
+
+			original, err := assemble(t, tt.source, false)
+			if err != nil {
+				t.Fatalf("Parser.Parse() error = %v", err)
+			}
+			translated, err := assemble(t, got, true)
+			if err != nil {
+				t.Fatalf("translation doesn't assemble: %v", err)
+			}
+			if !reflect.DeepEqual(translated, original) {
+				t.Errorf("translation assembles to %X, want %X", translated, original)
+			}
+		})
+	}
+}
+
+func TestFromIntel_Errors(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr string
+	}{
+		{"NOP\nRIM", "line 2: RIM has no Z80 equivalent"},
+		{"MOV A", "line 1: MOV expects 2 operands, got 1"},
+		{"RST 8", "line 1: expected routine value between 0 and 7, got: 8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := FromIntel(tt.source)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("FromIntel() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
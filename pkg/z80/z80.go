@@ -0,0 +1,446 @@
+// Package z80 reads programs written with Zilog Z80 mnemonics, such as
+// LD A,(HL) and JP NZ,LOOP. Only the instructions the 8080 has are allowed,
+// and they're translated into the Intel mnemonics that the parser
+// assembles, so they encode to exactly the same bytes.
+package z80
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lukepeterson/go8080assembler/pkg/isa"
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+)
+
+// Translate rewrites the tokens of a program lexed from Z80 source as the
+// tokens of the same program written with 8080 mnemonics. Labels, comments,
+// directives and line numbers are left as they are.
+func Translate(tokens []lexer.Token) ([]lexer.Token, error) {
+	translated := []lexer.Token{}
+	for start := 0; start < len(tokens); {
+		if tokens[start].Type == lexer.EOF {
+			translated = append(translated, tokens[start])
+			break
+		}
+		end := start
+		for end < len(tokens) && tokens[end].Type != lexer.EOF && tokens[end].Line == tokens[start].Line {
+			end++
+		}
+		line, err := translateLine(tokens[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", tokens[start].Line, err)
+		}
+		translated = append(translated, line...)
+		start = end
+	}
+	return translated, nil
+}
+
+// translateLine translates the statement on one line, keeping its labels
+// and comment.
+func translateLine(tokens []lexer.Token) ([]lexer.Token, error) {
+	translated := []lexer.Token{}
+	for len(tokens) >= 2 && tokens[0].Type == lexer.LABEL && tokens[1].Type == lexer.COLON {
+		translated = append(translated, tokens[:2]...)
+		tokens = tokens[2:]
+	}
+	var comment []lexer.Token
+	if n := len(tokens); n > 0 && tokens[n-1].Type == lexer.COMMENT {
+		comment = tokens[n-1:]
+		tokens = tokens[:n-1]
+	}
+	if len(tokens) > 0 {
+		statement, err := translateStatement(tokens)
+		if err != nil {
+			return nil, err
+		}
+		translated = append(translated, statement...)
+	}
+	return append(translated, comment...), nil
+}
+
+// statement is a Z80 instruction and its operands.
+type statement struct {
+	line     int
+	mnemonic string
+	operands []operand
+}
+
+func (s statement) String() string {
+	operands := []string{}
+	for _, o := range s.operands {
+		operands = append(operands, o.String())
+	}
+	return strings.TrimSpace(s.mnemonic + " " + strings.Join(operands, ", "))
+}
+
+// operand is a register, condition, number or label, or one of those in
+// parentheses.
+type operand struct {
+	token    lexer.Token
+	indirect bool
+}
+
+func (o operand) String() string {
+	if o.indirect {
+		return "(" + o.token.Literal + ")"
+	}
+	return o.token.Literal
+}
+
+var registers8 = map[string]bool{"A": true, "B": true, "C": true, "D": true, "E": true, "H": true, "L": true}
+
+// registers16 are the Z80 register pairs, and the 8080 names for them.
+var registers16 = map[string]string{"BC": "B", "DE": "D", "HL": "H", "SP": "SP", "AF": "PSW"}
+
+var conditions = map[string]bool{"NZ": true, "Z": true, "NC": true, "C": true, "PO": true, "PE": true, "P": true, "M": true}
+
+// z80Registers are the registers the 8080 doesn't have.
+var z80Registers = map[string]bool{"IX": true, "IY": true, "IXH": true, "IXL": true, "IYH": true, "IYL": true, "I": true, "R": true}
+
+// z80Instructions are the instructions the 8080 doesn't have.
+var z80Instructions = map[string]bool{
+	"DJNZ": true, "JR": true, "EXX": true, "NEG": true, "IM": true, "RETI": true, "RETN": true,
+	"LDI": true, "LDIR": true, "LDD": true, "LDDR": true, "CPI": true, "CPIR": true, "CPD": true, "CPDR": true,
+	"INI": true, "INIR": true, "IND": true, "INDR": true, "OUTI": true, "OTIR": true, "OUTD": true, "OTDR": true,
+	"RLC": true, "RRC": true, "RL": true, "RR": true, "SLA": true, "SRA": true, "SRL": true, "SLL": true,
+	"RLD": true, "RRD": true, "BIT": true, "SET": true, "RES": true,
+}
+
+// reg8 returns the 8080 name of an 8-bit register operand, with (HL) as M.
+func (o operand) reg8() (string, bool) {
+	if o.indirect {
+		return "M", o.token.Literal == "HL"
+	}
+	return o.token.Literal, registers8[o.token.Literal]
+}
+
+// is reports whether the operand is the register pair or condition name.
+func (o operand) is(name string) bool {
+	return !o.indirect && o.token.Literal == name
+}
+
+// value reports whether the operand is a number or label.
+func (o operand) value() bool {
+	return !o.indirect && o.numberOrLabel()
+}
+
+// address reports whether the operand is a number or label in parentheses,
+// which is the memory at that address.
+func (o operand) address() bool {
+	return o.indirect && o.numberOrLabel()
+}
+
+func (o operand) numberOrLabel() bool {
+	if o.token.Type != lexer.NUMBER && o.token.Type != lexer.LABEL {
+		return false
+	}
+	_, pair := registers16[o.token.Literal]
+	return !pair && !registers8[o.token.Literal]
+}
+
+var errNoEquivalent = errors.New("no 8080 equivalent")
+
+type translateFunc func(s statement) ([]lexer.Token, error)
+
+var instructions = map[string]translateFunc{
+	"LD":   translateLD,
+	"EX":   translateEX,
+	"PUSH": translateStack("PUSH"),
+	"POP":  translateStack("POP"),
+	"ADD":  translateADD,
+	"ADC":  translateArithmetic("ADC", "ACI"),
+	"SUB":  translateArithmetic("SUB", "SUI"),
+	"SBC":  translateArithmetic("SBB", "SBI"),
+	"AND":  translateArithmetic("ANA", "ANI"),
+	"XOR":  translateArithmetic("XRA", "XRI"),
+	"OR":   translateArithmetic("ORA", "ORI"),
+	"CP":   translateArithmetic("CMP", "CPI"),
+	"INC":  translateIncrement("INR", "INX"),
+	"DEC":  translateIncrement("DCR", "DCX"),
+	"JP":   translateJump("JMP", "J"),
+	"CALL": translateJump("CALL", "C"),
+	"RET":  translateRET,
+	"RST":  translateRST,
+	"IN":   translateIN,
+	"OUT":  translateOUT,
+	"NOP":  translateImplied("NOP"),
+	"HALT": translateImplied("HLT"),
+	"DI":   translateImplied("DI"),
+	"EI":   translateImplied("EI"),
+	"DAA":  translateImplied("DAA"),
+	"CPL":  translateImplied("CMA"),
+	"SCF":  translateImplied("STC"),
+	"CCF":  translateImplied("CMC"),
+	"RLCA": translateImplied("RLC"),
+	"RRCA": translateImplied("RRC"),
+	"RLA":  translateImplied("RAL"),
+	"RRA":  translateImplied("RAR"),
+}
+
+// translateStatement translates one instruction. Directives and
+// user-defined opcodes are passed through unchanged.
+func translateStatement(tokens []lexer.Token) ([]lexer.Token, error) {
+	mnemonic := tokens[0].Literal
+	if isa.IsDirective(mnemonic) || (tokens[0].Type == lexer.MNEMONIC && !lexer.IsMnemonic(mnemonic)) {
+		return tokens, nil
+	}
+	if z80Instructions[mnemonic] {
+		return nil, fmt.Errorf("%s is a Z80 instruction, which the 8080 doesn't have", mnemonic)
+	}
+	translate, found := instructions[mnemonic]
+	if !found {
+		return nil, fmt.Errorf("unknown instruction: %s", mnemonic)
+	}
+
+	operands, err := splitOperands(tokens[1:])
+	if err != nil {
+		return nil, err
+	}
+	s := statement{line: tokens[0].Line, mnemonic: mnemonic, operands: operands}
+	translated, err := translate(s)
+	if errors.Is(err, errNoEquivalent) {
+		return nil, fmt.Errorf("%s has no 8080 equivalent", s)
+	}
+	return translated, err
+}
+
+// splitOperands parses the comma separated operands of an instruction.
+func splitOperands(tokens []lexer.Token) ([]operand, error) {
+	operands := []operand{}
+	for len(tokens) > 0 {
+		end := 0
+		for end < len(tokens) && tokens[end].Type != lexer.COMMA {
+			end++
+		}
+		o, err := parseOperand(tokens[:end])
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, o)
+		if end == len(tokens) {
+			break
+		}
+		tokens = tokens[end+1:]
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("expected operand after comma")
+		}
+	}
+	return operands, nil
+}
+
+func parseOperand(tokens []lexer.Token) (operand, error) {
+	for i, token := range tokens {
+		if z80Registers[token.Literal] {
+			return operand{}, fmt.Errorf("%s is a Z80 register, which the 8080 doesn't have", token.Literal)
+		}
+		// The lexer reads the quote in AF' as the start of a string
+		if token.Literal == "AF" && i+1 < len(tokens) && tokens[i+1].Type == lexer.STRING {
+			return operand{}, fmt.Errorf("AF' is a Z80 register, which the 8080 doesn't have")
+		}
+	}
+
+	switch {
+	case len(tokens) == 1:
+		return operand{token: tokens[0]}, nil
+	case len(tokens) == 3 && tokens[0].Type == lexer.LPAREN && tokens[2].Type == lexer.RPAREN:
+		return operand{token: tokens[1], indirect: true}, nil
+	}
+	literals := []string{}
+	for _, token := range tokens {
+		literals = append(literals, token.Literal)
+	}
+	return operand{}, fmt.Errorf("invalid operand: %s", strings.Join(literals, ""))
+}
+
+// instruction returns the tokens of an 8080 instruction.
+func instruction(line int, mnemonic string, operands ...lexer.Token) []lexer.Token {
+	tokens := []lexer.Token{{Type: lexer.MNEMONIC, Literal: mnemonic, Line: line}}
+	for i, o := range operands {
+		if i > 0 {
+			tokens = append(tokens, lexer.Token{Type: lexer.COMMA, Literal: ",", Line: line})
+		}
+		o.Line = line
+		tokens = append(tokens, o)
+	}
+	return tokens
+}
+
+func register(name string) lexer.Token {
+	return lexer.Token{Type: lexer.REGISTER, Literal: name}
+}
+
+func translateLD(s statement) ([]lexer.Token, error) {
+	if len(s.operands) != 2 {
+		return nil, fmt.Errorf("LD expects 2 operands, got %d", len(s.operands))
+	}
+	dst, src := s.operands[0], s.operands[1]
+	dstReg, dstIsReg := dst.reg8()
+	srcReg, srcIsReg := src.reg8()
+	pair, dstIsPair := registers16[dst.token.Literal]
+	dstIsPair = dstIsPair && !dst.indirect && dst.token.Literal != "AF"
+
+	switch {
+	case dstIsReg && srcIsReg && !(dst.indirect && src.indirect):
+		return instruction(s.line, "MOV", register(dstReg), register(srcReg)), nil
+	case dstIsReg && src.value():
+		return instruction(s.line, "MVI", register(dstReg), src.token), nil
+	case dst.is("A") && src.indirect && (src.token.Literal == "BC" || src.token.Literal == "DE"):
+		return instruction(s.line, "LDAX", register(registers16[src.token.Literal])), nil
+	case src.is("A") && dst.indirect && (dst.token.Literal == "BC" || dst.token.Literal == "DE"):
+		return instruction(s.line, "STAX", register(registers16[dst.token.Literal])), nil
+	case dst.is("A") && src.address():
+		return instruction(s.line, "LDA", src.token), nil
+	case src.is("A") && dst.address():
+		return instruction(s.line, "STA", dst.token), nil
+	case dst.is("HL") && src.address():
+		return instruction(s.line, "LHLD", src.token), nil
+	case src.is("HL") && dst.address():
+		return instruction(s.line, "SHLD", dst.token), nil
+	case dst.is("SP") && src.is("HL"):
+		return instruction(s.line, "SPHL"), nil
+	case dstIsPair && src.value():
+		return instruction(s.line, "LXI", register(pair), src.token), nil
+	}
+	return nil, errNoEquivalent
+}
+
+func translateEX(s statement) ([]lexer.Token, error) {
+	if len(s.operands) == 2 {
+		dst, src := s.operands[0], s.operands[1]
+		switch {
+		case dst.is("DE") && src.is("HL"):
+			return instruction(s.line, "XCHG"), nil
+		case dst.indirect && dst.token.Literal == "SP" && src.is("HL"):
+			return instruction(s.line, "XTHL"), nil
+		}
+	}
+	return nil, errNoEquivalent
+}
+
+func translateStack(mnemonic string) translateFunc {
+	return func(s statement) ([]lexer.Token, error) {
+		if len(s.operands) == 1 && !s.operands[0].indirect {
+			if pair, found := registers16[s.operands[0].token.Literal]; found && pair != "SP" {
+				return instruction(s.line, mnemonic, register(pair)), nil
+			}
+		}
+		return nil, errNoEquivalent
+	}
+}
+
+func translateADD(s statement) ([]lexer.Token, error) {
+	if len(s.operands) == 2 && s.operands[0].is("HL") && !s.operands[1].indirect {
+		if pair, found := registers16[s.operands[1].token.Literal]; found && pair != "PSW" {
+			return instruction(s.line, "DAD", register(pair)), nil
+		}
+		return nil, errNoEquivalent
+	}
+	return translateArithmetic("ADD", "ADI")(s)
+}
+
+// translateArithmetic translates an operation on the accumulator, which
+// can be written with or without A as the first operand.
+func translateArithmetic(registerForm string, immediateForm string) translateFunc {
+	return func(s statement) ([]lexer.Token, error) {
+		operands := s.operands
+		if len(operands) == 2 && operands[0].is("A") {
+			operands = operands[1:]
+		}
+		if len(operands) != 1 {
+			return nil, errNoEquivalent
+		}
+		if reg, found := operands[0].reg8(); found {
+			return instruction(s.line, registerForm, register(reg)), nil
+		}
+		if operands[0].value() {
+			return instruction(s.line, immediateForm, operands[0].token), nil
+		}
+		return nil, errNoEquivalent
+	}
+}
+
+func translateIncrement(register8Form string, register16Form string) translateFunc {
+	return func(s statement) ([]lexer.Token, error) {
+		if len(s.operands) != 1 {
+			return nil, errNoEquivalent
+		}
+		o := s.operands[0]
+		if reg, found := o.reg8(); found {
+			return instruction(s.line, register8Form, register(reg)), nil
+		}
+		if pair, found := registers16[o.token.Literal]; found && !o.indirect && pair != "PSW" {
+			return instruction(s.line, register16Form, register(pair)), nil
+		}
+		return nil, errNoEquivalent
+	}
+}
+
+// translateJump translates JP and CALL, and their conditional forms, which
+// the 8080 writes as the prefix followed by the condition.
+func translateJump(unconditional string, prefix string) translateFunc {
+	return func(s statement) ([]lexer.Token, error) {
+		switch {
+		case len(s.operands) == 1 && s.operands[0].value():
+			return instruction(s.line, unconditional, s.operands[0].token), nil
+		case len(s.operands) == 1 && s.mnemonic == "JP" && s.operands[0].indirect && s.operands[0].token.Literal == "HL":
+			return instruction(s.line, "PCHL"), nil
+		case len(s.operands) == 2 && isCondition(s.operands[0]) && s.operands[1].value():
+			return instruction(s.line, prefix+s.operands[0].token.Literal, s.operands[1].token), nil
+		}
+		return nil, errNoEquivalent
+	}
+}
+
+func isCondition(o operand) bool {
+	return !o.indirect && conditions[o.token.Literal]
+}
+
+func translateRET(s statement) ([]lexer.Token, error) {
+	switch {
+	case len(s.operands) == 0:
+		return instruction(s.line, "RET"), nil
+	case len(s.operands) == 1 && isCondition(s.operands[0]):
+		return instruction(s.line, "R"+s.operands[0].token.Literal), nil
+	}
+	return nil, errNoEquivalent
+}
+
+// translateRST translates a restart, which the Z80 writes as the address
+// it calls and the 8080 as its number.
+func translateRST(s statement) ([]lexer.Token, error) {
+	if len(s.operands) != 1 || s.operands[0].indirect || s.operands[0].token.Type != lexer.NUMBER {
+		return nil, errNoEquivalent
+	}
+	literal := s.operands[0].token.Literal
+	address, err := isa.ParseNumber(literal)
+	if err != nil || address > 0x38 || address%8 != 0 {
+		return nil, fmt.Errorf("expected restart address 00H, 08H, ... 38H, got: %s", literal)
+	}
+	return instruction(s.line, "RST", lexer.Token{Type: lexer.NUMBER, Literal: strconv.Itoa(int(address / 8))}), nil
+}
+
+func translateIN(s statement) ([]lexer.Token, error) {
+	if len(s.operands) == 2 && s.operands[0].is("A") && s.operands[1].indirect && s.operands[1].token.Type == lexer.NUMBER {
+		return instruction(s.line, "IN", s.operands[1].token), nil
+	}
+	return nil, errNoEquivalent
+}
+
+func translateOUT(s statement) ([]lexer.Token, error) {
+	if len(s.operands) == 2 && s.operands[0].indirect && s.operands[0].token.Type == lexer.NUMBER && s.operands[1].is("A") {
+		return instruction(s.line, "OUT", s.operands[0].token), nil
+	}
+	return nil, errNoEquivalent
+}
+
+func translateImplied(mnemonic string) translateFunc {
+	return func(s statement) ([]lexer.Token, error) {
+		if len(s.operands) != 0 {
+			return nil, errNoEquivalent
+		}
+		return instruction(s.line, mnemonic), nil
+	}
+}
@@ -0,0 +1,104 @@
+package z80
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lukepeterson/go8080assembler/pkg/lexer"
+	"github.com/lukepeterson/go8080assembler/pkg/parser"
+)
+
+func assemble(t *testing.T, source string, z80 bool) ([]byte, error) {
+	t.Helper()
+	tokens, err := lexer.New(source).Lex()
+	if err != nil {
+		t.Fatalf("Lexer.Lex() error = %v", err)
+	}
+	if z80 {
+		if tokens, err = Translate(tokens); err != nil {
+			return nil, err
+		}
+	}
+	return parser.New(tokens).Parse()
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		z80   string
+		intel string
+	}{
+		{"LD B, C", "MOV B, C"},
+		{"LD A, (HL)", "MOV A, M"},
+		{"LD (HL), E", "MOV M, E"},
+		{"LD D, 12H", "MVI D, 12H"},
+		{"LD (HL), 0", "MVI M, 0"},
+		{"LD BC, 1234H", "LXI B, 1234H"},
+		{"LD SP, 0", "LXI SP, 0"},
+		{"LD HL, LOOP\nLOOP: NOP", "LXI H, LOOP\nLOOP: NOP"},
+		{"LD A, (BC)", "LDAX B"},
+		{"LD (DE), A", "STAX D"},
+		{"LD A, (1234H)", "LDA 1234H"},
+		{"LD (1234H), A", "STA 1234H"},
+		{"LD HL, (2000H)", "LHLD 2000H"},
+		{"LD (2000H), HL", "SHLD 2000H"},
+		{"LD SP, HL", "SPHL"},
+		{"EX DE, HL", "XCHG"},
+		{"EX (SP), HL", "XTHL"},
+		{"PUSH AF\nPOP BC", "PUSH PSW\nPOP B"},
+		{"ADD HL, DE\nADD HL, SP", "DAD D\nDAD SP"},
+		{"ADD A, B\nADD C\nADD A, 5", "ADD B\nADD C\nADI 5"},
+		{"ADC A, (HL)\nADC 1", "ADC M\nACI 1"},
+		{"SUB D\nSUB 3\nSBC A, E\nSBC A, 4", "SUB D\nSUI 3\nSBB E\nSBI 4"},
+		{"AND H\nAND 0FH\nXOR A\nXOR 80H\nOR L\nOR 1", "ANA H\nANI 0FH\nXRA A\nXRI 80H\nORA L\nORI 1"},
+		{"CP B\nCP 20H", "CMP B\nCPI 20H"},
+		{"INC A\nDEC (HL)\nINC BC\nDEC SP", "INR A\nDCR M\nINX B\nDCX SP"},
+		{"JP 0\nJP NZ, 0\nJP C, 0\nJP P, 0\nJP M, 0\nJP (HL)", "JMP 0\nJNZ 0\nJC 0\nJP 0\nJM 0\nPCHL"},
+		{"CALL 10H\nCALL Z, 10H\nCALL PO, 10H", "CALL 10H\nCZ 10H\nCPO 10H"},
+		{"RET\nRET NC\nRET PE", "RET\nRNC\nRPE"},
+		{"RST 0\nRST 38H", "RST 0\nRST 7"},
+		{"IN A, (10H)\nOUT (11H), A", "IN 10H\nOUT 11H"},
+		{"NOP\nHALT\nDI\nEI\nDAA", "NOP\nHLT\nDI\nEI\nDAA"},
+		{"CPL\nSCF\nCCF\nRLCA\nRRCA\nRLA\nRRA", "CMA\nSTC\nCMC\nRLC\nRRC\nRAL\nRAR"},
+		{"START: LD A, 1 ; comment\nDB 1, 2", "START: MVI A, 1 ; comment\nDB 1, 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.z80, func(t *testing.T) {
+			got, err := assemble(t, tt.z80, true)
+			if err != nil {
+				t.Fatalf("Translate() error = %v", err)
+			}
+			want, err := assemble(t, tt.intel, false)
+			if err != nil {
+				t.Fatalf("Parser.Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Translate() assembles to %X, want %X", got, want)
+			}
+		})
+	}
+}
+
+func TestTranslate_Errors(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr string
+	}{
+		{"LOOP: DJNZ LOOP", "line 1: DJNZ is a Z80 instruction, which the 8080 doesn't have"},
+		{"NOP\nLD A, (IX+5)", "line 2: IX is a Z80 register, which the 8080 doesn't have"},
+		{"LD A, I", "line 1: I is a Z80 register, which the 8080 doesn't have"},
+		{"EX AF, AF'", "line 1: AF' is a Z80 register, which the 8080 doesn't have"},
+		{"SBC HL, DE", "line 1: SBC HL, DE has no 8080 equivalent"},
+		{"LD (HL), (HL)", "line 1: LD (HL), (HL) has no 8080 equivalent"},
+		{"IN A, (C)", "line 1: IN A, (C) has no 8080 equivalent"},
+		{"RST 1", "line 1: expected restart address 00H, 08H, ... 38H, got: 1"},
+		{"MOV A, B", "line 1: unknown instruction: MOV"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := assemble(t, tt.source, true)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Translate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}